@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/holds"
+)
+
+// AccountHoldHandler lets admins freeze wallets and suspend users, and see
+// the audit trail of those changes
+type AccountHoldHandler struct {
+	holds *holds.Service
+}
+
+// NewAccountHoldHandler creates a new AccountHoldHandler instance
+func NewAccountHoldHandler(service *holds.Service) *AccountHoldHandler {
+	return &AccountHoldHandler{holds: service}
+}
+
+type placeHoldRequest struct {
+	Actor  string     `json:"actor" binding:"required,max=100"`
+	Reason string     `json:"reason" binding:"required,max=255"`
+	Until  *time.Time `json:"until"`
+}
+
+type liftHoldRequest struct {
+	Actor  string `json:"actor" binding:"required,max=100"`
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// FreezeWallet stops money moving in or out of a wallet, until the given
+// expiry if there is one
+func (h *AccountHoldHandler) FreezeWallet(c *gin.Context) {
+	walletID, ok := holdTargetID(c, "Invalid wallet ID")
+	if !ok {
+		return
+	}
+	var req placeHoldRequest
+	if !bindHoldRequest(c, &req) {
+		return
+	}
+
+	wallet, err := h.holds.FreezeWallet(walletID, holds.Hold{Actor: req.Actor, Reason: req.Reason, Until: req.Until})
+	if err != nil {
+		respondHoldError(c, "[FREEZE-WALLET]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// UnfreezeWallet lifts a wallet's freeze
+func (h *AccountHoldHandler) UnfreezeWallet(c *gin.Context) {
+	walletID, ok := holdTargetID(c, "Invalid wallet ID")
+	if !ok {
+		return
+	}
+	var req liftHoldRequest
+	if !bindHoldRequest(c, &req) {
+		return
+	}
+
+	wallet, err := h.holds.UnfreezeWallet(walletID, req.Actor, req.Reason)
+	if err != nil {
+		respondHoldError(c, "[UNFREEZE-WALLET]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// SuspendUser bars a user from the app
+func (h *AccountHoldHandler) SuspendUser(c *gin.Context) {
+	userID, ok := holdTargetID(c, "Invalid user ID")
+	if !ok {
+		return
+	}
+	var req placeHoldRequest
+	if !bindHoldRequest(c, &req) {
+		return
+	}
+
+	user, err := h.holds.Suspend(userID, holds.Hold{Actor: req.Actor, Reason: req.Reason, Until: req.Until})
+	if err != nil {
+		respondHoldError(c, "[SUSPEND-USER]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// ReinstateUser lifts a user's suspension
+func (h *AccountHoldHandler) ReinstateUser(c *gin.Context) {
+	userID, ok := holdTargetID(c, "Invalid user ID")
+	if !ok {
+		return
+	}
+	var req liftHoldRequest
+	if !bindHoldRequest(c, &req) {
+		return
+	}
+
+	user, err := h.holds.Reinstate(userID, req.Actor, req.Reason)
+	if err != nil {
+		respondHoldError(c, "[REINSTATE-USER]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// GetAccountStatusHistory returns the audit trail of a user's freezes and
+// suspensions, newest first
+func (h *AccountHoldHandler) GetAccountStatusHistory(c *gin.Context) {
+	userID, ok := holdTargetID(c, "Invalid user ID")
+	if !ok {
+		return
+	}
+
+	changes, err := h.holds.History(userID)
+	if err != nil {
+		log.Printf("[GET-ACCOUNT-STATUS-HISTORY] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch account status history",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": changes})
+}
+
+// holdTargetID parses the :id parameter
+func holdTargetID(c *gin.Context, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": message,
+		}})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func bindHoldRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return false
+	}
+	return true
+}
+
+// respondHoldError maps hold service errors to responses
+func respondHoldError(c *gin.Context, tag string, err error) {
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				validationErr.Field: {validationErr.Message},
+			},
+		}})
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	message := "Failed to update account status"
+	switch {
+	case errors.Is(err, holds.ErrWalletNotFound), errors.Is(err, holds.ErrUserNotFound):
+		status, code, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	case errors.Is(err, holds.ErrWalletClosed):
+		status, code, message = http.StatusConflict, "WALLET_CLOSED", err.Error()
+	case errors.Is(err, holds.ErrAlreadyFrozen):
+		status, code, message = http.StatusConflict, "WALLET_FROZEN", err.Error()
+	case errors.Is(err, holds.ErrNotFrozen):
+		status, code, message = http.StatusConflict, "WALLET_NOT_FROZEN", err.Error()
+	case errors.Is(err, holds.ErrAlreadySuspended):
+		status, code, message = http.StatusConflict, "ACCOUNT_SUSPENDED", err.Error()
+	case errors.Is(err, holds.ErrNotSuspended):
+		status, code, message = http.StatusConflict, "ACCOUNT_NOT_SUSPENDED", err.Error()
+	default:
+		log.Printf("%s Account status change failed: %v", tag, err)
+	}
+
+	c.JSON(status, gin.H{"error": gin.H{
+		"code":    code,
+		"message": message,
+	}})
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/moha/kaafipay-backend/internal/api/middleware"
 	"github.com/moha/kaafipay-backend/internal/config"
 	"github.com/moha/kaafipay-backend/internal/models"
 	"github.com/moha/kaafipay-backend/internal/repository"
@@ -125,6 +126,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if user.Suspended(time.Now()) {
+		middleware.RespondAccountSuspended(c, user)
+		return
+	}
 
 	// Generate tokens
 	expiration, _ := time.ParseDuration(h.cfg.JWTExpiration)
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/services/splits"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// BillSplitHandler splits bills between friends and settles up the shares
+type BillSplitHandler struct {
+	splits *splits.Service
+	limits *limits.Policy
+}
+
+// NewBillSplitHandler creates a new BillSplitHandler instance
+func NewBillSplitHandler(service *splits.Service, policy *limits.Policy) *BillSplitHandler {
+	return &BillSplitHandler{splits: service, limits: policy}
+}
+
+type billSplitParticipantRequest struct {
+	Phone      string  `json:"phone" binding:"required,min=9,max=15"`
+	Name       string  `json:"name" binding:"max=100"`
+	Percentage float64 `json:"percentage" binding:"gte=0,lte=100"`
+	Amount     float64 `json:"amount" binding:"gte=0"`
+}
+
+type createBillSplitRequest struct {
+	TransactionID *uuid.UUID                    `json:"transactionId"`
+	Amount        float64                       `json:"amount" binding:"required_without=TransactionID,omitempty,gt=0"`
+	Currency      string                        `json:"currency" binding:"omitempty,len=3"`
+	Description   string                        `json:"description" binding:"max=255"`
+	Method        string                        `json:"method" binding:"required,oneof=equal percentage exact"`
+	IncludeSelf   *bool                         `json:"includeSelf"`
+	Participants  []billSplitParticipantRequest `json:"participants" binding:"required,min=1,dive"`
+}
+
+// CreateBillSplit splits a transaction or an amount with other people and
+// tells each of them their share over WhatsApp. In an equal split the user
+// takes a share too unless includeSelf is false.
+func (h *BillSplitHandler) CreateBillSplit(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req createBillSplitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	input := splits.CreateInput{
+		TransactionID:  req.TransactionID,
+		Amount:         req.Amount,
+		Currency:       req.Currency,
+		Description:    req.Description,
+		Method:         req.Method,
+		IncludeCreator: req.IncludeSelf == nil || *req.IncludeSelf,
+	}
+	for _, p := range req.Participants {
+		input.Participants = append(input.Participants, splits.Participant{
+			Phone:      p.Phone,
+			Name:       p.Name,
+			Percentage: p.Percentage,
+			Amount:     p.Amount,
+		})
+	}
+
+	split, err := h.splits.Create(userID, input)
+	if err != nil {
+		respondBillSplitError(c, "[CREATE-BILL-SPLIT]", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": split})
+}
+
+// GetBillSplits returns the splits the user created, or those they owe a
+// share of with ?role=owed, optionally filtered by ?status
+func (h *BillSplitHandler) GetBillSplits(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	owed := false
+	switch c.Query("role") {
+	case "", "created":
+	case "owed":
+		owed = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "role must be created or owed",
+		}})
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.BillSplitOpen, models.BillSplitSettled, models.BillSplitCancelled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "status must be open, settled or cancelled",
+		}})
+		return
+	}
+
+	list, err := h.splits.List(userID, owed, status)
+	if err != nil {
+		log.Printf("[GET-BILL-SPLITS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch bill splits",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// GetBillSplitBalances returns who owes the user and whom the user owes
+// across their open splits
+func (h *BillSplitHandler) GetBillSplitBalances(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	balances, err := h.splits.Balances(userID)
+	if err != nil {
+		log.Printf("[GET-BILL-SPLIT-BALANCES] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch balances",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": balances})
+}
+
+// GetBillSplit returns a split the user created or has a share in
+func (h *BillSplitHandler) GetBillSplit(c *gin.Context) {
+	h.act(c, "[GET-BILL-SPLIT]", h.splits.Get)
+}
+
+// CancelBillSplit withdraws one of the user's open splits
+func (h *BillSplitHandler) CancelBillSplit(c *gin.Context) {
+	h.act(c, "[CANCEL-BILL-SPLIT]", h.splits.Cancel)
+}
+
+// RemindBillSplit reminds everyone who still owes a share
+func (h *BillSplitHandler) RemindBillSplit(c *gin.Context) {
+	h.act(c, "[REMIND-BILL-SPLIT]", h.splits.Remind)
+}
+
+// PayBillSplitShare starts paying the user's share from their wallet. The
+// returned transfer is confirmed like any other.
+func (h *BillSplitHandler) PayBillSplitShare(c *gin.Context) {
+	userID, splitID, shareID, ok := billSplitShareParams(c)
+	if !ok {
+		return
+	}
+	split, err := h.splits.Get(userID, splitID)
+	if err != nil {
+		respondBillSplitError(c, "[PAY-BILL-SPLIT-SHARE]", err)
+		return
+	}
+	for _, share := range split.Shares {
+		if share.ID == shareID &&
+			!checkTransferLimit(c, h.limits, "[PAY-BILL-SPLIT-SHARE]", userID, share.Amount, split.Currency) {
+			return
+		}
+	}
+
+	share, transfer, err := h.splits.Pay(userID, splitID, shareID)
+	if err != nil {
+		// Starting the payment fails with the transfer service's errors
+		if _, _, ok := billSplitErrorStatus(err); !ok {
+			respondTransferError(c, "[PAY-BILL-SPLIT-SHARE]", err)
+			return
+		}
+		respondBillSplitError(c, "[PAY-BILL-SPLIT-SHARE]", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": gin.H{
+		"share":    share,
+		"transfer": transfer,
+	}})
+}
+
+// MarkBillSplitSharePaid records that the user received a share outside
+// the app
+func (h *BillSplitHandler) MarkBillSplitSharePaid(c *gin.Context) {
+	userID, splitID, shareID, ok := billSplitShareParams(c)
+	if !ok {
+		return
+	}
+
+	share, err := h.splits.MarkPaid(userID, splitID, shareID)
+	if err != nil {
+		respondBillSplitError(c, "[MARK-BILL-SPLIT-SHARE-PAID]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": share})
+}
+
+// act applies a service method to the :id split and returns the result
+func (h *BillSplitHandler) act(c *gin.Context, tag string,
+	fn func(userID, splitID uuid.UUID) (*models.BillSplit, error)) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+	splitID, ok := billSplitID(c)
+	if !ok {
+		return
+	}
+
+	split, err := fn(userID, splitID)
+	if err != nil {
+		respondBillSplitError(c, tag, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": split})
+}
+
+// billSplitID parses the :id parameter
+func billSplitID(c *gin.Context) (uuid.UUID, bool) {
+	splitID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid bill split ID",
+		}})
+		return uuid.Nil, false
+	}
+	return splitID, true
+}
+
+// billSplitShareParams resolves the user, the :id split and the :shareId
+// share
+func billSplitShareParams(c *gin.Context) (uuid.UUID, uuid.UUID, uuid.UUID, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	splitID, ok := billSplitID(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	shareID, err := uuid.Parse(c.Param("shareId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid share ID",
+		}})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	return userID, splitID, shareID, true
+}
+
+// respondBillSplitError maps bill split service errors to responses
+func respondBillSplitError(c *gin.Context, tag string, err error) {
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				validationErr.Field: {validationErr.Message},
+			},
+		}})
+		return
+	}
+
+	status, code, ok := billSplitErrorStatus(err)
+	if !ok {
+		log.Printf("%s Bill split failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to process bill split",
+		}})
+		return
+	}
+
+	c.JSON(status, gin.H{"error": gin.H{
+		"code":    code,
+		"message": err.Error(),
+	}})
+}
+
+// billSplitErrorStatus returns the status and code for a bill split service
+// error, and false for any other error
+func billSplitErrorStatus(err error) (int, string, bool) {
+	var validationErr models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest, "VALIDATION_ERROR", true
+	case errors.Is(err, splits.ErrSplitNotFound), errors.Is(err, splits.ErrShareNotFound),
+		errors.Is(err, splits.ErrTransactionNotFound):
+		return http.StatusNotFound, "NOT_FOUND", true
+	case errors.Is(err, splits.ErrAlreadySplit):
+		return http.StatusConflict, "ALREADY_SPLIT", true
+	case errors.Is(err, splits.ErrNotOpen):
+		return http.StatusConflict, "SPLIT_NOT_OPEN", true
+	case errors.Is(err, splits.ErrNotOwed):
+		return http.StatusConflict, "SHARE_NOT_OWED", true
+	case errors.Is(err, splits.ErrNotYourShare):
+		return http.StatusForbidden, "FORBIDDEN", true
+	case errors.Is(err, splits.ErrRemindTooSoon):
+		return http.StatusTooManyRequests, "REMIND_TOO_SOON", true
+	}
+	return 0, "", false
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// BudgetAlertHandler serves alert history and the devices alerts are pushed to
+type BudgetAlertHandler struct {
+	db *gorm.DB
+}
+
+// NewBudgetAlertHandler creates a new BudgetAlertHandler instance
+func NewBudgetAlertHandler(db *gorm.DB) *BudgetAlertHandler {
+	return &BudgetAlertHandler{db: db}
+}
+
+type registerPushDeviceRequest struct {
+	Token    string `json:"token" binding:"required,max=255"`
+	Platform string `json:"platform" binding:"required"`
+}
+
+// GetBudgetAlerts returns the user's alerts, newest first, optionally for a
+// single category with ?categoryId=
+func (h *BudgetAlertHandler) GetBudgetAlerts(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	query := h.db.Where("user_id = ?", userID)
+	if v := c.Query("categoryId"); v != "" {
+		categoryID, err := uuid.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid category ID",
+			}})
+			return
+		}
+		query = query.Where("budget_category_id = ?", categoryID)
+	}
+
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "limit must be between 1 and 100",
+			}})
+			return
+		}
+	}
+
+	alerts := []models.BudgetAlert{}
+	if err := query.Order("created_at DESC").Limit(limit).Find(&alerts).Error; err != nil {
+		log.Printf("[GET-BUDGET-ALERTS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch budget alerts",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": alerts})
+}
+
+// RegisterPushDevice registers a device token for push alerts. A token that
+// was registered by another user moves to the current one.
+func (h *BudgetAlertHandler) RegisterPushDevice(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req registerPushDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+	platform := strings.ToLower(req.Platform)
+	if platform != models.PushPlatformIOS && platform != models.PushPlatformAndroid && platform != models.PushPlatformWeb {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "platform must be ios, android or web",
+		}})
+		return
+	}
+
+	device := models.PushDevice{
+		UserID:   userID,
+		Token:    strings.TrimSpace(req.Token),
+		Platform: platform,
+	}
+	if err := h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "updated_at"}),
+	}).Create(&device).Error; err != nil {
+		log.Printf("[REGISTER-PUSH-DEVICE] Failed for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to register device",
+		}})
+		return
+	}
+	if err := h.db.Where("token = ?", device.Token).First(&device).Error; err != nil {
+		log.Printf("[REGISTER-PUSH-DEVICE] Failed to reload device: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": device})
+}
+
+// DeletePushDevice stops push alerts to a device
+func (h *BudgetAlertHandler) DeletePushDevice(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	deviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid device ID",
+		}})
+		return
+	}
+
+	result := h.db.Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.PushDevice{})
+	if result.Error != nil {
+		log.Printf("[DELETE-PUSH-DEVICE] Database error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to delete device",
+		}})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Device not found",
+		}})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
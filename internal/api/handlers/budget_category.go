@@ -4,12 +4,18 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/budgets"
+	"github.com/moha/kaafipay-backend/internal/services/rules"
 	"github.com/moha/kaafipay-backend/internal/utils"
 )
 
@@ -19,15 +25,34 @@ var (
 
 // BudgetCategoryHandler handles operations on budget categories
 type BudgetCategoryHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	repo       repository.TransactionRepository
+	backfiller *rules.Backfiller
+	summarizer *budgets.Summarizer
 }
 
 // NewBudgetCategoryHandler creates a new BudgetCategoryHandler instance
-func NewBudgetCategoryHandler(db *gorm.DB) *BudgetCategoryHandler {
-	return &BudgetCategoryHandler{db: db}
+func NewBudgetCategoryHandler(db *gorm.DB, repo repository.TransactionRepository, backfiller *rules.Backfiller, summarizer *budgets.Summarizer) *BudgetCategoryHandler {
+	return &BudgetCategoryHandler{db: db, repo: repo, backfiller: backfiller, summarizer: summarizer}
 }
 
-// GetBudgetCategories returns all budget categories for a user
+type previewRulesRequest struct {
+	Rules []models.BudgetRule `json:"rules" binding:"required"`
+	Days  int                 `json:"days"`
+}
+
+// recategorizationJobResponse adds the computed progress to a job
+type recategorizationJobResponse struct {
+	*models.RecategorizationJob
+	Progress float64 `json:"progress"`
+}
+
+func newRecategorizationJobResponse(job *models.RecategorizationJob) recategorizationJobResponse {
+	return recategorizationJobResponse{RecategorizationJob: job, Progress: job.Progress()}
+}
+
+// GetBudgetCategories returns the user's budget categories and those shared
+// with their budget groups
 func (h *BudgetCategoryHandler) GetBudgetCategories(c *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
@@ -35,7 +60,9 @@ func (h *BudgetCategoryHandler) GetBudgetCategories(c *gin.Context) {
 	}
 
 	var categories []models.BudgetCategory
-	if err := h.db.Where("user_id = ?", userID).Find(&categories).Error; err != nil {
+	if err := h.db.Scopes(models.VisibleBudgetCategories(userID)).
+		Order("priority ASC").Order("created_at ASC").Order("id ASC").
+		Find(&categories).Error; err != nil {
 		log.Printf("[GET-BUDGET-CATEGORIES] Database query failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
 			"code":    "INTERNAL_ERROR",
@@ -47,7 +74,9 @@ func (h *BudgetCategoryHandler) GetBudgetCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": categories})
 }
 
-// CreateBudgetCategory creates a new budget category
+// CreateBudgetCategory creates a new budget category, shared with a budget
+// group when groupId is given. With ?backfill=true the user's history is
+// recategorized in the background.
 func (h *BudgetCategoryHandler) CreateBudgetCategory(c *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
@@ -56,6 +85,14 @@ func (h *BudgetCategoryHandler) CreateBudgetCategory(c *gin.Context) {
 	}
 	log.Printf("[CREATE-BUDGET-CATEGORY] Processing request for user: %s", userID)
 
+	if _, _, err := parseBackfillParams(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
 	var category models.BudgetCategory
 	if err := c.ShouldBindJSON(&category); err != nil {
 		log.Printf("[CREATE-BUDGET-CATEGORY] JSON binding failed: %v", err)
@@ -69,6 +106,13 @@ func (h *BudgetCategoryHandler) CreateBudgetCategory(c *gin.Context) {
 		category.Name, category.Icon, category.Budget, len(category.Rules))
 
 	category.UserID = userID
+	if category.Priority == 0 {
+		category.Priority = models.DefaultBudgetPriority
+	}
+	category.PeriodType = strings.ToLower(category.PeriodType)
+	category.RolloverMode = strings.ToLower(category.RolloverMode)
+	category.AlertChannel = strings.ToLower(category.AlertChannel)
+	category.SetPeriodDefaults()
 
 	if err := category.Validate(); err != nil {
 		if validationErr, ok := err.(models.ValidationError); ok {
@@ -91,6 +135,12 @@ func (h *BudgetCategoryHandler) CreateBudgetCategory(c *gin.Context) {
 		return
 	}
 	log.Printf("[CREATE-BUDGET-CATEGORY] Validation passed for category: %s", category.Name)
+	if !h.checkParentCategory(c, &category) {
+		return
+	}
+	if category.GroupID != nil && !h.checkGroupEditor(c, userID, *category.GroupID) {
+		return
+	}
 
 	if err := h.db.Create(&category).Error; err != nil {
 		log.Printf("[CREATE-BUDGET-CATEGORY] Database creation failed: %v", err)
@@ -103,16 +153,29 @@ func (h *BudgetCategoryHandler) CreateBudgetCategory(c *gin.Context) {
 	log.Printf("[CREATE-BUDGET-CATEGORY] Successfully created category: id=%s, name=%s",
 		category.ID, category.Name)
 
-	c.JSON(http.StatusCreated, gin.H{"data": category})
+	response := gin.H{"data": category}
+	if job := h.startBackfill(c, userID, category.ID); job != nil {
+		response["backfillJob"] = newRecategorizationJobResponse(job)
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
-// UpdateBudgetCategory updates an existing budget category
+// UpdateBudgetCategory updates an existing budget category. With
+// ?backfill=true the user's history is recategorized in the background.
 func (h *BudgetCategoryHandler) UpdateBudgetCategory(c *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
 		return
 	}
 
+	if _, _, err := parseBackfillParams(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
 	categoryID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
@@ -123,7 +186,9 @@ func (h *BudgetCategoryHandler) UpdateBudgetCategory(c *gin.Context) {
 	}
 
 	var existingCategory models.BudgetCategory
-	if err := h.db.Where("id = ? AND user_id = ?", categoryID, userID).First(&existingCategory).Error; err != nil {
+	if err := h.db.Scopes(models.EditableBudgetCategories(userID)).
+		Where("id = ?", categoryID).
+		First(&existingCategory).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
 				"code":    "NOT_FOUND",
@@ -160,6 +225,46 @@ func (h *BudgetCategoryHandler) UpdateBudgetCategory(c *gin.Context) {
 	if len(updateData.Rules) > 0 {
 		existingCategory.Rules = updateData.Rules
 	}
+	if updateData.Priority != 0 {
+		existingCategory.Priority = updateData.Priority
+	}
+	if updateData.ParentCategoryID != nil {
+		existingCategory.ParentCategoryID = updateData.ParentCategoryID
+	}
+	if updateData.PeriodType != "" {
+		existingCategory.PeriodType = strings.ToLower(updateData.PeriodType)
+		// A new period type starts from its default day unless one is given
+		existingCategory.PeriodStartDay = updateData.PeriodStartDay
+	}
+	if updateData.PeriodStartDay != 0 {
+		existingCategory.PeriodStartDay = updateData.PeriodStartDay
+	}
+	if updateData.PeriodAnchor != nil {
+		existingCategory.PeriodAnchor = updateData.PeriodAnchor
+	}
+	if updateData.PeriodLengthDays != 0 {
+		existingCategory.PeriodLengthDays = updateData.PeriodLengthDays
+	}
+	if updateData.RolloverMode != "" {
+		existingCategory.RolloverMode = strings.ToLower(updateData.RolloverMode)
+	}
+	if updateData.RolloverCap != nil {
+		existingCategory.RolloverCap = updateData.RolloverCap
+	}
+	if updateData.AlertThresholds != nil {
+		existingCategory.AlertThresholds = updateData.AlertThresholds
+	}
+	if updateData.AlertTransactionLimit != nil {
+		// A limit of 0 turns the transaction alert off
+		existingCategory.AlertTransactionLimit = updateData.AlertTransactionLimit
+		if *updateData.AlertTransactionLimit == 0 {
+			existingCategory.AlertTransactionLimit = nil
+		}
+	}
+	if updateData.AlertChannel != "" {
+		existingCategory.AlertChannel = strings.ToLower(updateData.AlertChannel)
+	}
+	existingCategory.SetPeriodDefaults()
 
 	if err := existingCategory.Validate(); err != nil {
 		if validationErr, ok := err.(models.ValidationError); ok {
@@ -179,6 +284,10 @@ func (h *BudgetCategoryHandler) UpdateBudgetCategory(c *gin.Context) {
 		return
 	}
 
+	if !h.checkParentCategory(c, &existingCategory) {
+		return
+	}
+
 	if err := h.db.Save(&existingCategory).Error; err != nil {
 		log.Printf("[UPDATE-BUDGET-CATEGORY] Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
@@ -188,7 +297,11 @@ func (h *BudgetCategoryHandler) UpdateBudgetCategory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": existingCategory})
+	response := gin.H{"data": existingCategory}
+	if job := h.startBackfill(c, userID, existingCategory.ID); job != nil {
+		response["backfillJob"] = newRecategorizationJobResponse(job)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // DeleteBudgetCategory deletes a budget category
@@ -207,7 +320,9 @@ func (h *BudgetCategoryHandler) DeleteBudgetCategory(c *gin.Context) {
 		return
 	}
 
-	result := h.db.Where("id = ? AND user_id = ?", categoryID, userID).Delete(&models.BudgetCategory{})
+	result := h.db.Scopes(models.EditableBudgetCategories(userID)).
+		Where("id = ?", categoryID).
+		Delete(&models.BudgetCategory{})
 	if result.Error != nil {
 		log.Printf("[DELETE-BUDGET-CATEGORY] Database error: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
@@ -227,3 +342,340 @@ func (h *BudgetCategoryHandler) DeleteBudgetCategory(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// GetBudgetSummary returns spending progress for each budget category over
+// the current period, or the previous one with ?period=previous
+func (h *BudgetCategoryHandler) GetBudgetSummary(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	period := c.DefaultQuery("period", "current")
+	periodsBack := 0
+	switch period {
+	case "current":
+	case "previous":
+		periodsBack = 1
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "period must be current or previous",
+		}})
+		return
+	}
+
+	summary, err := h.summarizer.Summarize(userID, time.Now(), periodsBack)
+	if err != nil {
+		log.Printf("[GET-BUDGET-SUMMARY] Failed for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to compute budget summary",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": summary})
+}
+
+// GetBudgetPeriods returns a category's closed periods, newest first, with
+// the effective budget and rollover of each
+func (h *BudgetCategoryHandler) GetBudgetPeriods(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	categoryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid category ID",
+		}})
+		return
+	}
+
+	limit := 12
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "limit must be between 1 and 100",
+			}})
+			return
+		}
+	}
+
+	var count int64
+	if err := h.db.Model(&models.BudgetCategory{}).
+		Scopes(models.VisibleBudgetCategories(userID)).
+		Where("id = ?", categoryID).
+		Count(&count).Error; err != nil {
+		log.Printf("[GET-BUDGET-PERIODS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch budget category",
+		}})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Budget category not found",
+		}})
+		return
+	}
+
+	periods := []models.BudgetPeriod{}
+	if err := h.db.Where("budget_category_id = ?", categoryID).
+		Order("period_end DESC").
+		Limit(limit).
+		Find(&periods).Error; err != nil {
+		log.Printf("[GET-BUDGET-PERIODS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch budget periods",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": periods})
+}
+
+// PreviewRules runs proposed rules for a category against recent
+// transactions without saving them
+func (h *BudgetCategoryHandler) PreviewRules(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	categoryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid category ID",
+		}})
+		return
+	}
+
+	var req previewRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	if req.Days == 0 {
+		req.Days = rules.DefaultPreviewDays
+	}
+	if req.Days < 1 || req.Days > rules.MaxPreviewDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				"days": {"Days must be between 1 and 365"},
+			},
+		}})
+		return
+	}
+	if err := models.ValidateBudgetRules(req.Rules); err != nil {
+		var validationErr models.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request parameters",
+				"details": map[string][]string{
+					validationErr.Field: {validationErr.Message},
+				},
+			}})
+			return
+		}
+	}
+
+	var category models.BudgetCategory
+	if err := h.db.Scopes(models.EditableBudgetCategories(userID)).
+		Where("id = ?", categoryID).
+		First(&category).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Budget category not found",
+		}})
+		return
+	}
+
+	preview, err := rules.PreviewRules(h.db, h.repo, userID, category, req.Rules, req.Days)
+	if err != nil {
+		log.Printf("[PREVIEW-RULES] Failed for category %s: %v", category.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to preview rules",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": preview})
+}
+
+// GetRecategorizationJob reports the progress of a backfill job
+func (h *BudgetCategoryHandler) GetRecategorizationJob(c *gin.Context) {
+	userID, jobID, ok := parseJobParams(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.backfiller.Get(userID, jobID)
+	if err != nil {
+		respondJobError(c, "[GET-RECATEGORIZATION-JOB]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": newRecategorizationJobResponse(job)})
+}
+
+// UndoRecategorizationJob restores the categories a backfill job replaced
+func (h *BudgetCategoryHandler) UndoRecategorizationJob(c *gin.Context) {
+	userID, jobID, ok := parseJobParams(c)
+	if !ok {
+		return
+	}
+
+	job, restored, err := h.backfiller.Undo(userID, jobID)
+	if err != nil {
+		respondJobError(c, "[UNDO-RECATEGORIZATION-JOB]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"job":      newRecategorizationJobResponse(job),
+		"restored": restored,
+	}})
+}
+
+// checkParentCategory responds with a validation error unless the
+// category's parent, when set, is a system category
+func (h *BudgetCategoryHandler) checkParentCategory(c *gin.Context, category *models.BudgetCategory) bool {
+	if category.ParentCategoryID == nil {
+		return true
+	}
+	system, err := isSystemCategory(h.db, *category.ParentCategoryID)
+	if err != nil {
+		log.Printf("[BUDGET-CATEGORY] Failed to check parent category: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "An unexpected error occurred",
+		}})
+		return false
+	}
+	if !system {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				"parentCategoryId": {"Parent must be a system category"},
+			},
+		}})
+		return false
+	}
+	return true
+}
+
+// checkGroupEditor responds with an error unless the user may add categories
+// to the group
+func (h *BudgetCategoryHandler) checkGroupEditor(c *gin.Context, userID, groupID uuid.UUID) bool {
+	member, err := findGroupMember(h.db, groupID, userID)
+	if err != nil {
+		log.Printf("[BUDGET-CATEGORY] Failed to check group membership: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "An unexpected error occurred",
+		}})
+		return false
+	}
+	if member == nil || !member.CanEdit() {
+		c.JSON(http.StatusForbidden, gin.H{"error": gin.H{
+			"code":    "FORBIDDEN",
+			"message": "Only the group's owner and editors can add shared categories",
+		}})
+		return false
+	}
+	return true
+}
+
+// startBackfill queues a recategorization job when the request asked for
+// one. Failing to queue it does not fail the save.
+func (h *BudgetCategoryHandler) startBackfill(c *gin.Context, userID, categoryID uuid.UUID) *models.RecategorizationJob {
+	backfill, since, _ := parseBackfillParams(c)
+	if !backfill {
+		return nil
+	}
+	job, err := h.backfiller.Enqueue(userID, &categoryID, since)
+	if err != nil {
+		log.Printf("[BACKFILL] Failed to queue job for category %s: %v", categoryID, err)
+		return nil
+	}
+	return job
+}
+
+// parseBackfillParams reads ?backfill=true and the optional ?since=YYYY-MM-DD
+// that limits it to recent transactions
+func parseBackfillParams(c *gin.Context) (bool, *time.Time, error) {
+	backfill := false
+	if v := c.Query("backfill"); v != "" {
+		var err error
+		backfill, err = strconv.ParseBool(v)
+		if err != nil {
+			return false, nil, errors.New("backfill must be true or false")
+		}
+	}
+
+	var since *time.Time
+	if v := c.Query("since"); v != "" {
+		t, _, err := parseDateParam(v)
+		if err != nil {
+			return false, nil, errors.New("since must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		}
+		since = &t
+	}
+	return backfill, since, nil
+}
+
+func parseJobParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid job ID",
+		}})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, jobID, true
+}
+
+func respondJobError(c *gin.Context, tag string, err error) {
+	switch {
+	case errors.Is(err, rules.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Job not found",
+		}})
+	case errors.Is(err, rules.ErrJobNotUndoable):
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "INVALID_JOB_STATE",
+			"message": err.Error(),
+		}})
+	default:
+		log.Printf("%s Failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to process job",
+		}})
+	}
+}
@@ -0,0 +1,858 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	groupInviteTTL         = 72 * time.Hour
+	maxGroupInviteAttempts = 5
+)
+
+// BudgetGroupHandler manages households that share budget categories.
+// Members join by invitation to their phone number and confirm with the code
+// sent to it. Each member chooses which of their linked accounts count
+// towards the group; none do until they say so.
+type BudgetGroupHandler struct {
+	db       *gorm.DB
+	whatsapp *whatsapp.WhatsAppProvider
+}
+
+// NewBudgetGroupHandler creates a new BudgetGroupHandler instance
+func NewBudgetGroupHandler(db *gorm.DB, whatsapp *whatsapp.WhatsAppProvider) *BudgetGroupHandler {
+	return &BudgetGroupHandler{db: db, whatsapp: whatsapp}
+}
+
+type createBudgetGroupRequest struct {
+	Name     string `json:"name" binding:"required,max=50"`
+	Currency string `json:"currency"`
+}
+
+type inviteGroupMemberRequest struct {
+	Phone string `json:"phone" binding:"required,min=9,max=9"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type updateGroupMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type acceptGroupInviteRequest struct {
+	Code string `json:"code" binding:"required,len=6"`
+}
+
+type shareGroupAccountsRequest struct {
+	AccountIDs []uuid.UUID `json:"accountIds" binding:"required"`
+}
+
+// budgetGroupResponse adds the caller's own view of a group
+type budgetGroupResponse struct {
+	*models.BudgetGroup
+	Role             string      `json:"role"`
+	SharedAccountIDs []uuid.UUID `json:"sharedAccountIds"`
+}
+
+// CreateBudgetGroup creates a group owned by the user. Its currency defaults
+// to the user's preferred currency.
+func (h *BudgetGroupHandler) CreateBudgetGroup(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req createBudgetGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				"name": {"Name is required"},
+			},
+		}})
+		return
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		var user models.User
+		if err := h.db.Select("id", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+			log.Printf("[CREATE-BUDGET-GROUP] Failed to load user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to create budget group",
+			}})
+			return
+		}
+		currency = strings.ToUpper(user.PreferredCurrency)
+		if currency == "" {
+			currency = "USD"
+		}
+	}
+	if len(currency) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				"currency": {"Currency must be a 3-letter code"},
+			},
+		}})
+		return
+	}
+
+	group := models.BudgetGroup{Name: name, OwnerID: userID, Currency: currency}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.BudgetGroupMember{
+			GroupID: group.ID,
+			UserID:  userID,
+			Role:    models.GroupRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("[CREATE-BUDGET-GROUP] Failed for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to create budget group",
+		}})
+		return
+	}
+	log.Printf("[CREATE-BUDGET-GROUP] Created group %s for user %s", group.ID, userID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": budgetGroupResponse{
+		BudgetGroup:      &group,
+		Role:             models.GroupRoleOwner,
+		SharedAccountIDs: []uuid.UUID{},
+	}})
+}
+
+// GetBudgetGroups returns the groups the user belongs to
+func (h *BudgetGroupHandler) GetBudgetGroups(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var memberships []models.BudgetGroupMember
+	if err := h.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&memberships).Error; err != nil {
+		log.Printf("[GET-BUDGET-GROUPS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch budget groups",
+		}})
+		return
+	}
+
+	groups := make([]budgetGroupResponse, 0, len(memberships))
+	for i := range memberships {
+		group, err := h.groupResponse(&memberships[i])
+		if err != nil {
+			log.Printf("[GET-BUDGET-GROUPS] Failed to load group %s: %v", memberships[i].GroupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch budget groups",
+			}})
+			return
+		}
+		groups = append(groups, *group)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": groups})
+}
+
+// GetBudgetGroup returns a group with its members
+func (h *BudgetGroupHandler) GetBudgetGroup(c *gin.Context) {
+	_, member, ok := h.loadMembership(c, "[GET-BUDGET-GROUP]")
+	if !ok {
+		return
+	}
+
+	group, err := h.groupResponse(member)
+	if err != nil {
+		log.Printf("[GET-BUDGET-GROUP] Failed to load group %s: %v", member.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch budget group",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": group})
+}
+
+// DeleteBudgetGroup deletes a group and its shared categories. Only the
+// owner can delete it.
+func (h *BudgetGroupHandler) DeleteBudgetGroup(c *gin.Context) {
+	_, member, ok := h.loadMembership(c, "[DELETE-BUDGET-GROUP]")
+	if !ok || !requireGroupOwner(c, member) {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// Categories are soft deleted, so they let go of the group first
+		if err := tx.Unscoped().Model(&models.BudgetCategory{}).
+			Where("group_id = ?", member.GroupID).
+			Updates(map[string]interface{}{
+				"group_id":   nil,
+				"deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", time.Now()),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.BudgetGroup{}, "id = ?", member.GroupID).Error
+	})
+	if err != nil {
+		log.Printf("[DELETE-BUDGET-GROUP] Failed for group %s: %v", member.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to delete budget group",
+		}})
+		return
+	}
+	log.Printf("[DELETE-BUDGET-GROUP] Deleted group %s", member.GroupID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// InviteGroupMember invites a phone number to the group and sends it the
+// code that accepts the invitation. Only the owner can invite.
+func (h *BudgetGroupHandler) InviteGroupMember(c *gin.Context) {
+	userID, member, ok := h.loadMembership(c, "[INVITE-GROUP-MEMBER]")
+	if !ok || !requireGroupOwner(c, member) {
+		return
+	}
+
+	var req inviteGroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	role := strings.ToLower(req.Role)
+	if role != models.GroupRoleEditor && role != models.GroupRoleViewer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				"role": {"Role must be editor or viewer"},
+			},
+		}})
+		return
+	}
+
+	var count int64
+	if err := h.db.Model(&models.BudgetGroupMember{}).
+		Joins("JOIN users ON users.id = budget_group_members.user_id").
+		Where("budget_group_members.group_id = ? AND users.phone = ?", member.GroupID, req.Phone).
+		Count(&count).Error; err != nil {
+		log.Printf("[INVITE-GROUP-MEMBER] Membership check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to invite member",
+		}})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "ALREADY_MEMBER",
+			"message": "This phone number is already a member of the group",
+		}})
+		return
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		log.Printf("[INVITE-GROUP-MEMBER] Failed to generate code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to invite member",
+		}})
+		return
+	}
+
+	var group models.BudgetGroup
+	invite := models.BudgetGroupInvite{
+		GroupID:   member.GroupID,
+		Phone:     req.Phone,
+		Role:      role,
+		InvitedBy: userID,
+		CodeHash:  utils.HashOTP(code),
+		Status:    models.GroupInvitePending,
+		ExpiresAt: time.Now().Add(groupInviteTTL),
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&group, "id = ?", member.GroupID).Error; err != nil {
+			return err
+		}
+		// A new invitation replaces any the phone still has pending
+		if err := tx.Model(&models.BudgetGroupInvite{}).
+			Where("group_id = ? AND phone = ? AND status = ?", member.GroupID, req.Phone, models.GroupInvitePending).
+			Update("status", models.GroupInviteRevoked).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invite).Error
+	})
+	if err != nil {
+		log.Printf("[INVITE-GROUP-MEMBER] Failed for group %s: %v", member.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to invite member",
+		}})
+		return
+	}
+
+	message := fmt.Sprintf("KaafiPay: You have been invited to share the %q budget. Open KaafiPay and enter code %s to join. The code expires in 3 days.",
+		group.Name, code)
+	if err := h.whatsapp.SendMessage(req.Phone, message); err != nil {
+		log.Printf("[INVITE-GROUP-MEMBER] Failed to send invite %s: %v", invite.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{
+			"code":    "DELIVERY_FAILED",
+			"message": "Failed to send the invitation code",
+		}})
+		return
+	}
+	log.Printf("[INVITE-GROUP-MEMBER] Invited %s to group %s as %s", req.Phone, member.GroupID, role)
+
+	c.JSON(http.StatusCreated, gin.H{"data": invite})
+}
+
+// RevokeGroupInvite withdraws a pending invitation
+func (h *BudgetGroupHandler) RevokeGroupInvite(c *gin.Context) {
+	_, member, ok := h.loadMembership(c, "[REVOKE-GROUP-INVITE]")
+	if !ok || !requireGroupOwner(c, member) {
+		return
+	}
+
+	inviteID, err := uuid.Parse(c.Param("inviteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid invite ID",
+		}})
+		return
+	}
+
+	now := time.Now()
+	result := h.db.Model(&models.BudgetGroupInvite{}).
+		Where("id = ? AND group_id = ? AND status = ?", inviteID, member.GroupID, models.GroupInvitePending).
+		Updates(map[string]interface{}{"status": models.GroupInviteRevoked, "responded_at": now})
+	if result.Error != nil {
+		log.Printf("[REVOKE-GROUP-INVITE] Database error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to revoke invite",
+		}})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Pending invite not found",
+		}})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UpdateGroupMember changes a member's role. Only the owner can change
+// roles, and ownership itself does not move.
+func (h *BudgetGroupHandler) UpdateGroupMember(c *gin.Context) {
+	_, member, ok := h.loadMembership(c, "[UPDATE-GROUP-MEMBER]")
+	if !ok || !requireGroupOwner(c, member) {
+		return
+	}
+
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid user ID",
+		}})
+		return
+	}
+
+	var req updateGroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	role := strings.ToLower(req.Role)
+	if role != models.GroupRoleEditor && role != models.GroupRoleViewer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				"role": {"Role must be editor or viewer"},
+			},
+		}})
+		return
+	}
+
+	target, err := findGroupMember(h.db, member.GroupID, targetID)
+	if err != nil {
+		log.Printf("[UPDATE-GROUP-MEMBER] Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to update member",
+		}})
+		return
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Member not found",
+		}})
+		return
+	}
+	if target.Role == models.GroupRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "The owner's role cannot be changed",
+		}})
+		return
+	}
+
+	if err := h.db.Model(target).Update("role", role).Error; err != nil {
+		log.Printf("[UPDATE-GROUP-MEMBER] Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to update member",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": target})
+}
+
+// RemoveGroupMember removes a member and the accounts they shared. The
+// owner can remove anyone else; other members can only leave.
+func (h *BudgetGroupHandler) RemoveGroupMember(c *gin.Context) {
+	userID, member, ok := h.loadMembership(c, "[REMOVE-GROUP-MEMBER]")
+	if !ok {
+		return
+	}
+
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid user ID",
+		}})
+		return
+	}
+	if targetID == userID && member.Role == models.GroupRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "The owner cannot leave the group; delete it instead",
+		}})
+		return
+	}
+	if targetID != userID && !requireGroupOwner(c, member) {
+		return
+	}
+
+	var removed int64
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND user_id = ?", member.GroupID, targetID).
+			Delete(&models.BudgetGroupAccount{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("group_id = ? AND user_id = ?", member.GroupID, targetID).
+			Delete(&models.BudgetGroupMember{})
+		removed = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		log.Printf("[REMOVE-GROUP-MEMBER] Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to remove member",
+		}})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Member not found",
+		}})
+		return
+	}
+	log.Printf("[REMOVE-GROUP-MEMBER] Removed user %s from group %s", targetID, member.GroupID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ShareGroupAccounts replaces the set of the user's linked accounts that
+// count towards the group. An empty list stops sharing.
+func (h *BudgetGroupHandler) ShareGroupAccounts(c *gin.Context) {
+	userID, member, ok := h.loadMembership(c, "[SHARE-GROUP-ACCOUNTS]")
+	if !ok {
+		return
+	}
+
+	var req shareGroupAccountsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.AccountIDs))
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range req.AccountIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		var count int64
+		if err := h.db.Model(&models.LinkedAccount{}).
+			Where("id IN ? AND user_id = ?", ids, userID).
+			Count(&count).Error; err != nil {
+			log.Printf("[SHARE-GROUP-ACCOUNTS] Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to share accounts",
+			}})
+			return
+		}
+		if int(count) != len(ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request parameters",
+				"details": map[string][]string{
+					"accountIds": {"Every account must be one of your linked accounts"},
+				},
+			}})
+			return
+		}
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND user_id = ?", member.GroupID, userID).
+			Delete(&models.BudgetGroupAccount{}).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Create(&models.BudgetGroupAccount{
+				GroupID:         member.GroupID,
+				UserID:          userID,
+				LinkedAccountID: id,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[SHARE-GROUP-ACCOUNTS] Failed for user %s in group %s: %v", userID, member.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to share accounts",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"sharedAccountIds": ids}})
+}
+
+// GetGroupInvites returns the pending invitations to the user's phone number
+func (h *BudgetGroupHandler) GetGroupInvites(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var user models.User
+	if err := h.db.Select("id", "phone").First(&user, "id = ?", userID).Error; err != nil {
+		log.Printf("[GET-GROUP-INVITES] Failed to load user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch invites",
+		}})
+		return
+	}
+
+	invites := []models.BudgetGroupInvite{}
+	if err := h.db.Preload("Group").
+		Where("phone = ? AND status = ? AND expires_at > ?", user.Phone, models.GroupInvitePending, time.Now()).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		log.Printf("[GET-GROUP-INVITES] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch invites",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": invites})
+}
+
+// AcceptGroupInvite joins the group with the code sent to the user's phone
+func (h *BudgetGroupHandler) AcceptGroupInvite(c *gin.Context) {
+	userID, invite, ok := h.loadInvite(c, "[ACCEPT-GROUP-INVITE]")
+	if !ok {
+		return
+	}
+
+	var req acceptGroupInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	_, claimed, err := utils.ClaimOTPAttempt(h.db, "budget_group_invites", invite.ID, models.GroupInvitePending, maxGroupInviteAttempts)
+	if err != nil {
+		log.Printf("[ACCEPT-GROUP-INVITE] Failed to count attempt on %s: %v", invite.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to accept invite",
+		}})
+		return
+	}
+	if !claimed {
+		// Either out of attempts or answered since it was loaded
+		var current models.BudgetGroupInvite
+		if err := h.db.Select("status").First(&current, "id = ?", invite.ID).Error; err == nil &&
+			current.Status != models.GroupInvitePending {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "Pending invite not found",
+			}})
+			return
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{
+			"code":    "TOO_MANY_ATTEMPTS",
+			"message": "Too many incorrect codes; ask for a new invitation",
+		}})
+		return
+	}
+	if !utils.CheckOTP(req.Code, invite.CodeHash) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{
+			"code":    "INVALID_CODE",
+			"message": "Invalid invitation code",
+		}})
+		return
+	}
+
+	var member models.BudgetGroupMember
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Claim the invite so a second accept cannot add the member twice
+		result := tx.Model(invite).
+			Where("status = ?", models.GroupInvitePending).
+			Updates(map[string]interface{}{"status": models.GroupInviteAccepted, "responded_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInviteNotPending
+		}
+
+		existing, err := findGroupMember(tx, invite.GroupID, userID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			member = *existing
+			return nil
+		}
+		member = models.BudgetGroupMember{GroupID: invite.GroupID, UserID: userID, Role: invite.Role}
+		return tx.Create(&member).Error
+	})
+	if errors.Is(err, errInviteNotPending) {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Pending invite not found",
+		}})
+		return
+	}
+	if err != nil {
+		log.Printf("[ACCEPT-GROUP-INVITE] Failed for invite %s: %v", invite.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to accept invite",
+		}})
+		return
+	}
+	log.Printf("[ACCEPT-GROUP-INVITE] User %s joined group %s as %s", userID, invite.GroupID, member.Role)
+
+	c.JSON(http.StatusOK, gin.H{"data": member})
+}
+
+// DeclineGroupInvite turns an invitation down
+func (h *BudgetGroupHandler) DeclineGroupInvite(c *gin.Context) {
+	_, invite, ok := h.loadInvite(c, "[DECLINE-GROUP-INVITE]")
+	if !ok {
+		return
+	}
+
+	if err := h.db.Model(invite).Updates(map[string]interface{}{
+		"status":       models.GroupInviteDeclined,
+		"responded_at": time.Now(),
+	}).Error; err != nil {
+		log.Printf("[DECLINE-GROUP-INVITE] Failed for invite %s: %v", invite.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to decline invite",
+		}})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+var errInviteNotPending = errors.New("invite is no longer pending")
+
+// loadMembership resolves the :id group and the user's membership of it.
+// Groups the user is not in are reported as not found.
+func (h *BudgetGroupHandler) loadMembership(c *gin.Context, tag string) (uuid.UUID, *models.BudgetGroupMember, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, nil, false
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid group ID",
+		}})
+		return uuid.Nil, nil, false
+	}
+
+	member, err := findGroupMember(h.db, groupID, userID)
+	if err != nil {
+		log.Printf("%s Membership lookup failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch budget group",
+		}})
+		return uuid.Nil, nil, false
+	}
+	if member == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Budget group not found",
+		}})
+		return uuid.Nil, nil, false
+	}
+	return userID, member, true
+}
+
+// loadInvite resolves the :id invite, which must be pending, unexpired and
+// addressed to the user's phone number
+func (h *BudgetGroupHandler) loadInvite(c *gin.Context, tag string) (uuid.UUID, *models.BudgetGroupInvite, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, nil, false
+	}
+
+	inviteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid invite ID",
+		}})
+		return uuid.Nil, nil, false
+	}
+
+	var invite models.BudgetGroupInvite
+	err = h.db.Where("id = ? AND status = ? AND expires_at > ?", inviteID, models.GroupInvitePending, time.Now()).
+		Where("phone = (?)", h.db.Model(&models.User{}).Select("phone").Where("id = ?", userID)).
+		First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Pending invite not found",
+		}})
+		return uuid.Nil, nil, false
+	}
+	if err != nil {
+		log.Printf("%s Database query failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch invite",
+		}})
+		return uuid.Nil, nil, false
+	}
+	return userID, &invite, true
+}
+
+// groupResponse loads a group with its members as seen by member
+func (h *BudgetGroupHandler) groupResponse(member *models.BudgetGroupMember) (*budgetGroupResponse, error) {
+	var group models.BudgetGroup
+	if err := h.db.
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Members.User", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name", "phone") }).
+		First(&group, "id = ?", member.GroupID).Error; err != nil {
+		return nil, err
+	}
+
+	shared := []uuid.UUID{}
+	if err := h.db.Model(&models.BudgetGroupAccount{}).
+		Where("group_id = ? AND user_id = ?", member.GroupID, member.UserID).
+		Pluck("linked_account_id", &shared).Error; err != nil {
+		return nil, err
+	}
+
+	return &budgetGroupResponse{BudgetGroup: &group, Role: member.Role, SharedAccountIDs: shared}, nil
+}
+
+// findGroupMember returns the user's membership of a group, or nil when they
+// are not a member
+func findGroupMember(db *gorm.DB, groupID, userID uuid.UUID) (*models.BudgetGroupMember, error) {
+	var member models.BudgetGroupMember
+	err := db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func requireGroupOwner(c *gin.Context, member *models.BudgetGroupMember) bool {
+	if member.Role != models.GroupRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": gin.H{
+			"code":    "FORBIDDEN",
+			"message": "Only the group's owner can do this",
+		}})
+		return false
+	}
+	return true
+}
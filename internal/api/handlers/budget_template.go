@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/budgets"
+	"github.com/moha/kaafipay-backend/internal/services/rules"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// maxMonthlyIncome keeps every scaled budget within the budget column
+const maxMonthlyIncome = 99999999
+
+// errCategoriesExist is returned when a template would duplicate a category
+var errCategoriesExist = errors.New("categories already exist")
+
+// BudgetTemplateHandler serves onboarding presets of budget categories
+type BudgetTemplateHandler struct {
+	db         *gorm.DB
+	backfiller *rules.Backfiller
+}
+
+// NewBudgetTemplateHandler creates a new BudgetTemplateHandler instance
+func NewBudgetTemplateHandler(db *gorm.DB, backfiller *rules.Backfiller) *BudgetTemplateHandler {
+	return &BudgetTemplateHandler{db: db, backfiller: backfiller}
+}
+
+type applyTemplateRequest struct {
+	MonthlyIncome float64 `json:"monthlyIncome" binding:"required,gt=0,lte=99999999"`
+	// Categories limits the categories created to these names
+	Categories []string `json:"categories"`
+}
+
+// GetBudgetTemplates lists the presets. With ?monthlyIncome= each category
+// includes its suggested amount.
+func (h *BudgetTemplateHandler) GetBudgetTemplates(c *gin.Context) {
+	templates := budgets.Templates()
+	if v := c.Query("monthlyIncome"); v != "" {
+		income, err := strconv.ParseFloat(v, 64)
+		if err != nil || income <= 0 || income > maxMonthlyIncome {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "monthlyIncome must be a positive amount",
+			}})
+			return
+		}
+		for i := range templates {
+			templates[i].WithIncome(income)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": templates})
+}
+
+// ApplyBudgetTemplate creates the template's categories for the user in one
+// transaction, scaled to their monthly income. With ?backfill=true the
+// user's history is recategorized in the background.
+func (h *BudgetTemplateHandler) ApplyBudgetTemplate(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	backfill, since, err := parseBackfillParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
+	template, ok := budgets.FindTemplate(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Budget template not found",
+		}})
+		return
+	}
+
+	var req applyTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
+	selected := template.Categories
+	if len(req.Categories) > 0 {
+		wanted := make(map[string]bool, len(req.Categories))
+		for _, name := range req.Categories {
+			wanted[name] = true
+		}
+		selected = nil
+		for _, category := range template.Categories {
+			if wanted[category.Name] {
+				selected = append(selected, category)
+				delete(wanted, category.Name)
+			}
+		}
+		if len(wanted) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "categories must be names of categories in the template",
+			}})
+			return
+		}
+	}
+
+	slugs := make([]string, 0, len(selected))
+	names := make([]string, 0, len(selected))
+	for _, category := range selected {
+		slugs = append(slugs, category.ParentSlug)
+		names = append(names, category.Name)
+	}
+
+	var created []models.BudgetCategory
+	var conflicts []string
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Names are unique per user, including deleted categories
+		if err := tx.Unscoped().Model(&models.BudgetCategory{}).
+			Where("user_id = ? AND name IN ?", userID, names).
+			Pluck("name", &conflicts).Error; err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return errCategoriesExist
+		}
+
+		var parents []models.TransactionCategory
+		if err := tx.Where("slug IN ? AND is_system = ?", slugs, true).Find(&parents).Error; err != nil {
+			return err
+		}
+		parentIDs := make(map[string]uuid.UUID, len(parents))
+		for _, parent := range parents {
+			parentIDs[parent.Slug] = parent.ID
+		}
+
+		for i, item := range selected {
+			category := item.BudgetCategory(req.MonthlyIncome)
+			category.UserID = userID
+			category.Priority = models.DefaultBudgetPriority + i
+			if id, ok := parentIDs[item.ParentSlug]; ok {
+				category.ParentCategoryID = &id
+			}
+			if err := category.Validate(); err != nil {
+				return err
+			}
+			if err := tx.Create(&category).Error; err != nil {
+				return err
+			}
+			created = append(created, category)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errCategoriesExist) {
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+				"code":    "CATEGORIES_EXIST",
+				"message": "Some of the template's categories already exist",
+				"details": map[string][]string{"categories": conflicts},
+			}})
+			return
+		}
+		log.Printf("[APPLY-BUDGET-TEMPLATE] Failed to apply %s for user %s: %v", template.ID, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to apply budget template",
+		}})
+		return
+	}
+	log.Printf("[APPLY-BUDGET-TEMPLATE] Created %d categories from %s for user %s", len(created), template.ID, userID)
+
+	response := gin.H{"data": created}
+	if backfill {
+		job, err := h.backfiller.Enqueue(userID, nil, since)
+		if err != nil {
+			log.Printf("[BACKFILL] Failed to queue job for template %s: %v", template.ID, err)
+		} else {
+			response["backfillJob"] = newRecategorizationJobResponse(job)
+		}
+	}
+	c.JSON(http.StatusCreated, response)
+}
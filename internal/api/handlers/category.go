@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// CategoryHandler serves the system category taxonomy and, for admins, the
+// merchant to category map
+type CategoryHandler struct {
+	db *gorm.DB
+}
+
+// NewCategoryHandler creates a new CategoryHandler instance
+func NewCategoryHandler(db *gorm.DB) *CategoryHandler {
+	return &CategoryHandler{db: db}
+}
+
+type merchantCategoryRequest struct {
+	MerchantName string    `json:"merchantName" binding:"required,max=255"`
+	CategoryID   uuid.UUID `json:"categoryId" binding:"required"`
+}
+
+// GetCategories returns the system categories as a tree
+func (h *CategoryHandler) GetCategories(c *gin.Context) {
+	var categories []models.TransactionCategory
+	if err := h.db.Where("is_system = ?", true).
+		Order("sort_order ASC").Order("name ASC").
+		Find(&categories).Error; err != nil {
+		log.Printf("[GET-CATEGORIES] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch categories",
+		}})
+		return
+	}
+
+	children := make(map[uuid.UUID][]models.TransactionCategory)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+	roots := []models.TransactionCategory{}
+	for _, category := range categories {
+		if category.ParentID == nil {
+			category.Children = children[category.ID]
+			roots = append(roots, category)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": roots})
+}
+
+// ListMerchantCategories returns the merchant map, optionally filtered with
+// ?search=
+func (h *CategoryHandler) ListMerchantCategories(c *gin.Context) {
+	query := h.db.Order("merchant_name ASC")
+	if search := models.NormalizeMerchantName(c.Query("search")); search != "" {
+		search = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search)
+		query = query.Where("merchant_name LIKE ?", "%"+search+"%")
+	}
+
+	mappings := []models.MerchantCategory{}
+	if err := query.Limit(500).Find(&mappings).Error; err != nil {
+		log.Printf("[LIST-MERCHANT-CATEGORIES] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch merchant categories",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": mappings})
+}
+
+// UpsertMerchantCategory maps a merchant to a system category, replacing any
+// existing mapping for it. Transactions already stored keep their category.
+func (h *CategoryHandler) UpsertMerchantCategory(c *gin.Context) {
+	var req merchantCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+	name := models.NormalizeMerchantName(req.MerchantName)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "merchantName is required",
+		}})
+		return
+	}
+
+	system, err := isSystemCategory(h.db, req.CategoryID)
+	if err != nil {
+		log.Printf("[UPSERT-MERCHANT-CATEGORY] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to save merchant category",
+		}})
+		return
+	}
+	if !system {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+			"code":    "INVALID_CATEGORY",
+			"message": "categoryId must be a system category",
+		}})
+		return
+	}
+
+	mapping := models.MerchantCategory{MerchantName: name, CategoryID: req.CategoryID}
+	if err := h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "merchant_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"category_id", "updated_at"}),
+	}).Create(&mapping).Error; err != nil {
+		log.Printf("[UPSERT-MERCHANT-CATEGORY] Failed to save %q: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to save merchant category",
+		}})
+		return
+	}
+	if err := h.db.Where("merchant_name = ?", name).First(&mapping).Error; err != nil {
+		log.Printf("[UPSERT-MERCHANT-CATEGORY] Failed to reload %q: %v", name, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": mapping})
+}
+
+// DeleteMerchantCategory removes a merchant mapping
+func (h *CategoryHandler) DeleteMerchantCategory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid merchant category ID",
+		}})
+		return
+	}
+
+	result := h.db.Where("id = ?", id).Delete(&models.MerchantCategory{})
+	if result.Error != nil {
+		log.Printf("[DELETE-MERCHANT-CATEGORY] Database error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to delete merchant category",
+		}})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Merchant category not found",
+		}})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// isSystemCategory reports whether id names a system category
+func isSystemCategory(db *gorm.DB, id uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.TransactionCategory{}).
+		Where("id = ? AND is_system = ?", id, true).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/kyc"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// KYCHandler takes users' identity documents and lets reviewers approve or
+// reject them, which moves users between KYC tiers
+type KYCHandler struct {
+	kyc *kyc.Service
+}
+
+// NewKYCHandler creates a new KYCHandler instance
+func NewKYCHandler(service *kyc.Service) *KYCHandler {
+	return &KYCHandler{kyc: service}
+}
+
+type submitKYCDocumentRequest struct {
+	DocumentType   string `json:"documentType" binding:"required"`
+	DocumentNumber string `json:"documentNumber" binding:"max=50"`
+	IssuingCountry string `json:"issuingCountry" binding:"omitempty,len=2"`
+	ExpiresOn      string `json:"expiresOn" binding:"omitempty,datetime=2006-01-02"`
+	StorageKey     string `json:"storageKey" binding:"required,max=255"`
+	FileName       string `json:"fileName" binding:"required,max=255"`
+	ContentType    string `json:"contentType" binding:"required,max=100"`
+	SizeBytes      int64  `json:"sizeBytes" binding:"required,gt=0"`
+	SHA256         string `json:"sha256" binding:"required,len=64"`
+}
+
+type reviewKYCDocumentRequest struct {
+	Reviewer string `json:"reviewer" binding:"required,max=100"`
+	Reason   string `json:"reason" binding:"max=255"`
+}
+
+// GetKYCStatus returns the user's tier, their limits with what is left of
+// them, and the documents needed for the next tier
+func (h *KYCHandler) GetKYCStatus(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	status, err := h.kyc.Status(userID)
+	if err != nil {
+		log.Printf("[GET-KYC-STATUS] Failed to load KYC status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch KYC status",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": status})
+}
+
+// GetKYCDocuments returns the documents the user has submitted
+func (h *KYCHandler) GetKYCDocuments(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	docs, err := h.kyc.Documents(userID)
+	if err != nil {
+		log.Printf("[GET-KYC-DOCUMENTS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch documents",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": docs})
+}
+
+// SubmitKYCDocument records a document the app has uploaded to storage and
+// queues it for review
+func (h *KYCHandler) SubmitKYCDocument(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req submitKYCDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	input := kyc.SubmitInput{
+		DocumentType:   req.DocumentType,
+		DocumentNumber: req.DocumentNumber,
+		IssuingCountry: req.IssuingCountry,
+		StorageKey:     req.StorageKey,
+		FileName:       req.FileName,
+		ContentType:    req.ContentType,
+		SizeBytes:      req.SizeBytes,
+		SHA256:         req.SHA256,
+	}
+	if req.ExpiresOn != "" {
+		expires, _ := time.Parse("2006-01-02", req.ExpiresOn)
+		input.ExpiresOn = &expires
+	}
+
+	doc, err := h.kyc.Submit(userID, input)
+	if err != nil {
+		respondKYCError(c, "[SUBMIT-KYC-DOCUMENT]", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": doc})
+}
+
+// GetKYCReviewQueue returns documents awaiting review, oldest first, or
+// those with another ?status
+func (h *KYCHandler) GetKYCReviewQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", models.KYCDocumentPending)
+	switch status {
+	case models.KYCDocumentPending, models.KYCDocumentApproved, models.KYCDocumentRejected, models.KYCDocumentExpired:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "status must be pending, approved, rejected or expired",
+		}})
+		return
+	}
+
+	docs, err := h.kyc.Queue(status)
+	if err != nil {
+		log.Printf("[GET-KYC-REVIEW-QUEUE] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch documents",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": docs})
+}
+
+// GetKYCReviewDocument returns a single document for review
+func (h *KYCHandler) GetKYCReviewDocument(c *gin.Context) {
+	documentID, ok := kycDocumentID(c)
+	if !ok {
+		return
+	}
+
+	doc, err := h.kyc.Document(documentID)
+	if err != nil {
+		respondKYCError(c, "[GET-KYC-REVIEW-DOCUMENT]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": doc})
+}
+
+// ApproveKYCDocument accepts a pending document
+func (h *KYCHandler) ApproveKYCDocument(c *gin.Context) {
+	h.review(c, "[APPROVE-KYC-DOCUMENT]", true)
+}
+
+// RejectKYCDocument turns down a pending document or withdraws an approval
+func (h *KYCHandler) RejectKYCDocument(c *gin.Context) {
+	h.review(c, "[REJECT-KYC-DOCUMENT]", false)
+}
+
+func (h *KYCHandler) review(c *gin.Context, tag string, approve bool) {
+	documentID, ok := kycDocumentID(c)
+	if !ok {
+		return
+	}
+
+	var req reviewKYCDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	var doc *models.KYCDocument
+	var err error
+	if approve {
+		doc, err = h.kyc.Approve(documentID, req.Reviewer)
+	} else {
+		doc, err = h.kyc.Reject(documentID, req.Reviewer, req.Reason)
+	}
+	if err != nil {
+		respondKYCError(c, tag, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": doc})
+}
+
+// kycDocumentID parses the :id parameter
+func kycDocumentID(c *gin.Context) (uuid.UUID, bool) {
+	documentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid document ID",
+		}})
+		return uuid.Nil, false
+	}
+	return documentID, true
+}
+
+// respondKYCError maps KYC service errors to responses
+func respondKYCError(c *gin.Context, tag string, err error) {
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				validationErr.Field: {validationErr.Message},
+			},
+		}})
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	message := "Failed to process document"
+	switch {
+	case errors.Is(err, kyc.ErrDocumentNotFound):
+		status, code, message = http.StatusNotFound, "NOT_FOUND", "Document not found"
+	case errors.Is(err, kyc.ErrAlreadyPending):
+		status, code, message = http.StatusConflict, "DOCUMENT_PENDING", err.Error()
+	case errors.Is(err, kyc.ErrAlreadyReviewed):
+		status, code, message = http.StatusConflict, "DOCUMENT_REVIEWED", err.Error()
+	default:
+		log.Printf("%s KYC request failed: %v", tag, err)
+	}
+
+	c.JSON(status, gin.H{"error": gin.H{
+		"code":    code,
+		"message": message,
+	}})
+}
+
+// checkTransferLimit runs the limits policy before a transfer is started
+// or confirmed, answering with the headroom left if the amount is over it.
+// It is early feedback only; the policy is enforced again as the transfer
+// completes.
+func checkTransferLimit(c *gin.Context, policy *limits.Policy, tag string, userID uuid.UUID, amount float64, currency string) bool {
+	err := policy.Check(userID, amount, currency)
+	if err == nil {
+		return true
+	}
+	if !respondLimitError(c, err) {
+		log.Printf("%s Limit check failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to check transfer limits",
+		}})
+	}
+	return false
+}
+
+// respondLimitError answers a *limits.LimitError or an unsupported
+// currency, and reports whether err was either
+func respondLimitError(c *gin.Context, err error) bool {
+	if errors.Is(err, limits.ErrUnsupportedCurrency) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+			"code":    "UNSUPPORTED_CURRENCY",
+			"message": err.Error(),
+		}})
+		return true
+	}
+	var limitErr *limits.LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+		"code":    "LIMIT_EXCEEDED",
+		"message": limitErr.Error(),
+		"details": limitErr,
+	}})
+	return true
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,41 +12,93 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/transactions"
 )
 
 // LinkedAccountHandler handles operations on linked accounts
 type LinkedAccountHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	ingestor *transactions.Ingestor
 }
 
 // NewLinkedAccountHandler creates a new LinkedAccountHandler instance
-func NewLinkedAccountHandler(db *gorm.DB) *LinkedAccountHandler {
-	return &LinkedAccountHandler{db: db}
+func NewLinkedAccountHandler(db *gorm.DB, ingestor *transactions.Ingestor) *LinkedAccountHandler {
+	return &LinkedAccountHandler{db: db, ingestor: ingestor}
 }
 
 // Request/Response types
 type linkAccountRequest struct {
 	Provider      models.Provider `json:"provider" binding:"required"`
-	AccountID     string          `json:"accountId" binding:"required"`
-	AccountNumber string          `json:"accountNumber" binding:"required"`
+	AccountID     string          `json:"accountId"`
+	AccountNumber string          `json:"accountNumber"`
 	AccountTitle  string          `json:"accountTitle" binding:"required"`
-	AccountType   string          `json:"accountType" binding:"required"`
+	AccountType   string          `json:"accountType"`
 	Currency      struct {
 		Code   string `json:"code" binding:"required"`
 		Name   string `json:"name" binding:"required"`
 		Symbol string `json:"symbol" binding:"required"`
 	} `json:"currency" binding:"required"`
 	IsDefaultAccount bool `json:"isDefaultAccount"`
-	Credentials      struct {
+	// Credentials and DeviceInfo are required for every provider except CASH
+	Credentials *struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
-	} `json:"credentials" binding:"required"`
-	DeviceInfo struct {
+	} `json:"credentials"`
+	DeviceInfo *struct {
 		DeviceID     string `json:"deviceId" binding:"required"`
 		DeviceModel  string `json:"deviceModel" binding:"required"`
 		Manufacturer string `json:"manufacturer" binding:"required"`
 		OSVersion    string `json:"osVersion" binding:"required"`
-	} `json:"deviceInfo" binding:"required"`
+	} `json:"deviceInfo"`
+}
+
+// validate applies the provider-dependent rules binding tags cannot express
+// and fills in the identifiers a cash wallet does not have
+func (r *linkAccountRequest) validate() error {
+	if !r.Provider.IsValid() {
+		return errors.New("unknown provider")
+	}
+
+	if !r.Provider.RequiresCredentials() {
+		if r.Credentials != nil || r.DeviceInfo != nil {
+			return errors.New("cash accounts do not take credentials or device info")
+		}
+		if r.AccountNumber == "" {
+			r.AccountNumber = "CASH-" + strings.ToUpper(uuid.NewString()[:8])
+		}
+		if r.AccountID == "" {
+			r.AccountID = r.AccountNumber
+		}
+		if r.AccountType == "" {
+			r.AccountType = "CASH"
+		}
+		return nil
+	}
+
+	switch {
+	case r.AccountID == "":
+		return errors.New("accountId is required")
+	case r.AccountNumber == "":
+		return errors.New("accountNumber is required")
+	case r.AccountType == "":
+		return errors.New("accountType is required")
+	case r.Credentials == nil:
+		return errors.New("credentials are required for this provider")
+	case r.DeviceInfo == nil:
+		return errors.New("deviceInfo is required for this provider")
+	}
+	return nil
+}
+
+// credentials returns the provider login and device id, empty for cash accounts
+func (r *linkAccountRequest) credentials() (username, password, deviceID string) {
+	if r.Credentials != nil {
+		username, password = r.Credentials.Username, r.Credentials.Password
+	}
+	if r.DeviceInfo != nil {
+		deviceID = r.DeviceInfo.DeviceID
+	}
+	return username, password, deviceID
 }
 
 type accountResponse struct {
@@ -59,9 +113,10 @@ type accountResponse struct {
 		Name   string `json:"name"`
 		Symbol string `json:"symbol"`
 	} `json:"currency"`
-	IsDefaultAccount bool    `json:"isDefaultAccount"`
-	CreatedAt        string  `json:"createdAt"`
-	LastSyncAt       *string `json:"lastSyncAt,omitempty"`
+	IsDefaultAccount bool     `json:"isDefaultAccount"`
+	Balance          *float64 `json:"balance,omitempty"` // Cash accounts only
+	CreatedAt        string   `json:"createdAt"`
+	LastSyncAt       *string  `json:"lastSyncAt,omitempty"`
 }
 
 func init() {
@@ -80,6 +135,14 @@ func (h *LinkedAccountHandler) LinkAccount(c *gin.Context) {
 		}})
 		return
 	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+	username, password, deviceID := req.credentials()
 
 	// Get user ID from context with detailed logging
 	userIDInterface, exists := c.Get("user_id")
@@ -150,9 +213,9 @@ func (h *LinkedAccountHandler) LinkAccount(c *gin.Context) {
 		existingAccount.CurrencyName = req.Currency.Name
 		existingAccount.CurrencySymbol = req.Currency.Symbol
 		existingAccount.IsDefaultAccount = req.IsDefaultAccount
-		existingAccount.ProviderUsername = req.Credentials.Username
-		existingAccount.ProviderPassword = req.Credentials.Password
-		existingAccount.DeviceID = req.DeviceInfo.DeviceID
+		existingAccount.ProviderUsername = username
+		existingAccount.ProviderPassword = password
+		existingAccount.DeviceID = deviceID
 
 		if err := h.db.Unscoped().Save(&existingAccount).Error; err != nil {
 			log.Printf("[LINK-ACCOUNT] Failed to reactivate account: %v", err)
@@ -180,9 +243,9 @@ func (h *LinkedAccountHandler) LinkAccount(c *gin.Context) {
 		CurrencyName:     req.Currency.Name,
 		CurrencySymbol:   req.Currency.Symbol,
 		IsDefaultAccount: req.IsDefaultAccount,
-		ProviderUsername: req.Credentials.Username,
-		ProviderPassword: req.Credentials.Password,
-		DeviceID:         req.DeviceInfo.DeviceID,
+		ProviderUsername: username,
+		ProviderPassword: password,
+		DeviceID:         deviceID,
 	}
 
 	if err := h.db.Create(&account).Error; err != nil {
@@ -252,9 +315,13 @@ func (h *LinkedAccountHandler) GetLinkedAccounts(c *gin.Context) {
 
 	log.Printf("[GET-ACCOUNTS] Found %d accounts for user %s", len(accounts), userID)
 
+	balances := h.loadCashBalances(accounts)
 	response := make([]accountResponse, len(accounts))
 	for i, account := range accounts {
 		response[i] = *h.toAccountResponse(&account)
+		if balance, ok := balances[account.ID]; ok {
+			response[i].Balance = &balance
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"accounts": response})
@@ -312,7 +379,11 @@ func (h *LinkedAccountHandler) GetLinkedAccount(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, h.toAccountResponse(&account))
+	response := h.toAccountResponse(&account)
+	if balance, ok := h.loadCashBalances([]models.LinkedAccount{account})[account.ID]; ok {
+		response.Balance = &balance
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // UnlinkAccount removes a linked account
@@ -496,11 +567,20 @@ func (h *LinkedAccountHandler) RefreshAccount(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement actual provider refresh logic here
-	// For now, just update the LastSyncAt timestamp
-	now := time.Now()
-	account.LastSyncAt = &now
-	if err := h.db.Save(&account).Error; err != nil {
+	if !account.Provider.RequiresCredentials() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "NOT_SYNCABLE",
+			"message": "Cash accounts have no provider to sync with",
+		}})
+		return
+	}
+
+	// TODO: Fetch transactions from the provider API here. Until then the
+	// ingestion run only records the sync and bumps LastSyncAt.
+	var fetched []models.ProviderTransaction
+	result, err := h.ingestor.Ingest(&account, models.SyncSourceProvider, fetched)
+	if err != nil {
+		log.Printf("[REFRESH-ACCOUNT] Ingestion failed for account %s: %v", account.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
 			"code":    "INTERNAL_ERROR",
 			"message": "Failed to refresh account",
@@ -511,10 +591,47 @@ func (h *LinkedAccountHandler) RefreshAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"id":         account.ID,
 		"lastSyncAt": account.LastSyncAt,
-		"status":     "SUCCESS",
+		"status":     models.AccountSyncSuccess,
+		"created":    len(result.Created),
+		"duplicates": result.Duplicates,
 	})
 }
 
+// loadCashBalances returns the balance of each cash account in accounts,
+// computed from its manual transactions. Other accounts are skipped: their
+// balance is whatever the provider last reported.
+func (h *LinkedAccountHandler) loadCashBalances(accounts []models.LinkedAccount) map[uuid.UUID]float64 {
+	balances := make(map[uuid.UUID]float64)
+	var ids []uuid.UUID
+	for _, account := range accounts {
+		if account.Provider == models.ProviderCash {
+			ids = append(ids, account.ID)
+			balances[account.ID] = 0
+		}
+	}
+	if len(ids) == 0 {
+		return balances
+	}
+
+	var rows []struct {
+		LinkedAccountID uuid.UUID
+		Balance         float64
+	}
+	if err := h.db.Model(&models.ProviderTransaction{}).
+		Select("linked_account_id, SUM(CASE WHEN transaction_type = ? THEN amount ELSE -amount END) AS balance",
+			models.TransactionTypeCredit).
+		Where("linked_account_id IN ?", ids).
+		Group("linked_account_id").
+		Scan(&rows).Error; err != nil {
+		log.Printf("[CASH-BALANCE] Failed to compute balances: %v", err)
+		return map[uuid.UUID]float64{}
+	}
+	for _, row := range rows {
+		balances[row.LinkedAccountID] = row.Balance
+	}
+	return balances
+}
+
 // Helper function to convert LinkedAccount to accountResponse
 func (h *LinkedAccountHandler) toAccountResponse(account *models.LinkedAccount) *accountResponse {
 	response := &accountResponse{
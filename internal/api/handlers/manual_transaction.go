@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/alerts"
+	"github.com/moha/kaafipay-backend/internal/services/rules"
+	"github.com/moha/kaafipay-backend/internal/services/transactions"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// ManualTransactionHandler handles transactions entered by hand on cash accounts
+type ManualTransactionHandler struct {
+	db       *gorm.DB
+	repo     repository.TransactionRepository
+	ingestor *transactions.Ingestor
+	alerter  *alerts.Alerter
+}
+
+// NewManualTransactionHandler creates a new ManualTransactionHandler instance
+func NewManualTransactionHandler(db *gorm.DB, repo repository.TransactionRepository, ingestor *transactions.Ingestor, alerter *alerts.Alerter) *ManualTransactionHandler {
+	return &ManualTransactionHandler{db: db, repo: repo, ingestor: ingestor, alerter: alerter}
+}
+
+type manualTransactionRequest struct {
+	AccountID         uuid.UUID              `json:"accountId" binding:"required"`
+	Type              models.TransactionType `json:"type" binding:"required"`
+	Amount            float64                `json:"amount" binding:"required,gt=0"`
+	Currency          string                 `json:"currency"`
+	Description       string                 `json:"description" binding:"max=500"`
+	MerchantName      string                 `json:"merchantName" binding:"max=255"`
+	CounterpartyName  string                 `json:"counterpartyName" binding:"max=255"`
+	CounterpartyPhone string                 `json:"counterpartyPhone" binding:"max=50"`
+	TransactionDate   *time.Time             `json:"transactionDate"`
+}
+
+type updateManualTransactionRequest struct {
+	Type              *models.TransactionType `json:"type"`
+	Amount            *float64                `json:"amount" binding:"omitempty,gt=0"`
+	Description       *string                 `json:"description" binding:"omitempty,max=500"`
+	MerchantName      *string                 `json:"merchantName" binding:"omitempty,max=255"`
+	CounterpartyName  *string                 `json:"counterpartyName" binding:"omitempty,max=255"`
+	CounterpartyPhone *string                 `json:"counterpartyPhone" binding:"omitempty,max=50"`
+	TransactionDate   *time.Time              `json:"transactionDate"`
+}
+
+// CreateManualTransaction records a cash transaction. It goes through the
+// same ingestion path as synced transactions so budgets and reports treat
+// both alike.
+func (h *ManualTransactionHandler) CreateManualTransaction(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req manualTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+	req.Type = models.TransactionType(strings.ToUpper(string(req.Type)))
+	if !req.Type.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "type must be CREDIT or DEBIT",
+		}})
+		return
+	}
+
+	var account models.LinkedAccount
+	if err := h.db.Where("id = ? AND user_id = ?", req.AccountID, userID).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Account not found",
+		}})
+		return
+	}
+	if account.Provider != models.ProviderCash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+			"code":    "NOT_CASH_ACCOUNT",
+			"message": "Manual transactions can only be added to cash accounts",
+		}})
+		return
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = strings.ToUpper(account.CurrencyCode)
+	}
+	if len(currency) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "currency must be a three letter code",
+		}})
+		return
+	}
+
+	date := time.Now()
+	if req.TransactionDate != nil {
+		date = *req.TransactionDate
+	}
+
+	txn := models.ProviderTransaction{
+		ProviderTransactionID: models.ManualTransactionPrefix + uuid.NewString(),
+		TransactionType:       req.Type,
+		Amount:                req.Amount,
+		Currency:              currency,
+		Description:           strings.TrimSpace(req.Description),
+		MerchantName:          strings.TrimSpace(req.MerchantName),
+		CounterpartyName:      strings.TrimSpace(req.CounterpartyName),
+		CounterpartyPhone:     strings.TrimSpace(req.CounterpartyPhone),
+		TransactionDate:       date,
+	}
+	if metadata, err := json.Marshal(map[string]string{"source": "manual"}); err == nil {
+		txn.ProviderMetadata = models.JSON(metadata)
+	}
+
+	result, err := h.ingestor.Ingest(&account, models.SyncSourceManual, []models.ProviderTransaction{txn})
+	if err != nil || len(result.Created) == 0 {
+		log.Printf("[CREATE-MANUAL-TRANSACTION] Ingestion failed for account %s: %v", account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to create transaction",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": result.Created[0]})
+}
+
+// UpdateManualTransaction edits a manual transaction and runs the user's
+// rules on it again, as an edit can change which category it belongs to.
+// Synced transactions belong to the provider and cannot be edited.
+func (h *ManualTransactionHandler) UpdateManualTransaction(c *gin.Context) {
+	txn, ok := h.findManual(c)
+	if !ok {
+		return
+	}
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req updateManualTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Type != nil {
+		txnType := models.TransactionType(strings.ToUpper(string(*req.Type)))
+		if !txnType.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "type must be CREDIT or DEBIT",
+			}})
+			return
+		}
+		updates["transaction_type"] = string(txnType)
+	}
+	if req.Amount != nil {
+		updates["amount"] = *req.Amount
+	}
+	if req.Description != nil {
+		updates["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.MerchantName != nil {
+		updates["merchant_name"] = strings.TrimSpace(*req.MerchantName)
+	}
+	if req.CounterpartyName != nil {
+		updates["counterparty_name"] = strings.TrimSpace(*req.CounterpartyName)
+	}
+	if req.CounterpartyPhone != nil {
+		updates["counterparty_phone"] = strings.TrimSpace(*req.CounterpartyPhone)
+	}
+	if req.TransactionDate != nil {
+		updates["transaction_date"] = *req.TransactionDate
+	}
+
+	if len(updates) > 0 {
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(txn).Updates(updates).Error; err != nil {
+				return err
+			}
+			if err := tx.First(txn, "id = ?", txn.ID).Error; err != nil {
+				return err
+			}
+
+			// Manual transactions have no provider category, so the system
+			// category is worked out again along with the budget category
+			evaluator, err := rules.Load(tx, userID)
+			if err != nil {
+				return err
+			}
+			txn.CategoryID = nil
+			evaluator.Apply(txn)
+			return tx.Model(&models.ProviderTransaction{}).Where("id = ?", txn.ID).Updates(map[string]interface{}{
+				"budget_category_id": txn.BudgetCategoryID,
+				"matched_rule":       txn.MatchedRule,
+				"category_id":        txn.CategoryID,
+			}).Error
+		})
+		if err != nil {
+			log.Printf("[UPDATE-MANUAL-TRANSACTION] Failed to update transaction %s: %v", txn.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to update transaction",
+			}})
+			return
+		}
+
+		// Alerts are checked in the background, as after ingestion
+		go h.alerter.Check(userID, []models.ProviderTransaction{*txn})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": txn})
+}
+
+// DeleteManualTransaction removes a manual transaction
+func (h *ManualTransactionHandler) DeleteManualTransaction(c *gin.Context) {
+	txn, ok := h.findManual(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&models.ProviderTransaction{}, "id = ?", txn.ID).Error; err != nil {
+		log.Printf("[DELETE-MANUAL-TRANSACTION] Failed to delete transaction %s: %v", txn.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to delete transaction",
+		}})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// findManual loads the transaction named in the path and checks that the
+// user owns it and that it was entered by hand
+func (h *ManualTransactionHandler) findManual(c *gin.Context) (*models.ProviderTransaction, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid transaction ID",
+		}})
+		return nil, false
+	}
+
+	txn, err := h.repo.Get(userID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "Transaction not found",
+			}})
+		} else {
+			log.Printf("[MANUAL-TRANSACTION] Failed to fetch transaction %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch transaction",
+			}})
+		}
+		return nil, false
+	}
+
+	if !txn.IsManual() {
+		c.JSON(http.StatusForbidden, gin.H{"error": gin.H{
+			"code":    "NOT_MANUAL_TRANSACTION",
+			"message": "Only manually entered transactions can be changed",
+		}})
+		return nil, false
+	}
+	return txn, true
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/ussd"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// PaymentIntentHandler starts mobile-money payments by handing the app the
+// USSD string to dial, and tracks them until the payment is seen
+type PaymentIntentHandler struct {
+	db      *gorm.DB
+	intents *ussd.Intents
+}
+
+// NewPaymentIntentHandler creates a new PaymentIntentHandler instance
+func NewPaymentIntentHandler(db *gorm.DB, intents *ussd.Intents) *PaymentIntentHandler {
+	return &PaymentIntentHandler{db: db, intents: intents}
+}
+
+type createPaymentIntentRequest struct {
+	RecipientNumber string  `json:"recipientNumber" binding:"required,min=7,max=20"`
+	Amount          float64 `json:"amount" binding:"required,gt=0"`
+	Note            string  `json:"note" binding:"max=255"`
+}
+
+// CreatePaymentIntent returns the dial string paying the recipient from the
+// account and starts watching the account for the payment
+func (h *PaymentIntentHandler) CreatePaymentIntent(c *gin.Context) {
+	account, ok := h.loadAccount(c, "[CREATE-PAYMENT-INTENT]")
+	if !ok {
+		return
+	}
+
+	var req createPaymentIntentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	intent, err := h.intents.Create(account, ussd.IntentInput{
+		RecipientNumber: req.RecipientNumber,
+		Amount:          req.Amount,
+		Note:            req.Note,
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, ussd.ErrUnsupportedProvider):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+			"code":    "UNSUPPORTED_PROVIDER",
+			"message": "USSD payments are not supported for this provider",
+		}})
+		return
+	case errors.Is(err, ussd.ErrInvalidNumber):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{"recipientNumber": {err.Error()}},
+		}})
+		return
+	case errors.Is(err, ussd.ErrInvalidAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{"amount": {err.Error()}},
+		}})
+		return
+	default:
+		log.Printf("[CREATE-PAYMENT-INTENT] Failed to create intent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to create payment intent",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": intent})
+}
+
+// GetPaymentIntents returns the account's payment intents, newest first,
+// optionally filtered by ?status
+func (h *PaymentIntentHandler) GetPaymentIntents(c *gin.Context) {
+	account, ok := h.loadAccount(c, "[GET-PAYMENT-INTENTS]")
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.PaymentIntentPending, models.PaymentIntentCompleted,
+		models.PaymentIntentExpired, models.PaymentIntentCancelled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "status must be pending, completed, expired or cancelled",
+		}})
+		return
+	}
+
+	intents, err := h.intents.List(account.ID, status)
+	if err != nil {
+		log.Printf("[GET-PAYMENT-INTENTS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch payment intents",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": intents})
+}
+
+// GetPaymentIntent returns a single payment intent
+func (h *PaymentIntentHandler) GetPaymentIntent(c *gin.Context) {
+	account, ok := h.loadAccount(c, "[GET-PAYMENT-INTENT]")
+	if !ok {
+		return
+	}
+	intentID, ok := paymentIntentID(c)
+	if !ok {
+		return
+	}
+
+	intent, err := h.intents.Get(account.ID, intentID)
+	if err != nil {
+		respondPaymentIntentError(c, "[GET-PAYMENT-INTENT]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": intent})
+}
+
+// CancelPaymentIntent stops tracking a pending payment intent
+func (h *PaymentIntentHandler) CancelPaymentIntent(c *gin.Context) {
+	account, ok := h.loadAccount(c, "[CANCEL-PAYMENT-INTENT]")
+	if !ok {
+		return
+	}
+	intentID, ok := paymentIntentID(c)
+	if !ok {
+		return
+	}
+
+	intent, err := h.intents.Cancel(account.ID, intentID)
+	if err != nil {
+		respondPaymentIntentError(c, "[CANCEL-PAYMENT-INTENT]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": intent})
+}
+
+// loadAccount resolves the :id linked account, which must belong to the user
+func (h *PaymentIntentHandler) loadAccount(c *gin.Context, tag string) (*models.LinkedAccount, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return nil, false
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid account ID",
+		}})
+		return nil, false
+	}
+
+	var account models.LinkedAccount
+	err = h.db.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Linked account not found",
+		}})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("%s Database query failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch linked account",
+		}})
+		return nil, false
+	}
+	return &account, true
+}
+
+// paymentIntentID parses the :intentId parameter
+func paymentIntentID(c *gin.Context) (uuid.UUID, bool) {
+	intentID, err := uuid.Parse(c.Param("intentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid payment intent ID",
+		}})
+		return uuid.Nil, false
+	}
+	return intentID, true
+}
+
+// respondPaymentIntentError maps payment intent errors to responses
+func respondPaymentIntentError(c *gin.Context, tag string, err error) {
+	switch {
+	case errors.Is(err, ussd.ErrIntentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Payment intent not found",
+		}})
+	case errors.Is(err, ussd.ErrNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "INTENT_NOT_PENDING",
+			"message": err.Error(),
+		}})
+	default:
+		log.Printf("%s Payment intent failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to process payment intent",
+		}})
+	}
+}
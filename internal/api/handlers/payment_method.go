@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// PaymentMethodHandler manages the bank accounts, cards and mobile-money
+// wallets a user pays with
+type PaymentMethodHandler struct {
+	db *gorm.DB
+}
+
+// NewPaymentMethodHandler creates a new PaymentMethodHandler instance
+func NewPaymentMethodHandler(db *gorm.DB) *PaymentMethodHandler {
+	return &PaymentMethodHandler{db: db}
+}
+
+type createPaymentMethodRequest struct {
+	Type          string `json:"type" binding:"required,oneof=bank_account card mobile_money"`
+	Provider      string `json:"provider" binding:"required,max=50"`
+	AccountNumber string `json:"accountNumber" binding:"required,max=100"`
+	AccountName   string `json:"accountName" binding:"required,max=100"`
+	ExpiryMonth   int    `json:"expiryMonth"`
+	ExpiryYear    int    `json:"expiryYear"`
+	IsDefault     bool   `json:"isDefault"`
+}
+
+type updatePaymentMethodRequest struct {
+	AccountName *string `json:"accountName" binding:"omitempty,max=100"`
+	Status      *string `json:"status" binding:"omitempty,oneof=active inactive"`
+	ExpiryMonth *int    `json:"expiryMonth"`
+	ExpiryYear  *int    `json:"expiryYear"`
+	IsDefault   *bool   `json:"isDefault"`
+}
+
+type paymentMethodResponse struct {
+	*models.PaymentMethod
+	AccountNumber string `json:"accountNumber"`
+}
+
+func toPaymentMethodResponse(m *models.PaymentMethod) paymentMethodResponse {
+	return paymentMethodResponse{PaymentMethod: m, AccountNumber: m.MaskedAccountNumber()}
+}
+
+// GetPaymentMethods returns the user's payment methods, optionally filtered
+// by ?type, defaults first
+func (h *PaymentMethodHandler) GetPaymentMethods(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	query := h.db.Where("user_id = ? AND status <> ?", userID, models.PaymentMethodDeleted)
+	if t := c.Query("type"); t != "" {
+		if !models.IsValidPaymentMethodType(t) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "type must be bank_account, card or mobile_money",
+			}})
+			return
+		}
+		query = query.Where("type = ?", t)
+	}
+
+	var methods []models.PaymentMethod
+	if err := query.Order("type ASC").Order("is_default DESC").Order("created_at ASC").Find(&methods).Error; err != nil {
+		log.Printf("[GET-PAYMENT-METHODS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch payment methods",
+		}})
+		return
+	}
+
+	response := make([]paymentMethodResponse, len(methods))
+	for i := range methods {
+		response[i] = toPaymentMethodResponse(&methods[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// GetPaymentMethod returns a single payment method
+func (h *PaymentMethodHandler) GetPaymentMethod(c *gin.Context) {
+	method, ok := h.loadMethod(c, "[GET-PAYMENT-METHOD]")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": toPaymentMethodResponse(method)})
+}
+
+// CreatePaymentMethod adds a payment method. The first active method of a
+// type becomes its default. Adding a deleted method again restores it.
+func (h *PaymentMethodHandler) CreatePaymentMethod(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req createPaymentMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	method := models.PaymentMethod{
+		UserID:        userID,
+		Type:          req.Type,
+		Provider:      strings.TrimSpace(req.Provider),
+		AccountNumber: req.AccountNumber,
+		AccountName:   strings.TrimSpace(req.AccountName),
+		Status:        models.PaymentMethodActive,
+	}
+	if method.Type == models.PaymentMethodMobileMoney {
+		method.Provider = strings.ToUpper(method.Provider)
+	}
+	var card *models.CardDetails
+	if method.Type == models.PaymentMethodCard {
+		card = &models.CardDetails{ExpiryMonth: req.ExpiryMonth, ExpiryYear: req.ExpiryYear}
+	}
+	if err := method.NormalizeAccountNumber(card); !respondPaymentMethodValidation(c, err) {
+		return
+	}
+	if err := method.Validate(card); !respondPaymentMethodValidation(c, err) {
+		return
+	}
+	if card != nil {
+		if card.Expired(time.Now()) {
+			respondPaymentMethodValidation(c, models.ValidationError{Field: "expiry", Message: "Card has expired"})
+			return
+		}
+		method.Metadata, _ = json.Marshal(card)
+	}
+	method.UpdateFingerprint(card)
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.PaymentMethod
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND type = ? AND fingerprint = ?", userID, method.Type, method.Fingerprint).
+			First(&existing).Error
+		switch {
+		case err == nil && existing.Status != models.PaymentMethodDeleted:
+			return errPaymentMethodExists
+		case err == nil:
+			method.ID = existing.ID
+			method.CreatedAt = existing.CreatedAt
+			if err := tx.Select("provider", "account_name", "metadata", "status", "is_default").
+				Save(&method).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&method).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if !req.IsDefault {
+			var defaults int64
+			if err := tx.Model(&models.PaymentMethod{}).
+				Where("user_id = ? AND type = ? AND is_default", userID, method.Type).
+				Count(&defaults).Error; err != nil {
+				return err
+			}
+			if defaults > 0 {
+				return nil
+			}
+		}
+		return setDefaultPaymentMethod(tx, &method)
+	})
+	if errors.Is(err, errPaymentMethodExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "PAYMENT_METHOD_EXISTS",
+			"message": "This payment method has already been added",
+		}})
+		return
+	}
+	if err != nil {
+		log.Printf("[CREATE-PAYMENT-METHOD] Failed to create payment method: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to create payment method",
+		}})
+		return
+	}
+
+	log.Printf("[CREATE-PAYMENT-METHOD] User %s added %s payment method %s", userID, method.Type, method.ID)
+	c.JSON(http.StatusCreated, gin.H{"data": toPaymentMethodResponse(&method)})
+}
+
+// UpdatePaymentMethod changes a method's name, status, card expiry or
+// default flag. Deactivating the default passes it to another method.
+func (h *PaymentMethodHandler) UpdatePaymentMethod(c *gin.Context) {
+	method, ok := h.loadMethod(c, "[UPDATE-PAYMENT-METHOD]")
+	if !ok {
+		return
+	}
+
+	var req updatePaymentMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	if req.AccountName != nil {
+		method.AccountName = strings.TrimSpace(*req.AccountName)
+	}
+	if req.Status != nil {
+		method.Status = *req.Status
+	}
+	card := method.CardDetails()
+	if req.ExpiryMonth != nil || req.ExpiryYear != nil {
+		if card == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request parameters",
+				"details": map[string][]string{"expiry": {"Only cards have an expiry"}},
+			}})
+			return
+		}
+		if req.ExpiryMonth != nil {
+			card.ExpiryMonth = *req.ExpiryMonth
+		}
+		if req.ExpiryYear != nil {
+			card.ExpiryYear = *req.ExpiryYear
+		}
+		if card.Expired(time.Now()) {
+			respondPaymentMethodValidation(c, models.ValidationError{Field: "expiry", Message: "Card has expired"})
+			return
+		}
+		method.Metadata, _ = json.Marshal(card)
+	}
+	if err := method.Validate(card); !respondPaymentMethodValidation(c, err) {
+		return
+	}
+	method.UpdateFingerprint(card)
+	if req.IsDefault != nil && *req.IsDefault && method.Status != models.PaymentMethodActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{"isDefault": {"Only an active payment method can be the default"}},
+		}})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := claimPaymentMethodFingerprint(tx, method); err != nil {
+			return err
+		}
+		if err := tx.Model(method).Select("account_name", "status", "metadata", "fingerprint").Updates(method).Error; err != nil {
+			return err
+		}
+		switch {
+		case method.Status != models.PaymentMethodActive || (req.IsDefault != nil && !*req.IsDefault):
+			if method.IsDefault {
+				return handOverDefaultPaymentMethod(tx, method)
+			}
+		case req.IsDefault != nil && *req.IsDefault:
+			return setDefaultPaymentMethod(tx, method)
+		}
+		return nil
+	})
+	if errors.Is(err, errPaymentMethodExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "PAYMENT_METHOD_EXISTS",
+			"message": "This payment method has already been added",
+		}})
+		return
+	}
+	if err != nil {
+		log.Printf("[UPDATE-PAYMENT-METHOD] Failed to update payment method %s: %v", method.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to update payment method",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": toPaymentMethodResponse(method)})
+}
+
+// SetDefaultPaymentMethod makes the method the default for its type
+func (h *PaymentMethodHandler) SetDefaultPaymentMethod(c *gin.Context) {
+	method, ok := h.loadMethod(c, "[SET-DEFAULT-PAYMENT-METHOD]")
+	if !ok {
+		return
+	}
+	if method.Status != models.PaymentMethodActive {
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "PAYMENT_METHOD_INACTIVE",
+			"message": "Only an active payment method can be the default",
+		}})
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return setDefaultPaymentMethod(tx, method)
+	}); err != nil {
+		log.Printf("[SET-DEFAULT-PAYMENT-METHOD] Failed to set default %s: %v", method.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to update payment method",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": toPaymentMethodResponse(method)})
+}
+
+// DeletePaymentMethod marks a payment method deleted. If it was the
+// default, the most recently added active method of its type takes over.
+func (h *PaymentMethodHandler) DeletePaymentMethod(c *gin.Context) {
+	method, ok := h.loadMethod(c, "[DELETE-PAYMENT-METHOD]")
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		wasDefault := method.IsDefault
+		if err := tx.Model(method).Updates(map[string]interface{}{
+			"status":     models.PaymentMethodDeleted,
+			"is_default": false,
+		}).Error; err != nil {
+			return err
+		}
+		if wasDefault {
+			return handOverDefaultPaymentMethod(tx, method)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[DELETE-PAYMENT-METHOD] Failed to delete payment method %s: %v", method.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to delete payment method",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"id": method.ID, "deleted": true}})
+}
+
+var errPaymentMethodExists = errors.New("payment method already exists")
+
+// claimPaymentMethodFingerprint makes sure no other method of the user has
+// method's fingerprint, as happens when a card's expiry is changed to match
+// another card. A deleted method with it is removed, since this one now
+// stands for the same card.
+func claimPaymentMethodFingerprint(tx *gorm.DB, method *models.PaymentMethod) error {
+	var other models.PaymentMethod
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND type = ? AND fingerprint = ? AND id <> ?",
+			method.UserID, method.Type, method.Fingerprint, method.ID).
+		First(&other).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil
+	case err != nil:
+		return err
+	case other.Status != models.PaymentMethodDeleted:
+		return errPaymentMethodExists
+	}
+	return tx.Delete(&other).Error
+}
+
+// setDefaultPaymentMethod makes method the user's only default of its type.
+// The user's methods of that type are locked first so concurrent changes
+// queue behind each other.
+func setDefaultPaymentMethod(tx *gorm.DB, method *models.PaymentMethod) error {
+	var locked []models.PaymentMethod
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("user_id = ? AND type = ?", method.UserID, method.Type).
+		Find(&locked).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.PaymentMethod{}).
+		Where("user_id = ? AND type = ? AND id <> ? AND is_default", method.UserID, method.Type, method.ID).
+		Update("is_default", false).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.PaymentMethod{}).Where("id = ?", method.ID).
+		Update("is_default", true).Error; err != nil {
+		return err
+	}
+	method.IsDefault = true
+	return nil
+}
+
+// handOverDefaultPaymentMethod clears method's default flag and gives it to
+// the most recently added other active method of its type, if there is one
+func handOverDefaultPaymentMethod(tx *gorm.DB, method *models.PaymentMethod) error {
+	if err := tx.Model(&models.PaymentMethod{}).Where("id = ?", method.ID).
+		Update("is_default", false).Error; err != nil {
+		return err
+	}
+	method.IsDefault = false
+
+	var next models.PaymentMethod
+	err := tx.Where("user_id = ? AND type = ? AND id <> ? AND status = ?",
+		method.UserID, method.Type, method.ID, models.PaymentMethodActive).
+		Order("created_at DESC").
+		First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return setDefaultPaymentMethod(tx, &next)
+}
+
+// loadMethod resolves the :id payment method, which must belong to the user
+// and not be deleted
+func (h *PaymentMethodHandler) loadMethod(c *gin.Context, tag string) (*models.PaymentMethod, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return nil, false
+	}
+
+	methodID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid payment method ID",
+		}})
+		return nil, false
+	}
+
+	var method models.PaymentMethod
+	err = h.db.Where("id = ? AND user_id = ? AND status <> ?", methodID, userID, models.PaymentMethodDeleted).
+		First(&method).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Payment method not found",
+		}})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("%s Database query failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch payment method",
+		}})
+		return nil, false
+	}
+	return &method, true
+}
+
+// respondPaymentMethodValidation responds with err when it is a validation
+// error and reports whether the request may continue
+func respondPaymentMethodValidation(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				validationErr.Field: {validationErr.Message},
+			},
+		}})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+		"code":    "INTERNAL_ERROR",
+		"message": "An unexpected error occurred",
+	}})
+	return false
+}
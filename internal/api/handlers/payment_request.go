@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/services/payrequests"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// PaymentRequestHandler lets users ask each other for money through a
+// shareable link, and pay or decline the requests they receive
+type PaymentRequestHandler struct {
+	requests *payrequests.Service
+	limits   *limits.Policy
+}
+
+// NewPaymentRequestHandler creates a new PaymentRequestHandler instance
+func NewPaymentRequestHandler(service *payrequests.Service, policy *limits.Policy) *PaymentRequestHandler {
+	return &PaymentRequestHandler{requests: service, limits: policy}
+}
+
+type createPaymentRequestRequest struct {
+	Amount     float64    `json:"amount" binding:"required,gt=0"`
+	Currency   string     `json:"currency" binding:"omitempty,len=3"`
+	Note       string     `json:"note" binding:"max=255"`
+	PayerPhone string     `json:"payerPhone" binding:"omitempty,min=9,max=15"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+type payPaymentRequestRequest struct {
+	Method          string `json:"method" binding:"required,oneof=wallet linked_account"`
+	LinkedAccountID string `json:"linkedAccountId" binding:"required_if=Method linked_account,omitempty,uuid"`
+	Reference       string `json:"reference" binding:"max=100"`
+}
+
+// CreatePaymentRequest asks for money. The response carries the link to
+// share and the payload to show as a QR code.
+func (h *PaymentRequestHandler) CreatePaymentRequest(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req createPaymentRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	input := payrequests.CreateInput{
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		Note:       req.Note,
+		PayerPhone: req.PayerPhone,
+	}
+	if req.ExpiresAt != nil {
+		input.ExpiresIn = time.Until(*req.ExpiresAt)
+		if input.ExpiresIn <= 0 {
+			input.ExpiresIn = -1
+		}
+	}
+
+	request, err := h.requests.Create(userID, input)
+	if err != nil {
+		respondPaymentRequestError(c, "[CREATE-PAYMENT-REQUEST]", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": request})
+}
+
+// GetPaymentRequests returns the requests the user sent, or received with
+// ?role=received, optionally filtered by ?status
+func (h *PaymentRequestHandler) GetPaymentRequests(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	received := false
+	switch c.Query("role") {
+	case "", "sent":
+	case "received":
+		received = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "role must be sent or received",
+		}})
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.PaymentRequestPending, models.PaymentRequestPaid, models.PaymentRequestDeclined,
+		models.PaymentRequestExpired, models.PaymentRequestCancelled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "status must be pending, paid, declined, expired or cancelled",
+		}})
+		return
+	}
+
+	requests, err := h.requests.List(userID, received, status)
+	if err != nil {
+		log.Printf("[GET-PAYMENT-REQUESTS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch payment requests",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": requests})
+}
+
+// GetPaymentRequest returns a request the user made or received
+func (h *PaymentRequestHandler) GetPaymentRequest(c *gin.Context) {
+	userID, requestID, ok := paymentRequestParams(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.requests.Get(userID, requestID)
+	if err != nil {
+		respondPaymentRequestError(c, "[GET-PAYMENT-REQUEST]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// CancelPaymentRequest withdraws one of the user's pending requests
+func (h *PaymentRequestHandler) CancelPaymentRequest(c *gin.Context) {
+	userID, requestID, ok := paymentRequestParams(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.requests.Cancel(userID, requestID)
+	if err != nil {
+		respondPaymentRequestError(c, "[CANCEL-PAYMENT-REQUEST]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// MarkPaymentRequestPaid records that the money arrived outside KaafiPay
+func (h *PaymentRequestHandler) MarkPaymentRequestPaid(c *gin.Context) {
+	userID, requestID, ok := paymentRequestParams(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.requests.MarkPaid(userID, requestID)
+	if err != nil {
+		respondPaymentRequestError(c, "[MARK-PAYMENT-REQUEST-PAID]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// RemindPaymentRequest sends the payer a WhatsApp reminder
+func (h *PaymentRequestHandler) RemindPaymentRequest(c *gin.Context) {
+	userID, requestID, ok := paymentRequestParams(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.requests.Remind(userID, requestID)
+	if err != nil {
+		respondPaymentRequestError(c, "[REMIND-PAYMENT-REQUEST]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// OpenPaymentLink returns the request behind a shared link
+func (h *PaymentRequestHandler) OpenPaymentLink(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	request, err := h.requests.Open(userID, c.Param("token"))
+	if err != nil {
+		respondPaymentRequestError(c, "[OPEN-PAYMENT-LINK]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// PayPaymentLink pays the request behind a link. Paying from the wallet
+// returns a pending transfer to confirm with POST /transfers/:id/confirm;
+// paying from a linked account records the payment for the requester to
+// confirm.
+func (h *PaymentRequestHandler) PayPaymentLink(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req payPaymentRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	input := payrequests.PayInput{Method: req.Method, Reference: req.Reference}
+	if req.LinkedAccountID != "" {
+		input.LinkedAccountID = uuid.MustParse(req.LinkedAccountID)
+	}
+	if req.Method == models.PaidViaWallet {
+		request, err := h.requests.Open(userID, c.Param("token"))
+		if err != nil {
+			respondPaymentRequestError(c, "[PAY-PAYMENT-LINK]", err)
+			return
+		}
+		if !checkTransferLimit(c, h.limits, "[PAY-PAYMENT-LINK]", userID, request.Amount, request.Currency) {
+			return
+		}
+	}
+
+	request, transfer, err := h.requests.Pay(userID, c.Param("token"), input)
+	if err != nil {
+		// Starting a wallet payment fails with the transfer service's errors
+		if _, _, ok := paymentRequestErrorStatus(err); !ok {
+			respondTransferError(c, "[PAY-PAYMENT-LINK]", err)
+			return
+		}
+		respondPaymentRequestError(c, "[PAY-PAYMENT-LINK]", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": gin.H{
+		"request":  request,
+		"transfer": transfer,
+	}})
+}
+
+// DeclinePaymentLink turns down a request addressed to the user
+func (h *PaymentRequestHandler) DeclinePaymentLink(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	request, err := h.requests.Decline(userID, c.Param("token"))
+	if err != nil {
+		respondPaymentRequestError(c, "[DECLINE-PAYMENT-LINK]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// paymentRequestParams resolves the user and the :id request ID
+func paymentRequestParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid payment request ID",
+		}})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, requestID, true
+}
+
+// respondPaymentRequestError maps payment request errors to responses
+func respondPaymentRequestError(c *gin.Context, tag string, err error) {
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				validationErr.Field: {validationErr.Message},
+			},
+		}})
+		return
+	}
+
+	status, code, ok := paymentRequestErrorStatus(err)
+	if !ok {
+		log.Printf("%s Payment request failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to process payment request",
+		}})
+		return
+	}
+
+	c.JSON(status, gin.H{"error": gin.H{
+		"code":    code,
+		"message": err.Error(),
+	}})
+}
+
+// paymentRequestErrorStatus returns the status and code for a payment
+// request service error, and false for any other error
+func paymentRequestErrorStatus(err error) (int, string, bool) {
+	var validationErr models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest, "VALIDATION_ERROR", true
+	case errors.Is(err, payrequests.ErrRequestNotFound):
+		return http.StatusNotFound, "NOT_FOUND", true
+	case errors.Is(err, payrequests.ErrExpired):
+		return http.StatusGone, "REQUEST_EXPIRED", true
+	case errors.Is(err, payrequests.ErrNotPending):
+		return http.StatusConflict, "REQUEST_NOT_PENDING", true
+	case errors.Is(err, payrequests.ErrAlreadyClaimed):
+		return http.StatusConflict, "PAYMENT_AWAITING_CONFIRMATION", true
+	case errors.Is(err, payrequests.ErrOwnRequest):
+		return http.StatusBadRequest, "OWN_REQUEST", true
+	case errors.Is(err, payrequests.ErrNotAddressed):
+		return http.StatusForbidden, "FORBIDDEN", true
+	case errors.Is(err, payrequests.ErrRemindTooSoon):
+		return http.StatusTooManyRequests, "REMINDER_TOO_SOON", true
+	case errors.Is(err, payrequests.ErrInvalidAccount):
+		return http.StatusUnprocessableEntity, "INVALID_ACCOUNT", true
+	}
+	return 0, "", false
+}
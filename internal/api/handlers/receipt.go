@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/receipts"
+	"github.com/moha/kaafipay-backend/internal/services/transactions"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const maxReceiptsPerRequest = 100
+
+// ReceiptHandler turns mobile-money SMS receipts into transactions
+type ReceiptHandler struct {
+	db       *gorm.DB
+	ingestor *transactions.Ingestor
+}
+
+// NewReceiptHandler creates a new ReceiptHandler instance
+func NewReceiptHandler(db *gorm.DB, ingestor *transactions.Ingestor) *ReceiptHandler {
+	return &ReceiptHandler{db: db, ingestor: ingestor}
+}
+
+type submitReceiptsRequest struct {
+	Receipts []struct {
+		Text       string     `json:"text" binding:"required"`
+		ReceivedAt *time.Time `json:"receivedAt"`
+	} `json:"receipts" binding:"required,min=1,dive"`
+}
+
+type receiptFailure struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// SubmitReceipts parses receipts for a linked account and stores them as transactions
+func (h *ReceiptHandler) SubmitReceipts(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid account ID",
+		}})
+		return
+	}
+
+	var req submitReceiptsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+	if len(req.Receipts) > maxReceiptsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Maximum 100 receipts per request",
+		}})
+		return
+	}
+
+	var account models.LinkedAccount
+	if err := h.db.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Account not found",
+		}})
+		return
+	}
+
+	if !receipts.Supports(account.Provider) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+			"code":    "UNSUPPORTED_PROVIDER",
+			"message": "Receipts are not supported for this provider",
+		}})
+		return
+	}
+
+	txns := make([]models.ProviderTransaction, 0, len(req.Receipts))
+	failures := make([]receiptFailure, 0)
+	for i, item := range req.Receipts {
+		receipt, err := receipts.Parse(account.Provider, item.Text)
+		if err != nil {
+			failures = append(failures, receiptFailure{Index: i, Message: err.Error()})
+			continue
+		}
+		txns = append(txns, receiptToTransaction(receipt, item.Text, item.ReceivedAt))
+	}
+
+	if len(txns) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+			"code":    "UNPARSEABLE_RECEIPTS",
+			"message": "None of the receipts could be parsed",
+			"details": failures,
+		}})
+		return
+	}
+
+	result, err := h.ingestor.Ingest(&account, models.SyncSourceReceipt, txns)
+	if err != nil {
+		log.Printf("[SUBMIT-RECEIPTS] Ingestion failed for account %s: %v", account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to store receipts",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"created":    result.Created,
+		"duplicates": result.Duplicates,
+		"failed":     failures,
+	}})
+}
+
+// receiptToTransaction maps a parsed receipt onto a provider transaction
+func receiptToTransaction(r *receipts.Receipt, text string, receivedAt *time.Time) models.ProviderTransaction {
+	date := time.Now()
+	switch {
+	case r.Date != nil:
+		date = *r.Date
+	case receivedAt != nil:
+		date = *receivedAt
+	}
+
+	counterparty := r.CounterpartyName
+	if counterparty == "" {
+		counterparty = r.CounterpartyNumber
+	}
+
+	var description string
+	switch {
+	case r.Kind == receipts.KindAirtime:
+		description = "Airtime top-up for " + counterparty
+	case r.Kind == receipts.KindPayment:
+		description = "Payment to " + counterparty
+	case r.Direction == models.TransactionTypeCredit:
+		description = "Received from " + counterparty
+	default:
+		description = "Sent to " + counterparty
+	}
+
+	txn := models.ProviderTransaction{
+		ProviderTransactionID: r.DedupKey(text),
+		TransactionType:       r.Direction,
+		Amount:                r.Amount,
+		Currency:              r.Currency,
+		Description:           strings.TrimSpace(description),
+		CounterpartyName:      r.CounterpartyName,
+		CounterpartyPhone:     r.CounterpartyNumber,
+		TransactionDate:       date,
+		BalanceAfter:          r.BalanceAfter,
+	}
+	if r.Kind == receipts.KindPayment {
+		txn.MerchantName = r.CounterpartyName
+	}
+
+	metadata, err := json.Marshal(map[string]string{
+		"source":    "sms_receipt",
+		"kind":      string(r.Kind),
+		"reference": r.Reference,
+		"rawText":   text,
+	})
+	if err == nil {
+		txn.ProviderMetadata = models.JSON(metadata)
+	}
+
+	return txn
+}
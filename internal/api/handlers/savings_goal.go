@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/goals"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// SavingsGoalHandler handles savings goals and their contributions
+type SavingsGoalHandler struct {
+	db      *gorm.DB
+	tracker *goals.Tracker
+}
+
+// NewSavingsGoalHandler creates a new SavingsGoalHandler instance
+func NewSavingsGoalHandler(db *gorm.DB, tracker *goals.Tracker) *SavingsGoalHandler {
+	return &SavingsGoalHandler{db: db, tracker: tracker}
+}
+
+type savingsGoalRequest struct {
+	Name            string     `json:"name"`
+	Icon            string     `json:"icon"`
+	TargetAmount    float64    `json:"targetAmount"`
+	Currency        string     `json:"currency"`
+	Deadline        string     `json:"deadline"`
+	LinkedAccountID *uuid.UUID `json:"linkedAccountId"`
+	Status          string     `json:"status"`
+}
+
+type goalContributionRequest struct {
+	Amount        float64 `json:"amount" binding:"required"`
+	Note          string  `json:"note" binding:"max=255"`
+	ContributedAt string  `json:"contributedAt"`
+}
+
+// savingsGoalResponse adds the computed progress to a goal
+type savingsGoalResponse struct {
+	*models.SavingsGoal
+	Progress *goals.Progress `json:"progress"`
+}
+
+// GetSavingsGoals returns the user's goals with their progress. Archived
+// goals are left out unless ?status=ARCHIVED asks for them.
+func (h *SavingsGoalHandler) GetSavingsGoals(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	query := h.db.Where("user_id = ?", userID)
+	switch status := strings.ToUpper(c.Query("status")); status {
+	case "":
+		query = query.Where("status <> ?", models.GoalStatusArchived)
+	case models.GoalStatusActive, models.GoalStatusAchieved, models.GoalStatusArchived:
+		query = query.Where("status = ?", status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "status must be ACTIVE, ACHIEVED or ARCHIVED",
+		}})
+		return
+	}
+
+	var savingsGoals []models.SavingsGoal
+	if err := query.Order("deadline ASC").Order("created_at ASC").Find(&savingsGoals).Error; err != nil {
+		log.Printf("[GET-SAVINGS-GOALS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch savings goals",
+		}})
+		return
+	}
+
+	now := time.Now()
+	response := make([]savingsGoalResponse, 0, len(savingsGoals))
+	for i := range savingsGoals {
+		progress, err := h.tracker.Progress(&savingsGoals[i], now)
+		if err != nil {
+			log.Printf("[GET-SAVINGS-GOALS] Progress of goal %s failed: %v", savingsGoals[i].ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to compute goal progress",
+			}})
+			return
+		}
+		response = append(response, savingsGoalResponse{SavingsGoal: &savingsGoals[i], Progress: progress})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// GetSavingsGoal returns a single goal with its progress
+func (h *SavingsGoalHandler) GetSavingsGoal(c *gin.Context) {
+	goal, ok := h.loadGoal(c, "[GET-SAVINGS-GOAL]")
+	if !ok {
+		return
+	}
+
+	progress, err := h.tracker.Progress(goal, time.Now())
+	if err != nil {
+		log.Printf("[GET-SAVINGS-GOAL] Progress of goal %s failed: %v", goal.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to compute goal progress",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": savingsGoalResponse{SavingsGoal: goal, Progress: progress}})
+}
+
+// CreateSavingsGoal creates a goal. Its currency defaults to the watched
+// account's currency, or the user's preferred currency without one.
+func (h *SavingsGoalHandler) CreateSavingsGoal(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req savingsGoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	goal := models.SavingsGoal{
+		UserID:          userID,
+		Name:            strings.TrimSpace(req.Name),
+		Icon:            req.Icon,
+		TargetAmount:    req.TargetAmount,
+		Currency:        strings.ToUpper(strings.TrimSpace(req.Currency)),
+		LinkedAccountID: req.LinkedAccountID,
+		Status:          models.GoalStatusActive,
+	}
+	if goal.Icon == "" {
+		goal.Icon = "piggy-bank"
+	}
+	if !h.applyDeadline(c, &goal, req.Deadline) {
+		return
+	}
+
+	if goal.Currency == "" {
+		var user models.User
+		if err := h.db.Select("id", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+			log.Printf("[CREATE-SAVINGS-GOAL] Failed to load user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to create savings goal",
+			}})
+			return
+		}
+		goal.Currency = strings.ToUpper(user.PreferredCurrency)
+	}
+	if !h.checkLinkedAccount(c, &goal, req.Currency == "") {
+		return
+	}
+	if goal.Currency == "" {
+		goal.Currency = "USD"
+	}
+
+	if !respondGoalValidation(c, goal.Validate()) {
+		return
+	}
+
+	if err := h.db.Create(&goal).Error; err != nil {
+		log.Printf("[CREATE-SAVINGS-GOAL] Database creation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to create savings goal",
+		}})
+		return
+	}
+	log.Printf("[CREATE-SAVINGS-GOAL] Created goal %s for user %s", goal.ID, userID)
+
+	// A goal watching an account may start part way there; those milestones
+	// are recorded without announcing them
+	progress, err := h.tracker.Track(&goal, time.Now(), false)
+	if err != nil {
+		log.Printf("[CREATE-SAVINGS-GOAL] Progress of goal %s failed: %v", goal.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": savingsGoalResponse{SavingsGoal: &goal, Progress: progress}})
+}
+
+// UpdateSavingsGoal updates the provided fields of a goal, except its
+// currency. A status of ARCHIVED shelves the goal and ACTIVE brings it back.
+func (h *SavingsGoalHandler) UpdateSavingsGoal(c *gin.Context) {
+	goal, ok := h.loadGoal(c, "[UPDATE-SAVINGS-GOAL]")
+	if !ok {
+		return
+	}
+
+	var req savingsGoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	retarget := false
+	if req.Name != "" {
+		goal.Name = strings.TrimSpace(req.Name)
+	}
+	if req.Icon != "" {
+		goal.Icon = req.Icon
+	}
+	if req.TargetAmount != 0 {
+		retarget = req.TargetAmount != goal.TargetAmount
+		goal.TargetAmount = req.TargetAmount
+	}
+	// Contributions are recorded in the goal's currency, so it stays fixed
+	if req.Currency != "" && !strings.EqualFold(strings.TrimSpace(req.Currency), goal.Currency) {
+		respondGoalValidation(c, models.ValidationError{Field: "currency", Message: "A goal's currency cannot be changed"})
+		return
+	}
+	if req.Deadline != "" && !h.applyDeadline(c, goal, req.Deadline) {
+		return
+	}
+	if req.LinkedAccountID != nil {
+		retarget = retarget || goal.LinkedAccountID == nil || *goal.LinkedAccountID != *req.LinkedAccountID
+		goal.LinkedAccountID = req.LinkedAccountID
+		if !h.checkLinkedAccount(c, goal, false) {
+			return
+		}
+	}
+	switch status := strings.ToUpper(req.Status); status {
+	case "":
+	case models.GoalStatusArchived:
+		goal.Status = models.GoalStatusArchived
+	case models.GoalStatusActive:
+		if goal.Status == models.GoalStatusArchived {
+			goal.Status = models.GoalStatusActive
+		}
+	default:
+		respondGoalValidation(c, models.ValidationError{Field: "status", Message: "Status must be ACTIVE or ARCHIVED"})
+		return
+	}
+
+	// A new target or source measures progress afresh; milestones already
+	// passed are recorded again below without being announced
+	if retarget {
+		goal.LastMilestone = 0
+		goal.AchievedAt = nil
+		if goal.Status == models.GoalStatusAchieved {
+			goal.Status = models.GoalStatusActive
+		}
+	}
+
+	if !respondGoalValidation(c, goal.Validate()) {
+		return
+	}
+
+	if err := h.db.Save(goal).Error; err != nil {
+		log.Printf("[UPDATE-SAVINGS-GOAL] Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to update savings goal",
+		}})
+		return
+	}
+
+	progress, err := h.tracker.Track(goal, time.Now(), false)
+	if err != nil {
+		log.Printf("[UPDATE-SAVINGS-GOAL] Progress of goal %s failed: %v", goal.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": savingsGoalResponse{SavingsGoal: goal, Progress: progress}})
+}
+
+// DeleteSavingsGoal deletes a goal and its contributions
+func (h *SavingsGoalHandler) DeleteSavingsGoal(c *gin.Context) {
+	goal, ok := h.loadGoal(c, "[DELETE-SAVINGS-GOAL]")
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(goal).Error; err != nil {
+		log.Printf("[DELETE-SAVINGS-GOAL] Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to delete savings goal",
+		}})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AddGoalContribution records money set aside for a goal, or taken back out
+// of it with a negative amount, and announces any milestone it reaches.
+// Goals that watch an account take their progress from its balance instead.
+func (h *SavingsGoalHandler) AddGoalContribution(c *gin.Context) {
+	goal, ok := h.loadGoal(c, "[ADD-GOAL-CONTRIBUTION]")
+	if !ok {
+		return
+	}
+
+	var req goalContributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	if goal.LinkedAccountID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "GOAL_TRACKS_ACCOUNT",
+			"message": "This goal follows its linked account's balance",
+		}})
+		return
+	}
+	if goal.Status == models.GoalStatusArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "GOAL_ARCHIVED",
+			"message": "Archived goals cannot take contributions",
+		}})
+		return
+	}
+
+	contribution := models.SavingsGoalContribution{
+		GoalID:        goal.ID,
+		UserID:        goal.UserID,
+		Amount:        utils.RoundMoney(req.Amount),
+		Note:          strings.TrimSpace(req.Note),
+		ContributedAt: time.Now(),
+	}
+	if req.ContributedAt != "" {
+		t, _, err := parseDateParam(req.ContributedAt)
+		if err != nil || t.After(time.Now()) {
+			respondGoalValidation(c, models.ValidationError{Field: "contributedAt", Message: "Must be a past date (YYYY-MM-DD) or RFC3339 timestamp"})
+			return
+		}
+		contribution.ContributedAt = t
+	}
+	if contribution.Amount == 0 {
+		respondGoalValidation(c, models.ValidationError{Field: "amount", Message: "Amount must not be 0"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the goal so concurrent withdrawals cannot overdraw it
+		if err := tx.Exec("SELECT id FROM savings_goals WHERE id = ? FOR UPDATE", goal.ID).Error; err != nil {
+			return err
+		}
+		if contribution.Amount < 0 {
+			var total float64
+			if err := tx.Model(&models.SavingsGoalContribution{}).
+				Select("COALESCE(SUM(amount), 0)").
+				Where("goal_id = ?", goal.ID).
+				Scan(&total).Error; err != nil {
+				return err
+			}
+			if total+contribution.Amount < 0 {
+				return errGoalOverdrawn
+			}
+		}
+		return tx.Create(&contribution).Error
+	})
+	if errors.Is(err, errGoalOverdrawn) {
+		respondGoalValidation(c, models.ValidationError{Field: "amount", Message: "Withdrawal is more than has been saved"})
+		return
+	}
+	if err != nil {
+		log.Printf("[ADD-GOAL-CONTRIBUTION] Failed for goal %s: %v", goal.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to record contribution",
+		}})
+		return
+	}
+
+	progress, err := h.tracker.Track(goal, time.Now(), true)
+	if err != nil {
+		log.Printf("[ADD-GOAL-CONTRIBUTION] Progress of goal %s failed: %v", goal.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{
+		"contribution": contribution,
+		"goal":         savingsGoalResponse{SavingsGoal: goal, Progress: progress},
+	}})
+}
+
+// GetGoalContributions returns a goal's contributions, newest first
+func (h *SavingsGoalHandler) GetGoalContributions(c *gin.Context) {
+	goal, ok := h.loadGoal(c, "[GET-GOAL-CONTRIBUTIONS]")
+	if !ok {
+		return
+	}
+
+	contributions := []models.SavingsGoalContribution{}
+	if err := h.db.Where("goal_id = ?", goal.ID).
+		Order("contributed_at DESC").Order("created_at DESC").
+		Find(&contributions).Error; err != nil {
+		log.Printf("[GET-GOAL-CONTRIBUTIONS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch contributions",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": contributions})
+}
+
+var errGoalOverdrawn = errors.New("withdrawal exceeds the amount saved")
+
+// loadGoal resolves the :id goal, which must belong to the user
+func (h *SavingsGoalHandler) loadGoal(c *gin.Context, tag string) (*models.SavingsGoal, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return nil, false
+	}
+
+	goalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid goal ID",
+		}})
+		return nil, false
+	}
+
+	var goal models.SavingsGoal
+	err = h.db.Where("id = ? AND user_id = ?", goalID, userID).First(&goal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Savings goal not found",
+		}})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("%s Database query failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch savings goal",
+		}})
+		return nil, false
+	}
+	return &goal, true
+}
+
+// applyDeadline parses a deadline date, which must not be in the past
+func (h *SavingsGoalHandler) applyDeadline(c *gin.Context, goal *models.SavingsGoal, value string) bool {
+	deadline, _, err := parseDateParam(value)
+	if err != nil {
+		return respondGoalValidation(c, models.ValidationError{Field: "deadline", Message: "Deadline must be a date (YYYY-MM-DD)"})
+	}
+	deadline = time.Date(deadline.Year(), deadline.Month(), deadline.Day(), 0, 0, 0, 0, time.UTC)
+	if deadline.Before(goals.Today(time.Now())) {
+		return respondGoalValidation(c, models.ValidationError{Field: "deadline", Message: "Deadline must not be in the past"})
+	}
+	goal.Deadline = deadline
+	return true
+}
+
+// checkLinkedAccount checks that the goal's account belongs to the user and
+// its balance can be converted into the goal's currency. With useCurrency
+// set the goal takes the account's currency.
+func (h *SavingsGoalHandler) checkLinkedAccount(c *gin.Context, goal *models.SavingsGoal, useCurrency bool) bool {
+	if goal.LinkedAccountID == nil {
+		return true
+	}
+
+	var account models.LinkedAccount
+	err := h.db.Select("id", "currency_code").
+		Where("id = ? AND user_id = ?", *goal.LinkedAccountID, goal.UserID).
+		First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return respondGoalValidation(c, models.ValidationError{Field: "linkedAccountId", Message: "Account must be one of your linked accounts"})
+	}
+	if err != nil {
+		log.Printf("[SAVINGS-GOAL] Failed to load account %s: %v", *goal.LinkedAccountID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "An unexpected error occurred",
+		}})
+		return false
+	}
+
+	if useCurrency && account.CurrencyCode != "" {
+		goal.Currency = strings.ToUpper(account.CurrencyCode)
+	}
+	if !h.tracker.CanConvert(account.CurrencyCode, goal.Currency) {
+		return respondGoalValidation(c, models.ValidationError{Field: "currency", Message: "No exchange rate between the account's currency and the goal's"})
+	}
+	return true
+}
+
+// respondGoalValidation responds with err when it is a validation error and
+// reports whether the request may continue
+func respondGoalValidation(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{
+				validationErr.Field: {validationErr.Message},
+			},
+		}})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+		"code":    "INTERNAL_ERROR",
+		"message": "An unexpected error occurred",
+	}})
+	return false
+}
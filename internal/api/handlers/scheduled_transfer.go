@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/schedules"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// ScheduledTransferHandler manages transfers that run later or repeatedly
+type ScheduledTransferHandler struct {
+	schedules *schedules.Service
+}
+
+// NewScheduledTransferHandler creates a new ScheduledTransferHandler instance
+func NewScheduledTransferHandler(service *schedules.Service) *ScheduledTransferHandler {
+	return &ScheduledTransferHandler{schedules: service}
+}
+
+type createScheduledTransferRequest struct {
+	RecipientPhone      string    `json:"recipientPhone" binding:"required,min=9,max=15"`
+	Amount              float64   `json:"amount" binding:"required,gt=0"`
+	Currency            string    `json:"currency" binding:"omitempty,len=3"`
+	Description         string    `json:"description" binding:"max=255"`
+	StartAt             time.Time `json:"startAt" binding:"required"`
+	Recurrence          string    `json:"recurrence" binding:"max=255"`
+	OnInsufficientFunds string    `json:"onInsufficientFunds" binding:"omitempty,oneof=skip retry"`
+}
+
+// CreateScheduledTransfer schedules a transfer to the user with the given
+// phone number. It does not run until confirmed with the code sent to the
+// sender.
+func (h *ScheduledTransferHandler) CreateScheduledTransfer(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req createScheduledTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	schedule, err := h.schedules.Create(userID, schedules.CreateInput{
+		RecipientPhone:      req.RecipientPhone,
+		Amount:              req.Amount,
+		Currency:            req.Currency,
+		Description:         req.Description,
+		StartAt:             req.StartAt,
+		Recurrence:          req.Recurrence,
+		OnInsufficientFunds: req.OnInsufficientFunds,
+	})
+	if err != nil {
+		respondScheduledTransferError(c, "[CREATE-SCHEDULED-TRANSFER]", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": schedule})
+}
+
+// ConfirmScheduledTransfer activates a new schedule with the sender's code
+func (h *ScheduledTransferHandler) ConfirmScheduledTransfer(c *gin.Context) {
+	userID, scheduleID, ok := scheduledTransferParams(c)
+	if !ok {
+		return
+	}
+
+	var req confirmTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+
+	schedule, err := h.schedules.Confirm(userID, scheduleID, req.Code)
+	if err != nil {
+		respondScheduledTransferError(c, "[CONFIRM-SCHEDULED-TRANSFER]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// GetScheduledTransfers returns the user's schedules, newest first,
+// optionally filtered by ?status
+func (h *ScheduledTransferHandler) GetScheduledTransfers(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.ScheduledTransferPendingConfirmation, models.ScheduledTransferActive,
+		models.ScheduledTransferPaused, models.ScheduledTransferCompleted, models.ScheduledTransferCancelled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "status must be pending_confirmation, active, paused, completed or cancelled",
+		}})
+		return
+	}
+
+	list, err := h.schedules.List(userID, status)
+	if err != nil {
+		log.Printf("[GET-SCHEDULED-TRANSFERS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch scheduled transfers",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// GetScheduledTransfer returns a single schedule
+func (h *ScheduledTransferHandler) GetScheduledTransfer(c *gin.Context) {
+	h.act(c, "[GET-SCHEDULED-TRANSFER]", h.schedules.Get)
+}
+
+// PauseScheduledTransfer stops a schedule running until it is resumed
+func (h *ScheduledTransferHandler) PauseScheduledTransfer(c *gin.Context) {
+	h.act(c, "[PAUSE-SCHEDULED-TRANSFER]", h.schedules.Pause)
+}
+
+// ResumeScheduledTransfer restarts a paused schedule from its next
+// occurrence
+func (h *ScheduledTransferHandler) ResumeScheduledTransfer(c *gin.Context) {
+	h.act(c, "[RESUME-SCHEDULED-TRANSFER]", h.schedules.Resume)
+}
+
+// SkipScheduledTransfer passes over a schedule's next occurrence
+func (h *ScheduledTransferHandler) SkipScheduledTransfer(c *gin.Context) {
+	h.act(c, "[SKIP-SCHEDULED-TRANSFER]", h.schedules.Skip)
+}
+
+// CancelScheduledTransfer stops a schedule for good
+func (h *ScheduledTransferHandler) CancelScheduledTransfer(c *gin.Context) {
+	h.act(c, "[CANCEL-SCHEDULED-TRANSFER]", h.schedules.Cancel)
+}
+
+// act applies a service method to the :id schedule and returns the result
+func (h *ScheduledTransferHandler) act(c *gin.Context, tag string,
+	fn func(userID, scheduleID uuid.UUID) (*models.ScheduledTransfer, error)) {
+	userID, scheduleID, ok := scheduledTransferParams(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := fn(userID, scheduleID)
+	if err != nil {
+		respondScheduledTransferError(c, tag, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// scheduledTransferParams resolves the user and the :id schedule ID
+func scheduledTransferParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	scheduleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid scheduled transfer ID",
+		}})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, scheduleID, true
+}
+
+// respondScheduledTransferError maps schedule errors to responses. Errors
+// shared with immediate transfers are answered the same way.
+func respondScheduledTransferError(c *gin.Context, tag string, err error) {
+	var status int
+	var code string
+	switch {
+	case errors.Is(err, schedules.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Scheduled transfer not found",
+		}})
+		return
+	case errors.Is(err, schedules.ErrInvalidRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{"recurrence": {err.Error()}},
+		}})
+		return
+	case errors.Is(err, schedules.ErrInvalidStart), errors.Is(err, schedules.ErrNoOccurrences):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+			"details": map[string][]string{"startAt": {err.Error()}},
+		}})
+		return
+	case errors.Is(err, schedules.ErrNotAwaitingCode):
+		status, code = http.StatusConflict, "SCHEDULE_NOT_PENDING"
+	case errors.Is(err, schedules.ErrNotActive):
+		status, code = http.StatusConflict, "SCHEDULE_NOT_ACTIVE"
+	case errors.Is(err, schedules.ErrNotPaused):
+		status, code = http.StatusConflict, "SCHEDULE_NOT_PAUSED"
+	case errors.Is(err, schedules.ErrFinished):
+		status, code = http.StatusConflict, "SCHEDULE_FINISHED"
+	case errors.Is(err, transfers.ErrTooManyAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{
+			"code":    "TOO_MANY_ATTEMPTS",
+			"message": "Too many incorrect codes; the scheduled transfer has been cancelled",
+		}})
+		return
+	default:
+		respondTransferError(c, tag, err)
+		return
+	}
+
+	c.JSON(status, gin.H{"error": gin.H{
+		"code":    code,
+		"message": err.Error(),
+	}})
+}
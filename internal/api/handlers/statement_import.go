@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/statements"
+	"github.com/moha/kaafipay-backend/internal/services/transactions"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const maxStatementSize = 5 << 20 // 5 MB
+
+// StatementImportHandler handles bank and wallet statement imports
+type StatementImportHandler struct {
+	db       *gorm.DB
+	importer *statements.Importer
+}
+
+// NewStatementImportHandler creates a new StatementImportHandler instance
+func NewStatementImportHandler(db *gorm.DB, importer *statements.Importer) *StatementImportHandler {
+	return &StatementImportHandler{db: db, importer: importer}
+}
+
+// PreviewImport parses an uploaded statement and returns a dry-run preview.
+// Expects multipart form fields: file, format (csv|ofx|qif, defaults to the
+// file extension), mapping (JSON, CSV only), dateFormat and currency.
+func (h *StatementImportHandler) PreviewImport(c *gin.Context) {
+	account, ok := h.findAccount(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxStatementSize+(1<<20))
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "A statement file is required",
+		}})
+		return
+	}
+	if fileHeader.Size > maxStatementSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": gin.H{
+			"code":    "FILE_TOO_LARGE",
+			"message": "Statement files must be 5 MB or smaller",
+		}})
+		return
+	}
+
+	format := statements.Format(strings.ToLower(c.PostForm("format")))
+	if format == "" {
+		format = statements.Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), "."))
+	}
+
+	opts := statements.Options{
+		DateFormat: c.PostForm("dateFormat"),
+		Currency:   strings.ToUpper(c.PostForm("currency")),
+	}
+	if mapping := c.PostForm("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "mapping must be a JSON object",
+			}})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Failed to read statement file",
+		}})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxStatementSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Failed to read statement file",
+		}})
+		return
+	}
+
+	stmtImport, err := h.importer.Preview(account, format, fileHeader.Filename, data, opts)
+	if err != nil {
+		var parseErr statements.ParseError
+		var mappingErr statements.MappingError
+		switch {
+		case errors.As(err, &parseErr):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+				"code":    "INVALID_STATEMENT",
+				"message": parseErr.Error(),
+				"details": gin.H{"line": parseErr.Line},
+			}})
+		case errors.Is(err, statements.ErrUnsupportedFormat):
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "format must be one of csv, ofx or qif",
+			}})
+		case errors.As(err, &mappingErr),
+			errors.Is(err, statements.ErrEmptyStatement),
+			errors.Is(err, statements.ErrTooManyRows),
+			errors.Is(err, statements.ErrCurrencyUnsupported):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gin.H{
+				"code":    "INVALID_STATEMENT",
+				"message": err.Error(),
+			}})
+		default:
+			log.Printf("[IMPORT-PREVIEW] Failed for account %s: %v", account.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to import statement",
+			}})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{
+		"import": stmtImport,
+		"summary": gin.H{
+			"total":      stmtImport.RowCount,
+			"new":        stmtImport.RowCount - stmtImport.DuplicateCount,
+			"duplicates": stmtImport.DuplicateCount,
+		},
+	}})
+}
+
+// CommitImport stores the non-duplicate rows of a previewed import
+func (h *StatementImportHandler) CommitImport(c *gin.Context) {
+	account, ok := h.findAccount(c)
+	if !ok {
+		return
+	}
+	importID, ok := parseImportID(c)
+	if !ok {
+		return
+	}
+
+	stmtImport, result, err := h.importer.Commit(account, importID)
+	if err != nil {
+		h.respondImportError(c, "[IMPORT-COMMIT]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"import":     stmtImport,
+		"created":    len(result.Created),
+		"duplicates": stmtImport.DuplicateCount,
+	}})
+}
+
+// UndoImport discards a preview or removes the transactions of a committed import
+func (h *StatementImportHandler) UndoImport(c *gin.Context) {
+	account, ok := h.findAccount(c)
+	if !ok {
+		return
+	}
+	importID, ok := parseImportID(c)
+	if !ok {
+		return
+	}
+
+	stmtImport, removed, err := h.importer.Undo(account, importID)
+	if err != nil {
+		h.respondImportError(c, "[IMPORT-UNDO]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"id":      stmtImport.ID,
+		"status":  stmtImport.Status,
+		"removed": removed,
+	}})
+}
+
+func (h *StatementImportHandler) findAccount(c *gin.Context) (*models.LinkedAccount, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return nil, false
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid account ID",
+		}})
+		return nil, false
+	}
+
+	var account models.LinkedAccount
+	if err := h.db.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Account not found",
+		}})
+		return nil, false
+	}
+	return &account, true
+}
+
+func parseImportID(c *gin.Context) (uuid.UUID, bool) {
+	importID, err := uuid.Parse(c.Param("importId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid import ID",
+		}})
+		return uuid.Nil, false
+	}
+	return importID, true
+}
+
+func (h *StatementImportHandler) respondImportError(c *gin.Context, tag string, err error) {
+	switch {
+	case errors.Is(err, statements.ErrImportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Import not found",
+		}})
+	case errors.Is(err, statements.ErrImportNotPending),
+		errors.Is(err, statements.ErrImportNotUndoable),
+		errors.Is(err, transactions.ErrAlreadyReverted):
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "INVALID_IMPORT_STATE",
+			"message": err.Error(),
+		}})
+	default:
+		log.Printf("%s Failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to process import",
+		}})
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/exports"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// TransactionHandler handles queries over synced provider transactions
+type TransactionHandler struct {
+	repo     repository.TransactionRepository
+	exporter *exports.Exporter
+}
+
+// NewTransactionHandler creates a new TransactionHandler instance
+func NewTransactionHandler(repo repository.TransactionRepository, exporter *exports.Exporter) *TransactionHandler {
+	return &TransactionHandler{repo: repo, exporter: exporter}
+}
+
+// GetTransactions returns a page of the user's transactions matching the query filters
+func (h *TransactionHandler) GetTransactions(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	filter, err := parseTransactionFilter(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		filter.Cursor, err = repository.DecodeTransactionCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid cursor",
+			}})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "limit must be a positive integer",
+			}})
+			return
+		}
+	}
+
+	txns, next, err := h.repo.List(filter)
+	if err != nil {
+		log.Printf("[GET-TRANSACTIONS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch transactions",
+		}})
+		return
+	}
+
+	pagination := gin.H{"hasMore": next != nil}
+	if next != nil {
+		pagination["nextCursor"] = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       txns,
+		"pagination": pagination,
+	})
+}
+
+// GetTransaction returns a single transaction by ID
+func (h *TransactionHandler) GetTransaction(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid transaction ID",
+		}})
+		return
+	}
+
+	txn, err := h.repo.Get(userID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "Transaction not found",
+			}})
+			return
+		}
+		log.Printf("[GET-TRANSACTION] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch transaction",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": txn})
+}
+
+// ExportTransactions streams the user's transactions matching the listing
+// filters as a CSV, OFX or PDF file. The file ends with a SHA-256 checksum of
+// the exported rows.
+func (h *TransactionHandler) ExportTransactions(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	format := exports.Format(strings.ToLower(c.DefaultQuery("format", string(exports.FormatCSV))))
+	if !format.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "format must be one of csv, ofx or pdf",
+		}})
+		return
+	}
+
+	filter, err := parseTransactionFilter(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		}})
+		return
+	}
+
+	fileName := fmt.Sprintf("transactions-%s.%s", time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Status(http.StatusOK)
+
+	if err := h.exporter.Export(c.Writer, format, filter); err != nil {
+		log.Printf("[EXPORT-TRANSACTIONS] Export failed for user %s: %v", userID, err)
+		// Once the body has started the status can no longer change; the
+		// truncated file has no checksum footer
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to export transactions",
+		}})
+	}
+}
+
+// parseTransactionFilter reads the listing filters shared by the transaction endpoints
+func parseTransactionFilter(c *gin.Context, userID uuid.UUID) (repository.TransactionFilter, error) {
+	filter := repository.TransactionFilter{
+		UserID: userID,
+		Search: strings.TrimSpace(c.Query("q")),
+	}
+
+	if v := c.Query("accountId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, errors.New("accountId must be a valid UUID")
+		}
+		filter.LinkedAccountID = &id
+	}
+	if v := c.Query("categoryId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, errors.New("categoryId must be a valid UUID")
+		}
+		filter.CategoryID = &id
+	}
+	if v := c.Query("budgetCategoryId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, errors.New("budgetCategoryId must be a valid UUID")
+		}
+		filter.BudgetCategoryID = &id
+	}
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseDateParam(v)
+		if err != nil {
+			return filter, errors.New("from must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			return filter, errors.New("to must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		}
+		// A bare date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+	if v := c.Query("minAmount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, errors.New("minAmount must be a number")
+		}
+		filter.MinAmount = &amount
+	}
+	if v := c.Query("maxAmount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, errors.New("maxAmount must be a number")
+		}
+		filter.MaxAmount = &amount
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, errors.New("minAmount must not be greater than maxAmount")
+	}
+	if v := c.Query("type"); v != "" {
+		filter.Type = models.TransactionType(strings.ToUpper(v))
+		if !filter.Type.IsValid() {
+			return filter, errors.New("type must be CREDIT or DEBIT")
+		}
+	}
+
+	return filter, nil
+}
+
+// parseDateParam accepts either YYYY-MM-DD or an RFC3339 timestamp
+func parseDateParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
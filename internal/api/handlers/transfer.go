@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	defaultTransferPageSize = 50
+	maxTransferPageSize     = 200
+)
+
+// TransferHandler sends money between users' wallets
+type TransferHandler struct {
+	transfers *transfers.Service
+	limits    *limits.Policy
+}
+
+// NewTransferHandler creates a new TransferHandler instance
+func NewTransferHandler(service *transfers.Service, policy *limits.Policy) *TransferHandler {
+	return &TransferHandler{transfers: service, limits: policy}
+}
+
+type createTransferRequest struct {
+	RecipientPhone string  `json:"recipientPhone" binding:"required,min=9,max=15"`
+	Amount         float64 `json:"amount" binding:"required,gt=0"`
+	Currency       string  `json:"currency" binding:"omitempty,len=3"`
+	Description    string  `json:"description" binding:"max=255"`
+}
+
+type confirmTransferRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// CreateTransfer starts a transfer to the user with the given phone number.
+// It stays pending until confirmed with the code sent to the sender.
+func (h *TransferHandler) CreateTransfer(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	var req createTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	if !checkTransferLimit(c, h.limits, "[CREATE-TRANSFER]", userID, req.Amount, req.Currency) {
+		return
+	}
+
+	transfer, err := h.transfers.Initiate(transfers.Request{
+		SenderID:       userID,
+		RecipientPhone: req.RecipientPhone,
+		Amount:         req.Amount,
+		Currency:       req.Currency,
+		Description:    req.Description,
+	})
+	if err != nil {
+		respondTransferError(c, "[CREATE-TRANSFER]", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": transfer})
+}
+
+// ConfirmTransfer completes a pending transfer with the sender's code. The
+// sender's limits are checked again up front, since other transfers may
+// have completed since this one was started; the transfer service checks
+// them once more as the money moves.
+func (h *TransferHandler) ConfirmTransfer(c *gin.Context) {
+	userID, transferID, ok := transferParams(c)
+	if !ok {
+		return
+	}
+
+	var req confirmTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "VALIDATION_ERROR",
+			"message": "Invalid request parameters",
+		}})
+		return
+	}
+	pending, err := h.transfers.Get(userID, transferID)
+	if err != nil {
+		respondTransferError(c, "[CONFIRM-TRANSFER]", err)
+		return
+	}
+	if pending.SenderID == userID && pending.Status == models.TransferStatusPending &&
+		!checkTransferLimit(c, h.limits, "[CONFIRM-TRANSFER]", userID, pending.Amount, pending.Currency) {
+		return
+	}
+
+	transfer, err := h.transfers.Confirm(userID, transferID, req.Code)
+	if err != nil {
+		respondTransferError(c, "[CONFIRM-TRANSFER]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": transfer})
+}
+
+// CancelTransfer withdraws a pending transfer
+func (h *TransferHandler) CancelTransfer(c *gin.Context) {
+	userID, transferID, ok := transferParams(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.transfers.Cancel(userID, transferID)
+	if err != nil {
+		respondTransferError(c, "[CANCEL-TRANSFER]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": transfer})
+}
+
+// GetTransfers returns the user's sent and received transfers, newest first
+func (h *TransferHandler) GetTransfers(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	limit := defaultTransferPageSize
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "limit must be a positive integer",
+			}})
+			return
+		}
+		if limit > maxTransferPageSize {
+			limit = maxTransferPageSize
+		}
+	}
+
+	list, err := h.transfers.List(userID, limit)
+	if err != nil {
+		log.Printf("[GET-TRANSFERS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch transfers",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// GetTransfer returns a transfer the user sent or received
+func (h *TransferHandler) GetTransfer(c *gin.Context) {
+	userID, transferID, ok := transferParams(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.transfers.Get(userID, transferID)
+	if err != nil {
+		respondTransferError(c, "[GET-TRANSFER]", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": transfer})
+}
+
+// transferParams resolves the user and the :id transfer ID
+func transferParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	transferID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid transfer ID",
+		}})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, transferID, true
+}
+
+// respondTransferError maps transfer service errors to responses
+func respondTransferError(c *gin.Context, tag string, err error) {
+	if respondLimitError(c, err) {
+		return
+	}
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	message := "Failed to process transfer"
+	switch {
+	case errors.Is(err, transfers.ErrTransferNotFound):
+		status, code, message = http.StatusNotFound, "NOT_FOUND", "Transfer not found"
+	case errors.Is(err, transfers.ErrRecipientNotFound):
+		status, code, message = http.StatusNotFound, "RECIPIENT_NOT_FOUND", err.Error()
+	case errors.Is(err, transfers.ErrSelfTransfer), errors.Is(err, transfers.ErrInvalidAmount):
+		status, code, message = http.StatusBadRequest, "VALIDATION_ERROR", err.Error()
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		status, code, message = http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS", "Insufficient funds in your wallet"
+	case errors.Is(err, repository.ErrWalletInactive):
+		status, code, message = http.StatusConflict, "WALLET_INACTIVE", "A wallet in this transfer is frozen or closed"
+	case errors.Is(err, repository.ErrCurrencyMismatch):
+		status, code, message = http.StatusConflict, "CURRENCY_MISMATCH", "Wallet currency does not match the transfer"
+	case errors.Is(err, transfers.ErrSenderSuspended):
+		status, code, message = http.StatusForbidden, "ACCOUNT_SUSPENDED", "Your account is suspended"
+	case errors.Is(err, transfers.ErrRejected):
+		status, code, message = http.StatusConflict, "TRANSFER_REJECTED", err.Error()
+	case errors.Is(err, transfers.ErrNotPending):
+		status, code, message = http.StatusConflict, "TRANSFER_NOT_PENDING", err.Error()
+	case errors.Is(err, transfers.ErrCodeExpired):
+		status, code, message = http.StatusGone, "CODE_EXPIRED", err.Error()
+	case errors.Is(err, transfers.ErrInvalidCode):
+		status, code, message = http.StatusUnauthorized, "INVALID_CODE", err.Error()
+	case errors.Is(err, transfers.ErrTooManyAttempts):
+		status, code, message = http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS", "Too many incorrect codes; the transfer has been failed"
+	case errors.Is(err, transfers.ErrCodeNotSent):
+		status, code, message = http.StatusBadGateway, "CODE_NOT_SENT", "Failed to send the confirmation code"
+	default:
+		log.Printf("%s Transfer failed: %v", tag, err)
+	}
+
+	c.JSON(status, gin.H{"error": gin.H{
+		"code":    code,
+		"message": message,
+	}})
+}
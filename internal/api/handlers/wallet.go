@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// WalletHandler serves wallet balances and their ledger history
+type WalletHandler struct {
+	ledger repository.LedgerRepository
+}
+
+// NewWalletHandler creates a new WalletHandler instance
+func NewWalletHandler(ledger repository.LedgerRepository) *WalletHandler {
+	return &WalletHandler{ledger: ledger}
+}
+
+// GetWallets returns the user's wallets
+func (h *WalletHandler) GetWallets(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return
+	}
+
+	wallets, err := h.ledger.ListWallets(userID)
+	if err != nil {
+		log.Printf("[GET-WALLETS] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch wallets",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": wallets})
+}
+
+// GetWallet returns a single wallet
+func (h *WalletHandler) GetWallet(c *gin.Context) {
+	wallet, ok := h.loadWallet(c, "[GET-WALLET]")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// GetWalletEntries returns a page of the wallet's ledger lines, newest first,
+// each with its journal entry and the balance after it
+func (h *WalletHandler) GetWalletEntries(c *gin.Context) {
+	wallet, ok := h.loadWallet(c, "[GET-WALLET-ENTRIES]")
+	if !ok {
+		return
+	}
+
+	var cursor *repository.LedgerCursor
+	if v := c.Query("cursor"); v != "" {
+		var err error
+		cursor, err = repository.DecodeLedgerCursor(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid cursor",
+			}})
+			return
+		}
+	}
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "limit must be a positive integer",
+			}})
+			return
+		}
+	}
+
+	entries, next, err := h.ledger.ListEntries(wallet.ID, cursor, limit)
+	if err != nil {
+		log.Printf("[GET-WALLET-ENTRIES] Database query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch wallet entries",
+		}})
+		return
+	}
+
+	pagination := gin.H{"hasMore": next != nil}
+	if next != nil {
+		pagination["nextCursor"] = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       entries,
+		"pagination": pagination,
+	})
+}
+
+// loadWallet resolves the :id wallet, which must belong to the user
+func (h *WalletHandler) loadWallet(c *gin.Context, tag string) (*models.Wallet, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return nil, false
+	}
+
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "Invalid wallet ID",
+		}})
+		return nil, false
+	}
+
+	wallet, err := h.ledger.GetWallet(userID, walletID)
+	if errors.Is(err, repository.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Wallet not found",
+		}})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("%s Database query failed: %v", tag, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch wallet",
+		}})
+		return nil, false
+	}
+	return wallet, true
+}
@@ -1,13 +1,18 @@
 package middleware
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"github.com/moha/kaafipay-backend/internal/config"
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
 	"github.com/moha/kaafipay-backend/internal/utils"
 )
 
@@ -16,7 +21,9 @@ func init() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 }
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware checks the bearer token and that its user may still use
+// the app; suspended users are turned away with ACCOUNT_SUSPENDED
+func AuthMiddleware(cfg *config.Config, userRepo repository.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Log the request path for context
 		log.Printf("[AUTH] New request to: %s", c.Request.URL.Path)
@@ -50,6 +57,29 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		log.Printf("[AUTH] Token validated successfully. UserID: %s, Phone: %s", claims.UserID, claims.Phone)
 
+		user, err := userRepo.FindByID(claims.UserID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[AUTH] User %s no longer exists", claims.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Printf("[AUTH] Failed to load user %s: %v", claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to authenticate",
+			}})
+			c.Abort()
+			return
+		}
+		if user.Suspended(time.Now()) {
+			log.Printf("[AUTH] Suspended user %s turned away", user.ID)
+			RespondAccountSuspended(c, user)
+			c.Abort()
+			return
+		}
+
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("phone", claims.Phone)
@@ -65,3 +95,16 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RespondAccountSuspended tells a suspended user why and until when
+func RespondAccountSuspended(c *gin.Context, user *models.User) {
+	details := gin.H{"reason": user.SuspendedReason}
+	if user.SuspendedUntil != nil {
+		details["until"] = user.SuspendedUntil
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": gin.H{
+		"code":    "ACCOUNT_SUSPENDED",
+		"message": "Your account is suspended",
+		"details": details,
+	}})
+}
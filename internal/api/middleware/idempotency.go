@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// Idempotency makes retries of a request safe. The first request with a
+// given Idempotency-Key runs normally and its response is stored for a day;
+// a retry with the same key and the same body gets that response back
+// without running again, and one with a different body is rejected with 409.
+// Server errors are not stored, so a request that failed that way can be
+// retried with its key. With required set, requests without a key are
+// rejected. It must run after AuthMiddleware, as keys are per user.
+func Idempotency(store repository.IdempotencyRepository, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			if required {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": gin.H{
+					"code":    "IDEMPOTENCY_KEY_REQUIRED",
+					"message": "This request requires an Idempotency-Key header",
+				}})
+				return
+			}
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Idempotency-Key must be at most 255 characters",
+			}})
+			return
+		}
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentRequestBytes))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Request body is too large",
+			}})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: requestHash(c.Request.Method, c.Request.URL.RequestURI(), body),
+		}
+		existing, err := store.Reserve(record)
+		if err != nil {
+			log.Printf("[IDEMPOTENCY] Failed to reserve key for user %s: %v", userID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to process request",
+			}})
+			return
+		}
+		if existing != nil {
+			replay(c, record, existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// A panic or server error leaves nothing worth replaying
+			if !completed {
+				if err := store.Release(userID, key); err != nil {
+					log.Printf("[IDEMPOTENCY] Failed to release key for user %s: %v", userID, err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		if err := store.Complete(userID, key, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Printf("[IDEMPOTENCY] Failed to store response for user %s: %v", userID, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replay answers a request whose key is already taken
+func replay(c *gin.Context, record, existing *models.IdempotencyKey) {
+	if existing.RequestHash != record.RequestHash {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "IDEMPOTENCY_KEY_MISMATCH",
+			"message": "This Idempotency-Key was already used for a different request",
+		}})
+		return
+	}
+	if !existing.Completed() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": gin.H{
+			"code":    "IDEMPOTENCY_KEY_IN_USE",
+			"message": "A request with this Idempotency-Key is still being processed",
+		}})
+		return
+	}
+
+	log.Printf("[IDEMPOTENCY] Replaying %s %s for user %s", existing.Method, existing.Path, existing.UserID)
+	c.Header(IdempotentReplayedHeader, "true")
+	contentType := existing.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Data(*existing.StatusCode, contentType, existing.ResponseBody)
+	c.Abort()
+}
+
+// requestHash fingerprints a request so a retry can be told apart from a
+// different request reusing the key
+func requestHash(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
@@ -8,6 +10,25 @@ import (
 	"github.com/moha/kaafipay-backend/internal/api/middleware"
 	"github.com/moha/kaafipay-backend/internal/config"
 	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/alerts"
+	"github.com/moha/kaafipay-backend/internal/services/budgets"
+	"github.com/moha/kaafipay-backend/internal/services/exports"
+	"github.com/moha/kaafipay-backend/internal/services/fx"
+	"github.com/moha/kaafipay-backend/internal/services/goals"
+	"github.com/moha/kaafipay-backend/internal/services/holds"
+	"github.com/moha/kaafipay-backend/internal/services/idempotency"
+	"github.com/moha/kaafipay-backend/internal/services/kyc"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/services/payrequests"
+	"github.com/moha/kaafipay-backend/internal/services/push"
+	"github.com/moha/kaafipay-backend/internal/services/rules"
+	"github.com/moha/kaafipay-backend/internal/services/schedules"
+	"github.com/moha/kaafipay-backend/internal/services/splits"
+	"github.com/moha/kaafipay-backend/internal/services/statements"
+	"github.com/moha/kaafipay-backend/internal/services/transactions"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/services/ussd"
+	"github.com/moha/kaafipay-backend/internal/services/wallets"
 	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
 )
 
@@ -27,13 +48,78 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 
 	// Repositories
 	userRepo := repository.NewUserRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	// Services
+	ingestor := transactions.NewIngestor(db)
+	importer := statements.NewImporter(db, ingestor)
+	exporter := exports.NewExporter(db, transactionRepo)
+	backfiller := rules.NewBackfiller(db)
+	backfiller.Start()
+	converter, err := fx.NewConverter(cfg.FXRates)
+	if err != nil {
+		log.Fatalf("Invalid FX_RATES: %v", err)
+	}
+	summarizer := budgets.NewSummarizer(db, converter)
+	periodCloser := budgets.NewPeriodCloser(db, summarizer)
+	periodCloser.Start()
+	pushSender := push.NewSender(db, cfg.PushGatewayURL, cfg.PushGatewayToken)
+	alerter := alerts.NewAlerter(db, summarizer, whatsappProvider, pushSender)
+	ingestor.AddListener(alerter)
+	goalTracker := goals.NewTracker(db, converter, whatsappProvider)
+	ingestor.AddListener(goalTracker)
+	paymentIntents := ussd.NewIntents(db)
+	ingestor.AddListener(paymentIntents)
+	paymentIntents.Start()
+	wallets.NewReconciler(db, ledgerRepo).Start()
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	idempotency.NewPurger(idempotencyRepo).Start()
+
+	// Money-moving routes must carry an Idempotency-Key; linking accepts one
+	requireIdempotency := middleware.Idempotency(idempotencyRepo, true)
+	allowIdempotency := middleware.Idempotency(idempotencyRepo, false)
 
 	// Handlers
 	authHandler := handlers.NewAuthHandler(cfg, userRepo)
 	verifyHandler := handlers.NewVerifyHandler(whatsappProvider)
-	linkedAccountHandler := handlers.NewLinkedAccountHandler(db)
-	budgetHandler := handlers.NewBudgetCategoryHandler(db)
+	linkedAccountHandler := handlers.NewLinkedAccountHandler(db, ingestor)
+	budgetHandler := handlers.NewBudgetCategoryHandler(db, transactionRepo, backfiller, summarizer)
 	userHandler := handlers.NewUserHandler(userRepo)
+	transactionHandler := handlers.NewTransactionHandler(transactionRepo, exporter)
+	receiptHandler := handlers.NewReceiptHandler(db, ingestor)
+	importHandler := handlers.NewStatementImportHandler(db, importer)
+	manualTransactionHandler := handlers.NewManualTransactionHandler(db, transactionRepo, ingestor, alerter)
+	budgetAlertHandler := handlers.NewBudgetAlertHandler(db)
+	categoryHandler := handlers.NewCategoryHandler(db)
+	budgetTemplateHandler := handlers.NewBudgetTemplateHandler(db, backfiller)
+	budgetGroupHandler := handlers.NewBudgetGroupHandler(db, whatsappProvider)
+	savingsGoalHandler := handlers.NewSavingsGoalHandler(db, goalTracker)
+	walletHandler := handlers.NewWalletHandler(ledgerRepo)
+	paymentIntentHandler := handlers.NewPaymentIntentHandler(db, paymentIntents)
+	transferLimits := limits.NewPolicy(db, converter)
+	transferService := transfers.NewService(db, ledgerRepo, whatsappProvider)
+	transferService.AddHook(transferLimits)
+	accountHolds := holds.NewService(db, whatsappProvider)
+	transferService.AddHook(accountHolds)
+	accountHolds.Start()
+	paymentRequests := payrequests.NewService(db, transferService, whatsappProvider, cfg.PaymentLinkBaseURL)
+	transferService.AddHook(paymentRequests)
+	paymentRequests.Start()
+	scheduledTransfers := schedules.NewService(db, transferService, transferLimits, whatsappProvider)
+	transferService.AddHook(scheduledTransfers)
+	scheduledTransfers.Start()
+	billSplits := splits.NewService(db, transactionRepo, transferService, whatsappProvider)
+	transferService.AddHook(billSplits)
+	transferHandler := handlers.NewTransferHandler(transferService, transferLimits)
+	paymentRequestHandler := handlers.NewPaymentRequestHandler(paymentRequests, transferLimits)
+	paymentMethodHandler := handlers.NewPaymentMethodHandler(db)
+	scheduledTransferHandler := handlers.NewScheduledTransferHandler(scheduledTransfers)
+	billSplitHandler := handlers.NewBillSplitHandler(billSplits, transferLimits)
+	kycService := kyc.NewService(db, transferLimits, whatsappProvider)
+	kycService.Start()
+	kycHandler := handlers.NewKYCHandler(kycService)
+	accountHoldHandler := handlers.NewAccountHoldHandler(accountHolds)
 
 	// Public routes
 	v1 := router.Group("/api/v1")
@@ -53,7 +139,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 
 		// Protected routes
 		protected := v1.Group("")
-		protected.Use(middleware.AuthMiddleware(cfg))
+		protected.Use(middleware.AuthMiddleware(cfg, userRepo))
 		{
 			// User profile routes
 			user := protected.Group("/user")
@@ -61,26 +147,183 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 				user.GET("/profile", userHandler.GetProfile)
 				user.PUT("/profile", userHandler.UpdateProfile)
 				user.PUT("/password", userHandler.ChangePassword)
+				user.POST("/push-devices", budgetAlertHandler.RegisterPushDevice)
+				user.DELETE("/push-devices/:id", budgetAlertHandler.DeletePushDevice)
 			}
 
 			// Linked accounts routes
 			accounts := protected.Group("/linked-accounts")
 			{
-				accounts.POST("", linkedAccountHandler.LinkAccount)
+				accounts.POST("", allowIdempotency, linkedAccountHandler.LinkAccount)
 				accounts.GET("", linkedAccountHandler.GetLinkedAccounts)
 				accounts.GET("/:id", linkedAccountHandler.GetLinkedAccount)
 				accounts.DELETE("/:id", linkedAccountHandler.UnlinkAccount)
 				accounts.PATCH("/:id/default", linkedAccountHandler.SetDefaultAccount)
 				accounts.POST("/:id/refresh", linkedAccountHandler.RefreshAccount)
+				accounts.POST("/:id/receipts", receiptHandler.SubmitReceipts)
+				accounts.POST("/:id/import", importHandler.PreviewImport)
+				accounts.POST("/:id/import/:importId/commit", importHandler.CommitImport)
+				accounts.DELETE("/:id/import/:importId", importHandler.UndoImport)
+				accounts.GET("/:id/payment-intents", paymentIntentHandler.GetPaymentIntents)
+				accounts.POST("/:id/payment-intents", allowIdempotency, paymentIntentHandler.CreatePaymentIntent)
+				accounts.GET("/:id/payment-intents/:intentId", paymentIntentHandler.GetPaymentIntent)
+				accounts.POST("/:id/payment-intents/:intentId/cancel", paymentIntentHandler.CancelPaymentIntent)
+			}
+
+			// Payment methods routes
+			paymentMethods := protected.Group("/payment-methods")
+			{
+				paymentMethods.GET("", paymentMethodHandler.GetPaymentMethods)
+				paymentMethods.POST("", allowIdempotency, paymentMethodHandler.CreatePaymentMethod)
+				paymentMethods.GET("/:id", paymentMethodHandler.GetPaymentMethod)
+				paymentMethods.PUT("/:id", paymentMethodHandler.UpdatePaymentMethod)
+				paymentMethods.DELETE("/:id", paymentMethodHandler.DeletePaymentMethod)
+				paymentMethods.PATCH("/:id/default", paymentMethodHandler.SetDefaultPaymentMethod)
 			}
 
 			// Budget categories routes
 			budgets := protected.Group("/budget-categories")
 			{
 				budgets.GET("", budgetHandler.GetBudgetCategories)
+				budgets.GET("/summary", budgetHandler.GetBudgetSummary)
 				budgets.POST("", budgetHandler.CreateBudgetCategory)
 				budgets.PUT("/:id", budgetHandler.UpdateBudgetCategory)
 				budgets.DELETE("/:id", budgetHandler.DeleteBudgetCategory)
+				budgets.GET("/:id/periods", budgetHandler.GetBudgetPeriods)
+				budgets.POST("/:id/rules/preview", budgetHandler.PreviewRules)
+			}
+
+			// System category routes
+			protected.GET("/categories", categoryHandler.GetCategories)
+
+			// Budget template routes
+			templates := protected.Group("/budget-templates")
+			{
+				templates.GET("", budgetTemplateHandler.GetBudgetTemplates)
+				templates.POST("/:id/apply", budgetTemplateHandler.ApplyBudgetTemplate)
+			}
+
+			// Budget group routes
+			groups := protected.Group("/budget-groups")
+			{
+				groups.POST("", budgetGroupHandler.CreateBudgetGroup)
+				groups.GET("", budgetGroupHandler.GetBudgetGroups)
+				groups.GET("/:id", budgetGroupHandler.GetBudgetGroup)
+				groups.DELETE("/:id", budgetGroupHandler.DeleteBudgetGroup)
+				groups.POST("/:id/invites", budgetGroupHandler.InviteGroupMember)
+				groups.DELETE("/:id/invites/:inviteId", budgetGroupHandler.RevokeGroupInvite)
+				groups.PUT("/:id/members/:userId", budgetGroupHandler.UpdateGroupMember)
+				groups.DELETE("/:id/members/:userId", budgetGroupHandler.RemoveGroupMember)
+				groups.PUT("/:id/accounts", budgetGroupHandler.ShareGroupAccounts)
+			}
+			invites := protected.Group("/budget-group-invites")
+			{
+				invites.GET("", budgetGroupHandler.GetGroupInvites)
+				invites.POST("/:id/accept", budgetGroupHandler.AcceptGroupInvite)
+				invites.POST("/:id/decline", budgetGroupHandler.DeclineGroupInvite)
+			}
+
+			// Savings goal routes
+			savingsGoals := protected.Group("/savings-goals")
+			{
+				savingsGoals.GET("", savingsGoalHandler.GetSavingsGoals)
+				savingsGoals.POST("", savingsGoalHandler.CreateSavingsGoal)
+				savingsGoals.GET("/:id", savingsGoalHandler.GetSavingsGoal)
+				savingsGoals.PUT("/:id", savingsGoalHandler.UpdateSavingsGoal)
+				savingsGoals.DELETE("/:id", savingsGoalHandler.DeleteSavingsGoal)
+				savingsGoals.GET("/:id/contributions", savingsGoalHandler.GetGoalContributions)
+				savingsGoals.POST("/:id/contributions", savingsGoalHandler.AddGoalContribution)
+			}
+
+			// Wallet routes
+			walletRoutes := protected.Group("/wallets")
+			{
+				walletRoutes.GET("", walletHandler.GetWallets)
+				walletRoutes.GET("/:id", walletHandler.GetWallet)
+				walletRoutes.GET("/:id/entries", walletHandler.GetWalletEntries)
+			}
+
+			// Transfer routes
+			transferRoutes := protected.Group("/transfers")
+			{
+				transferRoutes.GET("", transferHandler.GetTransfers)
+				transferRoutes.POST("", requireIdempotency, transferHandler.CreateTransfer)
+				transferRoutes.GET("/:id", transferHandler.GetTransfer)
+				transferRoutes.POST("/:id/confirm", requireIdempotency, transferHandler.ConfirmTransfer)
+				transferRoutes.POST("/:id/cancel", allowIdempotency, transferHandler.CancelTransfer)
+			}
+
+			// Scheduled transfer routes
+			scheduledTransferRoutes := protected.Group("/scheduled-transfers")
+			{
+				scheduledTransferRoutes.GET("", scheduledTransferHandler.GetScheduledTransfers)
+				scheduledTransferRoutes.POST("", allowIdempotency, scheduledTransferHandler.CreateScheduledTransfer)
+				scheduledTransferRoutes.GET("/:id", scheduledTransferHandler.GetScheduledTransfer)
+				scheduledTransferRoutes.POST("/:id/confirm", requireIdempotency, scheduledTransferHandler.ConfirmScheduledTransfer)
+				scheduledTransferRoutes.POST("/:id/pause", scheduledTransferHandler.PauseScheduledTransfer)
+				scheduledTransferRoutes.POST("/:id/resume", scheduledTransferHandler.ResumeScheduledTransfer)
+				scheduledTransferRoutes.POST("/:id/skip", allowIdempotency, scheduledTransferHandler.SkipScheduledTransfer)
+				scheduledTransferRoutes.POST("/:id/cancel", scheduledTransferHandler.CancelScheduledTransfer)
+			}
+
+			// Bill split routes
+			billSplitRoutes := protected.Group("/bill-splits")
+			{
+				billSplitRoutes.GET("", billSplitHandler.GetBillSplits)
+				billSplitRoutes.POST("", allowIdempotency, billSplitHandler.CreateBillSplit)
+				billSplitRoutes.GET("/balances", billSplitHandler.GetBillSplitBalances)
+				billSplitRoutes.GET("/:id", billSplitHandler.GetBillSplit)
+				billSplitRoutes.POST("/:id/cancel", billSplitHandler.CancelBillSplit)
+				billSplitRoutes.POST("/:id/remind", billSplitHandler.RemindBillSplit)
+				billSplitRoutes.POST("/:id/shares/:shareId/pay", requireIdempotency, billSplitHandler.PayBillSplitShare)
+				billSplitRoutes.POST("/:id/shares/:shareId/mark-paid", billSplitHandler.MarkBillSplitSharePaid)
+			}
+
+			kycRoutes := protected.Group("/kyc")
+			{
+				kycRoutes.GET("", kycHandler.GetKYCStatus)
+				kycRoutes.GET("/documents", kycHandler.GetKYCDocuments)
+				kycRoutes.POST("/documents", allowIdempotency, kycHandler.SubmitKYCDocument)
+			}
+
+			// Payment request routes
+			paymentRequestRoutes := protected.Group("/payment-requests")
+			{
+				paymentRequestRoutes.GET("", paymentRequestHandler.GetPaymentRequests)
+				paymentRequestRoutes.POST("", allowIdempotency, paymentRequestHandler.CreatePaymentRequest)
+				paymentRequestRoutes.GET("/:id", paymentRequestHandler.GetPaymentRequest)
+				paymentRequestRoutes.POST("/:id/cancel", paymentRequestHandler.CancelPaymentRequest)
+				paymentRequestRoutes.POST("/:id/mark-paid", paymentRequestHandler.MarkPaymentRequestPaid)
+				paymentRequestRoutes.POST("/:id/remind", paymentRequestHandler.RemindPaymentRequest)
+			}
+
+			// Shared payment request links, opened by the payer
+			paymentLinks := protected.Group("/payment-links")
+			{
+				paymentLinks.GET("/:token", paymentRequestHandler.OpenPaymentLink)
+				paymentLinks.POST("/:token/pay", requireIdempotency, paymentRequestHandler.PayPaymentLink)
+				paymentLinks.POST("/:token/decline", paymentRequestHandler.DeclinePaymentLink)
+			}
+
+			// Budget alert routes
+			protected.GET("/budget-alerts", budgetAlertHandler.GetBudgetAlerts)
+
+			// Recategorization job routes
+			jobs := protected.Group("/recategorization-jobs")
+			{
+				jobs.GET("/:id", budgetHandler.GetRecategorizationJob)
+				jobs.POST("/:id/undo", budgetHandler.UndoRecategorizationJob)
+			}
+
+			// Transactions routes
+			txns := protected.Group("/transactions")
+			{
+				txns.GET("", transactionHandler.GetTransactions)
+				txns.GET("/export", transactionHandler.ExportTransactions)
+				txns.GET("/:id", transactionHandler.GetTransaction)
+				txns.POST("", manualTransactionHandler.CreateManualTransaction)
+				txns.PUT("/:id", manualTransactionHandler.UpdateManualTransaction)
+				txns.DELETE("/:id", manualTransactionHandler.DeleteManualTransaction)
 			}
 		}
 
@@ -95,6 +338,34 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 				whatsapp.POST("/sessions", adminHandler.AddSession)
 				whatsapp.DELETE("/sessions/:sessionId", adminHandler.DeleteSession)
 			}
+
+			merchants := admin.Group("/merchant-categories")
+			{
+				merchants.GET("", categoryHandler.ListMerchantCategories)
+				merchants.PUT("", categoryHandler.UpsertMerchantCategory)
+				merchants.DELETE("/:id", categoryHandler.DeleteMerchantCategory)
+			}
+
+			kycReview := admin.Group("/kyc/documents")
+			{
+				kycReview.GET("", kycHandler.GetKYCReviewQueue)
+				kycReview.GET("/:id", kycHandler.GetKYCReviewDocument)
+				kycReview.POST("/:id/approve", kycHandler.ApproveKYCDocument)
+				kycReview.POST("/:id/reject", kycHandler.RejectKYCDocument)
+			}
+
+			adminWallets := admin.Group("/wallets")
+			{
+				adminWallets.POST("/:id/freeze", accountHoldHandler.FreezeWallet)
+				adminWallets.POST("/:id/unfreeze", accountHoldHandler.UnfreezeWallet)
+			}
+
+			adminUsers := admin.Group("/users")
+			{
+				adminUsers.GET("/:id/status-history", accountHoldHandler.GetAccountStatusHistory)
+				adminUsers.POST("/:id/suspend", accountHoldHandler.SuspendUser)
+				adminUsers.POST("/:id/reinstate", accountHoldHandler.ReinstateUser)
+			}
 		}
 	}
 
@@ -24,6 +24,16 @@ type Config struct {
 
 	// Admin
 	AdminToken string `mapstructure:"ADMIN_TOKEN"`
+
+	// Exchange rates as CODE=USD_VALUE pairs, e.g. "SLS=0.000118,SOS=0.00175"
+	FXRates string `mapstructure:"FX_RATES"`
+
+	// Push notifications
+	PushGatewayURL   string `mapstructure:"PUSH_GATEWAY_URL"`
+	PushGatewayToken string `mapstructure:"PUSH_GATEWAY_TOKEN"`
+
+	// Base URL of shared payment request links, e.g. "https://pay.kaafipay.com"
+	PaymentLinkBaseURL string `mapstructure:"PAYMENT_LINK_BASE_URL"`
 }
 
 func Load() (*Config, error) {
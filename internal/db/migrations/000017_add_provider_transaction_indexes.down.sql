@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_provider_transactions_account_date;
+
+ALTER TABLE provider_transactions
+    DROP CONSTRAINT IF EXISTS provider_transactions_linked_account_id_fkey;
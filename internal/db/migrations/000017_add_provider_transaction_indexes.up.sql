@@ -0,0 +1,9 @@
+-- linked_accounts was recreated in 000012 with CASCADE, which dropped the
+-- original foreign key from provider_transactions. Restore it.
+ALTER TABLE provider_transactions
+    ADD CONSTRAINT provider_transactions_linked_account_id_fkey
+    FOREIGN KEY (linked_account_id) REFERENCES linked_accounts(id);
+
+-- Keyset pagination orders by (transaction_date DESC, id DESC)
+CREATE INDEX idx_provider_transactions_account_date
+    ON provider_transactions(linked_account_id, transaction_date DESC, id DESC);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_provider_transactions_counterparty_phone;
+
+ALTER TABLE provider_transactions DROP COLUMN IF EXISTS counterparty_phone;
+ALTER TABLE provider_transactions DROP COLUMN IF EXISTS counterparty_name;
@@ -0,0 +1,5 @@
+-- Counterparty details extracted from SMS receipts and statements
+ALTER TABLE provider_transactions ADD COLUMN counterparty_name VARCHAR(255);
+ALTER TABLE provider_transactions ADD COLUMN counterparty_phone VARCHAR(50);
+
+CREATE INDEX idx_provider_transactions_counterparty_phone ON provider_transactions(counterparty_phone);
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS update_statement_imports_updated_at ON statement_imports;
+DROP TABLE IF EXISTS statement_imports;
+
+DROP INDEX IF EXISTS idx_provider_transactions_sync;
+ALTER TABLE provider_transactions DROP COLUMN IF EXISTS sync_id;
+
+ALTER TABLE linked_account_syncs DROP COLUMN IF EXISTS reverted_at;
+ALTER TABLE linked_account_syncs DROP COLUMN IF EXISTS transaction_count;
+ALTER TABLE linked_account_syncs DROP COLUMN IF EXISTS source;
@@ -0,0 +1,31 @@
+-- Record where each sync run came from so imports can be told apart and undone
+ALTER TABLE linked_account_syncs ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT 'SYNC';
+ALTER TABLE linked_account_syncs ADD COLUMN transaction_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE linked_account_syncs ADD COLUMN reverted_at TIMESTAMPTZ;
+
+-- The sync run that first created each transaction
+ALTER TABLE provider_transactions ADD COLUMN sync_id UUID REFERENCES linked_account_syncs(id);
+CREATE INDEX idx_provider_transactions_sync ON provider_transactions(sync_id);
+
+CREATE TABLE statement_imports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    linked_account_id UUID NOT NULL REFERENCES linked_accounts(id),
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'ofx', 'qif')),
+    file_name VARCHAR(255),
+    status VARCHAR(20) NOT NULL DEFAULT 'PREVIEW' CHECK (status IN ('PREVIEW', 'COMMITTED', 'REVERTED', 'DISCARDED')),
+    rows JSONB NOT NULL DEFAULT '[]',
+    row_count INTEGER NOT NULL DEFAULT 0,
+    duplicate_count INTEGER NOT NULL DEFAULT 0,
+    sync_id UUID REFERENCES linked_account_syncs(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_statement_imports_account ON statement_imports(linked_account_id);
+CREATE INDEX idx_statement_imports_user ON statement_imports(user_id);
+
+CREATE TRIGGER update_statement_imports_updated_at
+    BEFORE UPDATE ON statement_imports
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,13 @@
+ALTER TABLE linked_accounts ALTER COLUMN provider_username DROP DEFAULT;
+ALTER TABLE linked_accounts ALTER COLUMN provider_password DROP DEFAULT;
+ALTER TABLE linked_accounts ALTER COLUMN device_id DROP DEFAULT;
+
+-- PostgreSQL cannot remove a value from an enum type, so 'CASH' stays in
+-- account_provider. Remove the cash accounts and their transactions instead.
+DELETE FROM provider_transactions
+    WHERE linked_account_id IN (SELECT id FROM linked_accounts WHERE provider = 'CASH');
+DELETE FROM linked_account_syncs
+    WHERE linked_account_id IN (SELECT id FROM linked_accounts WHERE provider = 'CASH');
+DELETE FROM statement_imports
+    WHERE linked_account_id IN (SELECT id FROM linked_accounts WHERE provider = 'CASH');
+DELETE FROM linked_accounts WHERE provider = 'CASH';
@@ -0,0 +1,7 @@
+-- Cash wallets are linked accounts without a provider behind them
+ALTER TYPE account_provider ADD VALUE IF NOT EXISTS 'CASH';
+
+-- Credential-less accounts store no provider login or device
+ALTER TABLE linked_accounts ALTER COLUMN provider_username SET DEFAULT '';
+ALTER TABLE linked_accounts ALTER COLUMN provider_password SET DEFAULT '';
+ALTER TABLE linked_accounts ALTER COLUMN device_id SET DEFAULT '';
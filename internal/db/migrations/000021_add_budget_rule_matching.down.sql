@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_provider_transactions_budget_category;
+ALTER TABLE provider_transactions DROP COLUMN IF EXISTS matched_rule;
+ALTER TABLE provider_transactions DROP COLUMN IF EXISTS budget_category_id;
+ALTER TABLE budget_categories DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,9 @@
+-- Categories are evaluated in ascending priority order; the first match wins
+ALTER TABLE budget_categories ADD COLUMN priority INTEGER NOT NULL DEFAULT 100
+    CHECK (priority BETWEEN 1 AND 1000);
+
+-- The budget category a transaction was assigned to and the rule that matched
+ALTER TABLE provider_transactions ADD COLUMN budget_category_id UUID REFERENCES budget_categories(id);
+ALTER TABLE provider_transactions ADD COLUMN matched_rule JSONB;
+
+CREATE INDEX idx_provider_transactions_budget_category ON provider_transactions(budget_category_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS recategorization_changes;
+DROP TABLE IF EXISTS recategorization_jobs;
@@ -0,0 +1,40 @@
+-- Background jobs that re-run budget rules over a user's transaction history
+CREATE TABLE recategorization_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    budget_category_id UUID REFERENCES budget_categories(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING'
+        CHECK (status IN ('PENDING', 'RUNNING', 'COMPLETED', 'FAILED', 'UNDONE')),
+    since TIMESTAMPTZ,
+    total_count INTEGER NOT NULL DEFAULT 0,
+    processed_count INTEGER NOT NULL DEFAULT 0,
+    changed_count INTEGER NOT NULL DEFAULT 0,
+    -- Last transaction processed, so an interrupted job resumes where it stopped
+    cursor_id UUID,
+    error_message TEXT,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    undone_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_recategorization_jobs_user ON recategorization_jobs(user_id, created_at DESC);
+CREATE INDEX idx_recategorization_jobs_pending ON recategorization_jobs(created_at) WHERE status = 'PENDING';
+
+-- Before and after values of every transaction a job changed, for undo
+CREATE TABLE recategorization_changes (
+    id BIGSERIAL PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES recategorization_jobs(id) ON DELETE CASCADE,
+    transaction_id UUID NOT NULL REFERENCES provider_transactions(id) ON DELETE CASCADE,
+    old_budget_category_id UUID,
+    old_matched_rule JSONB,
+    new_budget_category_id UUID,
+    new_matched_rule JSONB,
+    UNIQUE (job_id, transaction_id)
+);
+
+CREATE TRIGGER update_recategorization_jobs_updated_at
+    BEFORE UPDATE ON recategorization_jobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
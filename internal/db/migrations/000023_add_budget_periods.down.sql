@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_provider_transactions_budget_category_date;
+ALTER TABLE budget_categories DROP CONSTRAINT IF EXISTS budget_categories_period_check;
+ALTER TABLE budget_categories
+    DROP COLUMN IF EXISTS period_length_days,
+    DROP COLUMN IF EXISTS period_anchor,
+    DROP COLUMN IF EXISTS period_start_day,
+    DROP COLUMN IF EXISTS period_type;
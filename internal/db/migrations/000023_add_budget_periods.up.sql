@@ -0,0 +1,18 @@
+-- Budgets apply to a recurring period. start_day is the ISO weekday (1 = Monday)
+-- for weekly budgets and the day of the month for monthly ones. Custom periods
+-- run for period_length_days from period_anchor.
+ALTER TABLE budget_categories
+    ADD COLUMN period_type VARCHAR(10) NOT NULL DEFAULT 'monthly'
+        CHECK (period_type IN ('weekly', 'monthly', 'custom')),
+    ADD COLUMN period_start_day INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN period_anchor DATE,
+    ADD COLUMN period_length_days INTEGER;
+
+ALTER TABLE budget_categories ADD CONSTRAINT budget_categories_period_check CHECK (
+    (period_type = 'weekly' AND period_start_day BETWEEN 1 AND 7) OR
+    (period_type = 'monthly' AND period_start_day BETWEEN 1 AND 28) OR
+    (period_type = 'custom' AND period_anchor IS NOT NULL AND period_length_days BETWEEN 1 AND 366)
+);
+
+CREATE INDEX idx_provider_transactions_budget_category_date
+    ON provider_transactions(budget_category_id, transaction_date);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_budget_periods_updated_at ON budget_periods;
+DROP TABLE IF EXISTS budget_periods;
+ALTER TABLE budget_categories
+    DROP COLUMN IF EXISTS rollover_cap,
+    DROP COLUMN IF EXISTS rollover_mode;
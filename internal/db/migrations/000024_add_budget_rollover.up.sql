@@ -0,0 +1,38 @@
+-- Unspent budget can carry over into the next period, in full or up to a cap
+ALTER TABLE budget_categories
+    ADD COLUMN rollover_mode VARCHAR(10) NOT NULL DEFAULT 'none'
+        CHECK (rollover_mode IN ('none', 'full', 'capped')),
+    ADD COLUMN rollover_cap DECIMAL(10,2)
+        CHECK (rollover_cap IS NULL OR rollover_cap > 0);
+
+-- Closed budget periods. Amounts are in the period's currency: the group's
+-- currency for a shared category, otherwise the user's preferred currency at
+-- the time the period was closed.
+CREATE TABLE budget_periods (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    budget_category_id UUID NOT NULL REFERENCES budget_categories(id) ON DELETE CASCADE,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    budget DECIMAL(12,2) NOT NULL,
+    carried_in DECIMAL(12,2) NOT NULL DEFAULT 0,
+    effective_budget DECIMAL(12,2) NOT NULL,
+    spent DECIMAL(12,2) NOT NULL,
+    rollover DECIMAL(12,2) NOT NULL DEFAULT 0,
+    rollover_mode VARCHAR(10) NOT NULL,
+    transaction_count INTEGER NOT NULL DEFAULT 0,
+    closed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (budget_category_id, period_start),
+    CHECK (period_end > period_start)
+);
+
+CREATE INDEX idx_budget_periods_category_end ON budget_periods(budget_category_id, period_end DESC);
+CREATE INDEX idx_budget_periods_user ON budget_periods(user_id, period_end DESC);
+
+CREATE TRIGGER update_budget_periods_updated_at
+    BEFORE UPDATE ON budget_periods
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
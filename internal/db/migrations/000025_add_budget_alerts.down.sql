@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS budget_alerts;
+DROP TRIGGER IF EXISTS update_push_devices_updated_at ON push_devices;
+DROP TABLE IF EXISTS push_devices;
+ALTER TABLE budget_categories
+    DROP COLUMN IF EXISTS alert_channel,
+    DROP COLUMN IF EXISTS alert_transaction_limit,
+    DROP COLUMN IF EXISTS alert_thresholds;
@@ -0,0 +1,47 @@
+-- Alert settings: percentages of the effective budget that trigger an alert,
+-- an optional per-transaction limit, and where alerts are delivered
+ALTER TABLE budget_categories
+    ADD COLUMN alert_thresholds JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN alert_transaction_limit DECIMAL(10,2)
+        CHECK (alert_transaction_limit IS NULL OR alert_transaction_limit > 0),
+    ADD COLUMN alert_channel VARCHAR(10) NOT NULL DEFAULT 'whatsapp'
+        CHECK (alert_channel IN ('whatsapp', 'push', 'both'));
+
+-- Devices registered for push notifications
+CREATE TABLE push_devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(255) NOT NULL UNIQUE,
+    platform VARCHAR(10) NOT NULL CHECK (platform IN ('ios', 'android', 'web')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_push_devices_user ON push_devices(user_id);
+
+CREATE TRIGGER update_push_devices_updated_at
+    BEFORE UPDATE ON push_devices
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Alerts sent to users. dedup_key makes each threshold fire once per period
+-- and each transaction alert fire once.
+CREATE TABLE budget_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    budget_category_id UUID NOT NULL REFERENCES budget_categories(id) ON DELETE CASCADE,
+    transaction_id UUID REFERENCES provider_transactions(id) ON DELETE SET NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('THRESHOLD', 'TRANSACTION_LIMIT')),
+    threshold INTEGER,
+    period_start TIMESTAMPTZ NOT NULL,
+    amount DECIMAL(12,2) NOT NULL,
+    budget DECIMAL(12,2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    message TEXT NOT NULL,
+    dedup_key VARCHAR(255) NOT NULL UNIQUE,
+    delivered_via VARCHAR(20),
+    delivery_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_budget_alerts_user ON budget_alerts(user_id, created_at DESC);
@@ -0,0 +1,19 @@
+ALTER TABLE budget_categories DROP COLUMN IF EXISTS parent_category_id;
+
+UPDATE provider_transactions SET category_id = NULL
+WHERE category_id IN (SELECT id FROM transaction_categories WHERE slug IS NOT NULL);
+DELETE FROM merchant_categories
+WHERE category_id IN (SELECT id FROM transaction_categories WHERE slug IS NOT NULL);
+DELETE FROM transaction_categories WHERE slug IS NOT NULL AND parent_id IS NOT NULL;
+DELETE FROM transaction_categories WHERE slug IS NOT NULL;
+
+DROP TRIGGER IF EXISTS update_merchant_categories_updated_at ON merchant_categories;
+ALTER TABLE merchant_categories
+    DROP COLUMN IF EXISTS updated_at,
+    ALTER COLUMN category_id DROP NOT NULL;
+
+DROP INDEX IF EXISTS idx_transaction_categories_parent;
+ALTER TABLE transaction_categories
+    ALTER COLUMN is_system DROP NOT NULL,
+    DROP COLUMN IF EXISTS sort_order,
+    DROP COLUMN IF EXISTS slug;
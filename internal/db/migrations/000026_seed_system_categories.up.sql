@@ -0,0 +1,105 @@
+-- System categories are identified by a stable slug so they can be seeded
+-- and referenced from code
+ALTER TABLE transaction_categories
+    ADD COLUMN slug VARCHAR(100) UNIQUE,
+    ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+UPDATE transaction_categories SET is_system = false WHERE is_system IS NULL;
+ALTER TABLE transaction_categories
+    ALTER COLUMN is_system SET NOT NULL,
+    ALTER COLUMN is_system SET DEFAULT false;
+CREATE INDEX idx_transaction_categories_parent ON transaction_categories(parent_id);
+
+-- Merchant names are stored normalized: lower case, single spaces
+DELETE FROM merchant_categories WHERE category_id IS NULL;
+ALTER TABLE merchant_categories
+    ALTER COLUMN category_id SET NOT NULL,
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TRIGGER update_merchant_categories_updated_at
+    BEFORE UPDATE ON merchant_categories
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- User budget categories can sit under a system category
+ALTER TABLE budget_categories
+    ADD COLUMN parent_category_id UUID REFERENCES transaction_categories(id);
+
+-- Top-level system categories
+INSERT INTO transaction_categories (name, slug, icon, color, is_system, sort_order) VALUES
+    ('Food', 'food', 'utensils', '#F97316', true, 10),
+    ('Transport', 'transport', 'car', '#3B82F6', true, 20),
+    ('Housing', 'housing', 'home', '#8B5CF6', true, 30),
+    ('Bills & Utilities', 'bills', 'receipt', '#EAB308', true, 40),
+    ('Shopping', 'shopping', 'shopping-bag', '#EC4899', true, 50),
+    ('Health', 'health', 'heart-pulse', '#EF4444', true, 60),
+    ('Education', 'education', 'graduation-cap', '#14B8A6', true, 70),
+    ('Family & Gifts', 'family', 'users', '#F59E0B', true, 80),
+    ('Fees & Charges', 'fees', 'percent', '#6B7280', true, 90),
+    ('Income', 'income', 'wallet', '#22C55E', true, 100),
+    ('Transfers', 'transfers', 'arrow-left-right', '#64748B', true, 110)
+ON CONFLICT (slug) DO NOTHING;
+
+-- Subcategories
+INSERT INTO transaction_categories (name, slug, icon, parent_id, is_system, sort_order)
+SELECT v.name, v.slug, v.icon, p.id, true, v.sort_order
+FROM (VALUES
+    ('food', 'Restaurants', 'food.restaurants', 'utensils', 1),
+    ('food', 'Groceries', 'food.groceries', 'shopping-cart', 2),
+    ('food', 'Cafes & Tea', 'food.cafes', 'coffee', 3),
+    ('food', 'Khat', 'food.khat', 'leaf', 4),
+    ('transport', 'Bajaj', 'transport.bajaj', 'bike', 1),
+    ('transport', 'Taxi', 'transport.taxi', 'car-taxi-front', 2),
+    ('transport', 'Bus', 'transport.bus', 'bus', 3),
+    ('transport', 'Fuel', 'transport.fuel', 'fuel', 4),
+    ('transport', 'Flights', 'transport.flights', 'plane', 5),
+    ('housing', 'Rent', 'housing.rent', 'key', 1),
+    ('housing', 'Maintenance', 'housing.maintenance', 'wrench', 2),
+    ('bills', 'Electricity', 'bills.electricity', 'zap', 1),
+    ('bills', 'Water', 'bills.water', 'droplet', 2),
+    ('bills', 'Mobile Airtime', 'bills.airtime', 'smartphone', 3),
+    ('bills', 'Internet', 'bills.internet', 'wifi', 4),
+    ('shopping', 'Clothing', 'shopping.clothing', 'shirt', 1),
+    ('shopping', 'Electronics', 'shopping.electronics', 'monitor', 2),
+    ('shopping', 'Household', 'shopping.household', 'sofa', 3),
+    ('health', 'Pharmacy', 'health.pharmacy', 'pill', 1),
+    ('health', 'Hospital & Clinic', 'health.hospital', 'hospital', 2),
+    ('education', 'School Fees', 'education.school_fees', 'school', 1),
+    ('education', 'Books & Supplies', 'education.supplies', 'book', 2),
+    ('family', 'Family Support', 'family.support', 'hand-heart', 1),
+    ('family', 'Weddings & Events', 'family.events', 'party-popper', 2),
+    ('family', 'Zakat & Charity', 'family.charity', 'heart-handshake', 3),
+    ('fees', 'Transfer Fees', 'fees.transfer', 'percent', 1),
+    ('fees', 'Bank Charges', 'fees.bank', 'landmark', 2),
+    ('income', 'Salary', 'income.salary', 'briefcase', 1),
+    ('income', 'Business', 'income.business', 'store', 2),
+    ('income', 'Remittances Received', 'income.remittances', 'globe', 3),
+    ('transfers', 'Own Accounts', 'transfers.own', 'repeat', 1),
+    ('transfers', 'Remittances Sent', 'transfers.remittances', 'send', 2)
+) AS v(parent_slug, name, slug, icon, sort_order)
+JOIN transaction_categories p ON p.slug = v.parent_slug
+ON CONFLICT (slug) DO NOTHING;
+
+-- Well known merchants
+INSERT INTO merchant_categories (merchant_name, category_id)
+SELECT v.merchant_name, c.id
+FROM (VALUES
+    ('telesom', 'bills.airtime'),
+    ('somtel', 'bills.airtime'),
+    ('hormuud', 'bills.airtime'),
+    ('golis', 'bills.airtime'),
+    ('telesom internet', 'bills.internet'),
+    ('somtel internet', 'bills.internet'),
+    ('beco', 'bills.electricity'),
+    ('hargeisa water agency', 'bills.water'),
+    ('dahabshiil', 'transfers.remittances'),
+    ('amal express', 'transfers.remittances'),
+    ('taaj', 'transfers.remittances'),
+    ('world remit', 'transfers.remittances'),
+    ('daallo airlines', 'transport.flights'),
+    ('ethiopian airlines', 'transport.flights'),
+    ('flydubai', 'transport.flights'),
+    ('totalenergies', 'transport.fuel'),
+    ('gulf petroleum', 'transport.fuel')
+) AS v(merchant_name, slug)
+JOIN transaction_categories c ON c.slug = v.slug
+ON CONFLICT (merchant_name) DO NOTHING;
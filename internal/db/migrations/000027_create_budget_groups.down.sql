@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_budget_categories_group;
+ALTER TABLE budget_categories DROP COLUMN IF EXISTS group_id;
+
+DROP TRIGGER IF EXISTS update_budget_group_invites_updated_at ON budget_group_invites;
+DROP TRIGGER IF EXISTS update_budget_group_members_updated_at ON budget_group_members;
+DROP TRIGGER IF EXISTS update_budget_groups_updated_at ON budget_groups;
+
+DROP TABLE IF EXISTS budget_group_invites;
+DROP TABLE IF EXISTS budget_group_accounts;
+DROP TABLE IF EXISTS budget_group_members;
+DROP TABLE IF EXISTS budget_groups;
@@ -0,0 +1,73 @@
+-- Households that share budget categories. Amounts of shared categories are
+-- in the group's currency.
+CREATE TABLE budget_groups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(50) NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id),
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE budget_group_members (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES budget_groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (group_id, user_id)
+);
+
+CREATE INDEX idx_budget_group_members_user ON budget_group_members(user_id);
+
+-- The linked accounts each member shares with the group. Only transactions on
+-- these accounts count towards shared categories.
+CREATE TABLE budget_group_accounts (
+    group_id UUID NOT NULL REFERENCES budget_groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    linked_account_id UUID NOT NULL REFERENCES linked_accounts(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, linked_account_id)
+);
+
+CREATE INDEX idx_budget_group_accounts_user ON budget_group_accounts(user_id);
+
+-- Invitations by phone number, confirmed with a code sent over WhatsApp
+CREATE TABLE budget_group_invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES budget_groups(id) ON DELETE CASCADE,
+    phone VARCHAR(50) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('editor', 'viewer')),
+    invited_by UUID NOT NULL REFERENCES users(id),
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(10) NOT NULL DEFAULT 'PENDING'
+        CHECK (status IN ('PENDING', 'ACCEPTED', 'DECLINED', 'REVOKED')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_budget_group_invites_phone ON budget_group_invites(phone) WHERE status = 'PENDING';
+
+ALTER TABLE budget_categories
+    ADD COLUMN group_id UUID REFERENCES budget_groups(id);
+
+CREATE INDEX idx_budget_categories_group ON budget_categories(group_id) WHERE group_id IS NOT NULL;
+
+CREATE TRIGGER update_budget_groups_updated_at
+    BEFORE UPDATE ON budget_groups
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_budget_group_members_updated_at
+    BEFORE UPDATE ON budget_group_members
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_budget_group_invites_updated_at
+    BEFORE UPDATE ON budget_group_invites
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
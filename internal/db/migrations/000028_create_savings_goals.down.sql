@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_savings_goals_updated_at ON savings_goals;
+DROP TABLE IF EXISTS savings_goal_contributions;
+DROP TABLE IF EXISTS savings_goals;
@@ -0,0 +1,41 @@
+-- Savings goals. Progress comes from the watched account's latest balance
+-- when one is linked, and from manual contributions otherwise. Amounts are in
+-- the goal's currency.
+CREATE TABLE savings_goals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    icon VARCHAR(50) NOT NULL DEFAULT 'piggy-bank',
+    target_amount DECIMAL(12,2) NOT NULL CHECK (target_amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    deadline DATE NOT NULL,
+    linked_account_id UUID REFERENCES linked_accounts(id) ON DELETE SET NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'ACTIVE'
+        CHECK (status IN ('ACTIVE', 'ACHIEVED', 'ARCHIVED')),
+    -- The highest milestone already announced, as a percentage of the target
+    last_milestone INTEGER NOT NULL DEFAULT 0,
+    achieved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_savings_goals_user ON savings_goals(user_id, status);
+CREATE INDEX idx_savings_goals_account ON savings_goals(linked_account_id) WHERE linked_account_id IS NOT NULL;
+
+-- Money the user set aside towards a goal by hand. Withdrawals are negative.
+CREATE TABLE savings_goal_contributions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    goal_id UUID NOT NULL REFERENCES savings_goals(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount DECIMAL(12,2) NOT NULL CHECK (amount <> 0),
+    note VARCHAR(255),
+    contributed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_savings_goal_contributions_goal ON savings_goal_contributions(goal_id, contributed_at DESC);
+
+CREATE TRIGGER update_savings_goals_updated_at
+    BEFORE UPDATE ON savings_goals
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
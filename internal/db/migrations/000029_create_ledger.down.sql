@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+DROP TRIGGER IF EXISTS journal_entries_append_only ON journal_entries;
+DROP FUNCTION IF EXISTS check_journal_balanced();
+DROP FUNCTION IF EXISTS prevent_ledger_mutation();
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS journal_entries;
@@ -0,0 +1,85 @@
+-- Double-entry ledger behind wallet balances. A journal entry is one business
+-- event; its lines move money between wallets and system accounts and always
+-- sum to zero. Positive amounts increase the account, so a wallet's balance
+-- is the sum of its lines. Both tables are append-only: mistakes are undone
+-- by posting a reversing entry.
+CREATE TABLE journal_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(20) NOT NULL,
+    -- Caller supplied key that makes posting idempotent
+    reference VARCHAR(100) UNIQUE,
+    description VARCHAR(255),
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    journal_entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    wallet_id UUID REFERENCES wallets(id),
+    system_account VARCHAR(20),
+    amount DECIMAL(14,2) NOT NULL CHECK (amount <> 0),
+    -- The wallet's balance once this line was applied
+    balance_after DECIMAL(14,2),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((wallet_id IS NULL) <> (system_account IS NULL)),
+    CHECK ((wallet_id IS NULL) = (balance_after IS NULL))
+);
+
+CREATE INDEX idx_ledger_entries_journal ON ledger_entries(journal_entry_id);
+CREATE INDEX idx_ledger_entries_wallet ON ledger_entries(wallet_id, id DESC) WHERE wallet_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION prevent_ledger_mutation()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entries_append_only
+    BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW
+    EXECUTE FUNCTION prevent_ledger_mutation();
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW
+    EXECUTE FUNCTION prevent_ledger_mutation();
+
+-- Checked at commit, once every line of the entry has been inserted
+CREATE OR REPLACE FUNCTION check_journal_balanced()
+RETURNS TRIGGER AS $$
+DECLARE
+    total DECIMAL(14,2);
+BEGIN
+    SELECT SUM(amount) INTO total FROM ledger_entries WHERE journal_entry_id = NEW.journal_entry_id;
+    IF total <> 0 THEN
+        RAISE EXCEPTION 'journal entry % does not balance: %', NEW.journal_entry_id, total;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+    AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+    EXECUTE FUNCTION check_journal_balanced();
+
+-- Wallets were created before the ledger existed; open each non-zero balance
+-- with an entry against the suspense account so balances match their lines
+DO $$
+DECLARE
+    w RECORD;
+    entry_id UUID;
+BEGIN
+    FOR w IN SELECT id, balance, currency FROM wallets WHERE balance <> 0 LOOP
+        INSERT INTO journal_entries (kind, reference, description, currency)
+        VALUES ('adjustment', 'opening:' || w.id, 'Opening balance', w.currency)
+        RETURNING id INTO entry_id;
+        INSERT INTO ledger_entries (journal_entry_id, wallet_id, amount, balance_after)
+        VALUES (entry_id, w.id, w.balance, w.balance);
+        INSERT INTO ledger_entries (journal_entry_id, system_account, amount)
+        VALUES (entry_id, 'suspense', -w.balance);
+    END LOOP;
+END $$;
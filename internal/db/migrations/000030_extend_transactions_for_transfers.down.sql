@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_transactions_receiver_created;
+DROP INDEX IF EXISTS idx_transactions_sender_created;
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactions_distinct_parties,
+    DROP CONSTRAINT IF EXISTS transactions_amount_positive,
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS failure_reason,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS otp_attempts,
+    DROP COLUMN IF EXISTS otp_hash,
+    DROP COLUMN IF EXISTS journal_entry_id,
+    DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,16 @@
+-- Wallet to wallet transfers between users. A transfer waits in pending
+-- until the sender confirms it with the code sent to their phone, then posts
+-- one journal entry moving the money.
+ALTER TABLE transactions
+    ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    ADD COLUMN journal_entry_id UUID REFERENCES journal_entries(id),
+    ADD COLUMN otp_hash VARCHAR(64),
+    ADD COLUMN otp_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN expires_at TIMESTAMPTZ,
+    ADD COLUMN failure_reason VARCHAR(255),
+    ADD COLUMN completed_at TIMESTAMPTZ,
+    ADD CONSTRAINT transactions_amount_positive CHECK (amount > 0),
+    ADD CONSTRAINT transactions_distinct_parties CHECK (sender_id <> receiver_id);
+
+CREATE INDEX idx_transactions_sender_created ON transactions(sender_id, created_at DESC);
+CREATE INDEX idx_transactions_receiver_created ON transactions(receiver_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_reference;
+DROP TRIGGER IF EXISTS update_payment_requests_updated_at ON payment_requests;
+DROP TABLE IF EXISTS payment_requests;
@@ -0,0 +1,41 @@
+-- Requests for money shared as a link or QR code. A request may be addressed
+-- to a phone number, which gets WhatsApp reminders, or left open for anyone
+-- with the link. It is paid by a wallet transfer, or the payer claims to
+-- have paid from a linked account and the requester confirms it.
+CREATE TABLE payment_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    requester_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    payer_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    payer_phone VARCHAR(50),
+    amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    note VARCHAR(255),
+    token VARCHAR(32) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'paid', 'declined', 'expired', 'cancelled')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    paid_via VARCHAR(20) CHECK (paid_via IN ('wallet', 'linked_account', 'manual')),
+    transfer_id UUID REFERENCES transactions(id),
+    linked_account_id UUID REFERENCES linked_accounts(id) ON DELETE SET NULL,
+    external_reference VARCHAR(100),
+    claimed_at TIMESTAMPTZ,
+    paid_at TIMESTAMPTZ,
+    declined_at TIMESTAMPTZ,
+    reminders_sent INTEGER NOT NULL DEFAULT 0,
+    last_reminded_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_requests_requester ON payment_requests(requester_id, created_at DESC);
+CREATE INDEX idx_payment_requests_payer ON payment_requests(payer_id, created_at DESC) WHERE payer_id IS NOT NULL;
+CREATE INDEX idx_payment_requests_payer_phone ON payment_requests(payer_phone) WHERE payer_phone IS NOT NULL;
+CREATE INDEX idx_payment_requests_pending ON payment_requests(expires_at) WHERE status = 'pending';
+
+-- Transfers record what they pay for, e.g. 'payment_request:<id>'
+CREATE INDEX idx_transactions_reference ON transactions(reference_id) WHERE reference_id IS NOT NULL;
+
+CREATE TRIGGER update_payment_requests_updated_at
+    BEFORE UPDATE ON payment_requests
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
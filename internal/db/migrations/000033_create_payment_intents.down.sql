@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_payment_intents_updated_at ON payment_intents;
+DROP TABLE IF EXISTS payment_intents;
@@ -0,0 +1,31 @@
+-- Mobile-money payments the user started by dialling a USSD string the app
+-- built. An intent completes when the debit it produced arrives through a
+-- receipt or a sync, and expires if none does within a day.
+CREATE TABLE payment_intents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    linked_account_id UUID NOT NULL REFERENCES linked_accounts(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL,
+    recipient_number VARCHAR(20) NOT NULL,
+    amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    note VARCHAR(255),
+    dial_string VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'completed', 'expired', 'cancelled')),
+    provider_transaction_id UUID REFERENCES provider_transactions(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_intents_account ON payment_intents(linked_account_id, created_at DESC);
+CREATE INDEX idx_payment_intents_pending ON payment_intents(linked_account_id, expires_at) WHERE status = 'pending';
+CREATE UNIQUE INDEX idx_payment_intents_transaction ON payment_intents(provider_transaction_id)
+    WHERE provider_transaction_id IS NOT NULL;
+
+CREATE TRIGGER update_payment_intents_updated_at
+    BEFORE UPDATE ON payment_intents
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
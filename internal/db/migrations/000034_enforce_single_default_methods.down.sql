@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_linked_accounts_one_default;
+DROP INDEX IF EXISTS idx_payment_methods_one_default;
@@ -0,0 +1,40 @@
+-- A user has at most one default payment method per type and one default
+-- linked account per provider. Earlier code could leave several defaults
+-- behind; keep the most recently updated one before enforcing it.
+
+-- Only active methods can be the default, so drop the others first and pick
+-- the survivor from what is left
+UPDATE payment_methods SET is_default = false WHERE is_default AND status <> 'active';
+
+UPDATE payment_methods pm SET is_default = false
+WHERE pm.is_default AND EXISTS (
+    SELECT 1 FROM payment_methods o
+    WHERE o.user_id = pm.user_id AND o.type = pm.type AND o.is_default
+      AND (o.updated_at, o.id) > (pm.updated_at, pm.id)
+);
+
+-- A type left without a default, as when its only defaults were inactive,
+-- gets its most recently updated active method as the default
+UPDATE payment_methods pm SET is_default = true
+WHERE pm.status = 'active' AND NOT EXISTS (
+    SELECT 1 FROM payment_methods o
+    WHERE o.user_id = pm.user_id AND o.type = pm.type AND o.is_default
+) AND NOT EXISTS (
+    SELECT 1 FROM payment_methods o
+    WHERE o.user_id = pm.user_id AND o.type = pm.type AND o.status = 'active'
+      AND (o.updated_at, o.id) > (pm.updated_at, pm.id)
+);
+
+CREATE UNIQUE INDEX idx_payment_methods_one_default
+    ON payment_methods(user_id, type) WHERE is_default;
+
+UPDATE linked_accounts la SET is_default_account = false
+WHERE la.is_default_account AND la.deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM linked_accounts o
+    WHERE o.user_id = la.user_id AND o.provider = la.provider
+      AND o.is_default_account AND o.deleted_at IS NULL
+      AND (o.updated_at, o.id) > (la.updated_at, la.id)
+);
+
+CREATE UNIQUE INDEX idx_linked_accounts_one_default
+    ON linked_accounts(user_id, provider) WHERE is_default_account AND deleted_at IS NULL;
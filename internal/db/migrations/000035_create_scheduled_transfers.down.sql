@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_scheduled_transfers_updated_at ON scheduled_transfers;
+DROP TABLE IF EXISTS scheduled_transfers;
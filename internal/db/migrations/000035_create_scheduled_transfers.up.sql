@@ -0,0 +1,43 @@
+-- Transfers that run at a set time, once or by an RRULE-style recurrence.
+-- next_run_at is the occurrence due next; a run that found the wallet short
+-- may be retried at retry_at before the occurrence is skipped. Each run is
+-- a transfer referencing 'scheduled_transfer:<id>:<occurrence>', and the
+-- transfer only completes if it moves next_run_at on from that occurrence,
+-- so no occurrence is paid twice.
+CREATE TABLE scheduled_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    description VARCHAR(255),
+    start_at TIMESTAMPTZ NOT NULL,
+    recurrence VARCHAR(255),
+    on_insufficient_funds VARCHAR(10) NOT NULL DEFAULT 'retry'
+        CHECK (on_insufficient_funds IN ('skip', 'retry')),
+    status VARCHAR(20) NOT NULL
+        CHECK (status IN ('pending_confirmation', 'active', 'paused', 'completed', 'cancelled')),
+    next_run_at TIMESTAMPTZ,
+    occurrences INTEGER NOT NULL DEFAULT 0,
+    retry_attempts INTEGER NOT NULL DEFAULT 0,
+    retry_at TIMESTAMPTZ,
+    reminded_for TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_transfer_id UUID REFERENCES transactions(id),
+    last_failure_reason VARCHAR(255),
+    otp_hash VARCHAR(64),
+    otp_attempts INTEGER NOT NULL DEFAULT 0,
+    otp_expires_at TIMESTAMPTZ,
+    confirmed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (recipient_id <> user_id)
+);
+
+CREATE INDEX idx_scheduled_transfers_user ON scheduled_transfers(user_id, created_at DESC);
+CREATE INDEX idx_scheduled_transfers_due ON scheduled_transfers((COALESCE(retry_at, next_run_at))) WHERE status = 'active';
+
+CREATE TRIGGER update_scheduled_transfers_updated_at
+    BEFORE UPDATE ON scheduled_transfers
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,58 @@
+-- Bills one user paid and split with others, who each owe the creator a
+-- share. Participants are KaafiPay users or plain phone numbers; a share
+-- held by phone is picked up by whoever signs up with that number. Shares
+-- are settled by a wallet transfer referencing 'bill_split_share:<id>' or
+-- marked paid by the creator.
+CREATE TABLE bill_splits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    creator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    transaction_id UUID REFERENCES provider_transactions(id) ON DELETE SET NULL,
+    description VARCHAR(255) NOT NULL,
+    total_amount DECIMAL(12,2) NOT NULL CHECK (total_amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    method VARCHAR(20) NOT NULL CHECK (method IN ('equal', 'percentage', 'exact')),
+    creator_share DECIMAL(12,2) NOT NULL CHECK (creator_share >= 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'settled', 'cancelled')),
+    settled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_bill_splits_creator ON bill_splits(creator_id, created_at DESC);
+-- A transaction is split at most once at a time
+CREATE UNIQUE INDEX idx_bill_splits_transaction ON bill_splits(transaction_id)
+    WHERE transaction_id IS NOT NULL AND status <> 'cancelled';
+
+CREATE TABLE bill_split_shares (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    split_id UUID NOT NULL REFERENCES bill_splits(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    phone VARCHAR(50) NOT NULL,
+    name VARCHAR(100),
+    amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+    percentage DECIMAL(5,2),
+    status VARCHAR(20) NOT NULL DEFAULT 'owed'
+        CHECK (status IN ('owed', 'paid', 'cancelled')),
+    settled_via VARCHAR(20) CHECK (settled_via IN ('transfer', 'manual')),
+    transfer_id UUID REFERENCES transactions(id),
+    paid_at TIMESTAMPTZ,
+    last_reminded_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (split_id, phone)
+);
+
+CREATE INDEX idx_bill_split_shares_split ON bill_split_shares(split_id);
+CREATE INDEX idx_bill_split_shares_user ON bill_split_shares(user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX idx_bill_split_shares_phone ON bill_split_shares(phone) WHERE status = 'owed';
+
+CREATE TRIGGER update_bill_splits_updated_at
+    BEFORE UPDATE ON bill_splits
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_bill_split_shares_updated_at
+    BEFORE UPDATE ON bill_split_shares
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
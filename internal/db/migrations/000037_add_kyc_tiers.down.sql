@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_transactions_sender_completed;
+DROP TRIGGER IF EXISTS update_kyc_documents_updated_at ON kyc_documents;
+DROP TABLE IF EXISTS kyc_documents;
+ALTER TABLE users DROP COLUMN IF EXISTS kyc_tier;
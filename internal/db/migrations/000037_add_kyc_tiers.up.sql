@@ -0,0 +1,42 @@
+-- KYC tiers set the user's transfer limits. Users start phone-verified and
+-- move up as reviewers approve the documents they upload.
+ALTER TABLE users ADD COLUMN kyc_tier VARCHAR(20) NOT NULL DEFAULT 'phone_verified'
+    CHECK (kyc_tier IN ('phone_verified', 'id_verified', 'full'));
+
+-- Metadata of uploaded KYC documents; the files are in object storage
+CREATE TABLE kyc_documents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document_type VARCHAR(30) NOT NULL
+        CHECK (document_type IN ('national_id', 'passport', 'drivers_license', 'proof_of_address', 'selfie')),
+    document_number VARCHAR(50),
+    issuing_country VARCHAR(2),
+    expires_on DATE,
+    storage_key VARCHAR(255) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    sha256 VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected')),
+    rejection_reason VARCHAR(255),
+    reviewed_by VARCHAR(100),
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_kyc_documents_user ON kyc_documents(user_id, created_at DESC);
+-- The review queue, oldest first
+CREATE INDEX idx_kyc_documents_pending ON kyc_documents(created_at) WHERE status = 'pending';
+-- One document of each type awaits review at a time
+CREATE UNIQUE INDEX idx_kyc_documents_one_pending ON kyc_documents(user_id, document_type) WHERE status = 'pending';
+
+-- Transfer limits sum what each user sent in the current day and month
+CREATE INDEX idx_transactions_sender_completed ON transactions(sender_id, completed_at)
+    WHERE status = 'completed';
+
+CREATE TRIGGER update_kyc_documents_updated_at
+    BEFORE UPDATE ON kyc_documents
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_suspended_until;
+DROP INDEX IF EXISTS idx_wallets_frozen_until;
+DROP TABLE IF EXISTS account_status_changes;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_until, DROP COLUMN IF EXISTS suspended_reason;
+ALTER TABLE wallets DROP COLUMN IF EXISTS frozen_until, DROP COLUMN IF EXISTS frozen_reason;
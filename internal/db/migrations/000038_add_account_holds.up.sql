@@ -0,0 +1,31 @@
+-- Why a wallet is frozen or a user suspended, and until when. A NULL
+-- expiry lasts until someone lifts it.
+ALTER TABLE wallets
+    ADD COLUMN frozen_reason VARCHAR(255),
+    ADD COLUMN frozen_until TIMESTAMPTZ;
+
+ALTER TABLE users
+    ADD COLUMN suspended_reason VARCHAR(255),
+    ADD COLUMN suspended_until TIMESTAMPTZ;
+
+-- Every freeze, unfreeze, suspension and reinstatement, by an admin or by
+-- the system
+CREATE TABLE account_status_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wallet_id UUID REFERENCES wallets(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL
+        CHECK (action IN ('wallet_frozen', 'wallet_unfrozen', 'user_suspended', 'user_reinstated')),
+    previous_status VARCHAR(20) NOT NULL,
+    new_status VARCHAR(20) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_account_status_changes_user ON account_status_changes(user_id, created_at DESC);
+
+-- The expiry worker looks for holds that have run out
+CREATE INDEX idx_wallets_frozen_until ON wallets(frozen_until) WHERE status = 'frozen';
+CREATE INDEX idx_users_suspended_until ON users(suspended_until) WHERE is_active = false;
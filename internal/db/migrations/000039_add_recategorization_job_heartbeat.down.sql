@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_recategorization_jobs_running;
+ALTER TABLE recategorization_jobs DROP COLUMN IF EXISTS heartbeat_at;
@@ -0,0 +1,5 @@
+-- The worker running a job touches heartbeat_at after every batch. A running
+-- job whose heartbeat is older than the lease was abandoned and is requeued.
+ALTER TABLE recategorization_jobs ADD COLUMN heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX idx_recategorization_jobs_running ON recategorization_jobs(heartbeat_at) WHERE status = 'RUNNING';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_payment_methods_fingerprint;
+ALTER TABLE payment_methods ADD CONSTRAINT payment_methods_user_id_type_account_number_key UNIQUE (user_id, type, account_number);
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS fingerprint;
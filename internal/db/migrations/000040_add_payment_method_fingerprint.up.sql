@@ -0,0 +1,17 @@
+-- Cards keep only their last four digits, so two different cards can share
+-- an account number. Methods are unique on a fingerprint instead: the card's
+-- brand, last four digits and expiry, or the account number for the rest.
+ALTER TABLE payment_methods ADD COLUMN fingerprint VARCHAR(100);
+
+UPDATE payment_methods SET fingerprint = CASE
+    WHEN type = 'card' AND metadata ? 'expiryMonth' AND metadata ? 'expiryYear' THEN
+        COALESCE(metadata->>'brand', '') || ':' || account_number || ':' ||
+        LPAD(metadata->>'expiryMonth', 2, '0') || '/' || (metadata->>'expiryYear')
+    ELSE account_number
+END;
+
+ALTER TABLE payment_methods ALTER COLUMN fingerprint SET NOT NULL;
+
+ALTER TABLE payment_methods DROP CONSTRAINT IF EXISTS payment_methods_user_id_type_account_number_key;
+
+CREATE UNIQUE INDEX idx_payment_methods_fingerprint ON payment_methods(user_id, type, fingerprint);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_kyc_documents_approved_expiry;
+UPDATE kyc_documents SET status = 'approved' WHERE status = 'expired';
+ALTER TABLE kyc_documents DROP CONSTRAINT IF EXISTS kyc_documents_status_check;
+ALTER TABLE kyc_documents ADD CONSTRAINT kyc_documents_status_check
+    CHECK (status IN ('pending', 'approved', 'rejected'));
@@ -0,0 +1,7 @@
+-- Approved documents are marked expired once their expiry date has passed,
+-- and their owners' tiers worked out again
+ALTER TABLE kyc_documents DROP CONSTRAINT IF EXISTS kyc_documents_status_check;
+ALTER TABLE kyc_documents ADD CONSTRAINT kyc_documents_status_check
+    CHECK (status IN ('pending', 'approved', 'rejected', 'expired'));
+
+CREATE INDEX idx_kyc_documents_approved_expiry ON kyc_documents(expires_on) WHERE status = 'approved';
@@ -0,0 +1 @@
+ALTER TABLE budget_group_invites RENAME COLUMN otp_attempts TO attempts;
@@ -0,0 +1,3 @@
+-- Invite codes count attempts in the same column as the other one-time
+-- codes, so they are claimed by the same conditional update
+ALTER TABLE budget_group_invites RENAME COLUMN attempts TO otp_attempts;
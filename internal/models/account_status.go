@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account status change actions
+const (
+	AccountWalletFrozen   = "wallet_frozen"
+	AccountWalletUnfrozen = "wallet_unfrozen"
+	AccountUserSuspended  = "user_suspended"
+	AccountUserReinstated = "user_reinstated"
+)
+
+// User statuses recorded in the audit trail
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+)
+
+// AccountStatusChange is the audit record of a wallet being frozen or
+// unfrozen, or a user being suspended or reinstated. Actor is the admin
+// who did it, or "system" for automated holds and expiries.
+type AccountStatusChange struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID         uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	WalletID       *uuid.UUID `json:"walletId,omitempty" gorm:"type:uuid"`
+	Action         string     `json:"action" gorm:"type:varchar(20);not null"`
+	PreviousStatus string     `json:"previousStatus" gorm:"type:varchar(20);not null"`
+	NewStatus      string     `json:"newStatus" gorm:"type:varchar(20);not null"`
+	Reason         string     `json:"reason" gorm:"type:varchar(255);not null"`
+	Actor          string     `json:"actor" gorm:"type:varchar(100);not null"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (AccountStatusChange) TableName() string {
+	return "account_status_changes"
+}
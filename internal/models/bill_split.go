@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How a bill is divided among its participants
+const (
+	SplitMethodEqual      = "equal"
+	SplitMethodPercentage = "percentage"
+	SplitMethodExact      = "exact"
+)
+
+// Bill split statuses. A split is settled once every share is paid.
+const (
+	BillSplitOpen      = "open"
+	BillSplitSettled   = "settled"
+	BillSplitCancelled = "cancelled"
+)
+
+// Bill split share statuses
+const (
+	BillShareOwed      = "owed"
+	BillSharePaid      = "paid"
+	BillShareCancelled = "cancelled"
+)
+
+// How a share was settled
+const (
+	SettledViaTransfer = "transfer" // a KaafiPay transfer to the creator
+	SettledViaManual   = "manual"   // marked paid by the creator
+)
+
+// BillSplit divides a bill the creator paid among the people who shared
+// it. Each participant owes the creator their share; the creator's own
+// share is what is left.
+type BillSplit struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatorID     uuid.UUID  `json:"creatorId" gorm:"type:uuid;not null"`
+	TransactionID *uuid.UUID `json:"transactionId,omitempty" gorm:"type:uuid"`
+	Description   string     `json:"description" gorm:"type:varchar(255);not null"`
+	TotalAmount   float64    `json:"totalAmount" gorm:"type:decimal(12,2);not null"`
+	Currency      string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Method        string     `json:"method" gorm:"type:varchar(20);not null"`
+	CreatorShare  float64    `json:"creatorShare" gorm:"type:decimal(12,2);not null"`
+	Status        string     `json:"status" gorm:"type:varchar(20);not null;default:'open'"`
+	SettledAt     *time.Time `json:"settledAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Creator *User            `json:"creator,omitempty" gorm:"foreignKey:CreatorID"`
+	Shares  []BillSplitShare `json:"shares,omitempty" gorm:"foreignKey:SplitID"`
+}
+
+// TableName specifies the table name for the model
+func (BillSplit) TableName() string {
+	return "bill_splits"
+}
+
+// BillSplitShare is what one participant owes the creator of a split. A
+// participant without a KaafiPay account is known by phone number until
+// one signs up with it.
+type BillSplitShare struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SplitID        uuid.UUID  `json:"splitId" gorm:"type:uuid;not null"`
+	UserID         *uuid.UUID `json:"userId,omitempty" gorm:"type:uuid"`
+	Phone          string     `json:"phone" gorm:"type:varchar(50);not null"`
+	Name           string     `json:"name,omitempty" gorm:"type:varchar(100)"`
+	Amount         float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Percentage     *float64   `json:"percentage,omitempty" gorm:"type:decimal(5,2)"`
+	Status         string     `json:"status" gorm:"type:varchar(20);not null;default:'owed'"`
+	SettledVia     *string    `json:"settledVia,omitempty" gorm:"type:varchar(20)"`
+	TransferID     *uuid.UUID `json:"transferId,omitempty" gorm:"type:uuid"`
+	PaidAt         *time.Time `json:"paidAt,omitempty"`
+	LastRemindedAt *time.Time `json:"lastRemindedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (BillSplitShare) TableName() string {
+	return "bill_split_shares"
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Budget alert kinds
+const (
+	BudgetAlertThreshold        = "THRESHOLD"
+	BudgetAlertTransactionLimit = "TRANSACTION_LIMIT"
+)
+
+// Alert delivery channels
+const (
+	AlertChannelWhatsApp = "whatsapp"
+	AlertChannelPush     = "push"
+	AlertChannelBoth     = "both"
+)
+
+// Limits on alert thresholds
+const (
+	MaxAlertThresholds = 5
+	MaxAlertThreshold  = 500 // percent of the effective budget
+)
+
+// AlertThresholds are percentages of a category's effective budget
+type AlertThresholds []int
+
+// Value implements the driver.Valuer interface
+func (t AlertThresholds) Value() (driver.Value, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]int(t))
+}
+
+// Scan implements the sql.Scanner interface
+func (t *AlertThresholds) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, (*[]int)(t))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]int)(t))
+	case nil:
+		*t = nil
+		return nil
+	}
+	return errors.New("invalid scan source for AlertThresholds")
+}
+
+// BudgetAlert is an alert sent about a budget category
+type BudgetAlert struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID           uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	BudgetCategoryID uuid.UUID  `json:"budgetCategoryId" gorm:"type:uuid;not null"`
+	TransactionID    *uuid.UUID `json:"transactionId,omitempty" gorm:"type:uuid"`
+	Kind             string     `json:"kind" gorm:"type:varchar(20);not null"`
+	Threshold        *int       `json:"threshold,omitempty"`
+	PeriodStart      time.Time  `json:"periodStart" gorm:"not null"`
+	Amount           float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Budget           float64    `json:"budget" gorm:"type:decimal(12,2);not null"`
+	Currency         string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Message          string     `json:"message" gorm:"not null"`
+	DedupKey         string     `json:"-" gorm:"type:varchar(255);not null;unique"`
+	DeliveredVia     string     `json:"deliveredVia,omitempty" gorm:"type:varchar(20)"`
+	DeliveryError    string     `json:"deliveryError,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (BudgetAlert) TableName() string {
+	return "budget_alerts"
+}
@@ -19,20 +19,63 @@ func (e ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Field, e.Message)
 }
 
-// BudgetRule represents a single rule for categorizing transactions
-type BudgetRule struct {
-	Type     string `json:"type"`     // 'description', 'merchant', 'amount'
-	Operator string `json:"operator"` // 'contains', 'equals', 'greater', 'less'
-	Value    string `json:"value"`    // The value to match against
-}
+// Budget category priorities. Categories are evaluated from the lowest value
+// up, and the first one with a matching rule claims the transaction.
+const (
+	DefaultBudgetPriority = 100
+	MinBudgetPriority     = 1
+	MaxBudgetPriority     = 1000
+)
+
+// Budget period types
+const (
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+	BudgetPeriodCustom  = "custom"
+)
+
+// Budget rollover modes
+const (
+	RolloverNone   = "none"
+	RolloverFull   = "full"
+	RolloverCapped = "capped"
+)
 
 // BudgetCategory represents a budget category with rules for auto-categorization
 type BudgetCategory struct {
-	ID        uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
-	UserID    uuid.UUID       `json:"userId" gorm:"type:uuid;not null"`
-	Name      string          `json:"name" gorm:"type:varchar(50);not null"`
-	Icon      string          `json:"icon" gorm:"type:varchar(50);not null"`
-	Budget    float64         `json:"budget" gorm:"type:decimal(10,2);not null"`
+	ID       uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID   uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	Name     string    `json:"name" gorm:"type:varchar(50);not null"`
+	Icon     string    `json:"icon" gorm:"type:varchar(50);not null"`
+	Budget   float64   `json:"budget" gorm:"type:decimal(10,2);not null"`
+	Priority int       `json:"priority" gorm:"not null;default:100"`
+
+	// System category the budget sits under; its transactions are reported
+	// under that category too
+	ParentCategoryID *uuid.UUID `json:"parentCategoryId,omitempty" gorm:"type:uuid"`
+	// Group the category is shared with. Shared categories count spending
+	// from every member's shared accounts; UserID is whoever created it.
+	GroupID *uuid.UUID `json:"groupId,omitempty" gorm:"type:uuid"`
+
+	// Period the budget applies to. StartDay is the ISO weekday (1 = Monday)
+	// for weekly budgets and the day of the month (1-28) for monthly ones.
+	// Custom periods last PeriodLengthDays starting from PeriodAnchor.
+	PeriodType       string     `json:"periodType" gorm:"type:varchar(10);not null;default:'monthly'"`
+	PeriodStartDay   int        `json:"periodStartDay" gorm:"not null;default:1"`
+	PeriodAnchor     *time.Time `json:"periodAnchor,omitempty" gorm:"type:date"`
+	PeriodLengthDays int        `json:"periodLengthDays,omitempty"`
+
+	// Unspent budget carried into the next period: none, full, or at most
+	// RolloverCap
+	RolloverMode string   `json:"rolloverMode" gorm:"type:varchar(10);not null;default:'none'"`
+	RolloverCap  *float64 `json:"rolloverCap,omitempty" gorm:"type:decimal(10,2)"`
+
+	// Alerts fire once per period as spending crosses each threshold, and for
+	// any single debit above AlertTransactionLimit
+	AlertThresholds       AlertThresholds `json:"alertThresholds" gorm:"type:jsonb;not null;default:'[]'"`
+	AlertTransactionLimit *float64        `json:"alertTransactionLimit,omitempty" gorm:"type:decimal(10,2)"`
+	AlertChannel          string          `json:"alertChannel" gorm:"type:varchar(10);not null;default:'whatsapp'"`
+
 	Rules     []BudgetRule    `json:"rules" gorm:"-"`                                         // Handled via RulesJSON
 	RulesJSON json.RawMessage `json:"-" gorm:"column:rules;type:jsonb;not null;default:'[]'"` // Actual DB column
 	CreatedAt time.Time       `json:"createdAt" gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
@@ -66,31 +109,163 @@ func (bc *BudgetCategory) Validate() error {
 	if bc.Budget <= 0 {
 		return ValidationError{Field: "budget", Message: "Budget must be greater than 0"}
 	}
-	if len(bc.Rules) == 0 {
-		return ValidationError{Field: "rules", Message: "At least one rule is required"}
+	if err := bc.validatePeriod(); err != nil {
+		return err
 	}
-	if len(bc.Rules) > 10 {
-		return ValidationError{Field: "rules", Message: "Maximum 10 rules allowed"}
+	if err := bc.validateRollover(); err != nil {
+		return err
 	}
+	if err := bc.validateAlerts(); err != nil {
+		return err
+	}
+	if bc.Priority < MinBudgetPriority || bc.Priority > MaxBudgetPriority {
+		return ValidationError{Field: "priority", Message: "Priority must be between 1 and 1000"}
+	}
+	return ValidateBudgetRules(bc.Rules)
+}
 
-	validTypes := map[string]bool{"description": true, "merchant": true, "amount": true}
-	validOperators := map[string]bool{"contains": true, "equals": true, "greater": true, "less": true}
+// SetPeriodDefaults fills in a monthly period starting on the 1st when none
+// was given
+func (bc *BudgetCategory) SetPeriodDefaults() {
+	if bc.PeriodType == "" {
+		bc.PeriodType = BudgetPeriodMonthly
+	}
+	if bc.PeriodStartDay == 0 && bc.PeriodType != BudgetPeriodCustom {
+		bc.PeriodStartDay = 1
+	}
+	if bc.RolloverMode == "" {
+		bc.RolloverMode = RolloverNone
+	}
+	if bc.AlertChannel == "" {
+		bc.AlertChannel = AlertChannelWhatsApp
+	}
+}
 
-	for i, rule := range bc.Rules {
-		if !validTypes[rule.Type] {
-			return ValidationError{Field: "rules", Message: "Invalid rule type at index " + string(rune(i))}
+func (bc *BudgetCategory) validateAlerts() error {
+	if len(bc.AlertThresholds) > MaxAlertThresholds {
+		return ValidationError{Field: "alertThresholds", Message: fmt.Sprintf("Maximum %d alert thresholds allowed", MaxAlertThresholds)}
+	}
+	seen := make(map[int]bool, len(bc.AlertThresholds))
+	for i, threshold := range bc.AlertThresholds {
+		if threshold < 1 || threshold > MaxAlertThreshold {
+			return ValidationError{Field: fmt.Sprintf("alertThresholds[%d]", i), Message: fmt.Sprintf("Thresholds must be between 1 and %d percent", MaxAlertThreshold)}
 		}
-		if !validOperators[rule.Operator] {
-			return ValidationError{Field: "rules", Message: "Invalid rule operator at index " + string(rune(i))}
+		if seen[threshold] {
+			return ValidationError{Field: fmt.Sprintf("alertThresholds[%d]", i), Message: "Thresholds must be unique"}
 		}
-		if rule.Value == "" || len(rule.Value) > 100 {
-			return ValidationError{Field: "rules", Message: "Rule value must be between 1 and 100 characters at index " + string(rune(i))}
+		seen[threshold] = true
+	}
+	if bc.AlertTransactionLimit != nil && *bc.AlertTransactionLimit <= 0 {
+		return ValidationError{Field: "alertTransactionLimit", Message: "Transaction limit must be greater than 0"}
+	}
+	switch bc.AlertChannel {
+	case AlertChannelWhatsApp, AlertChannelPush, AlertChannelBoth:
+	default:
+		return ValidationError{Field: "alertChannel", Message: "Alert channel must be whatsapp, push or both"}
+	}
+	return nil
+}
+
+func (bc *BudgetCategory) validateRollover() error {
+	switch bc.RolloverMode {
+	case RolloverNone, RolloverFull:
+	case RolloverCapped:
+		if bc.RolloverCap == nil || *bc.RolloverCap <= 0 {
+			return ValidationError{Field: "rolloverCap", Message: "Capped rollover needs a cap greater than 0"}
 		}
+	default:
+		return ValidationError{Field: "rolloverMode", Message: "Rollover mode must be none, full or capped"}
 	}
+	return nil
+}
 
+// RolloverFrom returns how much of a period's unspent budget carries into the
+// next one. Overspending is not carried.
+func (bc *BudgetCategory) RolloverFrom(effectiveBudget, spent float64) float64 {
+	unspent := effectiveBudget - spent
+	if unspent <= 0 {
+		return 0
+	}
+	switch bc.RolloverMode {
+	case RolloverFull:
+		return unspent
+	case RolloverCapped:
+		if bc.RolloverCap != nil && unspent > *bc.RolloverCap {
+			return *bc.RolloverCap
+		}
+		return unspent
+	}
+	return 0
+}
+
+func (bc *BudgetCategory) validatePeriod() error {
+	switch bc.PeriodType {
+	case BudgetPeriodWeekly:
+		if bc.PeriodStartDay < 1 || bc.PeriodStartDay > 7 {
+			return ValidationError{Field: "periodStartDay", Message: "Weekly budgets start on a weekday from 1 (Monday) to 7 (Sunday)"}
+		}
+	case BudgetPeriodMonthly:
+		if bc.PeriodStartDay < 1 || bc.PeriodStartDay > 28 {
+			return ValidationError{Field: "periodStartDay", Message: "Monthly budgets start on a day from 1 to 28"}
+		}
+	case BudgetPeriodCustom:
+		if bc.PeriodAnchor == nil {
+			return ValidationError{Field: "periodAnchor", Message: "Custom budgets need a start date"}
+		}
+		if bc.PeriodLengthDays < 1 || bc.PeriodLengthDays > 366 {
+			return ValidationError{Field: "periodLengthDays", Message: "Custom periods must last between 1 and 366 days"}
+		}
+	default:
+		return ValidationError{Field: "periodType", Message: "Period type must be weekly, monthly or custom"}
+	}
 	return nil
 }
 
+// PeriodAt returns the budget period containing t as [start, end). Periods
+// start at midnight in t's location.
+func (bc *BudgetCategory) PeriodAt(t time.Time) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch bc.PeriodType {
+	case BudgetPeriodWeekly:
+		// ISO weekday of day, 1 = Monday ... 7 = Sunday
+		weekday := (int(day.Weekday())+6)%7 + 1
+		start := day.AddDate(0, 0, -((weekday - bc.PeriodStartDay + 7) % 7))
+		return start, start.AddDate(0, 0, 7)
+
+	case BudgetPeriodCustom:
+		if bc.PeriodAnchor == nil || bc.PeriodLengthDays < 1 {
+			break
+		}
+		anchor := time.Date(bc.PeriodAnchor.Year(), bc.PeriodAnchor.Month(), bc.PeriodAnchor.Day(), 0, 0, 0, 0, t.Location())
+		days := DaysBetween(anchor, day)
+		n := days / bc.PeriodLengthDays
+		if days < 0 && days%bc.PeriodLengthDays != 0 {
+			n--
+		}
+		start := anchor.AddDate(0, 0, n*bc.PeriodLengthDays)
+		return start, start.AddDate(0, 0, bc.PeriodLengthDays)
+	}
+
+	// Monthly, also the fallback for incomplete settings
+	startDay := bc.PeriodStartDay
+	if startDay < 1 || startDay > 28 {
+		startDay = 1
+	}
+	start := time.Date(day.Year(), day.Month(), startDay, 0, 0, 0, 0, t.Location())
+	if day.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
+
+// DaysBetween counts calendar days from a to b, ignoring DST shifts
+func DaysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
 // TableName specifies the table name for the model
 func (BudgetCategory) TableName() string {
 	return "budget_categories"
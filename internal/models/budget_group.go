@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Budget group member roles
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleEditor = "editor"
+	GroupRoleViewer = "viewer"
+)
+
+// Budget group invite statuses
+const (
+	GroupInvitePending  = "PENDING"
+	GroupInviteAccepted = "ACCEPTED"
+	GroupInviteDeclined = "DECLINED"
+	GroupInviteRevoked  = "REVOKED"
+)
+
+// BudgetGroup is a household whose members share budget categories
+type BudgetGroup struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name      string    `json:"name" gorm:"type:varchar(50);not null"`
+	OwnerID   uuid.UUID `json:"ownerId" gorm:"type:uuid;not null"`
+	Currency  string    `json:"currency" gorm:"type:varchar(3);not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Members []BudgetGroupMember `json:"members,omitempty" gorm:"foreignKey:GroupID"`
+}
+
+// TableName specifies the table name for the model
+func (BudgetGroup) TableName() string {
+	return "budget_groups"
+}
+
+// BudgetGroupMember is a user's membership of a group
+type BudgetGroupMember struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	GroupID   uuid.UUID `json:"groupId" gorm:"type:uuid;not null"`
+	UserID    uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	Role      string    `json:"role" gorm:"type:varchar(10);not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// CanEdit reports whether the member may change the group's categories
+func (m *BudgetGroupMember) CanEdit() bool {
+	return m.Role == GroupRoleOwner || m.Role == GroupRoleEditor
+}
+
+// TableName specifies the table name for the model
+func (BudgetGroupMember) TableName() string {
+	return "budget_group_members"
+}
+
+// BudgetGroupAccount is a linked account a member shares with a group
+type BudgetGroupAccount struct {
+	GroupID         uuid.UUID `json:"groupId" gorm:"type:uuid;primaryKey"`
+	UserID          uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	LinkedAccountID uuid.UUID `json:"linkedAccountId" gorm:"type:uuid;primaryKey"`
+	CreatedAt       time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (BudgetGroupAccount) TableName() string {
+	return "budget_group_accounts"
+}
+
+// BudgetGroupInvite invites a phone number to join a group
+type BudgetGroupInvite struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	GroupID     uuid.UUID  `json:"groupId" gorm:"type:uuid;not null"`
+	Phone       string     `json:"phone" gorm:"type:varchar(50);not null"`
+	Role        string     `json:"role" gorm:"type:varchar(10);not null"`
+	InvitedBy   uuid.UUID  `json:"invitedBy" gorm:"type:uuid;not null"`
+	CodeHash    string     `json:"-" gorm:"type:varchar(64);not null"`
+	OTPAttempts int        `json:"-" gorm:"column:otp_attempts;not null;default:0"`
+	Status      string     `json:"status" gorm:"type:varchar(10);not null;default:'PENDING'"`
+	ExpiresAt   time.Time  `json:"expiresAt" gorm:"not null"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Group *BudgetGroup `json:"group,omitempty" gorm:"foreignKey:GroupID"`
+}
+
+// TableName specifies the table name for the model
+func (BudgetGroupInvite) TableName() string {
+	return "budget_group_invites"
+}
+
+// VisibleBudgetCategories scopes a query to the user's own categories and
+// those shared with groups they belong to
+func VisibleBudgetCategories(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(budget_categories.user_id = ? AND budget_categories.group_id IS NULL) OR budget_categories.group_id IN (?)",
+			userID, db.Session(&gorm.Session{NewDB: true}).Model(&BudgetGroupMember{}).Select("group_id").Where("user_id = ?", userID))
+	}
+}
+
+// EditableBudgetCategories scopes a query to the categories the user may
+// change: their own, and shared ones in groups where they are owner or editor
+func EditableBudgetCategories(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(budget_categories.user_id = ? AND budget_categories.group_id IS NULL) OR budget_categories.group_id IN (?)",
+			userID, db.Session(&gorm.Session{NewDB: true}).Model(&BudgetGroupMember{}).Select("group_id").
+				Where("user_id = ? AND role IN ?", userID, []string{GroupRoleOwner, GroupRoleEditor}))
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BudgetPeriod is the closing snapshot of one budget period for a category
+type BudgetPeriod struct {
+	ID               uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID           uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	BudgetCategoryID uuid.UUID `json:"budgetCategoryId" gorm:"type:uuid;not null"`
+	PeriodStart      time.Time `json:"periodStart" gorm:"not null"`
+	PeriodEnd        time.Time `json:"periodEnd" gorm:"not null"`
+	Currency         string    `json:"currency" gorm:"type:varchar(3);not null"`
+	Budget           float64   `json:"budget" gorm:"type:decimal(12,2);not null"`
+	CarriedIn        float64   `json:"carriedIn" gorm:"type:decimal(12,2);not null;default:0"`
+	EffectiveBudget  float64   `json:"effectiveBudget" gorm:"type:decimal(12,2);not null"`
+	Spent            float64   `json:"spent" gorm:"type:decimal(12,2);not null"`
+	Rollover         float64   `json:"rollover" gorm:"type:decimal(12,2);not null;default:0"`
+	RolloverMode     string    `json:"rolloverMode" gorm:"type:varchar(10);not null"`
+	TransactionCount int       `json:"transactionCount" gorm:"not null;default:0"`
+	ClosedAt         time.Time `json:"closedAt" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	CreatedAt        time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (BudgetPeriod) TableName() string {
+	return "budget_periods"
+}
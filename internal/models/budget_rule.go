@@ -0,0 +1,333 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Budget rule types
+const (
+	RuleTypeDescription       = "description"
+	RuleTypeMerchant          = "merchant"
+	RuleTypeAmount            = "amount"
+	RuleTypeProvider          = "provider"
+	RuleTypeLinkedAccount     = "linked_account"
+	RuleTypeCounterpartyPhone = "counterparty_phone"
+	RuleTypeDirection         = "direction"
+	RuleTypeDayOfWeek         = "day_of_week"
+)
+
+// Budget rule operators
+const (
+	RuleOpContains    = "contains"
+	RuleOpNotContains = "not_contains"
+	RuleOpEquals      = "equals"
+	RuleOpStartsWith  = "starts_with"
+	RuleOpRegex       = "regex"
+	RuleOpGreater     = "greater"
+	RuleOpLess        = "less"
+	RuleOpBetween     = "between"
+)
+
+// Limits on the size of a category's rule tree
+const (
+	MaxBudgetRules      = 10 // top-level rules per category
+	MaxBudgetRuleNodes  = 50 // rules and groups across the whole tree
+	MaxBudgetRuleDepth  = 4  // nesting of all/any groups
+	maxRuleValueLength  = 100
+	maxRulePatternBytes = 200
+)
+
+var textOperators = map[string]bool{
+	RuleOpContains: true, RuleOpNotContains: true, RuleOpEquals: true,
+	RuleOpStartsWith: true, RuleOpRegex: true,
+}
+
+// ruleOperators lists the operators each rule type accepts
+var ruleOperators = map[string]map[string]bool{
+	RuleTypeDescription:       textOperators,
+	RuleTypeMerchant:          textOperators,
+	RuleTypeCounterpartyPhone: textOperators,
+	RuleTypeAmount: {
+		RuleOpEquals: true, RuleOpGreater: true, RuleOpLess: true, RuleOpBetween: true,
+	},
+	RuleTypeProvider:      {RuleOpEquals: true},
+	RuleTypeLinkedAccount: {RuleOpEquals: true},
+	RuleTypeDirection:     {RuleOpEquals: true},
+	RuleTypeDayOfWeek:     {RuleOpEquals: true, RuleOpBetween: true},
+}
+
+// BudgetRule is either a predicate ({type, operator, value}) or a group that
+// combines nested rules with "all" (AND) or "any" (OR). A category's
+// top-level rules behave like an "any" group.
+type BudgetRule struct {
+	Type     string       `json:"type,omitempty"`
+	Operator string       `json:"operator,omitempty"`
+	Value    RuleValue    `json:"value,omitempty"`
+	All      []BudgetRule `json:"all,omitempty"`
+	Any      []BudgetRule `json:"any,omitempty"`
+}
+
+// IsGroup reports whether the rule combines nested rules
+func (r BudgetRule) IsGroup() bool {
+	return r.All != nil || r.Any != nil
+}
+
+// RuleValue holds a rule's value as raw JSON. Values may be strings,
+// numbers, or for "between" a two element array.
+type RuleValue json.RawMessage
+
+// StringRuleValue returns a rule value holding s
+func StringRuleValue(s string) RuleValue {
+	raw, _ := json.Marshal(s)
+	return RuleValue(raw)
+}
+
+// MarshalJSON returns the raw value
+func (v RuleValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+	return json.RawMessage(v).MarshalJSON()
+}
+
+// UnmarshalJSON stores a copy of the raw value
+func (v *RuleValue) UnmarshalJSON(data []byte) error {
+	if v == nil {
+		return errors.New("models.RuleValue: UnmarshalJSON on nil pointer")
+	}
+	*v = append((*v)[0:0], data...)
+	return nil
+}
+
+// Text returns the value as a string. Numbers are returned as written.
+func (v RuleValue) Text() (string, bool) {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s, true
+	}
+	var n json.Number
+	if err := json.Unmarshal(v, &n); err == nil {
+		return n.String(), true
+	}
+	return "", false
+}
+
+// Number returns the value as a number. Numeric strings are accepted so
+// rules stored before values were typed keep working.
+func (v RuleValue) Number() (float64, bool) {
+	var n float64
+	if err := json.Unmarshal(v, &n); err == nil {
+		return n, true
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return n, err == nil
+}
+
+// Pair returns the two bounds of a "between" value
+func (v RuleValue) Pair() (RuleValue, RuleValue, bool) {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(v, &pair); err != nil || len(pair) != 2 {
+		return nil, nil, false
+	}
+	return RuleValue(pair[0]), RuleValue(pair[1]), true
+}
+
+// Range returns the numeric bounds of a "between" value
+func (v RuleValue) Range() (float64, float64, bool) {
+	lo, hi, ok := v.Pair()
+	if !ok {
+		return 0, 0, false
+	}
+	from, okFrom := lo.Number()
+	to, okTo := hi.Number()
+	return from, to, okFrom && okTo
+}
+
+// WeekdayRange returns the bounds of a "between" day_of_week value
+func (v RuleValue) WeekdayRange() (time.Weekday, time.Weekday, bool) {
+	lo, hi, ok := v.Pair()
+	if !ok {
+		return 0, 0, false
+	}
+	from, okFrom := lo.Weekday()
+	to, okTo := hi.Weekday()
+	return from, to, okFrom && okTo
+}
+
+// Weekday returns the value as a day of the week
+func (v RuleValue) Weekday() (time.Weekday, bool) {
+	s, ok := v.Text()
+	if !ok {
+		return 0, false
+	}
+	return ParseWeekday(s)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseWeekday accepts English day names, full or abbreviated
+func ParseWeekday(s string) (time.Weekday, bool) {
+	day, ok := weekdays[strings.ToLower(strings.TrimSpace(s))]
+	return day, ok
+}
+
+// ValidateBudgetRules checks a category's rule tree. Errors name the failing
+// rule by path, e.g. "rules[2].any[0].value".
+func ValidateBudgetRules(rules []BudgetRule) error {
+	if len(rules) == 0 {
+		return ValidationError{Field: "rules", Message: "At least one rule is required"}
+	}
+	if len(rules) > MaxBudgetRules {
+		return ValidationError{Field: "rules", Message: fmt.Sprintf("Maximum %d rules allowed", MaxBudgetRules)}
+	}
+
+	nodes := 0
+	for i, rule := range rules {
+		if err := validateRule(rule, fmt.Sprintf("rules[%d]", i), 1, &nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRule(rule BudgetRule, path string, depth int, nodes *int) error {
+	*nodes++
+	if *nodes > MaxBudgetRuleNodes {
+		return ValidationError{Field: path, Message: fmt.Sprintf("Rules may contain at most %d conditions in total", MaxBudgetRuleNodes)}
+	}
+
+	if rule.IsGroup() {
+		if rule.Type != "" || rule.Operator != "" || len(rule.Value) > 0 {
+			return ValidationError{Field: path, Message: "A group cannot also have a type, operator or value"}
+		}
+		if rule.All != nil && rule.Any != nil {
+			return ValidationError{Field: path, Message: "A group must use either all or any, not both"}
+		}
+		if depth > MaxBudgetRuleDepth {
+			return ValidationError{Field: path, Message: fmt.Sprintf("Groups may be nested at most %d levels deep", MaxBudgetRuleDepth)}
+		}
+
+		key, children := "all", rule.All
+		if rule.Any != nil {
+			key, children = "any", rule.Any
+		}
+		if len(children) == 0 {
+			return ValidationError{Field: path + "." + key, Message: "A group needs at least one rule"}
+		}
+		for i, child := range children {
+			if err := validateRule(child, fmt.Sprintf("%s.%s[%d]", path, key, i), depth+1, nodes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	operators, ok := ruleOperators[rule.Type]
+	if !ok {
+		return ValidationError{Field: path + ".type", Message: "Invalid rule type"}
+	}
+	if !operators[rule.Operator] {
+		return ValidationError{Field: path + ".operator", Message: fmt.Sprintf("Operator %q is not valid for %s rules", rule.Operator, rule.Type)}
+	}
+	if msg := validateRuleValue(rule); msg != "" {
+		return ValidationError{Field: path + ".value", Message: msg}
+	}
+	return nil
+}
+
+// validateRuleValue returns a message describing what is wrong with the
+// rule's value, or "" when it is valid
+func validateRuleValue(rule BudgetRule) string {
+	if len(rule.Value) == 0 || string(rule.Value) == "null" {
+		return "Value is required"
+	}
+
+	switch rule.Type {
+	case RuleTypeDescription, RuleTypeMerchant, RuleTypeCounterpartyPhone:
+		s, ok := rule.Value.Text()
+		if !ok {
+			return "Value must be a string"
+		}
+		if rule.Operator == RuleOpRegex {
+			if s == "" || len(s) > maxRulePatternBytes {
+				return fmt.Sprintf("Pattern must be between 1 and %d characters", maxRulePatternBytes)
+			}
+			if _, err := regexp.Compile(s); err != nil {
+				return "Invalid regular expression: " + err.Error()
+			}
+			return ""
+		}
+		if strings.TrimSpace(s) == "" || len(s) > maxRuleValueLength {
+			return fmt.Sprintf("Value must be between 1 and %d characters", maxRuleValueLength)
+		}
+
+	case RuleTypeAmount:
+		if rule.Operator == RuleOpBetween {
+			lo, hi, ok := rule.Value.Range()
+			if !ok {
+				return "Value must be an array of two numbers, e.g. [10, 50]"
+			}
+			if lo < 0 || lo > hi {
+				return "Range must satisfy 0 <= min <= max"
+			}
+			return ""
+		}
+		n, ok := rule.Value.Number()
+		if !ok {
+			return "Value must be a number"
+		}
+		if n < 0 {
+			return "Value must not be negative"
+		}
+
+	case RuleTypeProvider:
+		s, _ := rule.Value.Text()
+		if !Provider(strings.ToUpper(s)).IsValid() {
+			return "Unknown provider"
+		}
+
+	case RuleTypeLinkedAccount:
+		s, _ := rule.Value.Text()
+		if _, err := uuid.Parse(s); err != nil {
+			return "Value must be a linked account ID"
+		}
+
+	case RuleTypeDirection:
+		s, _ := rule.Value.Text()
+		if !TransactionType(strings.ToUpper(s)).IsValid() {
+			return "Value must be CREDIT or DEBIT"
+		}
+
+	case RuleTypeDayOfWeek:
+		if rule.Operator == RuleOpBetween {
+			if _, _, ok := rule.Value.WeekdayRange(); !ok {
+				return `Value must be an array of two day names, e.g. ["mon", "fri"]`
+			}
+			return ""
+		}
+		if _, ok := rule.Value.Weekday(); !ok {
+			return "Value must be a day name such as mon or monday"
+		}
+	}
+	return ""
+}
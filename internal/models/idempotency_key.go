@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey records a request made with an Idempotency-Key header and,
+// once handled, the response to replay when the request is retried
+type IdempotencyKey struct {
+	UserID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Key          string    `gorm:"type:varchar(255);primaryKey"`
+	Method       string    `gorm:"type:varchar(10);not null"`
+	Path         string    `gorm:"type:varchar(255);not null"`
+	RequestHash  string    `gorm:"type:varchar(64);not null"`
+	StatusCode   *int      // nil while the first request is in flight
+	ContentType  string    `gorm:"type:varchar(100)"`
+	ResponseBody []byte    `gorm:"type:bytea"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	ExpiresAt    time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table name for the model
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// Completed reports whether the response has been stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != nil
+}
@@ -35,3 +35,20 @@ func (j *JSON) Scan(value interface{}) error {
 
 	return errors.New("invalid scan source for JSON")
 }
+
+// MarshalJSON returns the raw JSON document rather than a base64 string
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("null"), nil
+	}
+	return json.RawMessage(j).MarshalJSON()
+}
+
+// UnmarshalJSON stores a copy of the raw JSON document
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	if j == nil {
+		return errors.New("models.JSON: UnmarshalJSON on nil pointer")
+	}
+	*j = append((*j)[0:0], data...)
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KYC tiers, lowest first. Every user starts phone-verified, since signing
+// up needs a WhatsApp code.
+const (
+	KYCTierPhoneVerified = "phone_verified"
+	KYCTierIDVerified    = "id_verified"
+	KYCTierFull          = "full"
+)
+
+// KYC document types
+const (
+	KYCDocumentNationalID     = "national_id"
+	KYCDocumentPassport       = "passport"
+	KYCDocumentDriversLicense = "drivers_license"
+	KYCDocumentProofOfAddress = "proof_of_address"
+	KYCDocumentSelfie         = "selfie"
+)
+
+// KYC document review statuses. An approved document becomes expired
+// once its expiry date has passed.
+const (
+	KYCDocumentPending  = "pending"
+	KYCDocumentApproved = "approved"
+	KYCDocumentRejected = "rejected"
+	KYCDocumentExpired  = "expired"
+)
+
+// KYCTierRank orders the tiers; unknown tiers rank below phone-verified
+func KYCTierRank(tier string) int {
+	switch tier {
+	case KYCTierPhoneVerified:
+		return 1
+	case KYCTierIDVerified:
+		return 2
+	case KYCTierFull:
+		return 3
+	}
+	return 0
+}
+
+// IsIdentityDocument reports whether a document type proves who the user is
+func IsIdentityDocument(docType string) bool {
+	return docType == KYCDocumentNationalID || docType == KYCDocumentPassport || docType == KYCDocumentDriversLicense
+}
+
+// IsValidKYCDocumentType reports whether docType is a known document type
+func IsValidKYCDocumentType(docType string) bool {
+	return IsIdentityDocument(docType) || docType == KYCDocumentProofOfAddress || docType == KYCDocumentSelfie
+}
+
+// KYCDocument records an uploaded document and its review. The file itself
+// lives in object storage under StorageKey; only its metadata is kept here.
+type KYCDocument struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID          uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	DocumentType    string     `json:"documentType" gorm:"type:varchar(30);not null"`
+	DocumentNumber  string     `json:"documentNumber,omitempty" gorm:"type:varchar(50)"`
+	IssuingCountry  string     `json:"issuingCountry,omitempty" gorm:"type:varchar(2)"`
+	ExpiresOn       *time.Time `json:"expiresOn,omitempty" gorm:"type:date"`
+	StorageKey      string     `json:"storageKey" gorm:"type:varchar(255);not null"`
+	FileName        string     `json:"fileName" gorm:"type:varchar(255);not null"`
+	ContentType     string     `json:"contentType" gorm:"type:varchar(100);not null"`
+	SizeBytes       int64      `json:"sizeBytes" gorm:"not null"`
+	SHA256          string     `json:"sha256" gorm:"column:sha256;type:varchar(64);not null"`
+	Status          string     `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	RejectionReason string     `json:"rejectionReason,omitempty" gorm:"type:varchar(255)"`
+	ReviewedBy      string     `json:"reviewedBy,omitempty" gorm:"type:varchar(100)"`
+	ReviewedAt      *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the model
+func (KYCDocument) TableName() string {
+	return "kyc_documents"
+}
+
+// Expired reports whether the document has passed its expiry date
+func (d *KYCDocument) Expired(now time.Time) bool {
+	return d.ExpiresOn != nil && !now.Before(d.ExpiresOn.AddDate(0, 0, 1))
+}
@@ -17,8 +17,28 @@ const (
 	ProviderEvcplus  Provider = "EVCPLUS"
 	ProviderSomnet   Provider = "SOMNET"
 	ProviderSoltelco Provider = "SOLTELCO"
+
+	// ProviderCash is a synthetic provider for cash wallets. Cash accounts
+	// have no credentials and are only ever fed by manual transactions.
+	ProviderCash Provider = "CASH"
 )
 
+// IsValid reports whether the provider is a known value
+func (p Provider) IsValid() bool {
+	switch p {
+	case ProviderZaad, ProviderEdahab, ProviderSahal, ProviderEvcplus,
+		ProviderSomnet, ProviderSoltelco, ProviderCash:
+		return true
+	}
+	return false
+}
+
+// RequiresCredentials reports whether linking an account with this provider
+// needs provider login details and device information
+func (p Provider) RequiresCredentials() bool {
+	return p != ProviderCash
+}
+
 // Currency represents the currency information for an account
 type Currency struct {
 	Code   string `json:"code"`
@@ -69,40 +89,57 @@ type LinkedAccount struct {
 	SyncHistory []AccountSync `json:"-" gorm:"foreignKey:LinkedAccountID"`
 }
 
+// Sync statuses for linked account sync history entries
+const (
+	AccountSyncSuccess  = "SUCCESS"
+	AccountSyncFailed   = "FAILED"
+	AccountSyncReverted = "REVERTED"
+)
+
+// Sources of a sync history entry
+const (
+	SyncSourceProvider = "SYNC"
+	SyncSourceReceipt  = "RECEIPT"
+	SyncSourceImport   = "IMPORT"
+	SyncSourceManual   = "MANUAL"
+)
+
 // AccountSync represents the sync history for a linked account
 type AccountSync struct {
-	ID              uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	LinkedAccountID uuid.UUID `json:"linkedAccountId" gorm:"type:uuid;index;not null"`
-	SyncStatus      string    `json:"syncStatus" gorm:"not null"`
-	ErrorMessage    string    `json:"errorMessage,omitempty"`
-	CreatedAt       time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	LinkedAccountID  uuid.UUID  `json:"linkedAccountId" gorm:"type:uuid;index;not null"`
+	SyncStatus       string     `json:"syncStatus" gorm:"not null"`
+	Source           string     `json:"source" gorm:"type:varchar(20);not null;default:'SYNC'"`
+	TransactionCount int        `json:"transactionCount" gorm:"not null;default:0"`
+	ErrorMessage     string     `json:"errorMessage,omitempty"`
+	RevertedAt       *time.Time `json:"revertedAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
 
 	// Relations
 	LinkedAccount LinkedAccount `json:"-" gorm:"foreignKey:LinkedAccountID"`
 }
 
-// BeforeCreate hook to ensure only one default account per user per provider
+// BeforeCreate hook to ensure only one default account per user per provider.
+// It runs in the create's transaction, so a failure here aborts the create.
 func (la *LinkedAccount) BeforeCreate(tx *gorm.DB) error {
-	if la.IsDefaultAccount {
-		// Set all other accounts of this user and provider to non-default
-		tx.Model(&LinkedAccount{}).
-			Where("user_id = ? AND provider = ? AND is_default_account = ?",
-				la.UserID, la.Provider, true).
-			Update("is_default_account", false)
+	if !la.IsDefaultAccount {
+		return nil
 	}
-	return nil
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&LinkedAccount{}).
+		Where("user_id = ? AND provider = ? AND is_default_account = ?",
+			la.UserID, la.Provider, true).
+		Update("is_default_account", false).Error
 }
 
 // BeforeUpdate hook to maintain single default account constraint per provider
 func (la *LinkedAccount) BeforeUpdate(tx *gorm.DB) error {
-	if la.IsDefaultAccount {
-		// Set all other accounts of this user and provider to non-default
-		tx.Model(&LinkedAccount{}).
-			Where("user_id = ? AND provider = ? AND id != ? AND is_default_account = ?",
-				la.UserID, la.Provider, la.ID, true).
-			Update("is_default_account", false)
+	if !la.IsDefaultAccount {
+		return nil
 	}
-	return nil
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&LinkedAccount{}).
+		Where("user_id = ? AND provider = ? AND id != ? AND is_default_account = ?",
+			la.UserID, la.Provider, la.ID, true).
+		Update("is_default_account", false).Error
 }
 
 // TableName specifies the table name for the LinkedAccount model
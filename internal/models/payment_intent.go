@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment intent statuses
+const (
+	PaymentIntentPending   = "pending"
+	PaymentIntentCompleted = "completed"
+	PaymentIntentExpired   = "expired"
+	PaymentIntentCancelled = "cancelled"
+)
+
+// PaymentIntent is a mobile-money payment the user started by dialling the
+// USSD string built for it. It completes when the matching debit shows up
+// on the linked account.
+type PaymentIntent struct {
+	ID                    uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID                uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	LinkedAccountID       uuid.UUID  `json:"linkedAccountId" gorm:"type:uuid;not null"`
+	Provider              Provider   `json:"provider" gorm:"type:varchar(20);not null"`
+	RecipientNumber       string     `json:"recipientNumber" gorm:"type:varchar(20);not null"`
+	Amount                float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Currency              string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Note                  string     `json:"note,omitempty" gorm:"type:varchar(255)"`
+	DialString            string     `json:"dialString" gorm:"type:varchar(100);not null"`
+	Status                string     `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	ProviderTransactionID *uuid.UUID `json:"providerTransactionId,omitempty" gorm:"type:uuid"`
+	ExpiresAt             time.Time  `json:"expiresAt" gorm:"not null"`
+	CompletedAt           *time.Time `json:"completedAt,omitempty"`
+	CreatedAt             time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt             time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// TelURI opens the dialler with DialString filled in
+	TelURI string `json:"telUri" gorm:"-"`
+}
+
+// TableName specifies the table name for the model
+func (PaymentIntent) TableName() string {
+	return "payment_intents"
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment method types
+const (
+	PaymentMethodBankAccount = "bank_account"
+	PaymentMethodCard        = "card"
+	PaymentMethodMobileMoney = "mobile_money"
+)
+
+// Payment method statuses. Deleted methods are kept so their numbers can be
+// restored if the user adds them again.
+const (
+	PaymentMethodActive   = "active"
+	PaymentMethodInactive = "inactive"
+	PaymentMethodDeleted  = "deleted"
+)
+
+var (
+	mobileNumberPattern = regexp.MustCompile(`^\d{9,12}$`)
+	bankAccountPattern  = regexp.MustCompile(`^[A-Z0-9]{6,34}$`)
+	cardNumberPattern   = regexp.MustCompile(`^\d{12,19}$`)
+	last4Pattern        = regexp.MustCompile(`^\d{4}$`)
+)
+
+// PaymentMethod is a bank account, card or mobile-money wallet the user pays
+// with or gets paid into. Only the last four digits of a card are stored, so
+// a user's methods are told apart by their fingerprint instead.
+type PaymentMethod struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID        uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	Type          string    `json:"type" gorm:"type:varchar(20);not null"`
+	Provider      string    `json:"provider" gorm:"type:varchar(50);not null"`
+	AccountNumber string    `json:"-" gorm:"type:varchar(100);not null"`
+	Fingerprint   string    `json:"-" gorm:"type:varchar(100);not null"`
+	AccountName   string    `json:"accountName" gorm:"type:varchar(100);not null"`
+	IsDefault     bool      `json:"isDefault" gorm:"not null;default:false"`
+	Metadata      JSON      `json:"metadata,omitempty" gorm:"type:jsonb"`
+	Status        string    `json:"status" gorm:"type:varchar(20);not null;default:'active'"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (PaymentMethod) TableName() string {
+	return "payment_methods"
+}
+
+// CardDetails is the metadata kept for a card
+type CardDetails struct {
+	Brand       string `json:"brand"`
+	ExpiryMonth int    `json:"expiryMonth"`
+	ExpiryYear  int    `json:"expiryYear"`
+}
+
+// IsValidPaymentMethodType reports whether t is a known payment method type
+func IsValidPaymentMethodType(t string) bool {
+	return t == PaymentMethodBankAccount || t == PaymentMethodCard || t == PaymentMethodMobileMoney
+}
+
+// MaskedAccountNumber returns the account number with all but its last four
+// characters hidden
+func (m *PaymentMethod) MaskedAccountNumber() string {
+	n := m.AccountNumber
+	if len(n) <= 4 {
+		return "•••• " + n
+	}
+	return strings.Repeat("•", len(n)-4) + n[len(n)-4:]
+}
+
+// NormalizeAccountNumber strips spaces and dashes from the account number.
+// A full card number is checked and cut down to its last four digits, and
+// its brand recorded in the card details.
+func (m *PaymentMethod) NormalizeAccountNumber(card *CardDetails) error {
+	n := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(m.AccountNumber)))
+	switch m.Type {
+	case PaymentMethodMobileMoney:
+		n = strings.TrimPrefix(n, "+")
+	case PaymentMethodCard:
+		if !cardNumberPattern.MatchString(n) || !luhnValid(n) {
+			return ValidationError{Field: "accountNumber", Message: "Card number is not valid"}
+		}
+		if card != nil {
+			card.Brand = cardBrand(n)
+		}
+		n = n[len(n)-4:]
+	}
+	m.AccountNumber = n
+	return nil
+}
+
+// UpdateFingerprint sets the fingerprint that identifies the underlying
+// account. A card's is its brand, last four digits and expiry; any other
+// method's is its account number.
+func (m *PaymentMethod) UpdateFingerprint(card *CardDetails) {
+	m.Fingerprint = m.AccountNumber
+	if m.Type == PaymentMethodCard && card != nil {
+		m.Fingerprint = fmt.Sprintf("%s:%s:%02d/%d", card.Brand, m.AccountNumber, card.ExpiryMonth, card.ExpiryYear)
+	}
+}
+
+// Validate checks the fields required by the method's type
+func (m *PaymentMethod) Validate(card *CardDetails) error {
+	if !IsValidPaymentMethodType(m.Type) {
+		return ValidationError{Field: "type", Message: "Type must be bank_account, card or mobile_money"}
+	}
+	if name := strings.TrimSpace(m.AccountName); name == "" || len(name) > 100 {
+		return ValidationError{Field: "accountName", Message: "Account name must be between 1 and 100 characters"}
+	}
+	if m.Provider == "" || len(m.Provider) > 50 {
+		return ValidationError{Field: "provider", Message: "Provider must be between 1 and 50 characters"}
+	}
+
+	switch m.Type {
+	case PaymentMethodMobileMoney:
+		if p := Provider(m.Provider); !p.IsValid() || !p.RequiresCredentials() {
+			return ValidationError{Field: "provider", Message: "Provider must be a mobile-money provider"}
+		}
+		if !mobileNumberPattern.MatchString(m.AccountNumber) {
+			return ValidationError{Field: "accountNumber", Message: "Mobile number must be 9 to 12 digits"}
+		}
+	case PaymentMethodBankAccount:
+		if !bankAccountPattern.MatchString(m.AccountNumber) {
+			return ValidationError{Field: "accountNumber", Message: "Bank account number must be 6 to 34 letters or digits"}
+		}
+	case PaymentMethodCard:
+		if !last4Pattern.MatchString(m.AccountNumber) {
+			return ValidationError{Field: "accountNumber", Message: "Card number is not valid"}
+		}
+		if card == nil || card.ExpiryMonth < 1 || card.ExpiryMonth > 12 || card.ExpiryYear < 2000 {
+			return ValidationError{Field: "expiry", Message: "Card expiry month and year are required"}
+		}
+	}
+	return nil
+}
+
+// Expired reports whether the card's expiry month is over. A card is valid
+// through the last day of its expiry month.
+func (c *CardDetails) Expired(now time.Time) bool {
+	return !now.Before(time.Date(c.ExpiryYear, time.Month(c.ExpiryMonth)+1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// CardDetails decodes the card details from the metadata
+func (m *PaymentMethod) CardDetails() *CardDetails {
+	if m.Type != PaymentMethodCard || len(m.Metadata) == 0 {
+		return nil
+	}
+	var card CardDetails
+	if err := json.Unmarshal(m.Metadata, &card); err != nil {
+		return nil
+	}
+	return &card
+}
+
+// luhnValid checks a card number's check digit
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// cardBrand names the card network from the number's leading digits
+func cardBrand(number string) string {
+	switch {
+	case strings.HasPrefix(number, "4"):
+		return "visa"
+	case number[0] == '5' && number[1] >= '1' && number[1] <= '5',
+		number[0] == '2' && number[1] >= '2' && number[1] <= '7':
+		return "mastercard"
+	case strings.HasPrefix(number, "34"), strings.HasPrefix(number, "37"):
+		return "amex"
+	case strings.HasPrefix(number, "62"):
+		return "unionpay"
+	}
+	return "other"
+}
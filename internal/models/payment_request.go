@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment request statuses
+const (
+	PaymentRequestPending   = "pending"
+	PaymentRequestPaid      = "paid"
+	PaymentRequestDeclined  = "declined"
+	PaymentRequestExpired   = "expired"
+	PaymentRequestCancelled = "cancelled"
+)
+
+// How a payment request was paid
+const (
+	PaidViaWallet        = "wallet"         // a KaafiPay transfer
+	PaidViaLinkedAccount = "linked_account" // outside KaafiPay, claimed by the payer
+	PaidViaManual        = "manual"         // marked paid by the requester
+)
+
+// PaymentRequest asks for money, either from a particular phone number or
+// from whoever opens its link
+type PaymentRequest struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RequesterID       uuid.UUID  `json:"requesterId" gorm:"type:uuid;not null"`
+	PayerID           *uuid.UUID `json:"payerId,omitempty" gorm:"type:uuid"`
+	PayerPhone        *string    `json:"payerPhone,omitempty" gorm:"type:varchar(50)"`
+	Amount            float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Currency          string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Note              string     `json:"note,omitempty" gorm:"type:varchar(255)"`
+	Token             string     `json:"token" gorm:"type:varchar(32);not null;unique"`
+	Status            string     `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	ExpiresAt         time.Time  `json:"expiresAt" gorm:"not null"`
+	PaidVia           *string    `json:"paidVia,omitempty" gorm:"type:varchar(20)"`
+	TransferID        *uuid.UUID `json:"transferId,omitempty" gorm:"type:uuid"`
+	LinkedAccountID   *uuid.UUID `json:"linkedAccountId,omitempty" gorm:"type:uuid"`
+	ExternalReference string     `json:"externalReference,omitempty" gorm:"type:varchar(100)"`
+	ClaimedAt         *time.Time `json:"claimedAt,omitempty"`
+	PaidAt            *time.Time `json:"paidAt,omitempty"`
+	DeclinedAt        *time.Time `json:"declinedAt,omitempty"`
+	RemindersSent     int        `json:"remindersSent" gorm:"not null;default:0"`
+	LastRemindedAt    *time.Time `json:"lastRemindedAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt         time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Link opens the request on the web; QRPayload opens it in the app
+	Link      string `json:"link" gorm:"-"`
+	QRPayload string `json:"qrPayload" gorm:"-"`
+
+	Requester *User `json:"requester,omitempty" gorm:"foreignKey:RequesterID"`
+}
+
+// TableName specifies the table name for the model
+func (PaymentRequest) TableName() string {
+	return "payment_requests"
+}
+
+// Expired reports whether a pending request is past its expiry
+func (r *PaymentRequest) Expired(now time.Time) bool {
+	return r.Status == PaymentRequestPending && !now.Before(r.ExpiresAt)
+}
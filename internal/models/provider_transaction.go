@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionType represents the direction of money for a provider transaction
+type TransactionType string
+
+const (
+	TransactionTypeCredit TransactionType = "CREDIT"
+	TransactionTypeDebit  TransactionType = "DEBIT"
+)
+
+// Sync statuses for provider transactions
+const (
+	TransactionSyncPending = "PENDING"
+	TransactionSyncSynced  = "SYNCED"
+)
+
+// ManualTransactionPrefix marks the provider transaction ids of transactions
+// entered by hand on cash accounts
+const ManualTransactionPrefix = "manual:"
+
+// IsValid reports whether the transaction type is a known value
+func (t TransactionType) IsValid() bool {
+	return t == TransactionTypeCredit || t == TransactionTypeDebit
+}
+
+// ProviderTransaction represents a transaction synced from a linked account provider
+type ProviderTransaction struct {
+	ID                    uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	LinkedAccountID       uuid.UUID       `json:"linkedAccountId" gorm:"type:uuid;not null"`
+	ProviderTransactionID string          `json:"providerTransactionId" gorm:"type:varchar(255)"`
+	TransactionType       TransactionType `json:"type" gorm:"column:transaction_type;type:varchar(50);not null"`
+	Amount                float64         `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Currency              string          `json:"currency" gorm:"type:varchar(3);not null"`
+	Description           string          `json:"description"`
+	MerchantName          string          `json:"merchantName" gorm:"type:varchar(255)"`
+	CounterpartyName      string          `json:"counterpartyName,omitempty" gorm:"type:varchar(255)"`
+	CounterpartyPhone     string          `json:"counterpartyPhone,omitempty" gorm:"type:varchar(50)"`
+	TransactionDate       time.Time       `json:"transactionDate" gorm:"not null"`
+	BalanceAfter          *float64        `json:"balanceAfter,omitempty" gorm:"type:decimal(12,2)"`
+	CategoryID            *uuid.UUID      `json:"categoryId,omitempty" gorm:"type:uuid"`
+	BudgetCategoryID      *uuid.UUID      `json:"budgetCategoryId,omitempty" gorm:"type:uuid"`
+	MatchedRule           *RuleMatch      `json:"matchedRule,omitempty" gorm:"type:jsonb"`
+	ProviderMetadata      JSON            `json:"providerMetadata,omitempty" gorm:"type:jsonb"`
+	SyncStatus            string          `json:"syncStatus" gorm:"type:varchar(50);not null;default:'PENDING'"`
+	SyncID                *uuid.UUID      `json:"syncId,omitempty" gorm:"type:uuid"`
+	CreatedAt             time.Time       `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt             time.Time       `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Relations
+	LinkedAccount LinkedAccount `json:"-" gorm:"foreignKey:LinkedAccountID"`
+}
+
+// RuleMatch records which budget rule assigned a transaction to its budget
+// category. The rule is copied so the record survives later rule edits.
+type RuleMatch struct {
+	CategoryID uuid.UUID  `json:"categoryId"`
+	RuleIndex  int        `json:"ruleIndex"`
+	Rule       BudgetRule `json:"rule"`
+}
+
+// Value implements the driver.Valuer interface
+func (m RuleMatch) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+// Scan implements the sql.Scanner interface
+func (m *RuleMatch) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	}
+	return errors.New("invalid scan source for RuleMatch")
+}
+
+// IsManual reports whether the transaction was entered by hand rather than
+// synced, parsed or imported
+func (t *ProviderTransaction) IsManual() bool {
+	return strings.HasPrefix(t.ProviderTransactionID, ManualTransactionPrefix)
+}
+
+// TableName specifies the table name for the ProviderTransaction model
+func (ProviderTransaction) TableName() string {
+	return "provider_transactions"
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Push device platforms
+const (
+	PushPlatformIOS     = "ios"
+	PushPlatformAndroid = "android"
+	PushPlatformWeb     = "web"
+)
+
+// PushDevice is a device token that receives push notifications for a user
+type PushDevice struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	Token     string    `json:"token" gorm:"type:varchar(255);not null;unique"`
+	Platform  string    `json:"platform" gorm:"type:varchar(10);not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (PushDevice) TableName() string {
+	return "push_devices"
+}
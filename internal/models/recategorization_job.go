@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recategorization job statuses
+const (
+	RecategorizationPending   = "PENDING"
+	RecategorizationRunning   = "RUNNING"
+	RecategorizationCompleted = "COMPLETED"
+	RecategorizationFailed    = "FAILED"
+	RecategorizationUndone    = "UNDONE"
+)
+
+// RecategorizationJob re-runs a user's budget rules over their existing
+// transactions, usually after a category's rules were edited
+type RecategorizationJob struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID           uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	BudgetCategoryID *uuid.UUID `json:"budgetCategoryId,omitempty" gorm:"type:uuid"`
+	Status           string     `json:"status" gorm:"type:varchar(20);not null;default:'PENDING'"`
+	Since            *time.Time `json:"since,omitempty"`
+	TotalCount       int        `json:"total" gorm:"not null;default:0"`
+	ProcessedCount   int        `json:"processed" gorm:"not null;default:0"`
+	ChangedCount     int        `json:"changed" gorm:"not null;default:0"`
+	CursorID         *uuid.UUID `json:"-" gorm:"type:uuid"`
+	HeartbeatAt      *time.Time `json:"-"`
+	ErrorMessage     string     `json:"errorMessage,omitempty"`
+	StartedAt        *time.Time `json:"startedAt,omitempty"`
+	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+	UndoneAt         *time.Time `json:"undoneAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// Progress returns the share of transactions processed, from 0 to 1
+func (j *RecategorizationJob) Progress() float64 {
+	if j.TotalCount == 0 {
+		if j.Status == RecategorizationCompleted || j.Status == RecategorizationUndone {
+			return 1
+		}
+		return 0
+	}
+	return float64(j.ProcessedCount) / float64(j.TotalCount)
+}
+
+// RecategorizationChange is the before and after state of a transaction a
+// job changed
+type RecategorizationChange struct {
+	ID                  int64      `gorm:"primaryKey"`
+	JobID               uuid.UUID  `gorm:"type:uuid;not null"`
+	TransactionID       uuid.UUID  `gorm:"type:uuid;not null"`
+	OldBudgetCategoryID *uuid.UUID `gorm:"type:uuid"`
+	OldMatchedRule      *RuleMatch `gorm:"type:jsonb"`
+	NewBudgetCategoryID *uuid.UUID `gorm:"type:uuid"`
+	NewMatchedRule      *RuleMatch `gorm:"type:jsonb"`
+}
+
+// TableName specifies the table name for the RecategorizationJob model
+func (RecategorizationJob) TableName() string {
+	return "recategorization_jobs"
+}
+
+// TableName specifies the table name for the RecategorizationChange model
+func (RecategorizationChange) TableName() string {
+	return "recategorization_changes"
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Savings goal statuses
+const (
+	GoalStatusActive   = "ACTIVE"
+	GoalStatusAchieved = "ACHIEVED"
+	GoalStatusArchived = "ARCHIVED"
+)
+
+// GoalMilestones are the percentages of the target announced as the user
+// reaches them
+var GoalMilestones = []int{25, 50, 75, 100}
+
+// SavingsGoal is an amount the user wants to have saved by a deadline.
+// Progress comes from the latest balance of LinkedAccountID when set, and
+// from the goal's contributions otherwise.
+type SavingsGoal struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID          uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	Name            string     `json:"name" gorm:"type:varchar(50);not null"`
+	Icon            string     `json:"icon" gorm:"type:varchar(50);not null;default:'piggy-bank'"`
+	TargetAmount    float64    `json:"targetAmount" gorm:"type:decimal(12,2);not null"`
+	Currency        string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Deadline        time.Time  `json:"deadline" gorm:"type:date;not null"`
+	LinkedAccountID *uuid.UUID `json:"linkedAccountId,omitempty" gorm:"type:uuid"`
+	Status          string     `json:"status" gorm:"type:varchar(10);not null;default:'ACTIVE'"`
+	LastMilestone   int        `json:"lastMilestone" gorm:"not null;default:0"`
+	AchievedAt      *time.Time `json:"achievedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (SavingsGoal) TableName() string {
+	return "savings_goals"
+}
+
+// Validate validates the savings goal fields
+func (g *SavingsGoal) Validate() error {
+	if len(strings.TrimSpace(g.Name)) == 0 || len(g.Name) > 50 {
+		return ValidationError{Field: "name", Message: "Name must be between 1 and 50 characters"}
+	}
+	if len(g.Icon) > 50 {
+		return ValidationError{Field: "icon", Message: "Icon must be at most 50 characters"}
+	}
+	if g.TargetAmount <= 0 {
+		return ValidationError{Field: "targetAmount", Message: "Target amount must be greater than 0"}
+	}
+	if len(g.Currency) != 3 {
+		return ValidationError{Field: "currency", Message: "Currency must be a 3-letter code"}
+	}
+	if g.Deadline.IsZero() {
+		return ValidationError{Field: "deadline", Message: "Deadline is required"}
+	}
+	return nil
+}
+
+// SavingsGoalContribution is money set aside towards a goal by hand.
+// Withdrawals are negative.
+type SavingsGoalContribution struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	GoalID        uuid.UUID `json:"goalId" gorm:"type:uuid;not null"`
+	UserID        uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	Amount        float64   `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Note          string    `json:"note,omitempty" gorm:"type:varchar(255)"`
+	ContributedAt time.Time `json:"contributedAt" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (SavingsGoalContribution) TableName() string {
+	return "savings_goal_contributions"
+}
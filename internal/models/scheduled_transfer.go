@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scheduled transfer statuses. A schedule waits for the sender's
+// confirmation code before it runs.
+const (
+	ScheduledTransferPendingConfirmation = "pending_confirmation"
+	ScheduledTransferActive              = "active"
+	ScheduledTransferPaused              = "paused"
+	ScheduledTransferCompleted           = "completed"
+	ScheduledTransferCancelled           = "cancelled"
+)
+
+// What a scheduled transfer does when the wallet cannot cover a run
+const (
+	InsufficientFundsSkip  = "skip"  // skip the occurrence
+	InsufficientFundsRetry = "retry" // try again a few times before skipping it
+)
+
+// ScheduledTransfer sends the same amount to the same recipient once at
+// StartAt or repeatedly by its recurrence rule
+type ScheduledTransfer struct {
+	ID                  uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID              uuid.UUID  `json:"userId" gorm:"type:uuid;not null"`
+	RecipientID         uuid.UUID  `json:"recipientId" gorm:"type:uuid;not null"`
+	Amount              float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Currency            string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Description         string     `json:"description,omitempty" gorm:"type:varchar(255)"`
+	StartAt             time.Time  `json:"startAt" gorm:"not null"`
+	Recurrence          string     `json:"recurrence,omitempty" gorm:"type:varchar(255)"` // empty for a one-time transfer
+	OnInsufficientFunds string     `json:"onInsufficientFunds" gorm:"type:varchar(10);not null;default:'retry'"`
+	Status              string     `json:"status" gorm:"type:varchar(20);not null"`
+	NextRunAt           *time.Time `json:"nextRunAt,omitempty"`
+	Occurrences         int        `json:"occurrences" gorm:"not null;default:0"` // run or skipped
+	RetryAttempts       int        `json:"retryAttempts" gorm:"not null;default:0"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
+	RemindedFor         *time.Time `json:"-"`
+	LastRunAt           *time.Time `json:"lastRunAt,omitempty"`
+	LastTransferID      *uuid.UUID `json:"lastTransferId,omitempty" gorm:"type:uuid"`
+	LastFailureReason   string     `json:"lastFailureReason,omitempty" gorm:"type:varchar(255)"`
+	OTPHash             string     `json:"-" gorm:"column:otp_hash;type:varchar(64)"`
+	OTPAttempts         int        `json:"-" gorm:"column:otp_attempts;not null;default:0"`
+	OTPExpiresAt        *time.Time `json:"-" gorm:"column:otp_expires_at"`
+	ConfirmedAt         *time.Time `json:"confirmedAt,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt           time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Recipient *User `json:"recipient,omitempty" gorm:"foreignKey:RecipientID"`
+}
+
+// TableName specifies the table name for the model
+func (ScheduledTransfer) TableName() string {
+	return "scheduled_transfers"
+}
+
+// DueAt returns when the schedule next runs: its retry if one is pending,
+// otherwise its next occurrence
+func (s *ScheduledTransfer) DueAt() *time.Time {
+	if s.RetryAt != nil {
+		return s.RetryAt
+	}
+	return s.NextRunAt
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statement import statuses
+const (
+	ImportStatusPreview   = "PREVIEW"
+	ImportStatusCommitted = "COMMITTED"
+	ImportStatusReverted  = "REVERTED"
+	ImportStatusDiscarded = "DISCARDED"
+)
+
+// StatementImportRow is a parsed statement line awaiting commit
+type StatementImportRow struct {
+	Index                 int             `json:"index"`
+	ProviderTransactionID string          `json:"providerTransactionId"`
+	Date                  time.Time       `json:"date"`
+	Type                  TransactionType `json:"type"`
+	Amount                float64         `json:"amount"`
+	Currency              string          `json:"currency"`
+	Description           string          `json:"description"`
+	Payee                 string          `json:"payee,omitempty"`
+	Reference             string          `json:"reference,omitempty"`
+	BalanceAfter          *float64        `json:"balanceAfter,omitempty"`
+	Duplicate             bool            `json:"duplicate"`
+	DuplicateOf           *uuid.UUID      `json:"duplicateOf,omitempty"`
+}
+
+// StatementImport represents an uploaded statement file, from dry-run preview
+// through commit and optional undo
+type StatementImport struct {
+	ID              uuid.UUID            `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID          uuid.UUID            `json:"userId" gorm:"type:uuid;not null"`
+	LinkedAccountID uuid.UUID            `json:"linkedAccountId" gorm:"type:uuid;not null"`
+	Format          string               `json:"format" gorm:"type:varchar(10);not null"`
+	FileName        string               `json:"fileName,omitempty" gorm:"type:varchar(255)"`
+	Status          string               `json:"status" gorm:"type:varchar(20);not null;default:'PREVIEW'"`
+	Rows            []StatementImportRow `json:"rows" gorm:"-"`                                         // Handled via RowsJSON
+	RowsJSON        json.RawMessage      `json:"-" gorm:"column:rows;type:jsonb;not null;default:'[]'"` // Actual DB column
+	RowCount        int                  `json:"rowCount" gorm:"not null;default:0"`
+	DuplicateCount  int                  `json:"duplicateCount" gorm:"not null;default:0"`
+	SyncID          *uuid.UUID           `json:"syncId,omitempty" gorm:"type:uuid"`
+	CreatedAt       time.Time            `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time            `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeSave converts Rows to RowsJSON before saving
+func (si *StatementImport) BeforeSave(tx *gorm.DB) error {
+	rowsJSON, err := json.Marshal(si.Rows)
+	if err != nil {
+		return err
+	}
+	si.RowsJSON = rowsJSON
+	return nil
+}
+
+// AfterFind converts RowsJSON to Rows after fetching
+func (si *StatementImport) AfterFind(tx *gorm.DB) error {
+	return json.Unmarshal(si.RowsJSON, &si.Rows)
+}
+
+// TableName specifies the table name for the StatementImport model
+func (StatementImport) TableName() string {
+	return "statement_imports"
+}
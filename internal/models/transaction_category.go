@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionCategory is a node in the category taxonomy. System categories
+// are shared by all users and form a two level tree, e.g. Food > Restaurants.
+type TransactionCategory struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	Name      string     `json:"name" gorm:"type:varchar(100);not null"`
+	Slug      string     `json:"slug" gorm:"type:varchar(100);unique"`
+	Icon      string     `json:"icon,omitempty" gorm:"type:varchar(50)"`
+	Color     string     `json:"color,omitempty" gorm:"type:varchar(7)"`
+	ParentID  *uuid.UUID `json:"parentId,omitempty" gorm:"type:uuid"`
+	IsSystem  bool       `json:"isSystem" gorm:"not null;default:false"`
+	SortOrder int        `json:"-" gorm:"not null;default:0"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Children []TransactionCategory `json:"children,omitempty" gorm:"-"`
+}
+
+// TableName specifies the table name for the model
+func (TransactionCategory) TableName() string {
+	return "transaction_categories"
+}
+
+// MerchantCategory maps a merchant to a system category. Merchant names are
+// stored normalized, see NormalizeMerchantName.
+type MerchantCategory struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	MerchantName string    `json:"merchantName" gorm:"type:varchar(255);not null;unique"`
+	CategoryID   uuid.UUID `json:"categoryId" gorm:"type:uuid;not null"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt    time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name for the model
+func (MerchantCategory) TableName() string {
+	return "merchant_categories"
+}
+
+// NormalizeMerchantName lower-cases a merchant name and collapses its
+// whitespace so "  HORMUUD   Telecom" and "hormuud telecom" are the same
+func NormalizeMerchantName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transfer statuses
+const (
+	TransferStatusPending   = "pending"
+	TransferStatusCompleted = "completed"
+	TransferStatusFailed    = "failed"
+	TransferStatusCancelled = "cancelled"
+)
+
+// Transfer types
+const (
+	TransferTypeTransfer   = "transfer"
+	TransferTypeDeposit    = "deposit"
+	TransferTypeWithdrawal = "withdrawal"
+)
+
+// Transfer moves money from the sender's wallet to the receiver's. It stays
+// pending until the sender confirms it with the code sent to their phone.
+type Transfer struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	SenderID       uuid.UUID  `json:"senderId" gorm:"type:uuid;not null"`
+	ReceiverID     uuid.UUID  `json:"receiverId" gorm:"type:uuid;not null"`
+	Amount         float64    `json:"amount" gorm:"type:decimal(12,2);not null"`
+	Currency       string     `json:"currency" gorm:"type:varchar(3);not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);not null"`
+	Type           string     `json:"type" gorm:"type:varchar(20);not null"`
+	Description    string     `json:"description,omitempty" gorm:"type:text"`
+	ReferenceID    *string    `json:"referenceId,omitempty" gorm:"type:varchar(100)"`
+	JournalEntryID *uuid.UUID `json:"journalEntryId,omitempty" gorm:"type:uuid"`
+	OTPHash        string     `json:"-" gorm:"column:otp_hash;type:varchar(64)"`
+	OTPAttempts    int        `json:"-" gorm:"column:otp_attempts;not null;default:0"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	FailureReason  string     `json:"failureReason,omitempty" gorm:"type:varchar(255)"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Sender   *User `json:"sender,omitempty" gorm:"foreignKey:SenderID"`
+	Receiver *User `json:"receiver,omitempty" gorm:"foreignKey:ReceiverID"`
+}
+
+// TableName specifies the table name for the model
+func (Transfer) TableName() string {
+	return "transactions"
+}
@@ -8,15 +8,32 @@ import (
 )
 
 type User struct {
-	ID                uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	Phone             string    `gorm:"type:varchar(50);unique;not null" json:"phone"`
-	Name              string    `gorm:"type:varchar(100);not null" json:"name"`
-	Password          string    `gorm:"type:varchar(255);not null" json:"-"`
-	CountryCode       string    `gorm:"type:varchar(2)" json:"country_code"`
-	PreferredCurrency string    `gorm:"type:varchar(3);default:USD" json:"preferred_currency"`
-	IsActive          bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Phone             string     `gorm:"type:varchar(50);unique;not null" json:"phone"`
+	Name              string     `gorm:"type:varchar(100);not null" json:"name"`
+	Password          string     `gorm:"type:varchar(255);not null" json:"-"`
+	CountryCode       string     `gorm:"type:varchar(2)" json:"country_code"`
+	PreferredCurrency string     `gorm:"type:varchar(3);default:USD" json:"preferred_currency"`
+	IsActive          bool       `gorm:"default:true" json:"is_active"`
+	KYCTier           string     `gorm:"column:kyc_tier;type:varchar(20);not null;default:phone_verified" json:"kyc_tier"`
+	SuspendedReason   string     `gorm:"type:varchar(255)" json:"suspended_reason,omitempty"`
+	SuspendedUntil    *time.Time `json:"suspended_until,omitempty"`
+	CreatedAt         time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Suspended reports whether the user is barred from the app. A suspension
+// that has run out no longer counts, even before it is lifted.
+func (u *User) Suspended(now time.Time) bool {
+	return !u.IsActive && (u.SuspendedUntil == nil || now.Before(*u.SuspendedUntil))
+}
+
+// UnsuspendedUsers scopes a query to users who are not suspended at now,
+// by the same rule as Suspended
+func UnsuspendedUsers(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(users.is_active OR users.suspended_until <= ?)", now)
+	}
 }
 
 // BeforeCreate will set a UUID rather than numeric ID.
@@ -31,3 +48,8 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 func (User) TableName() string {
 	return "users"
 }
+
+// PublicUser selects the user fields that may be shown to other users
+func PublicUser(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "name", "phone")
+}
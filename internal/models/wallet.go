@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Wallet statuses
+const (
+	WalletStatusActive = "active"
+	WalletStatusFrozen = "frozen"
+	WalletStatusClosed = "closed"
+)
+
+// Journal entry kinds
+const (
+	JournalKindDeposit    = "deposit"
+	JournalKindWithdrawal = "withdrawal"
+	JournalKindTransfer   = "transfer"
+	JournalKindFee        = "fee"
+	JournalKindReversal   = "reversal"
+	JournalKindAdjustment = "adjustment"
+)
+
+// System ledger accounts: the other side of money entering and leaving
+// wallets. They have no balance row and may go negative.
+const (
+	SystemAccountFunding  = "funding"  // money arriving from outside KaafiPay
+	SystemAccountPayouts  = "payouts"  // money leaving KaafiPay
+	SystemAccountFees     = "fees"     // fees KaafiPay earns
+	SystemAccountSuspense = "suspense" // balances awaiting investigation
+)
+
+// Wallet is a user's stored-value balance in one currency. Balance is kept
+// in step with the wallet's ledger entries, which are the record of truth.
+type Wallet struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID    uuid.UUID `json:"userId" gorm:"type:uuid;not null"`
+	Balance   float64   `json:"balance" gorm:"type:decimal(12,2);not null;default:0"`
+	Currency  string    `json:"currency" gorm:"type:varchar(3);not null;default:'USD'"`
+	Status    string    `json:"status" gorm:"type:varchar(20);not null;default:'active'"`
+	CreatedAt time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Why the wallet is frozen and until when; no expiry means until lifted
+	FrozenReason string     `json:"frozenReason,omitempty" gorm:"type:varchar(255)"`
+	FrozenUntil  *time.Time `json:"frozenUntil,omitempty"`
+}
+
+// TableName specifies the table name for the model
+func (Wallet) TableName() string {
+	return "wallets"
+}
+
+// JournalEntry is one business event in the ledger. Its lines sum to zero.
+type JournalEntry struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Kind        string    `json:"kind" gorm:"type:varchar(20);not null"`
+	Reference   *string   `json:"reference,omitempty" gorm:"type:varchar(100)"`
+	Description string    `json:"description,omitempty" gorm:"type:varchar(255)"`
+	Currency    string    `json:"currency" gorm:"type:varchar(3);not null"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Lines []LedgerEntry `json:"lines,omitempty" gorm:"foreignKey:JournalEntryID"`
+}
+
+// TableName specifies the table name for the model
+func (JournalEntry) TableName() string {
+	return "journal_entries"
+}
+
+// LedgerEntry is one line of a journal entry against either a wallet or a
+// system account. Positive amounts increase the account.
+type LedgerEntry struct {
+	ID             int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	JournalEntryID uuid.UUID  `json:"journalEntryId" gorm:"type:uuid;not null"`
+	WalletID       *uuid.UUID `json:"walletId,omitempty" gorm:"type:uuid"`
+	SystemAccount  *string    `json:"systemAccount,omitempty" gorm:"type:varchar(20)"`
+	Amount         float64    `json:"amount" gorm:"type:decimal(14,2);not null"`
+	BalanceAfter   *float64   `json:"balanceAfter,omitempty" gorm:"type:decimal(14,2)"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP"`
+
+	Journal *JournalEntry `json:"journal,omitempty" gorm:"foreignKey:JournalEntryID"`
+}
+
+// TableName specifies the table name for the model
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// WalletLine returns a journal line moving amount into a wallet, or out of it
+// when negative
+func WalletLine(walletID uuid.UUID, amount float64) LedgerEntry {
+	return LedgerEntry{WalletID: &walletID, Amount: amount}
+}
+
+// SystemLine returns a journal line against a system account
+func SystemLine(account string, amount float64) LedgerEntry {
+	return LedgerEntry{SystemAccount: &account, Amount: amount}
+}
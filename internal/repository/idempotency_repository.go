@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// IdempotencyKeyTTL is how long a key's response is kept for replay
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyRepository stores the responses to requests made with an
+// Idempotency-Key header
+type IdempotencyRepository interface {
+	// Reserve claims record's key for a new request. If the key is already
+	// taken and has not expired, it returns the existing record instead and
+	// the request must not run.
+	Reserve(record *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	// Complete stores the response to a reserved request
+	Complete(userID uuid.UUID, key string, status int, contentType string, body []byte) error
+	// Release frees a reserved key whose request did not complete, so it can
+	// be retried
+	Release(userID uuid.UUID, key string) error
+	// PurgeExpired deletes expired keys and returns how many were removed
+	PurgeExpired() (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Reserve(record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	record.StatusCode = nil
+	record.ExpiresAt = time.Now().Add(IdempotencyKeyTTL)
+
+	// The second pass only runs after clearing an expired record that held
+	// the key
+	for attempt := 0; attempt < 2; attempt++ {
+		result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var existing models.IdempotencyKey
+		err := r.db.Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, nil
+		}
+		if err := r.db.Where("user_id = ? AND key = ? AND expires_at <= ?", record.UserID, record.Key, time.Now()).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("failed to reserve idempotency key")
+}
+
+func (r *idempotencyRepository) Complete(userID uuid.UUID, key string, status int, contentType string, body []byte) error {
+	return r.db.Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", userID, key).
+		Updates(map[string]interface{}{
+			"status_code":   status,
+			"content_type":  contentType,
+			"response_body": body,
+		}).Error
+}
+
+func (r *idempotencyRepository) Release(userID uuid.UUID, key string) error {
+	return r.db.Where("user_id = ? AND key = ? AND status_code IS NULL", userID, key).
+		Delete(&models.IdempotencyKey{}).Error
+}
+
+func (r *idempotencyRepository) PurgeExpired() (int64, error) {
+	result := r.db.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+const (
+	DefaultLedgerPageSize = 50
+	MaxLedgerPageSize     = 200
+
+	// maxSerializationRetries bounds how often a posting is retried after
+	// losing a serialization conflict to a concurrent one
+	maxSerializationRetries = 5
+)
+
+var (
+	ErrUnbalancedEntry    = errors.New("journal entry does not balance")
+	ErrInvalidEntry       = errors.New("invalid journal entry")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrWalletNotFound     = errors.New("wallet not found")
+	ErrWalletInactive     = errors.New("wallet is frozen or closed")
+	ErrCurrencyMismatch   = errors.New("wallet currency does not match the entry")
+	ErrDuplicateReference = errors.New("a journal entry with this reference already exists")
+)
+
+// LedgerCursor marks the last ledger line returned in a page. Lines are
+// numbered in posting order, so the number alone is a stable position.
+type LedgerCursor struct {
+	ID int64
+}
+
+// Encode returns the opaque string form of the cursor handed to clients
+func (c LedgerCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.ID, 10)))
+}
+
+// DecodeLedgerCursor parses a cursor produced by LedgerCursor.Encode
+func DecodeLedgerCursor(s string) (*LedgerCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &LedgerCursor{ID: id}, nil
+}
+
+// Reconciliation compares a wallet's stored balance with its ledger
+type Reconciliation struct {
+	WalletID      uuid.UUID
+	Balance       float64
+	LedgerBalance float64
+}
+
+// Matches reports whether the stored balance agrees with the ledger
+func (r Reconciliation) Matches() bool {
+	return toCents(r.Balance) == toCents(r.LedgerBalance)
+}
+
+// LedgerRepository keeps wallets and the double-entry ledger behind them.
+// Balances only change by posting journal entries, which lock the wallets
+// involved and update them with their lines in a serializable transaction.
+type LedgerRepository interface {
+	// Transact runs fn in a serializable transaction, retrying it when it
+	// loses a serialization conflict. fn may run more than once.
+	Transact(fn func(tx *gorm.DB) error) error
+	// Post records a balanced journal entry with entry.Lines and applies it
+	// to the wallets' balances in its own serializable transaction
+	Post(entry *models.JournalEntry) error
+	// PostTx posts entry inside tx, which must be serializable; use it to
+	// post alongside other writes in a Transact callback
+	PostTx(tx *gorm.DB, entry *models.JournalEntry) error
+	// GetOrCreateWallet returns the user's wallet in currency, opening an
+	// empty one if they have none
+	GetOrCreateWallet(userID uuid.UUID, currency string) (*models.Wallet, error)
+	// ListWallets returns the user's wallets
+	ListWallets(userID uuid.UUID) ([]models.Wallet, error)
+	// GetWallet returns one of the user's wallets, or ErrWalletNotFound
+	GetWallet(userID, walletID uuid.UUID) (*models.Wallet, error)
+	// ListEntries returns a page of a wallet's ledger lines, newest first,
+	// with their journal entries, and the cursor for the next page
+	ListEntries(walletID uuid.UUID, cursor *LedgerCursor, limit int) ([]models.LedgerEntry, *LedgerCursor, error)
+	// Reconcile compares a wallet's stored balance with the sum of its lines
+	Reconcile(walletID uuid.UUID) (*Reconciliation, error)
+}
+
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+func (r *ledgerRepository) Transact(fn func(tx *gorm.DB) error) error {
+	var err error
+	for attempt := 0; attempt < maxSerializationRetries; attempt++ {
+		err = r.db.Transaction(fn, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if !isSerializationFailure(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * 10 * time.Millisecond)
+	}
+	return fmt.Errorf("failed to post after %d attempts: %w", maxSerializationRetries, err)
+}
+
+func (r *ledgerRepository) Post(entry *models.JournalEntry) error {
+	lines := entry.Lines
+	return r.Transact(func(tx *gorm.DB) error {
+		// A retry starts from the entry as given
+		entry.ID = uuid.Nil
+		entry.Lines = append([]models.LedgerEntry(nil), lines...)
+		return r.PostTx(tx, entry)
+	})
+}
+
+func (r *ledgerRepository) PostTx(tx *gorm.DB, entry *models.JournalEntry) error {
+	if err := validateEntry(entry); err != nil {
+		return err
+	}
+
+	// Lock the wallets in a fixed order so concurrent postings over the same
+	// wallets queue instead of deadlocking
+	ids := make([]uuid.UUID, 0, len(entry.Lines))
+	seen := make(map[uuid.UUID]bool)
+	for _, line := range entry.Lines {
+		if line.WalletID != nil && !seen[*line.WalletID] {
+			seen[*line.WalletID] = true
+			ids = append(ids, *line.WalletID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	var wallets []models.Wallet
+	if len(ids) > 0 {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", ids).
+			Order("id").
+			Find(&wallets).Error; err != nil {
+			return err
+		}
+	}
+	if len(wallets) != len(ids) {
+		return ErrWalletNotFound
+	}
+
+	balances := make(map[uuid.UUID]int64, len(wallets))
+	for _, wallet := range wallets {
+		if wallet.Status != models.WalletStatusActive {
+			return fmt.Errorf("%w: %s", ErrWalletInactive, wallet.ID)
+		}
+		if !strings.EqualFold(wallet.Currency, entry.Currency) {
+			return fmt.Errorf("%w: %s holds %s", ErrCurrencyMismatch, wallet.ID, wallet.Currency)
+		}
+		balances[wallet.ID] = toCents(wallet.Balance)
+	}
+
+	for i := range entry.Lines {
+		line := &entry.Lines[i]
+		line.ID = 0
+		line.JournalEntryID = uuid.Nil
+		line.BalanceAfter = nil
+		if line.WalletID == nil {
+			continue
+		}
+		balance := balances[*line.WalletID] + toCents(line.Amount)
+		if balance < 0 {
+			return fmt.Errorf("%w in wallet %s", ErrInsufficientFunds, *line.WalletID)
+		}
+		balances[*line.WalletID] = balance
+		after := fromCents(balance)
+		line.BalanceAfter = &after
+	}
+
+	lines := entry.Lines
+	if err := tx.Omit("Lines").Create(entry).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateReference
+		}
+		return err
+	}
+	for i := range lines {
+		lines[i].JournalEntryID = entry.ID
+	}
+	if err := tx.Omit("Journal").Create(&lines).Error; err != nil {
+		return err
+	}
+	entry.Lines = lines
+
+	for id, balance := range balances {
+		if err := tx.Model(&models.Wallet{}).Where("id = ?", id).
+			Update("balance", fromCents(balance)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ledgerRepository) GetOrCreateWallet(userID uuid.UUID, currency string) (*models.Wallet, error) {
+	currency = strings.ToUpper(currency)
+	wallet := models.Wallet{UserID: userID, Currency: currency, Status: models.WalletStatusActive}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&wallet).Error; err != nil {
+		return nil, err
+	}
+	var existing models.Wallet
+	if err := r.db.Where("user_id = ? AND currency = ?", userID, currency).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *ledgerRepository) ListWallets(userID uuid.UUID) ([]models.Wallet, error) {
+	wallets := []models.Wallet{}
+	if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&wallets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list wallets: %v", err)
+	}
+	return wallets, nil
+}
+
+func (r *ledgerRepository) GetWallet(userID, walletID uuid.UUID) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := r.db.Where("id = ? AND user_id = ?", walletID, userID).First(&wallet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWalletNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (r *ledgerRepository) ListEntries(walletID uuid.UUID, cursor *LedgerCursor, limit int) ([]models.LedgerEntry, *LedgerCursor, error) {
+	if limit <= 0 {
+		limit = DefaultLedgerPageSize
+	}
+	if limit > MaxLedgerPageSize {
+		limit = MaxLedgerPageSize
+	}
+
+	query := r.db.Preload("Journal").Where("wallet_id = ?", walletID)
+	if cursor != nil {
+		query = query.Where("id < ?", cursor.ID)
+	}
+
+	entries := []models.LedgerEntry{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&entries).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to list ledger entries: %v", err)
+	}
+	if len(entries) <= limit {
+		return entries, nil, nil
+	}
+	entries = entries[:limit]
+	return entries, &LedgerCursor{ID: entries[len(entries)-1].ID}, nil
+}
+
+func (r *ledgerRepository) Reconcile(walletID uuid.UUID) (*Reconciliation, error) {
+	// One statement, so a posting in between cannot make the two disagree
+	var rows []Reconciliation
+	if err := r.db.Raw(`SELECT w.id AS wallet_id, w.balance,
+		COALESCE((SELECT SUM(l.amount) FROM ledger_entries l WHERE l.wallet_id = w.id), 0) AS ledger_balance
+		FROM wallets w WHERE w.id = ?`, walletID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrWalletNotFound
+	}
+	return &rows[0], nil
+}
+
+// validateEntry checks the entry's shape and that its lines sum to zero
+func validateEntry(entry *models.JournalEntry) error {
+	if entry.Kind == "" || len(entry.Currency) != 3 {
+		return fmt.Errorf("%w: kind and currency are required", ErrInvalidEntry)
+	}
+	if len(entry.Lines) < 2 {
+		return fmt.Errorf("%w: at least two lines are required", ErrInvalidEntry)
+	}
+	var total int64
+	for _, line := range entry.Lines {
+		if (line.WalletID == nil) == (line.SystemAccount == nil) {
+			return fmt.Errorf("%w: each line needs a wallet or a system account", ErrInvalidEntry)
+		}
+		cents := toCents(line.Amount)
+		if cents == 0 || math.Abs(line.Amount*100-float64(cents)) > 1e-6 {
+			return fmt.Errorf("%w: amounts must be non-zero whole cents", ErrInvalidEntry)
+		}
+		total += cents
+	}
+	if total != 0 {
+		return ErrUnbalancedEntry
+	}
+	return nil
+}
+
+// Amounts are summed in cents so balances never drift by float rounding
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+const (
+	DefaultTransactionPageSize = 50
+	MaxTransactionPageSize     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TransactionCursor marks the position of the last row returned in a page.
+// Rows are ordered by (transaction_date, id), newest first unless the filter
+// asks for ascending order, so the pair is unique and stable across inserts.
+type TransactionCursor struct {
+	TransactionDate time.Time
+	ID              uuid.UUID
+}
+
+// Encode returns the opaque string form of the cursor handed to clients
+func (c TransactionCursor) Encode() string {
+	raw := c.TransactionDate.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeTransactionCursor parses a cursor produced by TransactionCursor.Encode
+func DecodeTransactionCursor(s string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	date, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &TransactionCursor{TransactionDate: date, ID: id}, nil
+}
+
+// TransactionFilter describes which of a user's transactions to return
+type TransactionFilter struct {
+	UserID           uuid.UUID
+	LinkedAccountID  *uuid.UUID
+	From             *time.Time // inclusive
+	To               *time.Time // exclusive
+	MinAmount        *float64
+	MaxAmount        *float64
+	Type             models.TransactionType
+	CategoryID       *uuid.UUID // includes its subcategories
+	BudgetCategoryID *uuid.UUID
+	Search           string
+	Cursor           *TransactionCursor
+	Limit            int
+	Ascending        bool // oldest first; used by exports
+}
+
+type TransactionRepository interface {
+	// Upsert inserts the transactions, updating provider-owned fields of rows
+	// that already exist for the same (linked_account_id, provider_transaction_id).
+	Upsert(txns []models.ProviderTransaction) error
+	// ExistingProviderIDs returns the subset of ids already stored for the account
+	ExistingProviderIDs(linkedAccountID uuid.UUID, ids []string) (map[string]bool, error)
+	// List returns one page of transactions and the cursor for the next page,
+	// or nil when there are no more rows.
+	List(filter TransactionFilter) ([]models.ProviderTransaction, *TransactionCursor, error)
+	// Get returns one of the user's transactions, or gorm.ErrRecordNotFound
+	Get(userID, id uuid.UUID) (*models.ProviderTransaction, error)
+	// BalanceBefore returns the balance reported by the account's latest
+	// transaction strictly before the given time (or overall when before is
+	// nil), or nil when no transaction carries a balance.
+	BalanceBefore(linkedAccountID uuid.UUID, before *time.Time) (*float64, error)
+}
+
+type transactionRepository struct {
+	db *gorm.DB
+}
+
+func NewTransactionRepository(db *gorm.DB) TransactionRepository {
+	return &transactionRepository{db: db}
+}
+
+func (r *transactionRepository) Upsert(txns []models.ProviderTransaction) error {
+	if len(txns) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "linked_account_id"}, {Name: "provider_transaction_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"description",
+			"merchant_name",
+			"counterparty_name",
+			"counterparty_phone",
+			"balance_after",
+			"provider_metadata",
+			"sync_status",
+		}),
+	}).Create(&txns).Error
+}
+
+func (r *transactionRepository) ExistingProviderIDs(linkedAccountID uuid.UUID, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	var found []string
+	if err := r.db.Model(&models.ProviderTransaction{}).
+		Where("linked_account_id = ? AND provider_transaction_id IN ?", linkedAccountID, ids).
+		Pluck("provider_transaction_id", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+func (r *transactionRepository) List(filter TransactionFilter) ([]models.ProviderTransaction, *TransactionCursor, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultTransactionPageSize
+	}
+	if limit > MaxTransactionPageSize {
+		limit = MaxTransactionPageSize
+	}
+
+	comparison, direction := "<", "DESC"
+	if filter.Ascending {
+		comparison, direction = ">", "ASC"
+	}
+
+	query := r.scoped(filter)
+	if filter.Cursor != nil {
+		query = query.Where("(provider_transactions.transaction_date, provider_transactions.id) "+comparison+" (?, ?)",
+			filter.Cursor.TransactionDate, filter.Cursor.ID)
+	}
+
+	var txns []models.ProviderTransaction
+	if err := query.
+		Order("provider_transactions.transaction_date " + direction).
+		Order("provider_transactions.id " + direction).
+		Limit(limit + 1).
+		Find(&txns).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to list transactions: %v", err)
+	}
+
+	if len(txns) <= limit {
+		return txns, nil, nil
+	}
+
+	txns = txns[:limit]
+	last := txns[len(txns)-1]
+	return txns, &TransactionCursor{TransactionDate: last.TransactionDate, ID: last.ID}, nil
+}
+
+func (r *transactionRepository) Get(userID, id uuid.UUID) (*models.ProviderTransaction, error) {
+	var txn models.ProviderTransaction
+	if err := r.scoped(TransactionFilter{UserID: userID}).
+		Where("provider_transactions.id = ?", id).
+		First(&txn).Error; err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+func (r *transactionRepository) BalanceBefore(linkedAccountID uuid.UUID, before *time.Time) (*float64, error) {
+	query := r.db.Model(&models.ProviderTransaction{}).
+		Where("linked_account_id = ? AND balance_after IS NOT NULL", linkedAccountID)
+	if before != nil {
+		query = query.Where("transaction_date < ?", *before)
+	}
+
+	var txn models.ProviderTransaction
+	err := query.Order("transaction_date DESC").Order("id DESC").Limit(1).Find(&txn).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch balance: %v", err)
+	}
+	return txn.BalanceAfter, nil
+}
+
+// scoped applies the user ownership check and all non-cursor filters
+func (r *transactionRepository) scoped(filter TransactionFilter) *gorm.DB {
+	query := r.db.Model(&models.ProviderTransaction{}).
+		Select("provider_transactions.*").
+		Joins("JOIN linked_accounts ON linked_accounts.id = provider_transactions.linked_account_id").
+		Where("linked_accounts.user_id = ? AND linked_accounts.deleted_at IS NULL", filter.UserID)
+
+	if filter.LinkedAccountID != nil {
+		query = query.Where("provider_transactions.linked_account_id = ?", *filter.LinkedAccountID)
+	}
+	if filter.From != nil {
+		query = query.Where("provider_transactions.transaction_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("provider_transactions.transaction_date < ?", *filter.To)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("provider_transactions.amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("provider_transactions.amount <= ?", *filter.MaxAmount)
+	}
+	if filter.Type != "" {
+		query = query.Where("provider_transactions.transaction_type = ?", filter.Type)
+	}
+	if filter.CategoryID != nil {
+		query = query.Where("provider_transactions.category_id IN (SELECT id FROM transaction_categories WHERE id = ? OR parent_id = ?)",
+			*filter.CategoryID, *filter.CategoryID)
+	}
+	if filter.BudgetCategoryID != nil {
+		query = query.Where("provider_transactions.budget_category_id = ?", *filter.BudgetCategoryID)
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where("(provider_transactions.description ILIKE ? OR provider_transactions.merchant_name ILIKE ?)",
+			pattern, pattern)
+	}
+	return query
+}
+
+// escapeLike escapes the LIKE wildcard characters in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
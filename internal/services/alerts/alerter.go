@@ -0,0 +1,238 @@
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/budgets"
+	"github.com/moha/kaafipay-backend/internal/services/push"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// Alerter checks budget categories after transactions are ingested and
+// alerts the user when spending crosses a threshold or a single debit is
+// above the category's limit. Each alert is stored under a dedup key before
+// it is sent, so it fires at most once even if checks overlap.
+type Alerter struct {
+	db         *gorm.DB
+	summarizer *budgets.Summarizer
+	whatsapp   *whatsapp.WhatsAppProvider
+	push       *push.Sender
+}
+
+func NewAlerter(db *gorm.DB, summarizer *budgets.Summarizer, whatsapp *whatsapp.WhatsAppProvider, push *push.Sender) *Alerter {
+	return &Alerter{db: db, summarizer: summarizer, whatsapp: whatsapp, push: push}
+}
+
+// TransactionsIngested checks the categories the new transactions landed in.
+// Checks run in the background so delivery never slows ingestion.
+func (a *Alerter) TransactionsIngested(account *models.LinkedAccount, created []models.ProviderTransaction) {
+	txns := make([]models.ProviderTransaction, len(created))
+	copy(txns, created)
+	go a.Check(account.UserID, txns)
+}
+
+// Check evaluates the alerts of every category txns belong to
+func (a *Alerter) Check(userID uuid.UUID, txns []models.ProviderTransaction) {
+	byCategory := make(map[uuid.UUID][]models.ProviderTransaction)
+	for _, txn := range txns {
+		if txn.BudgetCategoryID != nil && txn.TransactionType == models.TransactionTypeDebit {
+			byCategory[*txn.BudgetCategoryID] = append(byCategory[*txn.BudgetCategoryID], txn)
+		}
+	}
+	if len(byCategory) == 0 {
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(byCategory))
+	for id := range byCategory {
+		ids = append(ids, id)
+	}
+	var categories []models.BudgetCategory
+	if err := a.db.Scopes(models.VisibleBudgetCategories(userID)).
+		Where("id IN ?", ids).
+		Find(&categories).Error; err != nil {
+		log.Printf("[BUDGET-ALERT] Failed to load categories for user %s: %v", userID, err)
+		return
+	}
+
+	var user models.User
+	if err := a.db.Select("id", "phone").First(&user, "id = ?", userID).Error; err != nil {
+		log.Printf("[BUDGET-ALERT] Failed to load user %s: %v", userID, err)
+		return
+	}
+
+	for i := range categories {
+		category := &categories[i]
+		if len(category.AlertThresholds) == 0 && category.AlertTransactionLimit == nil {
+			continue
+		}
+		if err := a.checkCategory(&user, category, byCategory[category.ID]); err != nil {
+			log.Printf("[BUDGET-ALERT] Category %s: %v", category.ID, err)
+		}
+	}
+}
+
+func (a *Alerter) checkCategory(user *models.User, category *models.BudgetCategory, txns []models.ProviderTransaction) error {
+	progress, err := a.summarizer.CategoryProgress(category, time.Now())
+	if err != nil {
+		return err
+	}
+	currency := progress.Currency
+
+	// Transactions from earlier periods, e.g. an imported statement, are
+	// history rather than news
+	if category.AlertTransactionLimit != nil {
+		limit := *category.AlertTransactionLimit
+		for _, txn := range txns {
+			if txn.TransactionDate.Before(progress.PeriodStart) {
+				continue
+			}
+			amount, err := a.summarizer.Convert(txn.Amount, txn.Currency, currency)
+			if err != nil || amount <= limit {
+				continue
+			}
+			txnID := txn.ID
+			alert := &models.BudgetAlert{
+				UserID:           user.ID,
+				BudgetCategoryID: category.ID,
+				TransactionID:    &txnID,
+				Kind:             models.BudgetAlertTransactionLimit,
+				PeriodStart:      progress.PeriodStart,
+				Amount:           utils.RoundMoney(amount),
+				Budget:           limit,
+				Currency:         currency,
+				Message: fmt.Sprintf("KaafiPay: A payment of %.2f %s%s in %s is above your %.2f %s alert limit.",
+					amount, currency, counterpartyOf(&txn), category.Name, limit, currency),
+				DedupKey: fmt.Sprintf("transaction:%s:%s", category.ID, txn.ID),
+			}
+			if err := a.fire(user, category, alert, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(category.AlertThresholds) == 0 {
+		return nil
+	}
+
+	// Thresholds on shared categories alert every member of the group.
+	// Transaction alerts above stay with the member who paid.
+	recipients := []models.User{*user}
+	if category.GroupID != nil {
+		recipients = nil
+		if err := a.db.Select("users.id", "users.phone").
+			Joins("JOIN budget_group_members ON budget_group_members.user_id = users.id").
+			Where("budget_group_members.group_id = ?", *category.GroupID).
+			Find(&recipients).Error; err != nil {
+			return err
+		}
+	}
+	for i := range recipients {
+		if err := a.checkThresholds(&recipients[i], category, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkThresholds records every crossed threshold so it does not fire again
+// this period, but delivers only the highest new one
+func (a *Alerter) checkThresholds(user *models.User, category *models.BudgetCategory, progress *budgets.CategorySummary) error {
+	thresholds := append([]int(nil), category.AlertThresholds...)
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+
+	whose, dedupSuffix := "your", ""
+	if category.GroupID != nil {
+		whose, dedupSuffix = "your household's shared", ":"+user.ID.String()
+	}
+
+	delivered := false
+	for _, threshold := range thresholds {
+		if progress.PercentUsed < float64(threshold) {
+			continue
+		}
+		alert := &models.BudgetAlert{
+			UserID:           user.ID,
+			BudgetCategoryID: category.ID,
+			Kind:             models.BudgetAlertThreshold,
+			Threshold:        &threshold,
+			PeriodStart:      progress.PeriodStart,
+			Amount:           progress.Spent,
+			Budget:           progress.EffectiveBudget,
+			Currency:         progress.Currency,
+			Message: fmt.Sprintf("KaafiPay: You have used %d%% of %s %s budget (%.2f of %.2f %s) this period.",
+				threshold, whose, category.Name, progress.Spent, progress.EffectiveBudget, progress.Currency),
+			DedupKey: fmt.Sprintf("threshold:%s:%s:%d%s", category.ID, progress.PeriodStart.Format("2006-01-02"), threshold, dedupSuffix),
+		}
+		if err := a.fire(user, category, alert, !delivered); err != nil {
+			return err
+		}
+		if alert.ID != uuid.Nil {
+			delivered = true
+		}
+	}
+	return nil
+}
+
+// fire stores the alert and, when deliver is set, sends it. Alerts whose
+// dedup key already exists are skipped and left with a nil ID.
+func (a *Alerter) fire(user *models.User, category *models.BudgetCategory, alert *models.BudgetAlert, deliver bool) error {
+	result := a.db.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		alert.ID = uuid.Nil
+		return nil
+	}
+	if !deliver {
+		return nil
+	}
+
+	var via, failures []string
+	if category.AlertChannel != models.AlertChannelPush {
+		if err := a.whatsapp.SendMessage(user.Phone, alert.Message); err != nil {
+			failures = append(failures, "whatsapp: "+err.Error())
+		} else {
+			via = append(via, models.AlertChannelWhatsApp)
+		}
+	}
+	if category.AlertChannel != models.AlertChannelWhatsApp {
+		data := map[string]string{"alertId": alert.ID.String(), "categoryId": category.ID.String()}
+		if err := a.push.Send(user.ID, category.Name, alert.Message, data); err != nil {
+			failures = append(failures, "push: "+err.Error())
+		} else {
+			via = append(via, models.AlertChannelPush)
+		}
+	}
+
+	alert.DeliveredVia = strings.Join(via, ",")
+	alert.DeliveryError = strings.Join(failures, "; ")
+	if len(failures) > 0 {
+		log.Printf("[BUDGET-ALERT] Delivery of alert %s failed: %s", alert.ID, alert.DeliveryError)
+	}
+	return a.db.Model(alert).Updates(map[string]interface{}{
+		"delivered_via":  alert.DeliveredVia,
+		"delivery_error": alert.DeliveryError,
+	}).Error
+}
+
+func counterpartyOf(txn *models.ProviderTransaction) string {
+	if txn.MerchantName != "" {
+		return " to " + txn.MerchantName
+	}
+	if txn.CounterpartyName != "" {
+		return " to " + txn.CounterpartyName
+	}
+	return ""
+}
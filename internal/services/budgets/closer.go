@@ -0,0 +1,129 @@
+package budgets
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	closeInterval = time.Hour
+	// maxPeriodsPerClose bounds how far a single run catches up on one
+	// category, e.g. after a long outage
+	maxPeriodsPerClose = 60
+)
+
+// PeriodCloser snapshots each budget period once it ends, recording what was
+// spent and how much rolls into the next period. Periods are closed in order
+// so each one's rollover feeds the next. Snapshots are unique per category
+// and period start, so several instances can run the closer side by side.
+type PeriodCloser struct {
+	db         *gorm.DB
+	summarizer *Summarizer
+}
+
+func NewPeriodCloser(db *gorm.DB, summarizer *Summarizer) *PeriodCloser {
+	return &PeriodCloser{db: db, summarizer: summarizer}
+}
+
+// Start runs the closer now and then every hour
+func (p *PeriodCloser) Start() {
+	go func() {
+		for {
+			if err := p.CloseDue(time.Now()); err != nil {
+				log.Printf("[BUDGET-CLOSE] %v", err)
+			}
+			time.Sleep(closeInterval)
+		}
+	}()
+}
+
+// CloseDue closes every period that ended at or before now
+func (p *PeriodCloser) CloseDue(now time.Time) error {
+	var categories []models.BudgetCategory
+	return p.db.Order("id").FindInBatches(&categories, 100, func(tx *gorm.DB, batch int) error {
+		for i := range categories {
+			if err := p.closeCategory(&categories[i], now.In(utils.LocalZone)); err != nil {
+				log.Printf("[BUDGET-CLOSE] Category %s: %v", categories[i].ID, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (p *PeriodCloser) closeCategory(category *models.BudgetCategory, now time.Time) error {
+	currency, err := p.summarizer.categoryCurrency(category)
+	if err != nil {
+		return err
+	}
+
+	// Resume after the last closed period, or start from the period the
+	// category was created in
+	var start, end time.Time
+	carried := 0.0
+	var last models.BudgetPeriod
+	err = p.db.Where("budget_category_id = ?", category.ID).Order("period_end DESC").First(&last).Error
+	switch {
+	case err == nil:
+		lastEnd := last.PeriodEnd.In(utils.LocalZone)
+		start, end = category.PeriodAt(lastEnd)
+		// The period settings changed since; close the remainder of the
+		// new period rather than overlapping the last one
+		if start.Before(lastEnd) {
+			start = lastEnd
+		}
+		if carried, err = p.summarizer.fx.Convert(last.Rollover, last.Currency, currency); err != nil {
+			log.Printf("[BUDGET-CLOSE] Category %s: dropping rollover: %v", category.ID, err)
+			carried = 0
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		start, end = category.PeriodAt(category.CreatedAt.In(utils.LocalZone))
+	default:
+		return err
+	}
+
+	for i := 0; i < maxPeriodsPerClose && !end.After(now); i++ {
+		spending, err := p.summarizer.spending(category, currency, start, end)
+		if err != nil {
+			return err
+		}
+
+		effective := category.Budget + carried
+		period := models.BudgetPeriod{
+			UserID:           category.UserID,
+			BudgetCategoryID: category.ID,
+			PeriodStart:      start,
+			PeriodEnd:        end,
+			Currency:         currency,
+			Budget:           category.Budget,
+			CarriedIn:        utils.RoundMoney(carried),
+			EffectiveBudget:  utils.RoundMoney(effective),
+			Spent:            utils.RoundMoney(spending.Spent),
+			Rollover:         utils.RoundMoney(category.RolloverFrom(effective, spending.Spent)),
+			RolloverMode:     category.RolloverMode,
+			TransactionCount: spending.Count,
+			ClosedAt:         time.Now(),
+		}
+		result := p.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&period)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Another instance is closing this category
+			return nil
+		}
+		log.Printf("[BUDGET-CLOSE] Closed %s %s to %s: spent %.2f of %.2f %s, rollover %.2f",
+			category.ID, start.Format("2006-01-02"), end.Format("2006-01-02"),
+			period.Spent, period.EffectiveBudget, currency, period.Rollover)
+
+		carried = period.Rollover
+		start, end = category.PeriodAt(end)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package budgets
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/fx"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// CategorySummary is a category's spending over one budget period. Amounts
+// are in Currency, which for shared categories is the group's currency;
+// PeriodEnd is exclusive. EffectiveBudget is
+// Budget plus whatever the previous period carried over, and Remaining,
+// PercentUsed and DailyAllowance are measured against it.
+type CategorySummary struct {
+	CategoryID       uuid.UUID  `json:"categoryId"`
+	GroupID          *uuid.UUID `json:"groupId,omitempty"`
+	Currency         string     `json:"currency"`
+	Name             string     `json:"name"`
+	Icon             string     `json:"icon"`
+	PeriodType       string     `json:"periodType"`
+	PeriodStart      time.Time  `json:"periodStart"`
+	PeriodEnd        time.Time  `json:"periodEnd"`
+	DaysInPeriod     int        `json:"daysInPeriod"`
+	DaysRemaining    int        `json:"daysRemaining"`
+	RolloverMode     string     `json:"rolloverMode"`
+	Budget           float64    `json:"budget"`
+	CarriedIn        float64    `json:"carriedIn"`
+	EffectiveBudget  float64    `json:"effectiveBudget"`
+	Spent            float64    `json:"spent"`
+	Remaining        float64    `json:"remaining"`
+	PercentUsed      float64    `json:"percentUsed"`
+	ProjectedSpend   float64    `json:"projectedSpend"`
+	DailyAllowance   float64    `json:"dailyAllowance"`
+	TransactionCount int        `json:"transactionCount"`
+	// UnconvertedCurrencies lists currencies left out of Spent because there
+	// is no exchange rate for them
+	UnconvertedCurrencies []string `json:"unconvertedCurrencies,omitempty"`
+}
+
+// Summary is the spending summary across a user's budget categories. Totals
+// are in the user's preferred currency.
+type Summary struct {
+	Currency        string            `json:"currency"`
+	Budget          float64           `json:"budget"`
+	EffectiveBudget float64           `json:"effectiveBudget"`
+	Spent           float64           `json:"spent"`
+	Remaining       float64           `json:"remaining"`
+	Categories      []CategorySummary `json:"categories"`
+}
+
+// Summarizer computes budget progress from categorized transactions
+type Summarizer struct {
+	db *gorm.DB
+	fx *fx.Converter
+}
+
+func NewSummarizer(db *gorm.DB, converter *fx.Converter) *Summarizer {
+	return &Summarizer{db: db, fx: converter}
+}
+
+// Summarize returns the progress of every category the user can see, their
+// own and those shared with their groups. periodsBack selects the period: 0
+// for the one containing now, 1 for the one before it, and so on.
+func (s *Summarizer) Summarize(userID uuid.UUID, now time.Time, periodsBack int) (*Summary, error) {
+	currency, err := s.userCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []models.BudgetCategory
+	if err := s.db.Scopes(models.VisibleBudgetCategories(userID)).
+		Order("priority ASC").Order("created_at ASC").Order("id ASC").
+		Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{Currency: currency, Categories: make([]CategorySummary, 0, len(categories))}
+	for i := range categories {
+		categoryCurrency, err := s.categoryCurrency(&categories[i])
+		if err != nil {
+			return nil, err
+		}
+		category, err := s.summarizeCategory(&categories[i], categoryCurrency, now.In(utils.LocalZone), periodsBack)
+		if err != nil {
+			return nil, err
+		}
+		summary.Categories = append(summary.Categories, *category)
+
+		// Shared categories in another currency count at today's rate
+		rate, err := s.fx.Convert(1, categoryCurrency, currency)
+		if err != nil {
+			log.Printf("[BUDGET-SUMMARY] Leaving category %s out of the totals: %v", category.CategoryID, err)
+			continue
+		}
+		summary.Budget += category.Budget * rate
+		summary.EffectiveBudget += category.EffectiveBudget * rate
+		summary.Spent += category.Spent * rate
+	}
+	summary.Budget = utils.RoundMoney(summary.Budget)
+	summary.EffectiveBudget = utils.RoundMoney(summary.EffectiveBudget)
+	summary.Spent = utils.RoundMoney(summary.Spent)
+	summary.Remaining = utils.RoundMoney(summary.EffectiveBudget - summary.Spent)
+	return summary, nil
+}
+
+// CategoryProgress returns a single category's progress in the period
+// containing now
+func (s *Summarizer) CategoryProgress(category *models.BudgetCategory, now time.Time) (*CategorySummary, error) {
+	currency, err := s.categoryCurrency(category)
+	if err != nil {
+		return nil, err
+	}
+	return s.summarizeCategory(category, currency, now.In(utils.LocalZone), 0)
+}
+
+// Convert converts amount into currency at the summarizer's rates
+func (s *Summarizer) Convert(amount float64, from, currency string) (float64, error) {
+	return s.fx.Convert(amount, from, currency)
+}
+
+// categoryCurrency returns the currency a category's budget is kept in: the
+// group's for shared categories and the owner's preferred currency otherwise
+func (s *Summarizer) categoryCurrency(category *models.BudgetCategory) (string, error) {
+	if category.GroupID == nil {
+		return s.userCurrency(category.UserID)
+	}
+	var group models.BudgetGroup
+	if err := s.db.Select("id", "currency").First(&group, "id = ?", *category.GroupID).Error; err != nil {
+		return "", err
+	}
+	return group.Currency, nil
+}
+
+func (s *Summarizer) userCurrency(userID uuid.UUID) (string, error) {
+	var user models.User
+	if err := s.db.Select("id", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+		return "", err
+	}
+	if user.PreferredCurrency == "" {
+		return "USD", nil
+	}
+	return strings.ToUpper(user.PreferredCurrency), nil
+}
+
+func (s *Summarizer) summarizeCategory(category *models.BudgetCategory, currency string, now time.Time, periodsBack int) (*CategorySummary, error) {
+	start, end := category.PeriodAt(now)
+	for i := 0; i < periodsBack; i++ {
+		start, end = category.PeriodAt(start.AddDate(0, 0, -1))
+	}
+
+	carriedIn, err := s.carriedInto(category, start, currency)
+	if err != nil {
+		return nil, err
+	}
+	spending, err := s.spending(category, currency, start, end)
+	if err != nil {
+		return nil, err
+	}
+	spent := spending.Spent
+	effective := category.Budget + carriedIn
+
+	summary := &CategorySummary{
+		CategoryID:            category.ID,
+		GroupID:               category.GroupID,
+		Currency:              currency,
+		Name:                  category.Name,
+		Icon:                  category.Icon,
+		PeriodType:            category.PeriodType,
+		PeriodStart:           start,
+		PeriodEnd:             end,
+		DaysInPeriod:          models.DaysBetween(start, end),
+		RolloverMode:          category.RolloverMode,
+		Budget:                category.Budget,
+		CarriedIn:             utils.RoundMoney(carriedIn),
+		EffectiveBudget:       utils.RoundMoney(effective),
+		TransactionCount:      spending.Count,
+		UnconvertedCurrencies: spending.Unconverted,
+	}
+
+	summary.Spent = utils.RoundMoney(spent)
+	summary.Remaining = utils.RoundMoney(effective - spent)
+	if effective > 0 {
+		summary.PercentUsed = utils.RoundMoney(spent / effective * 100)
+	}
+
+	// Days elapsed and remaining both count today
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	elapsed := summary.DaysInPeriod
+	if today.Before(end) {
+		elapsed = models.DaysBetween(start, today) + 1
+		summary.DaysRemaining = summary.DaysInPeriod - elapsed + 1
+	}
+
+	summary.ProjectedSpend = utils.RoundMoney(spent / float64(elapsed) * float64(summary.DaysInPeriod))
+	if summary.DaysRemaining > 0 && summary.Remaining > 0 {
+		summary.DailyAllowance = utils.RoundMoney(summary.Remaining / float64(summary.DaysRemaining))
+	}
+	return summary, nil
+}
+
+// carriedInto returns what the closed period ending at start carried over,
+// converted to currency. Nothing is carried until that period is closed.
+func (s *Summarizer) carriedInto(category *models.BudgetCategory, start time.Time, currency string) (float64, error) {
+	var previous models.BudgetPeriod
+	err := s.db.Where("budget_category_id = ? AND period_end = ?", category.ID, start).
+		First(&previous).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	carried, err := s.fx.Convert(previous.Rollover, previous.Currency, currency)
+	if err != nil {
+		log.Printf("[BUDGET-SUMMARY] Category %s: dropping rollover: %v", category.ID, err)
+		return 0, nil
+	}
+	return carried, nil
+}
+
+// periodSpending is what was spent in a category over a period
+type periodSpending struct {
+	Spent       float64
+	Count       int
+	Unconverted []string
+}
+
+type spendingRow struct {
+	Currency        string
+	TransactionType models.TransactionType
+	Total           float64
+	Count           int
+}
+
+// spending totals a category's transactions in [start, end) in currency.
+// Refunds credited back to the category offset what was spent in it. Shared
+// categories count transactions on accounts members still share, so an
+// account withdrawn from the group drops out of its history too.
+func (s *Summarizer) spending(category *models.BudgetCategory, currency string, start, end time.Time) (*periodSpending, error) {
+	categoryID := category.ID
+	query := s.db.Model(&models.ProviderTransaction{}).
+		Select("provider_transactions.currency, provider_transactions.transaction_type, SUM(provider_transactions.amount) AS total, COUNT(*) AS count")
+	if category.GroupID != nil {
+		query = query.Where("provider_transactions.linked_account_id IN (SELECT linked_account_id FROM budget_group_accounts WHERE group_id = ?)", *category.GroupID)
+	} else {
+		query = query.Joins("JOIN linked_accounts ON linked_accounts.id = provider_transactions.linked_account_id").
+			Where("linked_accounts.user_id = ?", category.UserID)
+	}
+
+	var rows []spendingRow
+	if err := query.
+		Where("provider_transactions.budget_category_id = ?", categoryID).
+		Where("provider_transactions.transaction_date >= ? AND provider_transactions.transaction_date < ?", start, end).
+		Group("provider_transactions.currency, provider_transactions.transaction_type").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := &periodSpending{}
+	for _, row := range rows {
+		amount, err := s.fx.Convert(row.Total, row.Currency, currency)
+		if err != nil {
+			log.Printf("[BUDGET-SUMMARY] Category %s: %v", categoryID, err)
+			result.Unconverted = append(result.Unconverted, strings.ToUpper(row.Currency))
+			continue
+		}
+		if row.TransactionType == models.TransactionTypeCredit {
+			result.Spent -= amount
+		} else {
+			result.Spent += amount
+		}
+		result.Count += row.Count
+	}
+	sort.Strings(result.Unconverted)
+	result.Spent = math.Max(result.Spent, 0)
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package budgets
+
+import (
+	"math"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// Template is an onboarding preset of budget categories. Amounts are shares
+// of the user's monthly income.
+type Template struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Categories  []TemplateCategory `json:"categories"`
+}
+
+// TemplateCategory is a budget category in a template. ParentSlug names the
+// system category it is created under.
+type TemplateCategory struct {
+	Name            string              `json:"name"`
+	Icon            string              `json:"icon"`
+	Share           float64             `json:"share"` // of monthly income, 0 to 1
+	SuggestedAmount *float64            `json:"suggestedAmount,omitempty"`
+	ParentSlug      string              `json:"parentSlug,omitempty"`
+	Rules           []models.BudgetRule `json:"rules"`
+}
+
+// Templates lists the available presets
+func Templates() []Template {
+	return []Template{
+		{
+			ID:          "student",
+			Name:        "Student",
+			Description: "Meals, transport, airtime and study costs on a tight monthly allowance",
+			Categories: []TemplateCategory{
+				{Name: "Books & Fees", Icon: "graduation-cap", Share: 0.25, ParentSlug: "education",
+					Rules: []models.BudgetRule{descriptionContains("school", "university", "college", "fees", "books")}},
+				{Name: "Airtime & Data", Icon: "smartphone", Share: 0.10, ParentSlug: "bills.airtime",
+					Rules: []models.BudgetRule{merchantContains("telesom", "somtel", "hormuud", "golis")}},
+				{Name: "Food & Tea", Icon: "utensils", Share: 0.30, ParentSlug: "food",
+					Rules: []models.BudgetRule{merchantContains("restaurant", "hotel", "cafe", "canteen", "shaah")}},
+				{Name: "Transport", Icon: "bike", Share: 0.15, ParentSlug: "transport",
+					Rules: []models.BudgetRule{merchantContains("bajaj", "taxi", "bus")}},
+				{Name: "Personal", Icon: "shopping-bag", Share: 0.10, ParentSlug: "shopping",
+					Rules: []models.BudgetRule{merchantContains("shop", "store", "supermarket", "boutique")}},
+			},
+		},
+		{
+			ID:          "family-hargeisa",
+			Name:        "Family in Hargeisa",
+			Description: "Rent, groceries, utilities and school fees for a household in Hargeisa",
+			Categories: []TemplateCategory{
+				{Name: "Rent", Icon: "key", Share: 0.25, ParentSlug: "housing.rent",
+					Rules: []models.BudgetRule{descriptionContains("rent", "kiro", "kirada")}},
+				{Name: "Electricity & Water", Icon: "zap", Share: 0.08, ParentSlug: "bills",
+					Rules: []models.BudgetRule{merchantContains("beco", "hargeisa water", "biyaha")}},
+				{Name: "Airtime", Icon: "smartphone", Share: 0.04, ParentSlug: "bills.airtime",
+					Rules: []models.BudgetRule{merchantContains("telesom", "somtel")}},
+				{Name: "School Fees", Icon: "school", Share: 0.15, ParentSlug: "education.school_fees",
+					Rules: []models.BudgetRule{descriptionContains("school", "iskuul", "madrasa", "fees")}},
+				{Name: "Health", Icon: "pill", Share: 0.05, ParentSlug: "health",
+					Rules: []models.BudgetRule{merchantContains("pharmacy", "farmashiye", "hospital", "clinic", "isbitaal")}},
+				{Name: "Groceries", Icon: "shopping-cart", Share: 0.28, ParentSlug: "food.groceries",
+					Rules: []models.BudgetRule{merchantContains("supermarket", "market", "suuq", "dukaan", "shop")}},
+				{Name: "Transport", Icon: "bike", Share: 0.05, ParentSlug: "transport",
+					Rules: []models.BudgetRule{merchantContains("bajaj", "taxi", "bus", "fuel", "petrol")}},
+			},
+		},
+		{
+			ID:          "remittance-receiver",
+			Name:        "Remittance receiver",
+			Description: "Make money sent from abroad cover the household, with a share passed on to relatives",
+			Categories: []TemplateCategory{
+				{Name: "Support to Relatives", Icon: "hand-heart", Share: 0.10, ParentSlug: "family.support",
+					Rules: []models.BudgetRule{{All: []models.BudgetRule{
+						merchantContains("dahabshiil", "amal", "taaj", "world remit"),
+						{Type: models.RuleTypeDirection, Operator: models.RuleOpEquals, Value: models.StringRuleValue("DEBIT")},
+					}}}},
+				{Name: "Rent", Icon: "key", Share: 0.25, ParentSlug: "housing.rent",
+					Rules: []models.BudgetRule{descriptionContains("rent", "kiro", "kirada")}},
+				{Name: "Utilities & Airtime", Icon: "zap", Share: 0.10, ParentSlug: "bills",
+					Rules: []models.BudgetRule{merchantContains("beco", "water", "telesom", "somtel")}},
+				{Name: "Education", Icon: "graduation-cap", Share: 0.15, ParentSlug: "education",
+					Rules: []models.BudgetRule{descriptionContains("school", "iskuul", "university", "fees")}},
+				{Name: "Household", Icon: "home", Share: 0.35, ParentSlug: "food.groceries",
+					Rules: []models.BudgetRule{merchantContains("supermarket", "market", "suuq", "dukaan", "shop")}},
+			},
+		},
+	}
+}
+
+// FindTemplate returns a fresh copy of the template with the given ID
+func FindTemplate(id string) (*Template, bool) {
+	for _, template := range Templates() {
+		if template.ID == id {
+			return &template, true
+		}
+	}
+	return nil, false
+}
+
+// WithIncome fills in each category's suggested amount for a monthly income
+func (t *Template) WithIncome(income float64) {
+	for i := range t.Categories {
+		amount := t.Categories[i].Amount(income)
+		t.Categories[i].SuggestedAmount = &amount
+	}
+}
+
+// Amount returns the category's budget for a monthly income, rounded to
+// whole currency units
+func (c *TemplateCategory) Amount(income float64) float64 {
+	return math.Max(math.Round(income*c.Share), 1)
+}
+
+// BudgetCategory builds the user's category from the template. The caller
+// resolves ParentSlug and sets the priority.
+func (c *TemplateCategory) BudgetCategory(income float64) models.BudgetCategory {
+	category := models.BudgetCategory{
+		Name:   c.Name,
+		Icon:   c.Icon,
+		Budget: c.Amount(income),
+		Rules:  c.Rules,
+	}
+	category.SetPeriodDefaults()
+	return category
+}
+
+func descriptionContains(values ...string) models.BudgetRule {
+	return containsAny(models.RuleTypeDescription, values)
+}
+
+func merchantContains(values ...string) models.BudgetRule {
+	return containsAny(models.RuleTypeMerchant, values)
+}
+
+// containsAny matches a text field containing any of values
+func containsAny(ruleType string, values []string) models.BudgetRule {
+	rules := make([]models.BudgetRule, 0, len(values))
+	for _, value := range values {
+		rules = append(rules, models.BudgetRule{
+			Type:     ruleType,
+			Operator: models.RuleOpContains,
+			Value:    models.StringRuleValue(value),
+		})
+	}
+	if len(rules) == 1 {
+		return rules[0]
+	}
+	return models.BudgetRule{Any: rules}
+}
@@ -0,0 +1,95 @@
+package exports
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+var csvHeader = []string{
+	"date",
+	"account_id",
+	"account",
+	"provider",
+	"transaction_id",
+	"type",
+	"amount",
+	"currency",
+	"description",
+	"merchant",
+	"counterparty",
+	"counterparty_phone",
+	"balance_after",
+}
+
+// csvWriter writes one row per transaction across all accounts, followed by
+// a "# checksum" comment line
+type csvWriter struct {
+	out         io.Writer
+	w           *csv.Writer
+	wroteHeader bool
+	account     models.LinkedAccount
+}
+
+func newCSVWriter(out io.Writer) *csvWriter {
+	return &csvWriter{out: out, w: csv.NewWriter(out)}
+}
+
+func (cw *csvWriter) BeginStatement(stmt Statement) error {
+	cw.account = stmt.Account
+	if cw.wroteHeader {
+		return nil
+	}
+	cw.wroteHeader = true
+	return cw.w.Write(csvHeader)
+}
+
+func (cw *csvWriter) WriteTransactions(txns []models.ProviderTransaction) error {
+	for i := range txns {
+		txn := &txns[i]
+		balance := ""
+		if txn.BalanceAfter != nil {
+			balance = formatAmount(*txn.BalanceAfter)
+		}
+		if err := cw.w.Write([]string{
+			txn.TransactionDate.UTC().Format(time.RFC3339),
+			txn.LinkedAccountID.String(),
+			cw.account.AccountTitle,
+			string(cw.account.Provider),
+			txn.ProviderTransactionID,
+			string(txn.TransactionType),
+			formatAmount(txn.Amount),
+			txn.Currency,
+			txn.Description,
+			txn.MerchantName,
+			txn.CounterpartyName,
+			txn.CounterpartyPhone,
+			balance,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) EndStatement(Statement) error {
+	return nil
+}
+
+func (cw *csvWriter) Close(checksum string) error {
+	if !cw.wroteHeader {
+		if err := cw.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	cw.w.Flush()
+	if err := cw.w.Error(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(cw.out, "# checksum %s\n", checksum)
+	return err
+}
@@ -0,0 +1,199 @@
+package exports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	FormatCSV Format = "csv"
+	FormatOFX Format = "ofx"
+	FormatPDF Format = "pdf"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// ContentType returns the MIME type served for the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatOFX:
+		return "application/x-ofx"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "application/octet-stream"
+}
+
+// IsValid reports whether the format can be exported
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatCSV, FormatOFX, FormatPDF:
+		return true
+	}
+	return false
+}
+
+// Statement describes one linked account section of an export
+type Statement struct {
+	Account        models.LinkedAccount
+	From           *time.Time
+	To             *time.Time
+	OpeningBalance *float64
+	ClosingBalance *float64
+}
+
+// writer renders one export format. Accounts are written one after another,
+// each followed by its transactions in batches, oldest first.
+type writer interface {
+	BeginStatement(stmt Statement) error
+	WriteTransactions(txns []models.ProviderTransaction) error
+	EndStatement(stmt Statement) error
+	// Close writes the footer carrying the checksum of all exported rows
+	Close(checksum string) error
+}
+
+// flusher is implemented by HTTP response writers
+type flusher interface {
+	Flush()
+}
+
+// Exporter streams a user's transactions to CSV, OFX or PDF
+type Exporter struct {
+	db   *gorm.DB
+	repo repository.TransactionRepository
+}
+
+func NewExporter(db *gorm.DB, repo repository.TransactionRepository) *Exporter {
+	return &Exporter{db: db, repo: repo}
+}
+
+// Export writes every transaction matching filter to w, grouped by linked
+// account. Rows are read in keyset batches and flushed as they are written,
+// so memory use does not grow with the size of the range.
+func (e *Exporter) Export(w io.Writer, format Format, filter repository.TransactionFilter) error {
+	var accounts []models.LinkedAccount
+	query := e.db.Where("user_id = ?", filter.UserID)
+	if filter.LinkedAccountID != nil {
+		query = query.Where("id = ?", *filter.LinkedAccountID)
+	}
+	if err := query.Order("created_at, id").Find(&accounts).Error; err != nil {
+		return fmt.Errorf("failed to fetch linked accounts: %v", err)
+	}
+
+	var out writer
+	switch format {
+	case FormatCSV:
+		out = newCSVWriter(w)
+	case FormatOFX:
+		out = newOFXWriter(w)
+	case FormatPDF:
+		out = newPDFWriter(w)
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	sum := newChecksum()
+	for _, account := range accounts {
+		stmt := Statement{Account: account, From: filter.From, To: filter.To}
+
+		var err error
+		if filter.From != nil {
+			if stmt.OpeningBalance, err = e.repo.BalanceBefore(account.ID, filter.From); err != nil {
+				return err
+			}
+		}
+		if stmt.ClosingBalance, err = e.repo.BalanceBefore(account.ID, filter.To); err != nil {
+			return err
+		}
+
+		if err := out.BeginStatement(stmt); err != nil {
+			return err
+		}
+
+		accountFilter := filter
+		accountFilter.LinkedAccountID = &account.ID
+		accountFilter.Ascending = true
+		accountFilter.Limit = repository.MaxTransactionPageSize
+		accountFilter.Cursor = nil
+		for {
+			txns, next, err := e.repo.List(accountFilter)
+			if err != nil {
+				return err
+			}
+			for i := range txns {
+				sum.add(&txns[i])
+			}
+			if err := out.WriteTransactions(txns); err != nil {
+				return err
+			}
+			if f, ok := w.(flusher); ok {
+				f.Flush()
+			}
+			if next == nil {
+				break
+			}
+			accountFilter.Cursor = next
+		}
+
+		if err := out.EndStatement(stmt); err != nil {
+			return err
+		}
+	}
+
+	return out.Close(sum.String())
+}
+
+// checksum hashes a canonical line per exported transaction. It depends only
+// on the exported rows, so the same filters over the same data always yield
+// the same value whatever the format or generation time.
+type checksum struct {
+	h hash.Hash
+}
+
+func newChecksum() *checksum {
+	return &checksum{h: sha256.New()}
+}
+
+func (c *checksum) add(txn *models.ProviderTransaction) {
+	fmt.Fprintf(c.h, "%s|%s|%s|%s|%s|%s|%s\n",
+		txn.LinkedAccountID,
+		txn.ProviderTransactionID,
+		txn.TransactionDate.UTC().Format(time.RFC3339),
+		txn.TransactionType,
+		formatAmount(txn.Amount),
+		txn.Currency,
+		strings.TrimSpace(txn.Description),
+	)
+}
+
+func (c *checksum) String() string {
+	return "sha256:" + hex.EncodeToString(c.h.Sum(nil))
+}
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// signedAmount returns the amount as seen from the account: debits negative
+func signedAmount(txn *models.ProviderTransaction) float64 {
+	if txn.TransactionType == models.TransactionTypeDebit {
+		return -txn.Amount
+	}
+	return txn.Amount
+}
@@ -0,0 +1,121 @@
+package exports
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+const ofxDateLayout = "20060102150405"
+
+// ofxWriter writes an OFX 2.x document with one bank statement per linked
+// account. The checksum goes in a trailing XML comment.
+type ofxWriter struct {
+	w       *bufio.Writer
+	started bool
+	stmtNo  int
+	last    time.Time
+}
+
+func newOFXWriter(out io.Writer) *ofxWriter {
+	return &ofxWriter{w: bufio.NewWriter(out)}
+}
+
+func (ow *ofxWriter) begin() {
+	if ow.started {
+		return
+	}
+	ow.started = true
+	ow.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	ow.w.WriteString(`<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	ow.w.WriteString("<OFX>\n<SIGNONMSGSRSV1><SONRS>\n")
+	ow.w.WriteString("<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(ow.w, "<DTSERVER>%s</DTSERVER>\n", time.Now().UTC().Format(ofxDateLayout))
+	ow.w.WriteString("<LANGUAGE>ENG</LANGUAGE>\n</SONRS></SIGNONMSGSRSV1>\n<BANKMSGSRSV1>\n")
+}
+
+func (ow *ofxWriter) BeginStatement(stmt Statement) error {
+	ow.begin()
+	ow.stmtNo++
+
+	start := stmt.Account.CreatedAt
+	if stmt.From != nil {
+		start = *stmt.From
+	}
+	end := time.Now()
+	if stmt.To != nil {
+		end = *stmt.To
+	}
+	ow.last = end
+
+	fmt.Fprintf(ow.w, "<STMTTRNRS>\n<TRNUID>%d</TRNUID>\n", ow.stmtNo)
+	ow.w.WriteString("<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n<STMTRS>\n")
+	fmt.Fprintf(ow.w, "<CURDEF>%s</CURDEF>\n", ofxEscape(strings.ToUpper(stmt.Account.CurrencyCode)))
+	fmt.Fprintf(ow.w, "<BANKACCTFROM><BANKID>%s</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n",
+		ofxEscape(string(stmt.Account.Provider)), ofxEscape(stmt.Account.AccountNumber))
+	fmt.Fprintf(ow.w, "<BANKTRANLIST>\n<DTSTART>%s</DTSTART>\n<DTEND>%s</DTEND>\n",
+		start.UTC().Format(ofxDateLayout), end.UTC().Format(ofxDateLayout))
+	return nil
+}
+
+func (ow *ofxWriter) WriteTransactions(txns []models.ProviderTransaction) error {
+	for i := range txns {
+		txn := &txns[i]
+		name := txn.MerchantName
+		if name == "" {
+			name = txn.CounterpartyName
+		}
+
+		ow.w.WriteString("<STMTTRN>\n")
+		fmt.Fprintf(ow.w, "<TRNTYPE>%s</TRNTYPE>\n", txn.TransactionType)
+		fmt.Fprintf(ow.w, "<DTPOSTED>%s</DTPOSTED>\n", txn.TransactionDate.UTC().Format(ofxDateLayout))
+		fmt.Fprintf(ow.w, "<TRNAMT>%s</TRNAMT>\n", formatAmount(signedAmount(txn)))
+		fmt.Fprintf(ow.w, "<FITID>%s</FITID>\n", ofxEscape(txn.ProviderTransactionID))
+		if name != "" {
+			// OFX limits NAME to 32 characters
+			fmt.Fprintf(ow.w, "<NAME>%s</NAME>\n", ofxEscape(truncate(name, 32)))
+		}
+		if txn.Description != "" {
+			fmt.Fprintf(ow.w, "<MEMO>%s</MEMO>\n", ofxEscape(truncate(txn.Description, 255)))
+		}
+		ow.w.WriteString("</STMTTRN>\n")
+	}
+	return ow.w.Flush()
+}
+
+func (ow *ofxWriter) EndStatement(stmt Statement) error {
+	ow.w.WriteString("</BANKTRANLIST>\n")
+	if stmt.ClosingBalance != nil {
+		fmt.Fprintf(ow.w, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n",
+			formatAmount(*stmt.ClosingBalance), ow.last.UTC().Format(ofxDateLayout))
+	}
+	ow.w.WriteString("</STMTRS>\n</STMTTRNRS>\n")
+	return ow.w.Flush()
+}
+
+func (ow *ofxWriter) Close(checksum string) error {
+	ow.begin()
+	ow.w.WriteString("</BANKMSGSRSV1>\n</OFX>\n")
+	fmt.Fprintf(ow.w, "<!-- checksum %s -->\n", checksum)
+	return ow.w.Flush()
+}
+
+func ofxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,329 @@
+package exports
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// A4 portrait, in points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 40
+	pdfLineHeight = 14
+	pdfFontSize   = 9
+)
+
+// Table column positions. Amount columns are right aligned on their edge.
+const (
+	pdfColDate        = pdfMargin
+	pdfColDescription = 100
+	pdfColDebitEdge   = 410
+	pdfColCreditEdge  = 480
+	pdfColBalanceEdge = pdfPageWidth - pdfMargin
+)
+
+// Fixed object numbers; pages are numbered from pdfFirstPageObject on and the
+// page tree is written last, once all its kids are known.
+const (
+	pdfCatalogObject   = 1
+	pdfPagesObject     = 2
+	pdfFontObject      = 3
+	pdfBoldFontObject  = 4
+	pdfFirstPageObject = 5
+)
+
+// pdfWriter writes a minimal PDF 1.4 statement using the standard Helvetica
+// fonts. Only the current page is held in memory; finished pages go straight
+// to the output and the cross-reference table is built from their offsets.
+type pdfWriter struct {
+	w       *countingWriter
+	offsets map[int]int64
+	nextObj int
+	pages   []int
+
+	page       bytes.Buffer
+	y          int
+	pageNo     int
+	started    bool
+	statements int
+
+	currency string
+	credits  float64
+	debits   float64
+}
+
+func newPDFWriter(out io.Writer) *pdfWriter {
+	return &pdfWriter{
+		w:       &countingWriter{w: bufio.NewWriter(out)},
+		offsets: make(map[int]int64),
+		nextObj: pdfFirstPageObject,
+	}
+}
+
+func (pw *pdfWriter) begin() {
+	if pw.started {
+		return
+	}
+	pw.started = true
+	pw.w.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	pw.object(pdfCatalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesObject))
+	pw.object(pdfFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	pw.object(pdfBoldFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	pw.newPage()
+}
+
+func (pw *pdfWriter) BeginStatement(stmt Statement) error {
+	pw.begin()
+	pw.statements++
+	pw.currency = stmt.Account.CurrencyCode
+	pw.credits, pw.debits = 0, 0
+
+	// Keep the account heading together with at least a few rows
+	pw.ensureSpace(8)
+	if pw.y < pdfPageHeight-pdfMargin-2*pdfLineHeight {
+		pw.y -= pdfLineHeight
+	}
+
+	pw.text(pdfColDate, true, 11, fmt.Sprintf("%s - %s %s", stmt.Account.AccountTitle, stmt.Account.Provider, stmt.Account.AccountNumber))
+	pw.y -= pdfLineHeight + 2
+	pw.text(pdfColDate, false, pdfFontSize, "Period: "+formatPeriod(stmt))
+	pw.y -= pdfLineHeight
+	pw.text(pdfColDate, false, pdfFontSize, "Opening balance: "+pw.formatBalance(stmt.OpeningBalance))
+	pw.y -= pdfLineHeight + 4
+
+	pw.tableHeader()
+	return nil
+}
+
+func (pw *pdfWriter) WriteTransactions(txns []models.ProviderTransaction) error {
+	for i := range txns {
+		txn := &txns[i]
+		if pw.ensureSpace(1) {
+			pw.tableHeader()
+		}
+
+		description := txn.Description
+		if description == "" {
+			description = txn.MerchantName
+		}
+		if description == "" {
+			description = txn.CounterpartyName
+		}
+
+		pw.text(pdfColDate, false, pdfFontSize, txn.TransactionDate.Format("2006-01-02"))
+		pw.text(pdfColDescription, false, pdfFontSize, truncate(description, 42))
+		if txn.TransactionType == models.TransactionTypeDebit {
+			pw.textRight(pdfColDebitEdge, formatAmount(txn.Amount))
+			pw.debits += txn.Amount
+		} else {
+			pw.textRight(pdfColCreditEdge, formatAmount(txn.Amount))
+			pw.credits += txn.Amount
+		}
+		if txn.BalanceAfter != nil {
+			pw.textRight(pdfColBalanceEdge, formatAmount(*txn.BalanceAfter))
+		}
+		pw.y -= pdfLineHeight
+	}
+	return pw.w.Flush()
+}
+
+func (pw *pdfWriter) EndStatement(stmt Statement) error {
+	pw.ensureSpace(4)
+	pw.rule()
+	pw.y -= pdfLineHeight
+	pw.text(pdfColDescription, true, pdfFontSize, "Totals")
+	pw.textRight(pdfColDebitEdge, formatAmount(pw.debits))
+	pw.textRight(pdfColCreditEdge, formatAmount(pw.credits))
+	pw.y -= pdfLineHeight
+	pw.text(pdfColDate, false, pdfFontSize, "Closing balance: "+pw.formatBalance(stmt.ClosingBalance))
+	pw.y -= pdfLineHeight
+	return pw.w.Flush()
+}
+
+func (pw *pdfWriter) Close(checksum string) error {
+	pw.begin()
+	if pw.statements == 0 {
+		pw.text(pdfColDate, false, pdfFontSize, "No linked accounts match the selected filters.")
+		pw.y -= pdfLineHeight
+	}
+	pw.ensureSpace(2)
+	pw.y -= pdfLineHeight
+	pw.text(pdfColDate, false, 7, "Checksum: "+checksum)
+	pw.finishPage()
+
+	kids := make([]string, len(pw.pages))
+	for i, obj := range pw.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", obj)
+	}
+	pw.object(pdfPagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pw.pages)))
+
+	size := pw.nextObj
+	xref := pw.w.n
+	fmt.Fprintf(pw.w, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for obj := 1; obj < size; obj++ {
+		fmt.Fprintf(pw.w, "%010d 00000 n \n", pw.offsets[obj])
+	}
+	fmt.Fprintf(pw.w, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, pdfCatalogObject, xref)
+	return pw.w.Flush()
+}
+
+func (pw *pdfWriter) object(num int, body string) {
+	pw.offsets[num] = pw.w.n
+	fmt.Fprintf(pw.w, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (pw *pdfWriter) newPage() {
+	pw.page.Reset()
+	pw.pageNo++
+	pw.y = pdfPageHeight - pdfMargin - pdfLineHeight
+	pw.textAt(pdfColBalanceEdge-pdfTextWidth(fmt.Sprintf("Page %d", pw.pageNo), 7), pdfMargin/2, false, 7, fmt.Sprintf("Page %d", pw.pageNo))
+}
+
+// finishPage writes the buffered page as a content stream and page object
+func (pw *pdfWriter) finishPage() {
+	contentObj, pageObj := pw.nextObj, pw.nextObj+1
+	pw.nextObj += 2
+
+	pw.offsets[contentObj] = pw.w.n
+	fmt.Fprintf(pw.w, "%d 0 obj\n<< /Length %d >>\nstream\n", contentObj, pw.page.Len())
+	pw.w.Write(pw.page.Bytes())
+	pw.w.WriteString("\nendstream\nendobj\n")
+
+	pw.object(pageObj, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> >>",
+		pdfPagesObject, pdfPageWidth, pdfPageHeight, contentObj, pdfFontObject, pdfBoldFontObject))
+	pw.pages = append(pw.pages, pageObj)
+}
+
+// ensureSpace starts a new page when fewer than lines rows are left, and
+// reports whether it did
+func (pw *pdfWriter) ensureSpace(lines int) bool {
+	if pw.y-lines*pdfLineHeight >= pdfMargin {
+		return false
+	}
+	pw.finishPage()
+	pw.newPage()
+	return true
+}
+
+func (pw *pdfWriter) tableHeader() {
+	pw.text(pdfColDate, true, pdfFontSize, "Date")
+	pw.text(pdfColDescription, true, pdfFontSize, "Description")
+	pw.textRightBold(pdfColDebitEdge, "Debit")
+	pw.textRightBold(pdfColCreditEdge, "Credit")
+	pw.textRightBold(pdfColBalanceEdge, "Balance")
+	pw.y -= 4
+	pw.rule()
+	pw.y -= pdfLineHeight
+}
+
+func (pw *pdfWriter) rule() {
+	fmt.Fprintf(&pw.page, "0.5 w %d %d m %d %d l S\n", pdfMargin, pw.y, pdfPageWidth-pdfMargin, pw.y)
+}
+
+func (pw *pdfWriter) text(x int, bold bool, size int, s string) {
+	pw.textAt(float64(x), pw.y, bold, size, s)
+}
+
+func (pw *pdfWriter) textRight(edge int, s string) {
+	pw.textAt(float64(edge)-pdfTextWidth(s, pdfFontSize), pw.y, false, pdfFontSize, s)
+}
+
+func (pw *pdfWriter) textRightBold(edge int, s string) {
+	pw.textAt(float64(edge)-pdfTextWidth(s, pdfFontSize), pw.y, true, pdfFontSize, s)
+}
+
+func (pw *pdfWriter) textAt(x float64, y int, bold bool, size int, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&pw.page, "BT /%s %d Tf %.2f %d Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+func (pw *pdfWriter) formatBalance(balance *float64) string {
+	if balance == nil {
+		return "not available"
+	}
+	return formatAmount(*balance) + " " + pw.currency
+}
+
+func formatPeriod(stmt Statement) string {
+	from, to := "start of history", "today"
+	if stmt.From != nil {
+		from = stmt.From.Format("2006-01-02")
+	}
+	if stmt.To != nil {
+		// Filters use an exclusive upper bound
+		to = stmt.To.Add(-1).Format("2006-01-02")
+	}
+	return from + " to " + to
+}
+
+// pdfEscape maps s onto the printable ASCII subset of WinAnsiEncoding and
+// escapes the string delimiters
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfTextWidth approximates the width of s in Helvetica. Amounts only use
+// digits and punctuation, whose widths are exact; other characters use an
+// average width.
+func pdfTextWidth(s string, size int) float64 {
+	units := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			units += 556
+		case r == '.' || r == ',' || r == ' ':
+			units += 278
+		case r == '-':
+			units += 333
+		default:
+			units += 580
+		}
+	}
+	return float64(units) * float64(size) / 1000
+}
+
+// countingWriter tracks the byte offset needed for the xref table
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (cw *countingWriter) WriteString(s string) (int, error) {
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (cw *countingWriter) Flush() error {
+	return cw.w.Flush()
+}
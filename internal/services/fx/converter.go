@@ -0,0 +1,77 @@
+package fx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultRates are approximate US dollar values of one unit of each currency
+// the providers report. They are overridden by FX_RATES.
+var defaultRates = map[string]float64{
+	"USD": 1,
+	"SLS": 1.0 / 8500, // Somaliland shilling, see receipts.CurrencySLS
+	"SOS": 1.0 / 571,
+	"ETB": 1.0 / 57,
+	"KES": 1.0 / 129,
+	"DJF": 1.0 / 178,
+	"EUR": 1.08,
+	"GBP": 1.27,
+}
+
+// Converter converts amounts between currencies through their US dollar
+// value. Rates are static, so historical amounts convert at today's rate.
+type Converter struct {
+	rates map[string]float64
+}
+
+// NewConverter returns a converter using the built-in rates overridden by
+// spec, a comma separated list of CODE=USD_VALUE pairs such as
+// "SLS=0.000118,SOS=0.00175"
+func NewConverter(spec string) (*Converter, error) {
+	rates := make(map[string]float64, len(defaultRates))
+	for code, rate := range defaultRates {
+		rates[code] = rate
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		code, value, ok := strings.Cut(pair, "=")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !ok || len(code) != 3 {
+			return nil, fmt.Errorf("invalid FX rate %q, want CODE=VALUE", pair)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid FX rate for %s: %q", code, value)
+		}
+		rates[code] = rate
+	}
+	return &Converter{rates: rates}, nil
+}
+
+// Supports reports whether the converter has a rate for currency
+func (c *Converter) Supports(currency string) bool {
+	_, ok := c.rates[strings.ToUpper(currency)]
+	return ok
+}
+
+// Convert converts amount from one currency to another
+func (c *Converter) Convert(amount float64, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, nil
+	}
+	fromRate, ok := c.rates[from]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", from)
+	}
+	toRate, ok := c.rates[to]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", to)
+	}
+	return amount * fromRate / toRate, nil
+}
@@ -0,0 +1,259 @@
+package goals
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/fx"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// Progress sources
+const (
+	SourceAccount       = "account"
+	SourceContributions = "contributions"
+)
+
+// Progress statuses
+const (
+	StatusAchieved = "achieved"
+	StatusOnTrack  = "on_track"
+	StatusBehind   = "behind"
+	StatusOverdue  = "overdue"
+)
+
+// daysPerMonth converts the days left before a deadline into months
+const daysPerMonth = 30.44
+
+// Progress is how far a goal is towards its target, in the goal's currency.
+// ExpectedSaved is where steady saving from the goal's creation would have
+// got to by now; a goal that has at least that much is on track.
+type Progress struct {
+	Source          string     `json:"source"`
+	Saved           float64    `json:"saved"`
+	Remaining       float64    `json:"remaining"`
+	PercentComplete float64    `json:"percentComplete"`
+	ExpectedSaved   float64    `json:"expectedSaved"`
+	DaysRemaining   int        `json:"daysRemaining"`
+	RequiredMonthly float64    `json:"requiredMonthly"`
+	Status          string     `json:"status"`
+	BalanceAsOf     *time.Time `json:"balanceAsOf,omitempty"`
+}
+
+// Tracker computes savings goal progress and announces milestones over
+// WhatsApp as the user reaches them. Goals watching an account are checked
+// whenever new transactions for it are ingested.
+type Tracker struct {
+	db       *gorm.DB
+	fx       *fx.Converter
+	whatsapp *whatsapp.WhatsAppProvider
+}
+
+func NewTracker(db *gorm.DB, converter *fx.Converter, whatsapp *whatsapp.WhatsAppProvider) *Tracker {
+	return &Tracker{db: db, fx: converter, whatsapp: whatsapp}
+}
+
+// TransactionsIngested re-checks the active goals watching the account. The
+// check runs in the background so it never slows ingestion.
+func (t *Tracker) TransactionsIngested(account *models.LinkedAccount, created []models.ProviderTransaction) {
+	go t.checkAccount(account.ID)
+}
+
+func (t *Tracker) checkAccount(accountID uuid.UUID) {
+	var goals []models.SavingsGoal
+	if err := t.db.Where("linked_account_id = ? AND status = ?", accountID, models.GoalStatusActive).
+		Find(&goals).Error; err != nil {
+		log.Printf("[SAVINGS-GOAL] Failed to load goals for account %s: %v", accountID, err)
+		return
+	}
+	for i := range goals {
+		if _, err := t.Track(&goals[i], time.Now(), true); err != nil {
+			log.Printf("[SAVINGS-GOAL] Goal %s: %v", goals[i].ID, err)
+		}
+	}
+}
+
+// Track computes the goal's progress and records any milestone it has newly
+// reached, marking the goal achieved at 100%. With announce set the highest
+// new milestone is sent to the user; otherwise milestones are recorded
+// silently, e.g. when a goal is created already part way there.
+func (t *Tracker) Track(goal *models.SavingsGoal, now time.Time, announce bool) (*Progress, error) {
+	progress, err := t.Progress(goal, now)
+	if err != nil {
+		return nil, err
+	}
+	if goal.Status != models.GoalStatusActive {
+		return progress, nil
+	}
+
+	reached := 0
+	for _, milestone := range models.GoalMilestones {
+		if progress.PercentComplete >= float64(milestone) {
+			reached = milestone
+		}
+	}
+	if reached <= goal.LastMilestone {
+		return progress, nil
+	}
+
+	updates := map[string]interface{}{"last_milestone": reached}
+	if reached == 100 {
+		updates["status"] = models.GoalStatusAchieved
+		updates["achieved_at"] = now
+	}
+	// The conditional update claims the milestone, so concurrent checks
+	// announce it once
+	result := t.db.Model(&models.SavingsGoal{}).
+		Where("id = ? AND last_milestone < ?", goal.ID, reached).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return progress, nil
+	}
+	goal.LastMilestone = reached
+	if reached == 100 {
+		goal.Status = models.GoalStatusAchieved
+		goal.AchievedAt = &now
+	}
+
+	if announce {
+		t.announce(goal, progress, reached)
+	}
+	return progress, nil
+}
+
+// Progress computes how far the goal is towards its target as of now
+func (t *Tracker) Progress(goal *models.SavingsGoal, now time.Time) (*Progress, error) {
+	now = now.In(utils.LocalZone)
+	progress := &Progress{Source: SourceContributions}
+
+	if goal.LinkedAccountID != nil {
+		progress.Source = SourceAccount
+		saved, asOf, err := t.accountBalance(*goal.LinkedAccountID, goal.Currency)
+		if err != nil {
+			return nil, err
+		}
+		progress.Saved, progress.BalanceAsOf = saved, asOf
+	} else {
+		var total float64
+		if err := t.db.Model(&models.SavingsGoalContribution{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("goal_id = ?", goal.ID).
+			Scan(&total).Error; err != nil {
+			return nil, err
+		}
+		progress.Saved = total
+	}
+
+	progress.Saved = utils.RoundMoney(progress.Saved)
+	progress.Remaining = utils.RoundMoney(math.Max(goal.TargetAmount-progress.Saved, 0))
+	progress.PercentComplete = utils.RoundMoney(math.Max(progress.Saved, 0) / goal.TargetAmount * 100)
+
+	// The deadline day counts, so the goal is due at the end of it
+	deadline := time.Date(goal.Deadline.Year(), goal.Deadline.Month(), goal.Deadline.Day(), 0, 0, 0, 0, utils.LocalZone).AddDate(0, 0, 1)
+	created := goal.CreatedAt.In(utils.LocalZone)
+	if created.IsZero() || created.After(now) {
+		created = now
+	}
+
+	if total := deadline.Sub(created); total > 0 {
+		elapsed := math.Min(math.Max(now.Sub(created).Hours()/total.Hours(), 0), 1)
+		progress.ExpectedSaved = utils.RoundMoney(goal.TargetAmount * elapsed)
+	} else {
+		progress.ExpectedSaved = goal.TargetAmount
+	}
+
+	if now.Before(deadline) {
+		progress.DaysRemaining = int(math.Ceil(deadline.Sub(now).Hours() / 24))
+		// Less than a month left means the rest is needed this month
+		months := math.Max(float64(progress.DaysRemaining)/daysPerMonth, 1)
+		progress.RequiredMonthly = math.Ceil(progress.Remaining/months*100) / 100
+	} else {
+		progress.RequiredMonthly = progress.Remaining
+	}
+
+	switch {
+	case progress.Remaining == 0:
+		progress.Status = StatusAchieved
+	case !now.Before(deadline):
+		progress.Status = StatusOverdue
+	case progress.Saved >= progress.ExpectedSaved:
+		progress.Status = StatusOnTrack
+	default:
+		progress.Status = StatusBehind
+	}
+	return progress, nil
+}
+
+// CanConvert reports whether balances in one currency can count towards a
+// goal in another
+func (t *Tracker) CanConvert(from, to string) bool {
+	_, err := t.fx.Convert(1, from, to)
+	return err == nil
+}
+
+// Today returns the current date in the users' calendar, as midnight UTC
+// like the deadlines stored for goals
+func Today(now time.Time) time.Time {
+	local := now.In(utils.LocalZone)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// accountBalance returns the account's latest reported balance in currency
+// and when it was reported. Accounts that have not reported a balance yet
+// count as empty.
+func (t *Tracker) accountBalance(accountID uuid.UUID, currency string) (float64, *time.Time, error) {
+	var account models.LinkedAccount
+	// An unlinked account still reports its last balance
+	if err := t.db.Unscoped().Select("id", "currency_code").First(&account, "id = ?", accountID).Error; err != nil {
+		return 0, nil, err
+	}
+
+	var latest models.ProviderTransaction
+	err := t.db.Select("id", "transaction_date", "balance_after").
+		Where("linked_account_id = ? AND balance_after IS NOT NULL", accountID).
+		Order("transaction_date DESC").Order("id DESC").
+		Limit(1).Find(&latest).Error
+	if err != nil {
+		return 0, nil, err
+	}
+	if latest.BalanceAfter == nil {
+		return 0, nil, nil
+	}
+
+	balance, err := t.fx.Convert(*latest.BalanceAfter, account.CurrencyCode, currency)
+	if err != nil {
+		return 0, nil, err
+	}
+	asOf := latest.TransactionDate
+	return balance, &asOf, nil
+}
+
+func (t *Tracker) announce(goal *models.SavingsGoal, progress *Progress, milestone int) {
+	var user models.User
+	if err := t.db.Select("id", "phone").First(&user, "id = ?", goal.UserID).Error; err != nil {
+		log.Printf("[SAVINGS-GOAL] Failed to load user %s: %v", goal.UserID, err)
+		return
+	}
+
+	message := fmt.Sprintf("KaafiPay: You are %d%% of the way to your %s goal (%.2f of %.2f %s). Keep going!",
+		milestone, goal.Name, progress.Saved, goal.TargetAmount, goal.Currency)
+	if milestone == 100 {
+		message = fmt.Sprintf("KaafiPay: Congratulations! You have reached your %s goal of %.2f %s.",
+			goal.Name, goal.TargetAmount, goal.Currency)
+	}
+	if err := t.whatsapp.SendMessage(user.Phone, message); err != nil {
+		log.Printf("[SAVINGS-GOAL] Failed to announce %d%% milestone of goal %s: %v", milestone, goal.ID, err)
+		return
+	}
+	log.Printf("[SAVINGS-GOAL] Announced %d%% milestone of goal %s", milestone, goal.ID)
+}
@@ -0,0 +1,441 @@
+// Package holds freezes wallets and suspends users, by hand or when
+// activity looks like fraud, and lifts the holds when they expire. Every
+// change is recorded in the account status audit trail.
+package holds
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	// SystemActor is the actor recorded for automated holds and expiries
+	SystemActor = "system"
+
+	// More than velocityMaxTransfers completed transfers out of a user's
+	// wallets within velocityWindow freezes them for velocityHold
+	velocityWindow       = time.Hour
+	velocityMaxTransfers = 10
+	velocityHold         = 24 * time.Hour
+
+	workerInterval = time.Minute
+	batchSize      = 100
+)
+
+var (
+	ErrWalletNotFound   = errors.New("wallet not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrWalletClosed     = errors.New("wallet is closed")
+	ErrAlreadyFrozen    = errors.New("wallet is already frozen")
+	ErrNotFrozen        = errors.New("wallet is not frozen")
+	ErrAlreadySuspended = errors.New("user is already suspended")
+	ErrNotSuspended     = errors.New("user is not suspended")
+)
+
+// Hold is why a wallet or user is being held, by whom and until when. A
+// nil Until lasts until the hold is lifted.
+type Hold struct {
+	Actor  string
+	Reason string
+	Until  *time.Time
+}
+
+// Service freezes and unfreezes wallets and suspends and reinstates users.
+// It is also the transfers' hook that puts a fraud hold on wallets sending
+// money unusually often; the transfer that trips the hold completes, the
+// ones after it are refused by the ledger.
+type Service struct {
+	db       *gorm.DB
+	whatsapp *whatsapp.WhatsAppProvider
+}
+
+func NewService(db *gorm.DB, whatsapp *whatsapp.WhatsAppProvider) *Service {
+	return &Service{db: db, whatsapp: whatsapp}
+}
+
+// FreezeWallet stops money moving in or out of a wallet
+func (s *Service) FreezeWallet(walletID uuid.UUID, hold Hold) (*models.Wallet, error) {
+	if err := validate(hold); err != nil {
+		return nil, err
+	}
+	var wallet models.Wallet
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockWallet(tx, walletID, &wallet); err != nil {
+			return err
+		}
+		switch wallet.Status {
+		case models.WalletStatusClosed:
+			return ErrWalletClosed
+		case models.WalletStatusFrozen:
+			return ErrAlreadyFrozen
+		}
+		return freeze(tx, &wallet, hold)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[HOLDS] %s froze wallet %s: %s", hold.Actor, wallet.ID, hold.Reason)
+	s.notifyUser(wallet.UserID, fmt.Sprintf("KaafiPay: Your %s wallet has been frozen%s: %s. Contact support if you think this is a mistake.",
+		wallet.Currency, until(hold.Until), hold.Reason))
+	return &wallet, nil
+}
+
+// UnfreezeWallet lifts a wallet's freeze
+func (s *Service) UnfreezeWallet(walletID uuid.UUID, actor, reason string) (*models.Wallet, error) {
+	if err := validateActor(actor); err != nil {
+		return nil, err
+	}
+	var wallet models.Wallet
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockWallet(tx, walletID, &wallet); err != nil {
+			return err
+		}
+		if wallet.Status != models.WalletStatusFrozen {
+			return ErrNotFrozen
+		}
+		return unfreeze(tx, &wallet, actor, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[HOLDS] %s unfroze wallet %s: %s", actor, wallet.ID, reason)
+	s.notifyUser(wallet.UserID, fmt.Sprintf("KaafiPay: Your %s wallet is no longer frozen. You can send and receive money again.",
+		wallet.Currency))
+	return &wallet, nil
+}
+
+// Suspend bars a user from signing in or using the app, and from being
+// paid
+func (s *Service) Suspend(userID uuid.UUID, hold Hold) (*models.User, error) {
+	if err := validate(hold); err != nil {
+		return nil, err
+	}
+	var user models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID, &user); err != nil {
+			return err
+		}
+		if user.Suspended(time.Now()) {
+			return ErrAlreadySuspended
+		}
+		user.IsActive = false
+		user.SuspendedReason = strings.TrimSpace(hold.Reason)
+		user.SuspendedUntil = hold.Until
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"is_active":        false,
+			"suspended_reason": user.SuspendedReason,
+			"suspended_until":  user.SuspendedUntil,
+		}).Error; err != nil {
+			return err
+		}
+		return audit(tx, &models.AccountStatusChange{
+			UserID:         user.ID,
+			Action:         models.AccountUserSuspended,
+			PreviousStatus: models.UserStatusActive,
+			NewStatus:      models.UserStatusSuspended,
+			Reason:         user.SuspendedReason,
+			Actor:          hold.Actor,
+			ExpiresAt:      hold.Until,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[HOLDS] %s suspended user %s: %s", hold.Actor, user.ID, hold.Reason)
+	s.send(user.Phone, fmt.Sprintf("KaafiPay: Your account has been suspended%s: %s. Contact support if you think this is a mistake.",
+		until(hold.Until), hold.Reason))
+	return &user, nil
+}
+
+// Reinstate lifts a user's suspension
+func (s *Service) Reinstate(userID uuid.UUID, actor, reason string) (*models.User, error) {
+	if err := validateActor(actor); err != nil {
+		return nil, err
+	}
+	var user models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID, &user); err != nil {
+			return err
+		}
+		if user.IsActive {
+			return ErrNotSuspended
+		}
+		return reinstate(tx, &user, actor, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[HOLDS] %s reinstated user %s: %s", actor, user.ID, reason)
+	s.send(user.Phone, "KaafiPay: Your account is no longer suspended. Welcome back.")
+	return &user, nil
+}
+
+// History returns the user's account status changes, newest first
+func (s *Service) History(userID uuid.UUID) ([]models.AccountStatusChange, error) {
+	var changes []models.AccountStatusChange
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&changes).Error
+	return changes, err
+}
+
+// TransferCompleting freezes the sender's wallets if this transfer takes
+// them past the velocity limit. Only transfers since the user's wallets
+// were last unfrozen count, so lifting a freeze early doesn't trip it again
+// on the transfers that caused it.
+func (s *Service) TransferCompleting(tx *gorm.DB, transfer *models.Transfer) error {
+	since := time.Now().Add(-velocityWindow)
+	var unfrozen models.AccountStatusChange
+	err := tx.Where("user_id = ? AND action = ? AND created_at > ?", transfer.SenderID, models.AccountWalletUnfrozen, since).
+		Order("created_at DESC").
+		First(&unfrozen).Error
+	switch {
+	case err == nil:
+		since = unfrozen.CreatedAt
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	var recent int64
+	if err := tx.Model(&models.Transfer{}).
+		Where("sender_id = ? AND type = ? AND status = ? AND completed_at >= ?",
+			transfer.SenderID, models.TransferTypeTransfer, models.TransferStatusCompleted, since).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent <= velocityMaxTransfers {
+		return nil
+	}
+
+	var wallets []models.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ?", transfer.SenderID, models.WalletStatusActive).
+		Find(&wallets).Error; err != nil {
+		return err
+	}
+	expires := time.Now().Add(velocityHold)
+	hold := Hold{
+		Actor:  SystemActor,
+		Reason: fmt.Sprintf("%d transfers sent within %d minutes", recent, int(velocityWindow.Minutes())),
+		Until:  &expires,
+	}
+	for i := range wallets {
+		if err := freeze(tx, &wallets[i], hold); err != nil {
+			return err
+		}
+	}
+	if len(wallets) == 0 {
+		return nil
+	}
+
+	log.Printf("[HOLDS] Froze %d wallets of user %s: %s", len(wallets), transfer.SenderID, hold.Reason)
+	// Sent without waiting for the transfer to commit; a later rollback
+	// leaves the user told about a hold that did not happen, which support
+	// can explain
+	go s.notifyUser(transfer.SenderID, fmt.Sprintf("KaafiPay: We've paused your wallet%s after unusually many transfers. Contact support if you need it sooner.",
+		until(hold.Until)))
+	return nil
+}
+
+// Start lifts expired holds in the background
+func (s *Service) Start() {
+	go func() {
+		for {
+			s.liftExpired()
+			time.Sleep(workerInterval)
+		}
+	}()
+}
+
+// liftExpired unfreezes wallets and reinstates users whose holds have run
+// out
+func (s *Service) liftExpired() {
+	now := time.Now()
+	var wallets []models.Wallet
+	if err := s.db.Where("status = ? AND frozen_until <= ?", models.WalletStatusFrozen, now).
+		Limit(batchSize).Find(&wallets).Error; err != nil {
+		log.Printf("[HOLDS] Failed to load expired wallet freezes: %v", err)
+		return
+	}
+	for _, w := range wallets {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var wallet models.Wallet
+			if err := lockWallet(tx, w.ID, &wallet); err != nil {
+				return err
+			}
+			// Lifted or extended since it was loaded
+			if wallet.Status != models.WalletStatusFrozen || wallet.FrozenUntil == nil || wallet.FrozenUntil.After(now) {
+				return nil
+			}
+			return unfreeze(tx, &wallet, SystemActor, "hold expired")
+		})
+		if err != nil {
+			log.Printf("[HOLDS] Failed to lift the freeze on wallet %s: %v", w.ID, err)
+		}
+	}
+
+	var users []models.User
+	if err := s.db.Where("is_active = ? AND suspended_until <= ?", false, now).
+		Limit(batchSize).Find(&users).Error; err != nil {
+		log.Printf("[HOLDS] Failed to load expired suspensions: %v", err)
+		return
+	}
+	for _, u := range users {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var user models.User
+			if err := lockUser(tx, u.ID, &user); err != nil {
+				return err
+			}
+			if user.IsActive || user.SuspendedUntil == nil || user.SuspendedUntil.After(now) {
+				return nil
+			}
+			return reinstate(tx, &user, SystemActor, "suspension expired")
+		})
+		if err != nil {
+			log.Printf("[HOLDS] Failed to lift the suspension of user %s: %v", u.ID, err)
+		}
+	}
+}
+
+func freeze(tx *gorm.DB, wallet *models.Wallet, hold Hold) error {
+	previous := wallet.Status
+	wallet.Status = models.WalletStatusFrozen
+	wallet.FrozenReason = strings.TrimSpace(hold.Reason)
+	wallet.FrozenUntil = hold.Until
+	if err := tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Updates(map[string]interface{}{
+		"status":        wallet.Status,
+		"frozen_reason": wallet.FrozenReason,
+		"frozen_until":  wallet.FrozenUntil,
+	}).Error; err != nil {
+		return err
+	}
+	return audit(tx, &models.AccountStatusChange{
+		UserID:         wallet.UserID,
+		WalletID:       &wallet.ID,
+		Action:         models.AccountWalletFrozen,
+		PreviousStatus: previous,
+		NewStatus:      wallet.Status,
+		Reason:         wallet.FrozenReason,
+		Actor:          hold.Actor,
+		ExpiresAt:      hold.Until,
+	})
+}
+
+func unfreeze(tx *gorm.DB, wallet *models.Wallet, actor, reason string) error {
+	wallet.Status = models.WalletStatusActive
+	wallet.FrozenReason = ""
+	wallet.FrozenUntil = nil
+	if err := tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Updates(map[string]interface{}{
+		"status":        wallet.Status,
+		"frozen_reason": nil,
+		"frozen_until":  nil,
+	}).Error; err != nil {
+		return err
+	}
+	return audit(tx, &models.AccountStatusChange{
+		UserID:         wallet.UserID,
+		WalletID:       &wallet.ID,
+		Action:         models.AccountWalletUnfrozen,
+		PreviousStatus: models.WalletStatusFrozen,
+		NewStatus:      wallet.Status,
+		Reason:         strings.TrimSpace(reason),
+		Actor:          actor,
+	})
+}
+
+func reinstate(tx *gorm.DB, user *models.User, actor, reason string) error {
+	user.IsActive = true
+	user.SuspendedReason = ""
+	user.SuspendedUntil = nil
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"is_active":        true,
+		"suspended_reason": nil,
+		"suspended_until":  nil,
+	}).Error; err != nil {
+		return err
+	}
+	return audit(tx, &models.AccountStatusChange{
+		UserID:         user.ID,
+		Action:         models.AccountUserReinstated,
+		PreviousStatus: models.UserStatusSuspended,
+		NewStatus:      models.UserStatusActive,
+		Reason:         strings.TrimSpace(reason),
+		Actor:          actor,
+	})
+}
+
+func audit(tx *gorm.DB, change *models.AccountStatusChange) error {
+	change.Actor = strings.TrimSpace(change.Actor)
+	return tx.Create(change).Error
+}
+
+func lockWallet(tx *gorm.DB, walletID uuid.UUID, wallet *models.Wallet) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(wallet, "id = ?", walletID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrWalletNotFound
+	}
+	return err
+}
+
+func lockUser(tx *gorm.DB, userID uuid.UUID, user *models.User) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func validate(hold Hold) error {
+	if err := validateActor(hold.Actor); err != nil {
+		return err
+	}
+	if hold.Until != nil && !hold.Until.After(time.Now()) {
+		return models.ValidationError{Field: "until", Message: "Expiry must be in the future"}
+	}
+	return nil
+}
+
+// validateActor keeps admins from recording changes as the system, so the
+// audit trail tells automated holds apart from manual ones
+func validateActor(actor string) error {
+	if strings.EqualFold(strings.TrimSpace(actor), SystemActor) {
+		return models.ValidationError{Field: "actor", Message: fmt.Sprintf("Actor %q is reserved for automated changes", SystemActor)}
+	}
+	return nil
+}
+
+// until describes a hold's expiry for a message
+func until(expires *time.Time) string {
+	if expires == nil {
+		return ""
+	}
+	return " until " + expires.In(utils.LocalZone).Format("15:04 on 2 Jan 2006")
+}
+
+func (s *Service) notifyUser(userID uuid.UUID, message string) {
+	var user models.User
+	if err := s.db.Select("id", "phone").First(&user, "id = ?", userID).Error; err != nil {
+		log.Printf("[HOLDS] Failed to load user %s to notify: %v", userID, err)
+		return
+	}
+	s.send(user.Phone, message)
+}
+
+func (s *Service) send(phone, message string) {
+	if err := s.whatsapp.SendMessage(phone, message); err != nil {
+		log.Printf("[HOLDS] Failed to message %s: %v", phone, err)
+	}
+}
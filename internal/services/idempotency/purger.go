@@ -0,0 +1,35 @@
+package idempotency
+
+import (
+	"log"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/repository"
+)
+
+const purgeInterval = time.Hour
+
+// Purger deletes idempotency keys once their responses are no longer kept
+// for replay
+type Purger struct {
+	store repository.IdempotencyRepository
+}
+
+func NewPurger(store repository.IdempotencyRepository) *Purger {
+	return &Purger{store: store}
+}
+
+// Start runs the purger now and then every hour
+func (p *Purger) Start() {
+	go func() {
+		for {
+			removed, err := p.store.PurgeExpired()
+			if err != nil {
+				log.Printf("[IDEMPOTENCY-PURGE] %v", err)
+			} else if removed > 0 {
+				log.Printf("[IDEMPOTENCY-PURGE] Removed %d expired keys", removed)
+			}
+			time.Sleep(purgeInterval)
+		}
+	}()
+}
@@ -0,0 +1,407 @@
+// Package kyc moves users between KYC tiers as reviewers approve or reject
+// the identity documents they upload.
+package kyc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+)
+
+const (
+	maxDocumentSize = 10 << 20
+	queueLimit      = 200
+
+	expiryInterval = time.Hour
+	batchSize      = 100
+)
+
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+	ErrAlreadyPending   = errors.New("a document of this type is already awaiting review")
+	ErrAlreadyReviewed  = errors.New("document has already been reviewed")
+)
+
+var (
+	allowedContentTypes = map[string]bool{"image/jpeg": true, "image/png": true, "application/pdf": true}
+	sha256Pattern       = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// tierRequirements are the document types a tier needs approved, on top
+// of those of the tiers below it. Any identity document counts as
+// national_id.
+var tierRequirements = []struct {
+	tier      string
+	documents []string
+}{
+	{models.KYCTierIDVerified, []string{models.KYCDocumentNationalID}},
+	{models.KYCTierFull, []string{models.KYCDocumentSelfie, models.KYCDocumentProofOfAddress}},
+}
+
+// SubmitInput is the metadata of a document the user has uploaded to
+// object storage
+type SubmitInput struct {
+	DocumentType   string
+	DocumentNumber string
+	IssuingCountry string
+	ExpiresOn      *time.Time
+	StorageKey     string
+	FileName       string
+	ContentType    string
+	SizeBytes      int64
+	SHA256         string
+}
+
+// Status is a user's tier, their limits and what they need for the next
+// tier
+type Status struct {
+	Tier     string        `json:"tier"`
+	Limits   *limits.Usage `json:"limits"`
+	NextTier string        `json:"nextTier,omitempty"`
+	// MissingDocuments are the types still needed for NextTier; an
+	// identity document is listed as national_id
+	MissingDocuments []string `json:"missingDocuments,omitempty"`
+	PendingDocuments []string `json:"pendingDocuments,omitempty"`
+}
+
+// Service records KYC documents and their review. A user's tier is worked
+// out again from their approved, unexpired documents whenever one of them
+// is reviewed or expires, so rejecting a document that was approved by
+// mistake, or letting a passport run out, lowers the tier again.
+type Service struct {
+	db       *gorm.DB
+	policy   *limits.Policy
+	whatsapp *whatsapp.WhatsAppProvider
+}
+
+func NewService(db *gorm.DB, policy *limits.Policy, whatsapp *whatsapp.WhatsAppProvider) *Service {
+	return &Service{db: db, policy: policy, whatsapp: whatsapp}
+}
+
+// Submit records an uploaded document for review
+func (s *Service) Submit(userID uuid.UUID, in SubmitInput) (*models.KYCDocument, error) {
+	doc := &models.KYCDocument{
+		UserID:         userID,
+		DocumentType:   strings.TrimSpace(in.DocumentType),
+		DocumentNumber: strings.TrimSpace(in.DocumentNumber),
+		IssuingCountry: strings.ToUpper(strings.TrimSpace(in.IssuingCountry)),
+		ExpiresOn:      in.ExpiresOn,
+		StorageKey:     strings.TrimSpace(in.StorageKey),
+		FileName:       strings.TrimSpace(in.FileName),
+		ContentType:    strings.ToLower(strings.TrimSpace(in.ContentType)),
+		SizeBytes:      in.SizeBytes,
+		SHA256:         strings.ToLower(strings.TrimSpace(in.SHA256)),
+		Status:         models.KYCDocumentPending,
+	}
+	switch {
+	case !models.IsValidKYCDocumentType(doc.DocumentType):
+		return nil, models.ValidationError{Field: "documentType",
+			Message: "Document type must be national_id, passport, drivers_license, proof_of_address or selfie"}
+	case models.IsIdentityDocument(doc.DocumentType) && doc.DocumentNumber == "":
+		return nil, models.ValidationError{Field: "documentNumber", Message: "Identity documents need their number"}
+	case doc.Expired(time.Now()):
+		return nil, models.ValidationError{Field: "expiresOn", Message: "Document has expired"}
+	case !allowedContentTypes[doc.ContentType]:
+		return nil, models.ValidationError{Field: "contentType", Message: "Documents must be JPEG, PNG or PDF"}
+	case doc.SizeBytes <= 0 || doc.SizeBytes > maxDocumentSize:
+		return nil, models.ValidationError{Field: "sizeBytes", Message: "Documents must be at most 10 MB"}
+	case !sha256Pattern.MatchString(doc.SHA256):
+		return nil, models.ValidationError{Field: "sha256", Message: "Must be the file's SHA-256 in hex"}
+	}
+
+	var pending int64
+	if err := s.db.Model(&models.KYCDocument{}).
+		Where("user_id = ? AND document_type = ? AND status = ?", userID, doc.DocumentType, models.KYCDocumentPending).
+		Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrAlreadyPending
+	}
+	if err := s.db.Create(doc).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[KYC] User %s submitted %s document %s", userID, doc.DocumentType, doc.ID)
+	return doc, nil
+}
+
+// Documents returns the user's documents, newest first
+func (s *Service) Documents(userID uuid.UUID) ([]models.KYCDocument, error) {
+	var docs []models.KYCDocument
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&docs).Error
+	return docs, err
+}
+
+// Status returns the user's tier, limits and next-tier requirements
+func (s *Service) Status(userID uuid.UUID) (*Status, error) {
+	usage, err := s.policy.Usage(userID, "")
+	if errors.Is(err, limits.ErrUnsupportedCurrency) {
+		// Show the limits in the currency they are set in instead
+		usage, err = s.policy.Usage(userID, "USD")
+	}
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.Documents(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Tier: usage.Tier, Limits: usage}
+	approved := approvedTypes(docs, time.Now())
+	for _, req := range tierRequirements {
+		if models.KYCTierRank(req.tier) <= models.KYCTierRank(usage.Tier) {
+			continue
+		}
+		status.NextTier = req.tier
+		for _, docType := range req.documents {
+			if !approved[docType] {
+				status.MissingDocuments = append(status.MissingDocuments, docType)
+			}
+		}
+		break
+	}
+	for _, doc := range docs {
+		if doc.Status == models.KYCDocumentPending {
+			status.PendingDocuments = append(status.PendingDocuments, doc.DocumentType)
+		}
+	}
+	return status, nil
+}
+
+// Queue returns documents with the given review status, oldest first, for
+// reviewers to work through
+func (s *Service) Queue(status string) ([]models.KYCDocument, error) {
+	var docs []models.KYCDocument
+	err := s.db.Preload("User", reviewedUser).
+		Where("status = ?", status).
+		Order("created_at ASC").
+		Limit(queueLimit).
+		Find(&docs).Error
+	return docs, err
+}
+
+// Document returns any user's document for review
+func (s *Service) Document(documentID uuid.UUID) (*models.KYCDocument, error) {
+	var doc models.KYCDocument
+	err := s.db.Preload("User", reviewedUser).First(&doc, "id = ?", documentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Approve accepts a pending document and raises the owner's tier if it
+// completes the next tier's requirements
+func (s *Service) Approve(documentID uuid.UUID, reviewer string) (*models.KYCDocument, error) {
+	return s.review(documentID, reviewer, models.KYCDocumentApproved, "")
+}
+
+// Reject turns down a pending document, or withdraws the approval of one,
+// lowering the owner's tier if it no longer has what it needs
+func (s *Service) Reject(documentID uuid.UUID, reviewer, reason string) (*models.KYCDocument, error) {
+	return s.review(documentID, reviewer, models.KYCDocumentRejected, reason)
+}
+
+func (s *Service) review(documentID uuid.UUID, reviewer, status, reason string) (*models.KYCDocument, error) {
+	var doc models.KYCDocument
+	var user models.User
+	var previousTier string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&doc, "id = ?", documentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDocumentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if doc.Status == status || (status == models.KYCDocumentApproved && doc.Status != models.KYCDocumentPending) {
+			return ErrAlreadyReviewed
+		}
+
+		now := time.Now()
+		doc.Status = status
+		doc.ReviewedBy = strings.TrimSpace(reviewer)
+		doc.ReviewedAt = &now
+		doc.RejectionReason = strings.TrimSpace(reason)
+		if err := tx.Model(&models.KYCDocument{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+			"status":           doc.Status,
+			"reviewed_by":      doc.ReviewedBy,
+			"reviewed_at":      now,
+			"rejection_reason": doc.RejectionReason,
+		}).Error; err != nil {
+			return err
+		}
+
+		previousTier, err = retier(tx, doc.UserID, now, &user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[KYC] %s %s document %s of user %s", doc.ReviewedBy, doc.Status, doc.ID, doc.UserID)
+
+	if user.KYCTier != previousTier {
+		s.notifyTier(&user, previousTier, "")
+	} else if status == models.KYCDocumentRejected {
+		message := fmt.Sprintf("KaafiPay: We couldn't accept your %s", describeDocument(doc.DocumentType))
+		if doc.RejectionReason != "" {
+			message += ": " + doc.RejectionReason
+		}
+		s.send(user.Phone, message+". Please upload it again in the app.")
+	}
+
+	doc.User = &models.User{ID: user.ID, Name: user.Name, Phone: user.Phone, KYCTier: user.KYCTier}
+	return &doc, nil
+}
+
+// Start marks approved documents expired once their expiry date has
+// passed, in the background
+func (s *Service) Start() {
+	go func() {
+		for {
+			s.expireDocuments()
+			time.Sleep(expiryInterval)
+		}
+	}()
+}
+
+// expireDocuments marks approved documents past their expiry date expired
+// and works their owners' tiers out again
+func (s *Service) expireDocuments() {
+	now := time.Now()
+	var docs []models.KYCDocument
+	// A document is valid through its expiry date
+	if err := s.db.Where("status = ? AND expires_on <= ?", models.KYCDocumentApproved, now.AddDate(0, 0, -1)).
+		Limit(batchSize).Find(&docs).Error; err != nil {
+		log.Printf("[KYC] Failed to load expired documents: %v", err)
+		return
+	}
+	for _, d := range docs {
+		var user models.User
+		var previousTier string
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.KYCDocument{}).
+				Where("id = ? AND status = ?", d.ID, models.KYCDocumentApproved).
+				Update("status", models.KYCDocumentExpired)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			var err error
+			previousTier, err = retier(tx, d.UserID, now, &user)
+			return err
+		})
+		if err != nil {
+			log.Printf("[KYC] Failed to expire document %s: %v", d.ID, err)
+			continue
+		}
+		if previousTier != "" && user.KYCTier != previousTier {
+			s.notifyTier(&user, previousTier, fmt.Sprintf("Your %s has expired. ", describeDocument(d.DocumentType)))
+		}
+	}
+}
+
+// retier works the user's tier out again from their approved, unexpired
+// documents, loading the user into user, and returns their tier before.
+// The user is locked so concurrent reviews agree on the tier.
+func retier(tx *gorm.DB, userID uuid.UUID, now time.Time, user *models.User) (string, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, "id = ?", userID).Error; err != nil {
+		return "", err
+	}
+	var docs []models.KYCDocument
+	if err := tx.Where("user_id = ? AND status = ?", userID, models.KYCDocumentApproved).
+		Find(&docs).Error; err != nil {
+		return "", err
+	}
+	previousTier := user.KYCTier
+	user.KYCTier = tierFor(approvedTypes(docs, now))
+	if user.KYCTier == previousTier {
+		return previousTier, nil
+	}
+	return previousTier, tx.Model(&models.User{}).Where("id = ?", user.ID).Update("kyc_tier", user.KYCTier).Error
+}
+
+// notifyTier tells the user about their new tier and its limits, after
+// the reason it changed if there is one
+func (s *Service) notifyTier(user *models.User, previousTier, reason string) {
+	log.Printf("[KYC] User %s moved from %s to %s", user.ID, previousTier, user.KYCTier)
+	tierLimits := limits.LimitsFor(user.KYCTier)
+	s.send(user.Phone, fmt.Sprintf("KaafiPay: %sYour account is now %s. You can send up to %.2f USD a day and %.2f USD a month.",
+		reason, describeTier(user.KYCTier), tierLimits.Daily, tierLimits.Monthly))
+}
+
+// approvedTypes returns the types of the approved, unexpired documents,
+// counting every identity document as national_id
+func approvedTypes(docs []models.KYCDocument, now time.Time) map[string]bool {
+	approved := make(map[string]bool)
+	for _, doc := range docs {
+		if doc.Status != models.KYCDocumentApproved || doc.Expired(now) {
+			continue
+		}
+		docType := doc.DocumentType
+		if models.IsIdentityDocument(docType) {
+			docType = models.KYCDocumentNationalID
+		}
+		approved[docType] = true
+	}
+	return approved
+}
+
+// tierFor returns the highest tier whose requirements, and those of every
+// tier below it, the approved documents meet
+func tierFor(approved map[string]bool) string {
+	tier := models.KYCTierPhoneVerified
+	for _, req := range tierRequirements {
+		for _, docType := range req.documents {
+			if !approved[docType] {
+				return tier
+			}
+		}
+		tier = req.tier
+	}
+	return tier
+}
+
+func describeTier(tier string) string {
+	switch tier {
+	case models.KYCTierIDVerified:
+		return "ID verified"
+	case models.KYCTierFull:
+		return "fully verified"
+	}
+	return "phone verified"
+}
+
+func describeDocument(docType string) string {
+	switch docType {
+	case models.KYCDocumentNationalID:
+		return "national ID"
+	case models.KYCDocumentDriversLicense:
+		return "driver's license"
+	}
+	return strings.ReplaceAll(docType, "_", " ")
+}
+
+func (s *Service) send(phone, message string) {
+	if err := s.whatsapp.SendMessage(phone, message); err != nil {
+		log.Printf("[KYC] Failed to message %s: %v", phone, err)
+	}
+}
+
+func reviewedUser(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "name", "phone", "kyc_tier")
+}
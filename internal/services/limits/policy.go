@@ -0,0 +1,279 @@
+// Package limits enforces the daily and monthly amounts each KYC tier may
+// send. The policy is a transfers hook, so the check that counts runs in
+// the transaction that moves the money; handlers also check it up front so
+// the sender hears about a limit before being sent a code.
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/fx"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// Periods a limit applies to
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// limitCurrency is the currency the tier limits are set in
+const limitCurrency = "USD"
+
+// TierLimits are the most a tier may send, in US dollars
+type TierLimits struct {
+	Daily   float64 `json:"daily"`
+	Monthly float64 `json:"monthly"`
+}
+
+// tierLimits are the regulatory limits for each KYC tier
+var tierLimits = map[string]TierLimits{
+	models.KYCTierPhoneVerified: {Daily: 100, Monthly: 500},
+	models.KYCTierIDVerified:    {Daily: 1000, Monthly: 5000},
+	models.KYCTierFull:          {Daily: 10000, Monthly: 50000},
+}
+
+var (
+	// ErrLimitExceeded is wrapped by every LimitError
+	ErrLimitExceeded = errors.New("transfer limit exceeded")
+	// ErrUnsupportedCurrency is returned for a currency with no exchange
+	// rate, as its amounts cannot be counted against the limits
+	ErrUnsupportedCurrency = errors.New("transfers in this currency are not supported")
+)
+
+// LimitError reports a transfer that would take the user past one of
+// their limits, and how much they can still send in that period
+type LimitError struct {
+	Period    string    `json:"period"`
+	Tier      string    `json:"tier"`
+	Amount    float64   `json:"amount"`
+	Limit     float64   `json:"limit"`
+	Used      float64   `json:"used"`
+	Remaining float64   `json:"remaining"`
+	Currency  string    `json:"currency"`
+	ResetsAt  time.Time `json:"resetsAt"`
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("sending %.2f %s would exceed your %s limit of %.2f %s; you can send %.2f %s more until %s",
+		e.Amount, e.Currency, e.Period, e.Limit, e.Currency, e.Remaining, e.Currency,
+		e.ResetsAt.In(utils.LocalZone).Format("15:04 on 2 Jan 2006"))
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Usage is what a user has sent against their limits, in one currency
+type Usage struct {
+	Tier             string    `json:"tier"`
+	Currency         string    `json:"currency"`
+	DailyLimit       float64   `json:"dailyLimit"`
+	DailyUsed        float64   `json:"dailyUsed"`
+	DailyRemaining   float64   `json:"dailyRemaining"`
+	DailyResetsAt    time.Time `json:"dailyResetsAt"`
+	MonthlyLimit     float64   `json:"monthlyLimit"`
+	MonthlyUsed      float64   `json:"monthlyUsed"`
+	MonthlyRemaining float64   `json:"monthlyRemaining"`
+	MonthlyResetsAt  time.Time `json:"monthlyResetsAt"`
+}
+
+// Policy checks transfers against the sender's tier limits. What a user
+// has sent is the sum of their completed outgoing transfers in the current
+// calendar day and month, East Africa Time, converted to the currency of
+// the check.
+type Policy struct {
+	db        *gorm.DB
+	converter *fx.Converter
+}
+
+func NewPolicy(db *gorm.DB, converter *fx.Converter) *Policy {
+	return &Policy{db: db, converter: converter}
+}
+
+// LimitsFor returns a tier's limits in US dollars
+func LimitsFor(tier string) TierLimits {
+	if limits, ok := tierLimits[tier]; ok {
+		return limits
+	}
+	return tierLimits[models.KYCTierPhoneVerified]
+}
+
+// Check returns a *LimitError if sending amount would take the user past
+// their daily or monthly limit. An empty currency is the user's preferred
+// currency.
+func (p *Policy) Check(userID uuid.UUID, amount float64, currency string) error {
+	return p.check(p.db, userID, amount, currency, uuid.Nil)
+}
+
+// TransferCompleting checks the transfer against the sender's limits. The
+// sender's row is locked first, so concurrent transfers from the same
+// sender are checked one after another and each sees the others once they
+// commit.
+func (p *Policy) TransferCompleting(tx *gorm.DB, transfer *models.Transfer) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		First(&models.User{}, "id = ?", transfer.SenderID).Error; err != nil {
+		return err
+	}
+	err := p.check(tx, transfer.SenderID, transfer.Amount, transfer.Currency, transfer.ID)
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) || errors.Is(err, ErrUnsupportedCurrency) {
+		return fmt.Errorf("%w: %w", transfers.ErrRejected, err)
+	}
+	return err
+}
+
+// check is Check against db, leaving the exclude transfer out of what the
+// user has sent
+func (p *Policy) check(db *gorm.DB, userID uuid.UUID, amount float64, currency string, exclude uuid.UUID) error {
+	usage, err := p.usage(db, userID, currency, exclude)
+	if err != nil {
+		return err
+	}
+
+	return exceeds(usage, amount)
+}
+
+// exceeds returns a *LimitError if sending amount would take usage past
+// its daily or monthly limit
+func exceeds(usage *Usage, amount float64) error {
+	amount = utils.RoundMoney(amount)
+	if amount > usage.DailyRemaining+1e-9 {
+		return &LimitError{
+			Period:    PeriodDaily,
+			Tier:      usage.Tier,
+			Amount:    amount,
+			Limit:     usage.DailyLimit,
+			Used:      usage.DailyUsed,
+			Remaining: usage.DailyRemaining,
+			Currency:  usage.Currency,
+			ResetsAt:  usage.DailyResetsAt,
+		}
+	}
+	if amount > usage.MonthlyRemaining+1e-9 {
+		return &LimitError{
+			Period:    PeriodMonthly,
+			Tier:      usage.Tier,
+			Amount:    amount,
+			Limit:     usage.MonthlyLimit,
+			Used:      usage.MonthlyUsed,
+			Remaining: usage.MonthlyRemaining,
+			Currency:  usage.Currency,
+			ResetsAt:  usage.MonthlyResetsAt,
+		}
+	}
+	return nil
+}
+
+// Usage returns the user's limits and what they have sent against them,
+// in currency or, if empty, the user's preferred currency. A currency with
+// no exchange rate fails with ErrUnsupportedCurrency.
+func (p *Policy) Usage(userID uuid.UUID, currency string) (*Usage, error) {
+	return p.usage(p.db, userID, currency, uuid.Nil)
+}
+
+func (p *Policy) usage(db *gorm.DB, userID uuid.UUID, currency string, exclude uuid.UUID) (*Usage, error) {
+	var user models.User
+	if err := db.Select("id", "kyc_tier", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = strings.ToUpper(user.PreferredCurrency)
+	}
+	if currency == "" {
+		currency = limitCurrency
+	}
+	if !p.converter.Supports(currency) {
+		return nil, fmt.Errorf("%w: no exchange rate for %s", ErrUnsupportedCurrency, currency)
+	}
+
+	dayStart, monthStart := periodStarts(time.Now())
+	var rows []sent
+	if err := sentQuery(db, userID, dayStart, monthStart, exclude).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return p.tally(user.KYCTier, currency, dayStart, monthStart, rows)
+}
+
+// sent is what a user sent in one currency in the current day and month
+type sent struct {
+	Currency string
+	Daily    float64
+	Monthly  float64
+}
+
+// periodStarts returns the start of the local day and month now is in
+func periodStarts(now time.Time) (time.Time, time.Time) {
+	now = now.In(utils.LocalZone)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, utils.LocalZone),
+		time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, utils.LocalZone)
+}
+
+// sentQuery totals the user's completed transfers since monthStart, and
+// since dayStart, by currency, leaving out the exclude transfer
+func sentQuery(db *gorm.DB, userID uuid.UUID, dayStart, monthStart time.Time, exclude uuid.UUID) *gorm.DB {
+	query := db.Model(&models.Transfer{}).
+		Select("currency, COALESCE(SUM(CASE WHEN completed_at >= ? THEN amount END), 0) AS daily, SUM(amount) AS monthly", dayStart).
+		Where("sender_id = ? AND type = ? AND status = ? AND completed_at >= ?",
+			userID, models.TransferTypeTransfer, models.TransferStatusCompleted, monthStart)
+	if exclude != uuid.Nil {
+		query = query.Where("id <> ?", exclude)
+	}
+	return query.Group("currency")
+}
+
+// tally converts the tier's limits and what was sent into currency and
+// works out the headroom left in each period
+func (p *Policy) tally(tier, currency string, dayStart, monthStart time.Time, rows []sent) (*Usage, error) {
+	limits := LimitsFor(tier)
+	usage := &Usage{
+		Tier:            tier,
+		Currency:        currency,
+		DailyResetsAt:   dayStart.AddDate(0, 0, 1),
+		MonthlyResetsAt: monthStart.AddDate(0, 1, 0),
+	}
+	var err error
+	if usage.DailyLimit, err = p.convert(limits.Daily, limitCurrency, currency); err != nil {
+		return nil, err
+	}
+	if usage.MonthlyLimit, err = p.convert(limits.Monthly, limitCurrency, currency); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		daily, err := p.convert(row.Daily, row.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		monthly, err := p.convert(row.Monthly, row.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		usage.DailyUsed += daily
+		usage.MonthlyUsed += monthly
+	}
+	usage.DailyUsed = utils.RoundMoney(usage.DailyUsed)
+	usage.MonthlyUsed = utils.RoundMoney(usage.MonthlyUsed)
+	usage.DailyRemaining = math.Max(0, utils.RoundMoney(usage.DailyLimit-usage.DailyUsed))
+	usage.MonthlyRemaining = math.Max(0, utils.RoundMoney(usage.MonthlyLimit-usage.MonthlyUsed))
+	return usage, nil
+}
+
+// convert converts amount, rounded to the cent
+func (p *Policy) convert(amount float64, from, to string) (float64, error) {
+	converted, err := p.converter.Convert(amount, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupportedCurrency, err)
+	}
+	return utils.RoundMoney(converted), nil
+}
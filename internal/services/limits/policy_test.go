@@ -0,0 +1,267 @@
+package limits
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/fx"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	converter, err := fx.NewConverter("KES=0.01,EUR=1.25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Policy{converter: converter}
+}
+
+func TestPeriodStarts(t *testing.T) {
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantDay   string
+		wantMonth string
+	}{
+		{
+			name:      "late evening UTC is the next local day and month",
+			now:       time.Date(2024, time.May, 31, 21, 30, 0, 0, time.UTC),
+			wantDay:   "2024-06-01T00:00:00+03:00",
+			wantMonth: "2024-06-01T00:00:00+03:00",
+		},
+		{
+			name:      "last local minute of the month",
+			now:       time.Date(2024, time.May, 31, 20, 59, 0, 0, time.UTC),
+			wantDay:   "2024-05-31T00:00:00+03:00",
+			wantMonth: "2024-05-01T00:00:00+03:00",
+		},
+		{
+			name:      "local midnight itself",
+			now:       time.Date(2024, time.May, 14, 21, 0, 0, 0, time.UTC),
+			wantDay:   "2024-05-15T00:00:00+03:00",
+			wantMonth: "2024-05-01T00:00:00+03:00",
+		},
+		{
+			name:      "new year locally",
+			now:       time.Date(2024, time.December, 31, 22, 0, 0, 0, time.UTC),
+			wantDay:   "2025-01-01T00:00:00+03:00",
+			wantMonth: "2025-01-01T00:00:00+03:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day, month := periodStarts(tt.now)
+			if got := day.Format(time.RFC3339); got != tt.wantDay {
+				t.Errorf("day start = %s, want %s", got, tt.wantDay)
+			}
+			if got := month.Format(time.RFC3339); got != tt.wantMonth {
+				t.Errorf("month start = %s, want %s", got, tt.wantMonth)
+			}
+		})
+	}
+}
+
+func TestTally(t *testing.T) {
+	tests := []struct {
+		name          string
+		tier          string
+		currency      string
+		rows          []sent
+		wantLimits    [2]float64 // daily, monthly
+		wantUsed      [2]float64
+		wantRemaining [2]float64
+		wantErr       error
+	}{
+		{
+			name:          "nothing sent",
+			tier:          models.KYCTierPhoneVerified,
+			currency:      "USD",
+			wantLimits:    [2]float64{100, 500},
+			wantRemaining: [2]float64{100, 500},
+		},
+		{
+			name:          "headroom left in both periods",
+			tier:          models.KYCTierIDVerified,
+			currency:      "USD",
+			rows:          []sent{{Currency: "USD", Daily: 250, Monthly: 1200}},
+			wantLimits:    [2]float64{1000, 5000},
+			wantUsed:      [2]float64{250, 1200},
+			wantRemaining: [2]float64{750, 3800},
+		},
+		{
+			name:     "sent in several currencies",
+			tier:     models.KYCTierPhoneVerified,
+			currency: "USD",
+			rows: []sent{
+				{Currency: "KES", Daily: 5000, Monthly: 20000},
+				{Currency: "USD", Daily: 10, Monthly: 10.5},
+			},
+			wantLimits:    [2]float64{100, 500},
+			wantUsed:      [2]float64{60, 210.5},
+			wantRemaining: [2]float64{40, 289.5},
+		},
+		{
+			name:          "limits in another currency",
+			tier:          models.KYCTierPhoneVerified,
+			currency:      "KES",
+			rows:          []sent{{Currency: "USD", Daily: 30, Monthly: 30}},
+			wantLimits:    [2]float64{10000, 50000},
+			wantUsed:      [2]float64{3000, 3000},
+			wantRemaining: [2]float64{7000, 47000},
+		},
+		{
+			name:          "over the limit leaves no headroom",
+			tier:          models.KYCTierPhoneVerified,
+			currency:      "USD",
+			rows:          []sent{{Currency: "EUR", Daily: 100, Monthly: 100}},
+			wantLimits:    [2]float64{100, 500},
+			wantUsed:      [2]float64{125, 125},
+			wantRemaining: [2]float64{0, 375},
+		},
+		{
+			name:          "unknown tier has the lowest limits",
+			tier:          "",
+			currency:      "USD",
+			wantLimits:    [2]float64{100, 500},
+			wantRemaining: [2]float64{100, 500},
+		},
+		{
+			name:     "sent in a currency with no rate",
+			tier:     models.KYCTierFull,
+			currency: "USD",
+			rows:     []sent{{Currency: "XYZ", Daily: 1, Monthly: 1}},
+			wantErr:  ErrUnsupportedCurrency,
+		},
+	}
+
+	dayStart := time.Date(2024, time.May, 31, 0, 0, 0, 0, utils.LocalZone)
+	monthStart := time.Date(2024, time.May, 1, 0, 0, 0, 0, utils.LocalZone)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := testPolicy(t).tally(tt.tier, tt.currency, dayStart, monthStart, tt.rows)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tally: %v", err)
+			}
+			got := [3][2]float64{
+				{usage.DailyLimit, usage.MonthlyLimit},
+				{usage.DailyUsed, usage.MonthlyUsed},
+				{usage.DailyRemaining, usage.MonthlyRemaining},
+			}
+			want := [3][2]float64{tt.wantLimits, tt.wantUsed, tt.wantRemaining}
+			if got != want {
+				t.Errorf("limits, used, remaining = %v, want %v", got, want)
+			}
+			if !usage.DailyResetsAt.Equal(time.Date(2024, time.June, 1, 0, 0, 0, 0, utils.LocalZone)) {
+				t.Errorf("daily resets at %s", usage.DailyResetsAt)
+			}
+			if !usage.MonthlyResetsAt.Equal(time.Date(2024, time.June, 1, 0, 0, 0, 0, utils.LocalZone)) {
+				t.Errorf("monthly resets at %s", usage.MonthlyResetsAt)
+			}
+		})
+	}
+}
+
+func TestExceeds(t *testing.T) {
+	usage := &Usage{
+		Tier:             models.KYCTierPhoneVerified,
+		Currency:         "USD",
+		DailyLimit:       100,
+		DailyUsed:        60,
+		DailyRemaining:   40,
+		MonthlyLimit:     500,
+		MonthlyUsed:      470,
+		MonthlyRemaining: 30,
+	}
+	tests := []struct {
+		name       string
+		usage      *Usage
+		amount     float64
+		wantPeriod string // empty when the amount fits
+	}{
+		{name: "well within", usage: usage, amount: 10},
+		{name: "exactly the monthly headroom", usage: usage, amount: 30},
+		{name: "sub-cent over rounds away", usage: usage, amount: 30.004},
+		{name: "a cent over the month", usage: usage, amount: 30.01, wantPeriod: PeriodMonthly},
+		{name: "over both reports the day", usage: usage, amount: 45, wantPeriod: PeriodDaily},
+		{
+			name:       "no headroom left",
+			usage:      &Usage{DailyLimit: 100, DailyUsed: 100, MonthlyLimit: 500, MonthlyUsed: 100, MonthlyRemaining: 400},
+			amount:     0.01,
+			wantPeriod: PeriodDaily,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exceeds(tt.usage, tt.amount)
+			if tt.wantPeriod == "" {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+				return
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("got %v, want a LimitError", err)
+			}
+			if limitErr.Period != tt.wantPeriod {
+				t.Errorf("period = %s, want %s", limitErr.Period, tt.wantPeriod)
+			}
+		})
+	}
+}
+
+func TestSentQueryExclude(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, transferID := uuid.New(), uuid.New()
+	dayStart, monthStart := periodStarts(time.Now())
+
+	for _, tt := range []struct {
+		name        string
+		exclude     uuid.UUID
+		wantExclude bool
+	}{
+		{name: "nothing excluded", exclude: uuid.Nil},
+		{name: "transfer excluded", exclude: transferID, wantExclude: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []sent
+			stmt := sentQuery(db, userID, dayStart, monthStart, tt.exclude).Scan(&rows).Statement
+			sql := stmt.SQL.String()
+			if got := strings.Contains(sql, "id <> "); got != tt.wantExclude {
+				t.Errorf("excludes a transfer = %v, want %v in %s", got, tt.wantExclude, sql)
+			}
+			var excluded bool
+			for _, v := range stmt.Vars {
+				if v == transferID {
+					excluded = true
+				}
+			}
+			if excluded != tt.wantExclude {
+				t.Errorf("transfer ID bound = %v, want %v", excluded, tt.wantExclude)
+			}
+			if !strings.Contains(sql, "GROUP BY") {
+				t.Errorf("totals are not grouped by currency: %s", sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package payrequests
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	DefaultExpiry = 7 * 24 * time.Hour
+	MaxExpiry     = 30 * 24 * time.Hour
+
+	// referencePrefix marks the transfers that pay a request
+	referencePrefix = "payment_request:"
+
+	// Automatic reminders go to the payer once a day, at most three times
+	reminderInterval = 24 * time.Hour
+	maxReminders     = 3
+	// manualReminderGap stops the requester nagging more than twice a day
+	manualReminderGap = 12 * time.Hour
+
+	workerInterval = time.Hour
+
+	defaultLinkBaseURL = "https://pay.kaafipay.com"
+)
+
+var (
+	ErrRequestNotFound = errors.New("payment request not found")
+	ErrNotPending      = errors.New("payment request is no longer pending")
+	ErrExpired         = errors.New("payment request has expired")
+	ErrOwnRequest      = errors.New("cannot pay your own payment request")
+	ErrNotAddressed    = errors.New("only the person asked to pay can decline this request")
+	ErrAlreadyClaimed  = errors.New("a payment for this request is already awaiting confirmation")
+	ErrRemindTooSoon   = errors.New("a reminder was sent recently")
+	ErrInvalidAccount  = errors.New("linked account cannot pay this request")
+)
+
+// CreateInput describes a new payment request
+type CreateInput struct {
+	Amount     float64
+	Currency   string // defaults to the requester's preferred currency
+	Note       string
+	PayerPhone string        // optional; open to anyone with the link when empty
+	ExpiresIn  time.Duration // defaults to DefaultExpiry
+}
+
+// PayInput says how the payer is paying
+type PayInput struct {
+	Method          string // models.PaidViaWallet or models.PaidViaLinkedAccount
+	LinkedAccountID uuid.UUID
+	Reference       string // the provider's transaction reference for a linked account payment
+}
+
+// Service creates payment requests, lets payers pay or decline them, and
+// chases and expires them in the background. Wallet payments go through a
+// transfer; the service is the transfers' hook that marks the request paid
+// in the same transaction that moves the money.
+type Service struct {
+	db          *gorm.DB
+	transfers   *transfers.Service
+	whatsapp    *whatsapp.WhatsAppProvider
+	linkBaseURL string
+}
+
+func NewService(db *gorm.DB, transferService *transfers.Service, whatsapp *whatsapp.WhatsAppProvider, linkBaseURL string) *Service {
+	if linkBaseURL == "" {
+		linkBaseURL = defaultLinkBaseURL
+	}
+	return &Service{
+		db:          db,
+		transfers:   transferService,
+		whatsapp:    whatsapp,
+		linkBaseURL: strings.TrimRight(linkBaseURL, "/"),
+	}
+}
+
+// Create stores a new request and, when it is addressed to a phone number,
+// sends the link there
+func (s *Service) Create(requesterID uuid.UUID, in CreateInput) (*models.PaymentRequest, error) {
+	amount := utils.RoundMoney(in.Amount)
+	if amount <= 0 || math.Abs(in.Amount-amount) > 1e-9 {
+		return nil, models.ValidationError{Field: "amount", Message: "must be a positive number of whole cents"}
+	}
+	expiresIn := in.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = DefaultExpiry
+	}
+	if expiresIn < time.Hour || expiresIn > MaxExpiry {
+		return nil, models.ValidationError{Field: "expiresAt", Message: "must be between an hour and 30 days away"}
+	}
+
+	var requester models.User
+	if err := s.db.First(&requester, "id = ?", requesterID).Error; err != nil {
+		return nil, err
+	}
+	currency := strings.ToUpper(strings.TrimSpace(in.Currency))
+	if currency == "" {
+		currency = strings.ToUpper(requester.PreferredCurrency)
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	request := models.PaymentRequest{
+		RequesterID: requesterID,
+		Amount:      amount,
+		Currency:    currency,
+		Note:        strings.TrimSpace(in.Note),
+		Token:       token,
+		Status:      models.PaymentRequestPending,
+		ExpiresAt:   time.Now().Add(expiresIn),
+	}
+
+	var payer *models.User
+	if phone := strings.TrimSpace(in.PayerPhone); phone != "" {
+		if phone == requester.Phone {
+			return nil, models.ValidationError{Field: "payerPhone", Message: "cannot request money from yourself"}
+		}
+		request.PayerPhone = &phone
+		var user models.User
+		err := s.db.Select("id", "name", "phone").Scopes(models.UnsuspendedUsers(time.Now())).
+			Where("phone = ?", phone).First(&user).Error
+		if err == nil {
+			request.PayerID = &user.ID
+			payer = &user
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Create(&request).Error; err != nil {
+		return nil, err
+	}
+	s.decorate(&request)
+	log.Printf("[PAYMENT-REQUEST] User %s requested %.2f %s (request %s)", requesterID, amount, currency, request.ID)
+
+	if request.PayerPhone != nil {
+		greeting := "Hi"
+		if payer != nil {
+			greeting = "Hi " + payer.Name
+		}
+		message := fmt.Sprintf("KaafiPay: %s, %s is asking you for %.2f %s%s. Pay or decline here: %s",
+			greeting, requester.Name, amount, currency, noteSuffix(request.Note), request.Link)
+		go s.send(*request.PayerPhone, message)
+	}
+	return &request, nil
+}
+
+// List returns the requests the user sent, or with received set, the ones
+// addressed to them, newest first
+func (s *Service) List(userID uuid.UUID, received bool, status string) ([]models.PaymentRequest, error) {
+	requests := []models.PaymentRequest{}
+	query := s.db.Preload("Requester", models.PublicUser)
+	if received {
+		query = query.Where("payer_id = ? OR payer_phone = (?)", userID,
+			s.db.Model(&models.User{}).Select("phone").Where("id = ?", userID))
+	} else {
+		query = query.Where("requester_id = ?", userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at DESC").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	for i := range requests {
+		s.decorate(&requests[i])
+	}
+	return requests, nil
+}
+
+// Get returns a request the user made or that is addressed to them
+func (s *Service) Get(userID, requestID uuid.UUID) (*models.PaymentRequest, error) {
+	var request models.PaymentRequest
+	err := s.db.Preload("Requester", models.PublicUser).
+		Where("id = ?", requestID).
+		Where("requester_id = ? OR payer_id = ? OR payer_phone = (?)", userID, userID,
+			s.db.Model(&models.User{}).Select("phone").Where("id = ?", userID)).
+		First(&request).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.decorate(&request)
+	return &request, nil
+}
+
+// Open returns the request behind a link for the user who opened it.
+// Requests addressed to someone else are hidden.
+func (s *Service) Open(userID uuid.UUID, token string) (*models.PaymentRequest, error) {
+	var request models.PaymentRequest
+	err := s.db.Preload("Requester", models.PublicUser).Where("token = ?", token).First(&request).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if request.RequesterID != userID && request.PayerPhone != nil {
+		addressed, err := s.addressedTo(&request, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !addressed {
+			return nil, ErrRequestNotFound
+		}
+	}
+	s.decorate(&request)
+	return &request, nil
+}
+
+// Pay starts paying the request behind a link. A wallet payment returns the
+// pending transfer for the payer to confirm with their code; the request is
+// paid when it completes. A linked account payment records the payer's
+// claim for the requester to confirm with MarkPaid.
+func (s *Service) Pay(payerID uuid.UUID, token string, in PayInput) (*models.PaymentRequest, *models.Transfer, error) {
+	request, err := s.Open(payerID, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request.RequesterID == payerID {
+		return nil, nil, ErrOwnRequest
+	}
+	if err := s.checkPayable(request); err != nil {
+		return nil, nil, err
+	}
+	if request.ClaimedAt != nil {
+		return nil, nil, ErrAlreadyClaimed
+	}
+
+	switch in.Method {
+	case models.PaidViaWallet:
+		description := "Payment request"
+		if request.Note != "" {
+			description += ": " + request.Note
+		}
+		transfer, err := s.transfers.Initiate(transfers.Request{
+			SenderID:    payerID,
+			RecipientID: request.RequesterID,
+			Amount:      request.Amount,
+			Currency:    request.Currency,
+			Description: description,
+			ReferenceID: referencePrefix + request.ID.String(),
+		})
+		return request, transfer, err
+
+	case models.PaidViaLinkedAccount:
+		var account models.LinkedAccount
+		err := s.db.Where("id = ? AND user_id = ? AND is_active = ?", in.LinkedAccountID, payerID, true).
+			First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAccount
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !account.Provider.RequiresCredentials() || !strings.EqualFold(account.CurrencyCode, request.Currency) {
+			return nil, nil, ErrInvalidAccount
+		}
+
+		now := time.Now()
+		via := models.PaidViaLinkedAccount
+		result := s.db.Model(&models.PaymentRequest{}).
+			Where("id = ? AND status = ? AND claimed_at IS NULL", request.ID, models.PaymentRequestPending).
+			Updates(map[string]interface{}{
+				"payer_id":           payerID,
+				"paid_via":           via,
+				"linked_account_id":  account.ID,
+				"external_reference": strings.TrimSpace(in.Reference),
+				"claimed_at":         now,
+			})
+		if result.Error != nil {
+			return nil, nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, nil, ErrAlreadyClaimed
+		}
+		request.PayerID = &payerID
+		request.PaidVia = &via
+		request.LinkedAccountID = &account.ID
+		request.ExternalReference = strings.TrimSpace(in.Reference)
+		request.ClaimedAt = &now
+
+		var payer models.User
+		if err := s.db.Select("id", "name", "phone").First(&payer, "id = ?", payerID).Error; err == nil {
+			reference := ""
+			if request.ExternalReference != "" {
+				reference = " (reference " + request.ExternalReference + ")"
+			}
+			message := fmt.Sprintf("KaafiPay: %s says they paid your request for %.2f %s from their %s account%s. Confirm it in the app once you have received it.",
+				payer.Name, request.Amount, request.Currency, account.Provider, reference)
+			go s.send(request.Requester.Phone, message)
+		}
+		log.Printf("[PAYMENT-REQUEST] User %s claimed payment of request %s from account %s", payerID, request.ID, account.ID)
+		return request, nil, nil
+	}
+	return nil, nil, models.ValidationError{Field: "method", Message: "must be wallet or linked_account"}
+}
+
+// Decline turns down a request addressed to the user
+func (s *Service) Decline(payerID uuid.UUID, token string) (*models.PaymentRequest, error) {
+	request, err := s.Open(payerID, token)
+	if err != nil {
+		return nil, err
+	}
+	if request.PayerPhone == nil || request.RequesterID == payerID {
+		return nil, ErrNotAddressed
+	}
+	if err := s.checkPayable(request); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !s.transition(request, models.PaymentRequestDeclined, map[string]interface{}{"declined_at": now, "payer_id": payerID}) {
+		return nil, ErrNotPending
+	}
+	request.DeclinedAt = &now
+	request.PayerID = &payerID
+
+	var payer models.User
+	if err := s.db.Select("id", "name").First(&payer, "id = ?", payerID).Error; err == nil {
+		go s.send(request.Requester.Phone, fmt.Sprintf("KaafiPay: %s declined your request for %.2f %s%s.",
+			payer.Name, request.Amount, request.Currency, noteSuffix(request.Note)))
+	}
+	return request, nil
+}
+
+// Cancel withdraws one of the user's pending requests
+func (s *Service) Cancel(requesterID, requestID uuid.UUID) (*models.PaymentRequest, error) {
+	request, err := s.own(requesterID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.transition(request, models.PaymentRequestCancelled, nil) {
+		return nil, ErrNotPending
+	}
+	return request, nil
+}
+
+// MarkPaid records that the requester received the money outside KaafiPay,
+// confirming the payer's claim if there is one
+func (s *Service) MarkPaid(requesterID, requestID uuid.UUID) (*models.PaymentRequest, error) {
+	request, err := s.own(requesterID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	via := models.PaidViaManual
+	if request.PaidVia != nil {
+		via = *request.PaidVia
+	}
+	if !s.transition(request, models.PaymentRequestPaid, map[string]interface{}{"paid_via": via, "paid_at": now}) {
+		return nil, ErrNotPending
+	}
+	request.PaidVia = &via
+	request.PaidAt = &now
+
+	if request.PayerID != nil {
+		var payer models.User
+		if err := s.db.Select("id", "phone").First(&payer, "id = ?", *request.PayerID).Error; err == nil {
+			go s.send(payer.Phone, fmt.Sprintf("KaafiPay: %s confirmed your payment of %.2f %s%s. Thank you!",
+				request.Requester.Name, request.Amount, request.Currency, noteSuffix(request.Note)))
+		}
+	}
+	return request, nil
+}
+
+// Remind sends the payer a reminder now
+func (s *Service) Remind(requesterID, requestID uuid.UUID) (*models.PaymentRequest, error) {
+	request, err := s.own(requesterID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.PayerPhone == nil {
+		return nil, ErrNotAddressed
+	}
+	if err := s.checkPayable(request); err != nil {
+		return nil, err
+	}
+	if request.ClaimedAt != nil {
+		return nil, ErrAlreadyClaimed
+	}
+	if request.LastRemindedAt != nil && time.Since(*request.LastRemindedAt) < manualReminderGap {
+		return nil, ErrRemindTooSoon
+	}
+	if err := s.remind(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// TransferCompleting marks the request a transfer pays as paid. It rejects
+// the transfer if the request was paid, cancelled, expired or claimed as
+// paid from a linked account since the transfer started.
+func (s *Service) TransferCompleting(tx *gorm.DB, transfer *models.Transfer) error {
+	if transfer.ReferenceID == nil || !strings.HasPrefix(*transfer.ReferenceID, referencePrefix) {
+		return nil
+	}
+	requestID, err := uuid.Parse(strings.TrimPrefix(*transfer.ReferenceID, referencePrefix))
+	if err != nil {
+		return nil
+	}
+
+	result := tx.Model(&models.PaymentRequest{}).
+		Where("id = ? AND status = ? AND expires_at > ? AND claimed_at IS NULL", requestID, models.PaymentRequestPending, time.Now()).
+		Where("requester_id = ? AND amount = ? AND currency = ?", transfer.ReceiverID, transfer.Amount, transfer.Currency).
+		Updates(map[string]interface{}{
+			"status":      models.PaymentRequestPaid,
+			"paid_via":    models.PaidViaWallet,
+			"payer_id":    transfer.SenderID,
+			"transfer_id": transfer.ID,
+			"paid_at":     time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: the payment request is no longer open", transfers.ErrRejected)
+	}
+	log.Printf("[PAYMENT-REQUEST] Request %s paid by transfer %s", requestID, transfer.ID)
+	return nil
+}
+
+// Start expires overdue requests and sends due reminders now and then every
+// hour
+func (s *Service) Start() {
+	go func() {
+		for {
+			s.expireOverdue()
+			s.sendDueReminders()
+			time.Sleep(workerInterval)
+		}
+	}()
+}
+
+func (s *Service) expireOverdue() {
+	var overdue []models.PaymentRequest
+	if err := s.db.Preload("Requester", models.PublicUser).
+		Where("status = ? AND expires_at <= ?", models.PaymentRequestPending, time.Now()).
+		Find(&overdue).Error; err != nil {
+		log.Printf("[PAYMENT-REQUEST] Failed to load overdue requests: %v", err)
+		return
+	}
+	for i := range overdue {
+		request := &overdue[i]
+		if !s.transition(request, models.PaymentRequestExpired, nil) {
+			continue
+		}
+		if request.Requester != nil {
+			s.send(request.Requester.Phone, fmt.Sprintf("KaafiPay: Your request for %.2f %s%s expired without being paid.",
+				request.Amount, request.Currency, noteSuffix(request.Note)))
+		}
+	}
+}
+
+func (s *Service) sendDueReminders() {
+	cutoff := time.Now().Add(-reminderInterval)
+	var due []models.PaymentRequest
+	if err := s.db.Preload("Requester", models.PublicUser).
+		Where("status = ? AND expires_at > ? AND payer_phone IS NOT NULL AND claimed_at IS NULL", models.PaymentRequestPending, time.Now()).
+		Where("reminders_sent < ? AND COALESCE(last_reminded_at, created_at) <= ?", maxReminders, cutoff).
+		Find(&due).Error; err != nil {
+		log.Printf("[PAYMENT-REQUEST] Failed to load requests due a reminder: %v", err)
+		return
+	}
+	for i := range due {
+		if err := s.remind(&due[i]); err != nil {
+			log.Printf("[PAYMENT-REQUEST] Reminder for request %s failed: %v", due[i].ID, err)
+		}
+	}
+}
+
+// remind sends the payer a reminder and counts it
+func (s *Service) remind(request *models.PaymentRequest) error {
+	s.decorate(request)
+	name := "Someone"
+	if request.Requester != nil {
+		name = request.Requester.Name
+	}
+	message := fmt.Sprintf("KaafiPay: Reminder: %s is still waiting for %.2f %s%s. The request expires on %s. Pay or decline here: %s",
+		name, request.Amount, request.Currency, noteSuffix(request.Note),
+		request.ExpiresAt.In(utils.LocalZone).Format("2 Jan 2006"), request.Link)
+	if err := s.whatsapp.SendMessage(*request.PayerPhone, message); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&models.PaymentRequest{}).Where("id = ?", request.ID).
+		Updates(map[string]interface{}{
+			"reminders_sent":   gorm.Expr("reminders_sent + 1"),
+			"last_reminded_at": now,
+		}).Error; err != nil {
+		return err
+	}
+	request.RemindersSent++
+	request.LastRemindedAt = &now
+	return nil
+}
+
+// own loads one of the requester's requests
+func (s *Service) own(requesterID, requestID uuid.UUID) (*models.PaymentRequest, error) {
+	var request models.PaymentRequest
+	err := s.db.Preload("Requester", models.PublicUser).
+		Where("id = ? AND requester_id = ?", requestID, requesterID).
+		First(&request).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.decorate(&request)
+	return &request, nil
+}
+
+// checkPayable reports why a request can no longer be acted on, if it can't
+func (s *Service) checkPayable(request *models.PaymentRequest) error {
+	if request.Expired(time.Now()) {
+		return ErrExpired
+	}
+	if request.Status != models.PaymentRequestPending {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// transition moves a pending request to status and reports whether it was
+// still pending
+func (s *Service) transition(request *models.PaymentRequest, status string, updates map[string]interface{}) bool {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = status
+	result := s.db.Model(&models.PaymentRequest{}).
+		Where("id = ? AND status = ?", request.ID, models.PaymentRequestPending).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[PAYMENT-REQUEST] Failed to mark request %s %s: %v", request.ID, status, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	request.Status = status
+	return true
+}
+
+// addressedTo reports whether the request was sent to the user
+func (s *Service) addressedTo(request *models.PaymentRequest, userID uuid.UUID) (bool, error) {
+	if request.PayerID != nil && *request.PayerID == userID {
+		return true, nil
+	}
+	var user models.User
+	if err := s.db.Select("id", "phone").First(&user, "id = ?", userID).Error; err != nil {
+		return false, err
+	}
+	return request.PayerPhone != nil && *request.PayerPhone == user.Phone, nil
+}
+
+// decorate fills in the request's link and QR payload
+func (s *Service) decorate(request *models.PaymentRequest) {
+	request.Link = s.linkBaseURL + "/r/" + request.Token
+	query := url.Values{}
+	query.Set("amount", fmt.Sprintf("%.2f", request.Amount))
+	query.Set("currency", request.Currency)
+	request.QRPayload = "kaafipay://pay-request/" + request.Token + "?" + query.Encode()
+}
+
+func (s *Service) send(phone, message string) {
+	if err := s.whatsapp.SendMessage(phone, message); err != nil {
+		log.Printf("[PAYMENT-REQUEST] Failed to message %s: %v", phone, err)
+	}
+}
+
+func noteSuffix(note string) string {
+	if note == "" {
+		return ""
+	}
+	return " for \"" + note + "\""
+}
+
+// newToken returns a random, URL-safe link token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,90 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// ErrNoDevices is returned when the user has no registered devices
+var ErrNoDevices = errors.New("user has no push devices")
+
+// ErrNotConfigured is returned when no push gateway is configured
+var ErrNotConfigured = errors.New("push gateway is not configured")
+
+// Sender delivers notifications to a user's devices through a push gateway
+// that accepts a JSON array of {to, title, body, data} messages, such as the
+// Expo push service
+type Sender struct {
+	db         *gorm.DB
+	gatewayURL string
+	token      string
+	client     *http.Client
+}
+
+func NewSender(db *gorm.DB, gatewayURL, token string) *Sender {
+	return &Sender{
+		db:         db,
+		gatewayURL: gatewayURL,
+		token:      token,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type message struct {
+	To    string            `json:"to"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Send notifies every device the user has registered
+func (s *Sender) Send(userID uuid.UUID, title, body string, data map[string]string) error {
+	if s.gatewayURL == "" {
+		return ErrNotConfigured
+	}
+
+	var devices []models.PushDevice
+	if err := s.db.Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return ErrNoDevices
+	}
+
+	messages := make([]message, 0, len(devices))
+	for _, device := range devices {
+		messages = append(messages, message{To: device.Token, Title: title, Body: body, Data: data})
+	}
+	payload, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.gatewayURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("push gateway returned status %d", resp.StatusCode)
+	}
+	return nil
+}
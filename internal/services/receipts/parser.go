@@ -0,0 +1,316 @@
+// Package receipts parses the SMS receipts that ZAAD, EVC Plus, eDahab and
+// Sahal send after every mobile-money transaction.
+package receipts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+var (
+	ErrUnknownFormat       = errors.New("receipt text does not match any known provider format")
+	ErrUnsupportedProvider = errors.New("receipts are not supported for this provider")
+	ErrNoAmount            = errors.New("receipt does not contain an amount")
+	ErrNoDirection         = errors.New("receipt does not say whether money was sent or received")
+)
+
+// Kind describes what the receipt is for
+type Kind string
+
+const (
+	KindTransfer Kind = "TRANSFER"
+	KindPayment  Kind = "PAYMENT"
+	KindAirtime  Kind = "AIRTIME"
+)
+
+// CurrencySLS is the code used for the Somaliland shilling. It has no ISO
+// code and provider_transactions.currency holds three characters.
+const CurrencySLS = "SLS"
+
+// Receipt is the structured content of a single provider SMS
+type Receipt struct {
+	Provider           models.Provider
+	Kind               Kind
+	Direction          models.TransactionType
+	Amount             float64
+	Currency           string
+	CounterpartyName   string
+	CounterpartyNumber string
+	BalanceAfter       *float64
+	Reference          string
+	Date               *time.Time
+}
+
+// DedupKey returns a stable identifier for the receipt. The provider reference
+// is used when present; otherwise the normalised text is hashed so that the
+// same SMS submitted twice maps to the same transaction.
+func (r *Receipt) DedupKey(text string) string {
+	if r.Reference != "" {
+		return "rcpt:" + strings.ToUpper(r.Reference)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return "rcpt:sha-" + hex.EncodeToString(sum[:16])
+}
+
+// phrase maps a direction phrase to the direction and kind it implies
+type phrase struct {
+	pattern   *regexp.Regexp
+	direction models.TransactionType
+	kind      Kind
+}
+
+// grammar holds the provider specific parts of a receipt format. The field
+// extractors below are shared because the providers use the same Somali
+// wording for most fields.
+type grammar struct {
+	provider models.Provider
+	header   *regexp.Regexp
+	// currency returns the default currency for a header match
+	currency func(header []string) string
+}
+
+var grammars = []*grammar{
+	{
+		provider: models.ProviderEvcplus,
+		header:   regexp.MustCompile(`(?i)\[-*\s*EVC\s*Plus\s*-*\]`),
+		currency: func([]string) string { return "USD" },
+	},
+	{
+		provider: models.ProviderZaad,
+		header:   regexp.MustCompile(`(?i)\[-*\s*ZAAD(?:\s+(USD|SLSH|SLS))?\s*-*\]`),
+		currency: func(m []string) string {
+			if len(m) > 1 && m[1] != "" && !strings.EqualFold(m[1], "USD") {
+				return CurrencySLS
+			}
+			return "USD"
+		},
+	},
+	{
+		provider: models.ProviderEdahab,
+		header:   regexp.MustCompile(`(?i)\be-?dahab\b`),
+		currency: func([]string) string { return "USD" },
+	},
+	{
+		provider: models.ProviderSahal,
+		header:   regexp.MustCompile(`(?i)\[-*\s*SAHAL\s*-*\]`),
+		currency: func([]string) string { return "USD" },
+	},
+}
+
+// Direction phrases, checked in order. Each captures the counterparty
+// segment that follows the phrase.
+var phrases = []phrase{
+	{regexp.MustCompile(`(?i)\bka\s+heshay\s+`), models.TransactionTypeCredit, KindTransfer},
+	{regexp.MustCompile(`(?i)\bkuugu\s+soo\s+diray\b\s*`), models.TransactionTypeCredit, KindTransfer},
+	{regexp.MustCompile(`(?i)\breceived\b.*?\bfrom\s+`), models.TransactionTypeCredit, KindTransfer},
+	{regexp.MustCompile(`(?i)\bu\s+dirtay\s+`), models.TransactionTypeDebit, KindTransfer},
+	{regexp.MustCompile(`(?i)\bsent\b.*?\bto\s+`), models.TransactionTypeDebit, KindTransfer},
+	{regexp.MustCompile(`(?i)\bku\s+bixisay\s+`), models.TransactionTypeDebit, KindPayment},
+	{regexp.MustCompile(`(?i)\bu\s+bixisay\s+`), models.TransactionTypeDebit, KindPayment},
+	{regexp.MustCompile(`(?i)\bpaid\b.*?\bto\s+`), models.TransactionTypeDebit, KindPayment},
+	{regexp.MustCompile(`(?i)\bku\s+shubatay\s*`), models.TransactionTypeDebit, KindAirtime},
+	{regexp.MustCompile(`(?i)\bairtime\b.*?\bfor\s+`), models.TransactionTypeDebit, KindAirtime},
+}
+
+var (
+	// Amounts: "$5", "$ 1,250.50", "USD 20", "50,000 SLSH", "50000 Sl.Sh"
+	moneyPattern = regexp.MustCompile(`(?i)(?:(\$|USD)\s?([0-9][0-9,]*(?:\.[0-9]+)?))|(?:([0-9][0-9,]*(?:\.[0-9]+)?)\s?(SLSH|SLS|Sl\.?\s?Sh\.?))`)
+
+	balancePattern = regexp.MustCompile(`(?i)(?:haraag\w*|balance)(?:\s+(?:waa|is))?\s*[:=]?\s*((?:\$|USD)\s?[0-9][0-9,]*(?:\.[0-9]+)?|[0-9][0-9,]*(?:\.[0-9]+)?\s?(?:SLSH|SLS|Sl\.?\s?Sh\.?))`)
+
+	referencePattern = regexp.MustCompile(`(?i)\b(?:lambarka\s+tixraaca|tixraac|tix|ref(?:erence)?|transaction\s+id|tid)\s*(?:no\.?)?\s*[:#]?\s*([A-Z0-9][A-Z0-9-]{3,})`)
+
+	datePattern = regexp.MustCompile(`(?i)\b(?:tar(?:iikh(?:da)?)?|date)\s*:?\s*(\d{1,2}/\d{1,2}/\d{2,4}(?:\s+\d{1,2}:\d{2}(?::\d{2})?)?)`)
+
+	// The counterparty segment ends at the next comma, sentence break or field label
+	segmentEnd = regexp.MustCompile(`(?i)(?:,|;|\.\s|\.$|\s+(?:tar(?:iikh(?:da)?)?|tix(?:raac)?|lambarka|haraag\w*|date|ref(?:erence)?|balance|on)\b|$)`)
+
+	nameThenNumber = regexp.MustCompile(`^(.+?)\s*\(\s*(\+?\d{6,15})\s*\)$`)
+	numberThenName = regexp.MustCompile(`^(\+?\d{6,15})\s*\(\s*(.+?)\s*\)$`)
+	numberOnly     = regexp.MustCompile(`^(\+?\d{6,15})$`)
+	nameAndNumber  = regexp.MustCompile(`^(.+?)\s+(\+?\d{6,15})$`)
+)
+
+var dateLayouts = []string{
+	"02/01/06 15:04:05",
+	"02/01/2006 15:04:05",
+	"02/01/06 15:04",
+	"02/01/2006 15:04",
+	"2/1/06 15:04:05",
+	"2/1/2006 15:04:05",
+	"02/01/06",
+	"02/01/2006",
+}
+
+// Detect returns the provider whose header appears in the text
+func Detect(text string) (models.Provider, bool) {
+	for _, g := range grammars {
+		if g.header.MatchString(text) {
+			return g.provider, true
+		}
+	}
+	return "", false
+}
+
+// Supports reports whether receipts from the provider can be parsed
+func Supports(provider models.Provider) bool {
+	return grammarFor(provider) != nil
+}
+
+// Parse extracts a Receipt from text sent by the given provider. The text must
+// carry that provider's header; a receipt from another provider is rejected.
+func Parse(provider models.Provider, text string) (*Receipt, error) {
+	g := grammarFor(provider)
+	if g == nil {
+		return nil, ErrUnsupportedProvider
+	}
+
+	header := g.header.FindStringSubmatch(text)
+	if header == nil {
+		if detected, ok := Detect(text); ok {
+			return nil, fmt.Errorf("receipt is from %s, not %s", detected, provider)
+		}
+		return nil, ErrUnknownFormat
+	}
+	body := strings.Join(strings.Fields(g.header.ReplaceAllString(text, " ")), " ")
+
+	receipt := &Receipt{
+		Provider: g.provider,
+		Currency: g.currency(header),
+	}
+
+	// The balance clause also contains an amount, so pull it out before
+	// looking for the transaction amount.
+	if m := balancePattern.FindStringSubmatchIndex(body); m != nil {
+		if amount, _, ok := parseMoney(body[m[2]:m[3]]); ok {
+			receipt.BalanceAfter = &amount
+		}
+		body = body[:m[0]] + body[m[1]:]
+	}
+
+	if m := referencePattern.FindStringSubmatch(body); m != nil {
+		receipt.Reference = strings.TrimRight(m[1], "-")
+	}
+
+	if m := datePattern.FindStringSubmatch(body); m != nil {
+		if date, ok := parseDate(m[1]); ok {
+			receipt.Date = &date
+		}
+	}
+
+	loc := moneyPattern.FindStringIndex(body)
+	if loc == nil {
+		return nil, ErrNoAmount
+	}
+	amount, currency, ok := parseMoney(body[loc[0]:loc[1]])
+	if !ok || amount <= 0 {
+		return nil, ErrNoAmount
+	}
+	receipt.Amount = amount
+	if currency != "" {
+		receipt.Currency = currency
+	}
+
+	found := false
+	for _, p := range phrases {
+		m := p.pattern.FindStringIndex(body)
+		if m == nil {
+			continue
+		}
+		receipt.Direction = p.direction
+		receipt.Kind = p.kind
+		receipt.CounterpartyName, receipt.CounterpartyNumber = parseCounterparty(counterpartySegment(body[m[1]:]))
+		found = true
+		break
+	}
+	if !found {
+		return nil, ErrNoDirection
+	}
+
+	return receipt, nil
+}
+
+func grammarFor(provider models.Provider) *grammar {
+	for _, g := range grammars {
+		if g.provider == provider {
+			return g
+		}
+	}
+	return nil
+}
+
+// counterpartySegment returns the text after a direction phrase up to the
+// end of the counterparty, skipping a leading amount ("u dirtay $5 Ahmed").
+func counterpartySegment(s string) string {
+	s = strings.TrimSpace(s)
+	if loc := moneyPattern.FindStringIndex(s); loc != nil && loc[0] == 0 {
+		s = strings.TrimSpace(s[loc[1]:])
+	}
+	if loc := segmentEnd.FindStringIndex(s); loc != nil {
+		s = s[:loc[0]]
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseCounterparty splits a segment such as "Ahmed Ali(252615123456)",
+// "659123456 (Hodan Ali)" or "252615123456" into name and number
+func parseCounterparty(segment string) (name, number string) {
+	segment = strings.TrimSpace(strings.Trim(segment, ".:"))
+	switch {
+	case segment == "":
+		return "", ""
+	case nameThenNumber.MatchString(segment):
+		m := nameThenNumber.FindStringSubmatch(segment)
+		return strings.TrimSpace(m[1]), normalizeNumber(m[2])
+	case numberThenName.MatchString(segment):
+		m := numberThenName.FindStringSubmatch(segment)
+		return strings.TrimSpace(m[2]), normalizeNumber(m[1])
+	case numberOnly.MatchString(segment):
+		return "", normalizeNumber(segment)
+	case nameAndNumber.MatchString(segment):
+		m := nameAndNumber.FindStringSubmatch(segment)
+		return strings.TrimSpace(m[1]), normalizeNumber(m[2])
+	}
+	return segment, ""
+}
+
+func normalizeNumber(n string) string {
+	return strings.TrimPrefix(strings.TrimSpace(n), "+")
+}
+
+// parseMoney converts a matched amount into a number and a currency code.
+// The currency is empty when the text uses no marker.
+func parseMoney(s string) (float64, string, bool) {
+	m := moneyPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, "", false
+	}
+	digits, currency := m[2], "USD"
+	if m[1] == "" {
+		digits, currency = m[3], CurrencySLS
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(digits, ",", ""), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return amount, currency, true
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, utils.LocalZone); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,345 @@
+package receipts
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider models.Provider
+		text     string
+		want     Receipt
+		wantDate string // RFC3339, empty when the receipt has no date
+	}{
+		// EVC Plus
+		{
+			name:     "evc sent with name and number",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] $5 ayaad u dirtay Ahmed Ali(252615123456), Tar: 12/05/24 10:15:30, Haraagaagu waa $20.50.",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 5, Currency: "USD",
+				CounterpartyName: "Ahmed Ali", CounterpartyNumber: "252615123456", BalanceAfter: ptr(20.5)},
+			wantDate: "2024-05-12T10:15:30+03:00",
+		},
+		{
+			name:     "evc received",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] Waxaad $10 ka heshay Faadumo Xasan(252617654321), Tar: 13/05/24 11:00:00, Haraagaagu waa $30.50.",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 10, Currency: "USD",
+				CounterpartyName: "Faadumo Xasan", CounterpartyNumber: "252617654321", BalanceAfter: ptr(30.5)},
+			wantDate: "2024-05-13T11:00:00+03:00",
+		},
+		{
+			name:     "evc sent to bare number",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] $1.25 ayaad u dirtay 615000111, Tar: 01/02/2024 08:05, Haraagaagu waa $3.",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 1.25, Currency: "USD",
+				CounterpartyNumber: "615000111", BalanceAfter: ptr(3)},
+			wantDate: "2024-02-01T08:05:00+03:00",
+		},
+		{
+			name:     "evc airtime top up",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] $1 ayaad ku shubatay 615123456, Tar: 20/06/24 19:45:10, Haraagaagu waa $8.75",
+			want: Receipt{Kind: KindAirtime, Direction: models.TransactionTypeDebit, Amount: 1, Currency: "USD",
+				CounterpartyNumber: "615123456", BalanceAfter: ptr(8.75)},
+			wantDate: "2024-06-20T19:45:10+03:00",
+		},
+		{
+			name:     "evc merchant payment with reference",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] $12.40 ayaad u bixisay Hayat Market(503344), Tix: 88123456, Tar: 02/03/24 14:10:00, Haraagaagu waa $100.",
+			want: Receipt{Kind: KindPayment, Direction: models.TransactionTypeDebit, Amount: 12.4, Currency: "USD",
+				CounterpartyName: "Hayat Market", CounterpartyNumber: "503344", BalanceAfter: ptr(100), Reference: "88123456"},
+			wantDate: "2024-03-02T14:10:00+03:00",
+		},
+		{
+			name:     "evc thousands separator",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] Waxaad $1,250.00 ka heshay Dahabshil Bank(252610000000), Tar: 05/01/24 09:00:00, Haraagaagu waa $1,300.00",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 1250, Currency: "USD",
+				CounterpartyName: "Dahabshil Bank", CounterpartyNumber: "252610000000", BalanceAfter: ptr(1300)},
+			wantDate: "2024-01-05T09:00:00+03:00",
+		},
+		{
+			name:     "evc header with spaces and no balance",
+			provider: models.ProviderEvcplus,
+			text:     "[- EVC Plus -] $2 ayaad u dirtay Cabdi(252612223344), Tar: 07/07/24 07:07:07",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 2, Currency: "USD",
+				CounterpartyName: "Cabdi", CounterpartyNumber: "252612223344"},
+			wantDate: "2024-07-07T07:07:07+03:00",
+		},
+		{
+			name:     "evc multiline",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-]\n$7 ayaad u dirtay\nXamdi Warsame(252619998877),\nTar: 11/11/24 11:11:11,\nHaraagaagu waa $0.50",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 7, Currency: "USD",
+				CounterpartyName: "Xamdi Warsame", CounterpartyNumber: "252619998877", BalanceAfter: ptr(0.5)},
+			wantDate: "2024-11-11T11:11:11+03:00",
+		},
+		{
+			name:     "evc english wording",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] You have sent $15.00 to Asha Omar (252615551122) on 09/09/24 12:00:00. Balance: $45.00",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 15, Currency: "USD",
+				CounterpartyName: "Asha Omar", CounterpartyNumber: "252615551122", BalanceAfter: ptr(45)},
+		},
+		{
+			name:     "evc english received",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] You have received $4 from 252614445566. Ref: EV12345678. Balance is $9",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 4, Currency: "USD",
+				CounterpartyNumber: "252614445566", BalanceAfter: ptr(9), Reference: "EV12345678"},
+		},
+
+		// ZAAD
+		{
+			name:     "zaad usd sent",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD USD-] Waxaad $20 u dirtay Cali Maxamed (634123456), Tix: 4455667, Tar: 12/05/2024 09:12:33, Haraagaagu waa $100.25.",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 20, Currency: "USD",
+				CounterpartyName: "Cali Maxamed", CounterpartyNumber: "634123456", BalanceAfter: ptr(100.25), Reference: "4455667"},
+			wantDate: "2024-05-12T09:12:33+03:00",
+		},
+		{
+			name:     "zaad usd received",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD USD-] Waxaad $15 ka heshay Maryan Yuusuf (634998877), Tix: 9988776, Tar: 14/05/2024 16:40:00, Haraagaagu waa $115.25.",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 15, Currency: "USD",
+				CounterpartyName: "Maryan Yuusuf", CounterpartyNumber: "634998877", BalanceAfter: ptr(115.25), Reference: "9988776"},
+			wantDate: "2024-05-14T16:40:00+03:00",
+		},
+		{
+			name:     "zaad shilling sent",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD SLSH-] Waxaad 50,000 SLSH u dirtay Hodan Ismaaciil (634112233), Tix: 5566778, Tar: 01/06/2024 10:00:00, Haraagaagu waa 150,000 SLSH.",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 50000, Currency: CurrencySLS,
+				CounterpartyName: "Hodan Ismaaciil", CounterpartyNumber: "634112233", BalanceAfter: ptr(150000), Reference: "5566778"},
+			wantDate: "2024-06-01T10:00:00+03:00",
+		},
+		{
+			name:     "zaad shilling with Sl.Sh marker",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD SLSH-] Waxaad 12000 Sl.Sh ka heshay 634556677, Tar: 02/06/2024 08:30:00, Haraagaagu waa 162000 Sl.Sh",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 12000, Currency: CurrencySLS,
+				CounterpartyNumber: "634556677", BalanceAfter: ptr(162000)},
+			wantDate: "2024-06-02T08:30:00+03:00",
+		},
+		{
+			name:     "zaad merchant payment",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD USD-] Waxaad $3.50 ku bixisay Bajaj Express (501122), Tix: 1122334, Tar: 03/06/2024 13:15:00, Haraagaagu waa $96.75",
+			want: Receipt{Kind: KindPayment, Direction: models.TransactionTypeDebit, Amount: 3.5, Currency: "USD",
+				CounterpartyName: "Bajaj Express", CounterpartyNumber: "501122", BalanceAfter: ptr(96.75), Reference: "1122334"},
+			wantDate: "2024-06-03T13:15:00+03:00",
+		},
+		{
+			name:     "zaad plain header defaults to usd",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD-] Waxaad $1 ku shubatay 634000000, Tar: 04/06/2024 06:00, Haraagaagu waa $95.75",
+			want: Receipt{Kind: KindAirtime, Direction: models.TransactionTypeDebit, Amount: 1, Currency: "USD",
+				CounterpartyNumber: "634000000", BalanceAfter: ptr(95.75)},
+			wantDate: "2024-06-04T06:00:00+03:00",
+		},
+		{
+			name:     "zaad name without parentheses",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD USD-] Waxaad $8 u dirtay Ayaan Cumar 634777888, Tar: 05/06/2024 18:20:00",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 8, Currency: "USD",
+				CounterpartyName: "Ayaan Cumar", CounterpartyNumber: "634777888"},
+			wantDate: "2024-06-05T18:20:00+03:00",
+		},
+
+		// eDahab
+		{
+			name:     "edahab sent number then name",
+			provider: models.ProviderEdahab,
+			text:     "eDahab: Waxaad $12.00 u dirtay 659123456 (Hodan Ali). Lambarka Tixraaca: ED123456. Haraagaaga: $40.00",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 12, Currency: "USD",
+				CounterpartyName: "Hodan Ali", CounterpartyNumber: "659123456", BalanceAfter: ptr(40), Reference: "ED123456"},
+		},
+		{
+			name:     "edahab received",
+			provider: models.ProviderEdahab,
+			text:     "eDahab: Waxaad $8 ka heshay 659654321 (Sahra Nuur). Lambarka Tixraaca: ED654321. Haraagaaga: $48.00",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 8, Currency: "USD",
+				CounterpartyName: "Sahra Nuur", CounterpartyNumber: "659654321", BalanceAfter: ptr(48), Reference: "ED654321"},
+		},
+		{
+			name:     "edahab with date",
+			provider: models.ProviderEdahab,
+			text:     "E-Dahab: Waxaad $2.5 u bixisay Somtel Shop (659000111). Tariikhda: 15/08/2024 20:00:00. Haraagaaga: $10",
+			want: Receipt{Kind: KindPayment, Direction: models.TransactionTypeDebit, Amount: 2.5, Currency: "USD",
+				CounterpartyName: "Somtel Shop", CounterpartyNumber: "659000111", BalanceAfter: ptr(10)},
+			wantDate: "2024-08-15T20:00:00+03:00",
+		},
+		{
+			name:     "edahab kuugu soo diray",
+			provider: models.ProviderEdahab,
+			text:     "eDahab: $30 ayaa kuugu soo diray Guuleed Axmed (659332211). Lambarka Tixraaca: ED998877",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 30, Currency: "USD",
+				CounterpartyName: "Guuleed Axmed", CounterpartyNumber: "659332211", Reference: "ED998877"},
+		},
+
+		// Sahal
+		{
+			name:     "sahal sent",
+			provider: models.ProviderSahal,
+			text:     "[-SAHAL-] $6 ayaad u dirtay Abdirahman (907112233), Tar: 10/10/24 10:10:10, Haraagaagu waa $14",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeDebit, Amount: 6, Currency: "USD",
+				CounterpartyName: "Abdirahman", CounterpartyNumber: "907112233", BalanceAfter: ptr(14)},
+			wantDate: "2024-10-10T10:10:10+03:00",
+		},
+		{
+			name:     "sahal received with plus prefix",
+			provider: models.ProviderSahal,
+			text:     "[-SAHAL-] Waxaad $9 ka heshay Idil(+252907445566), Tar: 11/10/24 09:00:00",
+			want: Receipt{Kind: KindTransfer, Direction: models.TransactionTypeCredit, Amount: 9, Currency: "USD",
+				CounterpartyName: "Idil", CounterpartyNumber: "252907445566"},
+			wantDate: "2024-10-11T09:00:00+03:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.provider, tt.text)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got.Provider != tt.provider {
+				t.Errorf("Provider = %q, want %q", got.Provider, tt.provider)
+			}
+			if got.Kind != tt.want.Kind {
+				t.Errorf("Kind = %q, want %q", got.Kind, tt.want.Kind)
+			}
+			if got.Direction != tt.want.Direction {
+				t.Errorf("Direction = %q, want %q", got.Direction, tt.want.Direction)
+			}
+			if math.Abs(got.Amount-tt.want.Amount) > 0.001 {
+				t.Errorf("Amount = %v, want %v", got.Amount, tt.want.Amount)
+			}
+			if got.Currency != tt.want.Currency {
+				t.Errorf("Currency = %q, want %q", got.Currency, tt.want.Currency)
+			}
+			if got.CounterpartyName != tt.want.CounterpartyName {
+				t.Errorf("CounterpartyName = %q, want %q", got.CounterpartyName, tt.want.CounterpartyName)
+			}
+			if got.CounterpartyNumber != tt.want.CounterpartyNumber {
+				t.Errorf("CounterpartyNumber = %q, want %q", got.CounterpartyNumber, tt.want.CounterpartyNumber)
+			}
+			if got.Reference != tt.want.Reference {
+				t.Errorf("Reference = %q, want %q", got.Reference, tt.want.Reference)
+			}
+			switch {
+			case tt.want.BalanceAfter == nil && got.BalanceAfter != nil:
+				t.Errorf("BalanceAfter = %v, want nil", *got.BalanceAfter)
+			case tt.want.BalanceAfter != nil && got.BalanceAfter == nil:
+				t.Errorf("BalanceAfter = nil, want %v", *tt.want.BalanceAfter)
+			case tt.want.BalanceAfter != nil && math.Abs(*got.BalanceAfter-*tt.want.BalanceAfter) > 0.001:
+				t.Errorf("BalanceAfter = %v, want %v", *got.BalanceAfter, *tt.want.BalanceAfter)
+			}
+			if tt.wantDate != "" {
+				want, _ := time.Parse(time.RFC3339, tt.wantDate)
+				if got.Date == nil || !got.Date.Equal(want) {
+					t.Errorf("Date = %v, want %v", got.Date, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider models.Provider
+		text     string
+		wantErr  error
+	}{
+		{
+			name:     "unsupported provider",
+			provider: models.ProviderSomnet,
+			text:     "[-EVCPlus-] $5 ayaad u dirtay 615123456",
+			wantErr:  ErrUnsupportedProvider,
+		},
+		{
+			name:     "not a receipt",
+			provider: models.ProviderEvcplus,
+			text:     "Your KaafiPay verification code is: 123456",
+			wantErr:  ErrUnknownFormat,
+		},
+		{
+			name:     "no amount",
+			provider: models.ProviderEvcplus,
+			text:     "[-EVCPlus-] Adeegga waa la joojiyay",
+			wantErr:  ErrNoAmount,
+		},
+		{
+			name:     "no direction",
+			provider: models.ProviderZaad,
+			text:     "[-ZAAD USD-] Haraagaagu waa $10. Lacag $5 ayaa la xannibay",
+			wantErr:  ErrNoDirection,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.provider, tt.text)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRejectsOtherProvider(t *testing.T) {
+	_, err := Parse(models.ProviderEvcplus, "[-ZAAD USD-] Waxaad $20 u dirtay 634123456")
+	if err == nil {
+		t.Fatal("Parse() accepted a ZAAD receipt for an EVC Plus account")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want models.Provider
+		ok   bool
+	}{
+		{"[-EVCPlus-] $5 ayaad u dirtay 615123456", models.ProviderEvcplus, true},
+		{"[-ZAAD SLSH-] Waxaad 5000 SLSH u dirtay 634123456", models.ProviderZaad, true},
+		{"eDahab: Waxaad $1 u dirtay 659123456", models.ProviderEdahab, true},
+		{"[-SAHAL-] $1 ayaad u dirtay 907123456", models.ProviderSahal, true},
+		{"Hello there", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Detect(tt.text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Detect(%q) = %q, %v; want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	withRef := &Receipt{Reference: "ed123456"}
+	if got := withRef.DedupKey("anything"); got != "rcpt:ED123456" {
+		t.Errorf("DedupKey() = %q, want reference based key", got)
+	}
+
+	noRef := &Receipt{}
+	a := noRef.DedupKey("[-EVCPlus-] $5 ayaad u dirtay  615123456")
+	b := noRef.DedupKey("[-EVCPlus-]\n$5 ayaad u dirtay 615123456")
+	if a != b {
+		t.Errorf("DedupKey() differs for whitespace-only changes: %q vs %q", a, b)
+	}
+	c := noRef.DedupKey("[-EVCPlus-] $6 ayaad u dirtay 615123456")
+	if a == c {
+		t.Error("DedupKey() collides for different receipts")
+	}
+}
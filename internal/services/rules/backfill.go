@@ -0,0 +1,348 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+const (
+	backfillBatchSize = 500
+	backfillIdlePoll  = time.Minute
+	// backfillLease is how long a running job may go without a heartbeat
+	// before another worker takes it over
+	backfillLease = 5 * time.Minute
+)
+
+var (
+	ErrJobNotFound    = errors.New("recategorization job not found")
+	ErrJobNotUndoable = errors.New("only completed or failed jobs can be undone")
+
+	// errLeaseLost stops a worker whose job was taken over by another
+	errLeaseLost = errors.New("job was taken over by another worker")
+)
+
+// Backfiller runs recategorization jobs in the background. Jobs are claimed
+// with SKIP LOCKED, so several instances can share the queue, and progress is
+// checkpointed after every batch so an interrupted job resumes where it
+// stopped. The checkpoint doubles as a heartbeat: a running job that misses
+// it for longer than the lease is requeued, and a checkpoint only commits
+// if the job is still where its worker left it.
+type Backfiller struct {
+	db   *gorm.DB
+	wake chan struct{}
+}
+
+func NewBackfiller(db *gorm.DB) *Backfiller {
+	return &Backfiller{db: db, wake: make(chan struct{}, 1)}
+}
+
+// Start starts the worker loop
+func (b *Backfiller) Start() {
+	go func() {
+		for {
+			b.requeueAbandoned()
+			for {
+				ran, err := b.runNext()
+				if err != nil {
+					log.Printf("[BACKFILL] %v", err)
+				}
+				if !ran {
+					break
+				}
+			}
+			select {
+			case <-b.wake:
+			case <-time.After(backfillIdlePoll):
+			}
+		}
+	}()
+}
+
+// Enqueue creates a job that recategorizes the user's transactions dated on
+// or after since, or all of them when since is nil
+func (b *Backfiller) Enqueue(userID uuid.UUID, categoryID *uuid.UUID, since *time.Time) (*models.RecategorizationJob, error) {
+	var total int64
+	if err := b.userTransactions(userID, since).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	job := &models.RecategorizationJob{
+		UserID:           userID,
+		BudgetCategoryID: categoryID,
+		Status:           models.RecategorizationPending,
+		Since:            since,
+		TotalCount:       int(total),
+	}
+	if err := b.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns one of the user's jobs
+func (b *Backfiller) Get(userID, jobID uuid.UUID) (*models.RecategorizationJob, error) {
+	var job models.RecategorizationJob
+	err := b.db.Where("id = ? AND user_id = ?", jobID, userID).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Undo restores the categories a job replaced. Transactions recategorized
+// again since the job ran are left alone.
+func (b *Backfiller) Undo(userID, jobID uuid.UUID) (*models.RecategorizationJob, int64, error) {
+	var job models.RecategorizationJob
+	var restored int64
+	err := b.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", jobID, userID).
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if job.Status != models.RecategorizationCompleted && job.Status != models.RecategorizationFailed {
+			return ErrJobNotUndoable
+		}
+
+		result := tx.Exec(`
+			UPDATE provider_transactions pt
+			SET budget_category_id = c.old_budget_category_id,
+			    matched_rule = c.old_matched_rule
+			FROM recategorization_changes c
+			WHERE c.job_id = ?
+			  AND pt.id = c.transaction_id
+			  AND pt.budget_category_id IS NOT DISTINCT FROM c.new_budget_category_id`, job.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		restored = result.RowsAffected
+
+		now := time.Now()
+		job.Status = models.RecategorizationUndone
+		job.UndoneAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":    job.Status,
+			"undone_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	log.Printf("[BACKFILL] Undid job %s: %d transactions restored", job.ID, restored)
+	return &job, restored, nil
+}
+
+// requeueAbandoned puts running jobs whose worker stopped sending
+// heartbeats back in the queue
+func (b *Backfiller) requeueAbandoned() {
+	result := b.db.Model(&models.RecategorizationJob{}).
+		Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)",
+			models.RecategorizationRunning, time.Now().Add(-backfillLease)).
+		Update("status", models.RecategorizationPending)
+	if result.Error != nil {
+		log.Printf("[BACKFILL] Failed to requeue abandoned jobs: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[BACKFILL] Requeued %d abandoned jobs", result.RowsAffected)
+	}
+}
+
+// runNext claims the oldest pending job and runs it. It reports whether a
+// job was found.
+func (b *Backfiller) runNext() (bool, error) {
+	var job models.RecategorizationJob
+	if err := b.db.Raw(`
+		UPDATE recategorization_jobs
+		SET status = ?, started_at = COALESCE(started_at, NOW()), heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM recategorization_jobs
+			WHERE status = ?
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, models.RecategorizationRunning, models.RecategorizationPending).
+		Scan(&job).Error; err != nil {
+		return false, fmt.Errorf("failed to claim job: %v", err)
+	}
+	if job.ID == uuid.Nil {
+		return false, nil
+	}
+
+	err := b.process(&job)
+	if errors.Is(err, errLeaseLost) {
+		log.Printf("[BACKFILL] Job %s: %v", job.ID, err)
+		return true, nil
+	}
+	if err != nil {
+		log.Printf("[BACKFILL] Job %s failed: %v", job.ID, err)
+		if updateErr := b.db.Model(&job).Updates(map[string]interface{}{
+			"status":        models.RecategorizationFailed,
+			"error_message": err.Error(),
+			"completed_at":  time.Now(),
+		}).Error; updateErr != nil {
+			log.Printf("[BACKFILL] Failed to mark job %s failed: %v", job.ID, updateErr)
+		}
+		return true, nil
+	}
+
+	log.Printf("[BACKFILL] Job %s completed: %d processed, %d changed", job.ID, job.ProcessedCount, job.ChangedCount)
+	return true, nil
+}
+
+// process walks the user's transactions in id order, one batch per database
+// transaction, and records every change it makes
+func (b *Backfiller) process(job *models.RecategorizationJob) error {
+	evaluator, err := Load(b.db, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	for {
+		query := b.userTransactions(job.UserID, job.Since).
+			Select("provider_transactions.*").
+			Order("provider_transactions.id").
+			Limit(backfillBatchSize)
+		if job.CursorID != nil {
+			query = query.Where("provider_transactions.id > ?", *job.CursorID)
+		}
+
+		var txns []models.ProviderTransaction
+		if err := query.Find(&txns).Error; err != nil {
+			return err
+		}
+		if len(txns) == 0 {
+			break
+		}
+
+		var changes []models.RecategorizationChange
+		for i := range txns {
+			txn := &txns[i]
+			oldCategory, oldRule := txn.BudgetCategoryID, txn.MatchedRule
+			evaluator.Apply(txn)
+			if sameCategory(oldCategory, txn.BudgetCategoryID) && sameRule(oldRule, txn.MatchedRule) {
+				continue
+			}
+			changes = append(changes, models.RecategorizationChange{
+				JobID:               job.ID,
+				TransactionID:       txn.ID,
+				OldBudgetCategoryID: oldCategory,
+				OldMatchedRule:      oldRule,
+				NewBudgetCategoryID: txn.BudgetCategoryID,
+				NewMatchedRule:      txn.MatchedRule,
+			})
+		}
+
+		lastID := txns[len(txns)-1].ID
+		err := b.db.Transaction(func(tx *gorm.DB) error {
+			if len(changes) > 0 {
+				if err := tx.Create(&changes).Error; err != nil {
+					return err
+				}
+			}
+			for _, change := range changes {
+				if err := tx.Model(&models.ProviderTransaction{}).
+					Where("id = ?", change.TransactionID).
+					Updates(map[string]interface{}{
+						"budget_category_id": change.NewBudgetCategoryID,
+						"matched_rule":       change.NewMatchedRule,
+					}).Error; err != nil {
+					return err
+				}
+			}
+			return b.checkpoint(tx, job, map[string]interface{}{
+				"processed_count": gorm.Expr("processed_count + ?", len(txns)),
+				"changed_count":   gorm.Expr("changed_count + ?", len(changes)),
+				"cursor_id":       lastID,
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		job.ProcessedCount += len(txns)
+		job.ChangedCount += len(changes)
+		job.CursorID = &lastID
+	}
+
+	now := time.Now()
+	if err := b.checkpoint(b.db, job, map[string]interface{}{
+		"status":       models.RecategorizationCompleted,
+		"completed_at": now,
+	}); err != nil {
+		return err
+	}
+	job.Status = models.RecategorizationCompleted
+	job.CompletedAt = &now
+	return nil
+}
+
+// checkpoint applies updates to the job and renews its lease, failing with
+// errLeaseLost if the job is no longer running from where this worker left
+// it
+func (b *Backfiller) checkpoint(db *gorm.DB, job *models.RecategorizationJob, updates map[string]interface{}) error {
+	updates["heartbeat_at"] = gorm.Expr("NOW()")
+	result := db.Model(&models.RecategorizationJob{}).
+		Where("id = ? AND status = ? AND cursor_id IS NOT DISTINCT FROM ?",
+			job.ID, models.RecategorizationRunning, job.CursorID).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// userTransactions scopes a query to the user's transactions, including those
+// on accounts that have since been unlinked
+func (b *Backfiller) userTransactions(userID uuid.UUID, since *time.Time) *gorm.DB {
+	query := b.db.Model(&models.ProviderTransaction{}).
+		Joins("JOIN linked_accounts ON linked_accounts.id = provider_transactions.linked_account_id").
+		Where("linked_accounts.user_id = ?", userID)
+	if since != nil {
+		query = query.Where("provider_transactions.transaction_date >= ?", *since)
+	}
+	return query
+}
+
+func sameCategory(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func sameRule(a, b *models.RuleMatch) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ra, errA := json.Marshal(a)
+	rb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ra, rb)
+}
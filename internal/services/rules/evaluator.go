@@ -0,0 +1,321 @@
+package rules
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// amountTolerance absorbs float rounding when comparing money amounts
+const amountTolerance = 0.005
+
+// Evaluator assigns transactions to a user's budget categories. Categories are
+// tried in priority order (lowest value first, then oldest first) and a
+// category matches when any of its top-level rules matches. The first
+// matching category wins, so each transaction lands in at most one category.
+//
+// Text comparisons ignore case and surrounding whitespace, regex patterns
+// match case-insensitively, and amount rules compare the unsigned amount.
+//
+// Categories shared with a budget group only match transactions on accounts
+// the user shares with that group.
+//
+// Independently of the user's budgets, transactions are placed in the system
+// taxonomy: under the matching budget category's parent when it has one, and
+// otherwise by the merchant map.
+type Evaluator struct {
+	categories []models.BudgetCategory
+	providers  map[uuid.UUID]models.Provider
+	patterns   map[string]*regexp.Regexp
+	merchants  *MerchantMap
+	shared     map[uuid.UUID]map[uuid.UUID]bool // group -> shared accounts
+}
+
+// NewEvaluator returns an evaluator over categories, which must already be in
+// evaluation order. providers maps the user's linked accounts to their
+// provider for "provider" rules. Use Load to fetch both from the database.
+func NewEvaluator(categories []models.BudgetCategory, providers map[uuid.UUID]models.Provider) *Evaluator {
+	return &Evaluator{
+		categories: categories,
+		providers:  providers,
+		patterns:   make(map[string]*regexp.Regexp),
+		shared:     make(map[uuid.UUID]map[uuid.UUID]bool),
+	}
+}
+
+// Load returns an evaluator over the user's budget categories, including
+// those shared with their groups
+func Load(db *gorm.DB, userID uuid.UUID) (*Evaluator, error) {
+	var categories []models.BudgetCategory
+	if err := db.Scopes(models.VisibleBudgetCategories(userID)).
+		Order("priority ASC").
+		Order("created_at ASC").
+		Order("id ASC").
+		Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	providers, err := loadProviders(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	evaluator := NewEvaluator(categories, providers)
+	evaluator.merchants = NewMerchantMap(db)
+
+	var shared []models.BudgetGroupAccount
+	if err := db.Where("user_id = ?", userID).Find(&shared).Error; err != nil {
+		return nil, err
+	}
+	for _, account := range shared {
+		if evaluator.shared[account.GroupID] == nil {
+			evaluator.shared[account.GroupID] = make(map[uuid.UUID]bool)
+		}
+		evaluator.shared[account.GroupID][account.LinkedAccountID] = true
+	}
+	return evaluator, nil
+}
+
+// loadProviders maps all of the user's linked accounts, including unlinked
+// ones whose transactions are still on record, to their provider
+func loadProviders(db *gorm.DB, userID uuid.UUID) (map[uuid.UUID]models.Provider, error) {
+	var accounts []models.LinkedAccount
+	if err := db.Unscoped().Select("id", "provider").
+		Where("user_id = ?", userID).
+		Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	providers := make(map[uuid.UUID]models.Provider, len(accounts))
+	for _, account := range accounts {
+		providers[account.ID] = account.Provider
+	}
+	return providers, nil
+}
+
+// Match returns the category and top-level rule that claim txn, or nil when
+// no rule matches
+func (e *Evaluator) Match(txn *models.ProviderTransaction) *models.RuleMatch {
+	for _, category := range e.categories {
+		if match := e.MatchCategory(&category, txn); match != nil {
+			return match
+		}
+	}
+	return nil
+}
+
+// MatchCategory evaluates a single category's rules against txn, ignoring
+// priority
+func (e *Evaluator) MatchCategory(category *models.BudgetCategory, txn *models.ProviderTransaction) *models.RuleMatch {
+	if category.GroupID != nil && !e.shared[*category.GroupID][txn.LinkedAccountID] {
+		return nil
+	}
+	for i, rule := range category.Rules {
+		if e.eval(rule, txn) {
+			return &models.RuleMatch{CategoryID: category.ID, RuleIndex: i, Rule: rule}
+		}
+	}
+	return nil
+}
+
+// Apply sets the budget category and matched rule on txn. A transaction that
+// matches no rule has no budget category but may still get a system category.
+func (e *Evaluator) Apply(txn *models.ProviderTransaction) bool {
+	match := e.Match(txn)
+	if match == nil {
+		txn.BudgetCategoryID = nil
+		txn.MatchedRule = nil
+		e.applySystemCategory(txn, nil)
+		return false
+	}
+	categoryID := match.CategoryID
+	txn.BudgetCategoryID = &categoryID
+	txn.MatchedRule = match
+	e.applySystemCategory(txn, match)
+	return true
+}
+
+// applySystemCategory fills in the system category unless the provider or the
+// user already set one
+func (e *Evaluator) applySystemCategory(txn *models.ProviderTransaction, match *models.RuleMatch) {
+	if txn.CategoryID != nil {
+		return
+	}
+	if match != nil {
+		for _, category := range e.categories {
+			if category.ID == match.CategoryID && category.ParentCategoryID != nil {
+				parent := *category.ParentCategoryID
+				txn.CategoryID = &parent
+				return
+			}
+		}
+	}
+	if e.merchants != nil {
+		txn.CategoryID = e.merchants.Lookup(merchantOf(txn))
+	}
+}
+
+func (e *Evaluator) eval(rule models.BudgetRule, txn *models.ProviderTransaction) bool {
+	switch {
+	case rule.All != nil:
+		for _, child := range rule.All {
+			if !e.eval(child, txn) {
+				return false
+			}
+		}
+		return len(rule.All) > 0
+	case rule.Any != nil:
+		for _, child := range rule.Any {
+			if e.eval(child, txn) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch rule.Type {
+	case models.RuleTypeDescription:
+		return e.matchText(rule, txn.Description)
+	case models.RuleTypeMerchant:
+		return e.matchText(rule, merchantOf(txn))
+	case models.RuleTypeCounterpartyPhone:
+		return e.matchPhone(rule, txn.CounterpartyPhone)
+	case models.RuleTypeAmount:
+		return matchAmount(rule, txn.Amount)
+	case models.RuleTypeProvider:
+		value, _ := rule.Value.Text()
+		provider, ok := e.providers[txn.LinkedAccountID]
+		return ok && strings.EqualFold(string(provider), strings.TrimSpace(value))
+	case models.RuleTypeLinkedAccount:
+		value, _ := rule.Value.Text()
+		id, err := uuid.Parse(strings.TrimSpace(value))
+		return err == nil && id == txn.LinkedAccountID
+	case models.RuleTypeDirection:
+		value, _ := rule.Value.Text()
+		return strings.EqualFold(string(txn.TransactionType), strings.TrimSpace(value))
+	case models.RuleTypeDayOfWeek:
+		return matchWeekday(rule, txn.TransactionDate.In(utils.LocalZone).Weekday())
+	}
+	return false
+}
+
+// merchantOf returns who the money went to or came from. Mobile-money
+// transfers rarely carry a merchant, so the counterparty stands in for it.
+func merchantOf(txn *models.ProviderTransaction) string {
+	if txn.MerchantName != "" {
+		return txn.MerchantName
+	}
+	return txn.CounterpartyName
+}
+
+func (e *Evaluator) matchText(rule models.BudgetRule, field string) bool {
+	value, ok := rule.Value.Text()
+	if !ok {
+		return false
+	}
+	if rule.Operator == models.RuleOpRegex {
+		pattern := e.pattern(value)
+		return pattern != nil && pattern.MatchString(field)
+	}
+
+	field = strings.ToLower(strings.TrimSpace(field))
+	value = strings.ToLower(strings.TrimSpace(value))
+	if rule.Operator == models.RuleOpNotContains {
+		return !strings.Contains(field, value)
+	}
+	if field == "" {
+		return false
+	}
+
+	switch rule.Operator {
+	case models.RuleOpContains:
+		return strings.Contains(field, value)
+	case models.RuleOpEquals:
+		return field == value
+	case models.RuleOpStartsWith:
+		return strings.HasPrefix(field, value)
+	}
+	return false
+}
+
+// matchPhone compares phone numbers on their digits only, so "+252 63 444"
+// and "25263444" are the same number. Regex patterns see the raw value.
+func (e *Evaluator) matchPhone(rule models.BudgetRule, phone string) bool {
+	if rule.Operator == models.RuleOpRegex {
+		return e.matchText(rule, phone)
+	}
+	value, ok := rule.Value.Text()
+	if !ok {
+		return false
+	}
+	normalized := rule
+	normalized.Value = models.StringRuleValue(digitsOnly(value))
+	return e.matchText(normalized, digitsOnly(phone))
+}
+
+func matchAmount(rule models.BudgetRule, amount float64) bool {
+	if rule.Operator == models.RuleOpBetween {
+		lo, hi, ok := rule.Value.Range()
+		return ok && amount >= lo-amountTolerance && amount <= hi+amountTolerance
+	}
+
+	target, ok := rule.Value.Number()
+	if !ok {
+		return false
+	}
+	switch rule.Operator {
+	case models.RuleOpEquals:
+		return math.Abs(amount-target) < amountTolerance
+	case models.RuleOpGreater:
+		return amount > target
+	case models.RuleOpLess:
+		return amount < target
+	}
+	return false
+}
+
+// matchWeekday handles single days and inclusive ranges. Ranges may wrap
+// around the week, so ["fri", "sun"] covers Friday to Sunday.
+func matchWeekday(rule models.BudgetRule, day time.Weekday) bool {
+	if rule.Operator == models.RuleOpBetween {
+		from, to, ok := rule.Value.WeekdayRange()
+		if !ok {
+			return false
+		}
+		if from <= to {
+			return day >= from && day <= to
+		}
+		return day >= from || day <= to
+	}
+	want, ok := rule.Value.Weekday()
+	return ok && day == want
+}
+
+// pattern compiles and caches a case-insensitive regex. Invalid patterns,
+// which validation normally rejects, never match.
+func (e *Evaluator) pattern(expr string) *regexp.Regexp {
+	if re, ok := e.patterns[expr]; ok {
+		return re
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		re = nil
+	}
+	e.patterns[expr] = re
+	return re
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
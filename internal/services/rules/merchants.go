@@ -0,0 +1,53 @@
+package rules
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// minMerchantMatch is the shortest mapped name matched inside a longer
+// merchant name, so short entries do not match by accident
+const minMerchantMatch = 4
+
+// MerchantMap looks up the system category of a merchant. A merchant matches
+// its exact mapped name first, then the longest mapped name it contains as
+// whole words, so "hormuud" also covers "hormuud telecom somalia" but not
+// "hormuudka". Lookups are cached for the life of the map.
+type MerchantMap struct {
+	db    *gorm.DB
+	cache map[string]*uuid.UUID
+}
+
+func NewMerchantMap(db *gorm.DB) *MerchantMap {
+	return &MerchantMap{db: db, cache: make(map[string]*uuid.UUID)}
+}
+
+// Lookup returns the system category for the merchant, or nil when it is not
+// mapped or the lookup fails
+func (m *MerchantMap) Lookup(merchant string) *uuid.UUID {
+	name := models.NormalizeMerchantName(merchant)
+	if name == "" {
+		return nil
+	}
+	if id, ok := m.cache[name]; ok {
+		return id
+	}
+
+	// STRPOS rather than LIKE, so a "%" or "_" in a mapped name is matched
+	// as itself
+	var mapping models.MerchantCategory
+	err := m.db.Where("merchant_name = ?", name).
+		Or("LENGTH(merchant_name) >= ? AND STRPOS(?, ' ' || merchant_name || ' ') > 0", minMerchantMatch, " "+name+" ").
+		Order(gorm.Expr("merchant_name = ? DESC, LENGTH(merchant_name) DESC", name)).
+		Limit(1).
+		Find(&mapping).Error
+
+	var id *uuid.UUID
+	if err == nil && mapping.ID != uuid.Nil {
+		id = &mapping.CategoryID
+	}
+	m.cache[name] = id
+	return id
+}
@@ -0,0 +1,156 @@
+package rules
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+)
+
+const (
+	DefaultPreviewDays = 90
+	MaxPreviewDays     = 365
+
+	// maxPreviewTransactions bounds the work a single preview can do
+	maxPreviewTransactions = 5000
+	// maxPreviewListed bounds the transactions listed in the response; the
+	// counts always cover everything scanned
+	maxPreviewListed = 200
+)
+
+// PreviewConflict is another category whose rules also match a transaction
+type PreviewConflict struct {
+	CategoryID uuid.UUID `json:"categoryId"`
+	Name       string    `json:"name"`
+	Priority   int       `json:"priority"`
+	RuleIndex  int       `json:"ruleIndex"`
+	// Wins is true when the other category comes first and would take the
+	// transaction instead
+	Wins bool `json:"wins"`
+}
+
+// PreviewMatch is a transaction the proposed rules match
+type PreviewMatch struct {
+	Transaction       models.ProviderTransaction `json:"transaction"`
+	RuleIndex         int                        `json:"ruleIndex"`
+	Assigned          bool                       `json:"assigned"`
+	CurrentCategoryID *uuid.UUID                 `json:"currentCategoryId,omitempty"`
+	Conflicts         []PreviewConflict          `json:"conflicts,omitempty"`
+}
+
+// Preview is the outcome of running proposed rules without saving them
+type Preview struct {
+	Days      int  `json:"days"`
+	Scanned   int  `json:"scanned"`
+	Truncated bool `json:"truncated"`
+
+	Matched    int `json:"matched"`    // transactions the proposed rules match
+	Assigned   int `json:"assigned"`   // of those, the ones this category would win
+	Conflicted int `json:"conflicted"` // of those, the ones another category also matches
+	Released   int `json:"released"`   // currently in this category but no longer matched
+
+	Matches          []PreviewMatch               `json:"matches"`
+	ReleasedExamples []models.ProviderTransaction `json:"releasedExamples"`
+}
+
+// PreviewRules runs proposed rules for a category over the user's
+// transactions from the last days days, taking the other categories and
+// priorities into account. Nothing is written.
+func PreviewRules(db *gorm.DB, repo repository.TransactionRepository, userID uuid.UUID, category models.BudgetCategory, proposed []models.BudgetRule, days int) (*Preview, error) {
+	evaluator, err := Load(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	category.Rules = proposed
+	for i := range evaluator.categories {
+		if evaluator.categories[i].ID == category.ID {
+			evaluator.categories[i] = category
+		}
+	}
+
+	preview := &Preview{
+		Days:             days,
+		Matches:          []PreviewMatch{},
+		ReleasedExamples: []models.ProviderTransaction{},
+	}
+
+	from := time.Now().AddDate(0, 0, -days)
+	filter := repository.TransactionFilter{
+		UserID: userID,
+		From:   &from,
+		Limit:  repository.MaxTransactionPageSize,
+	}
+	for {
+		txns, next, err := repo.List(filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range txns {
+			if preview.Scanned == maxPreviewTransactions {
+				preview.Truncated = true
+				return preview, nil
+			}
+			preview.Scanned++
+			evaluator.previewTransaction(preview, &category, &txns[i])
+		}
+		if next == nil {
+			return preview, nil
+		}
+		filter.Cursor = next
+	}
+}
+
+func (e *Evaluator) previewTransaction(preview *Preview, category *models.BudgetCategory, txn *models.ProviderTransaction) {
+	current := txn.BudgetCategoryID
+	match := e.MatchCategory(category, txn)
+	if match == nil {
+		if current != nil && *current == category.ID {
+			preview.Released++
+			if len(preview.ReleasedExamples) < maxPreviewListed {
+				preview.ReleasedExamples = append(preview.ReleasedExamples, *txn)
+			}
+		}
+		return
+	}
+
+	result := PreviewMatch{
+		Transaction:       *txn,
+		RuleIndex:         match.RuleIndex,
+		CurrentCategoryID: current,
+	}
+
+	before := true
+	for i := range e.categories {
+		other := &e.categories[i]
+		if other.ID == category.ID {
+			before = false
+			continue
+		}
+		if otherMatch := e.MatchCategory(other, txn); otherMatch != nil {
+			result.Conflicts = append(result.Conflicts, PreviewConflict{
+				CategoryID: other.ID,
+				Name:       other.Name,
+				Priority:   other.Priority,
+				RuleIndex:  otherMatch.RuleIndex,
+				Wins:       before,
+			})
+		}
+	}
+	winner := e.Match(txn)
+	result.Assigned = winner != nil && winner.CategoryID == category.ID
+
+	preview.Matched++
+	if result.Assigned {
+		preview.Assigned++
+	}
+	if len(result.Conflicts) > 0 {
+		preview.Conflicted++
+	}
+	if len(preview.Matches) < maxPreviewListed {
+		preview.Matches = append(preview.Matches, result)
+	}
+}
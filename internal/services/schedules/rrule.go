@@ -0,0 +1,266 @@
+// Package schedules runs transfers on a schedule: once at a set time or
+// repeatedly by an iCalendar-style recurrence rule.
+package schedules
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// Rule frequencies. Nothing repeats more often than daily.
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+const (
+	maxInterval = 366
+	maxCount    = 1000
+	// maxPeriods bounds the search for an occurrence
+	maxPeriods = 1000
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule is the subset of an RFC 5545 RRULE that payments need, e.g.
+// "FREQ=MONTHLY;BYMONTHDAY=25" or "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR;COUNT=6".
+// Rules are expanded in the users' local calendar: occurrences keep the
+// start's local time of day, and weekdays and month days are local ones.
+type Rule struct {
+	Freq     string
+	Interval int
+	// ByDay lists the weekdays of a weekly rule; the start's weekday if empty
+	ByDay []time.Weekday
+	// ByMonthDay lists the days of a monthly rule, -1 being the last. Days
+	// past the end of a short month fall on its last day rather than being
+	// skipped. The start's day if empty.
+	ByMonthDay []int
+	// Count limits the number of occurrences. Next does not apply it; the
+	// caller counts the occurrences it has used.
+	Count int
+	Until *time.Time
+}
+
+// ParseRule parses a rule, with or without its "RRULE:" prefix
+func ParseRule(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	rule := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: %q is not KEY=VALUE", ErrInvalidRule, part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s given twice", ErrInvalidRule, key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+				rule.Freq = value
+			default:
+				return nil, fmt.Errorf("%w: FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY", ErrInvalidRule)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxInterval {
+				return nil, fmt.Errorf("%w: INTERVAL must be between 1 and %d", ErrInvalidRule, maxInterval)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxCount {
+				return nil, fmt.Errorf("%w: COUNT must be between 1 and %d", ErrInvalidRule, maxCount)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("%w: BYDAY takes MO, TU, WE, TH, FR, SA or SU", ErrInvalidRule)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -1 || n > 31 {
+					return nil, fmt.Errorf("%w: BYMONTHDAY takes days 1 to 31 or -1", ErrInvalidRule)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s is not supported", ErrInvalidRule, key)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	case rule.Count > 0 && rule.Until != nil:
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot both be given", ErrInvalidRule)
+	case len(rule.ByDay) > 0 && rule.Freq != FreqWeekly:
+		return nil, fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrInvalidRule)
+	case len(rule.ByMonthDay) > 0 && rule.Freq != FreqMonthly:
+		return nil, fmt.Errorf("%w: BYMONTHDAY is only supported with FREQ=MONTHLY", ErrInvalidRule)
+	}
+	return rule, nil
+}
+
+// parseUntil accepts a local date or a UTC date-time
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, utils.LocalZone); err == nil {
+		// A bare date includes the whole local day
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ", ErrInvalidRule)
+}
+
+// String returns the rule in canonical form
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the rule's first occurrence after after, in UTC, for a
+// schedule starting at start. It reports false once the rule's UNTIL has
+// passed.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	start, after = start.In(utils.LocalZone), after.In(utils.LocalZone)
+	period := r.periodNear(start, after)
+	for i := 0; i < maxPeriods; i, period = i+1, period+r.Interval {
+		for _, t := range r.occurrences(start, period) {
+			if t.Before(start) || !t.After(after) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return time.Time{}, false
+			}
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// periodNear returns the last period of the rule, counted in days, weeks,
+// months or years from the start, that begins before after
+func (r *Rule) periodNear(start, after time.Time) int {
+	if !after.After(start) {
+		return 0
+	}
+	var n int
+	switch r.Freq {
+	case FreqDaily:
+		n = int(after.Sub(start).Hours() / 24)
+	case FreqWeekly:
+		n = int(after.Sub(start).Hours() / (24 * 7))
+	case FreqMonthly:
+		n = (after.Year()-start.Year())*12 + int(after.Month()-start.Month())
+	case FreqYearly:
+		n = after.Year() - start.Year()
+	}
+	// Step back a period so occurrences early in after's period are not missed
+	n = n/r.Interval*r.Interval - r.Interval
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// occurrences lists, in order, the occurrences in the period'th day, week,
+// month or year from the start, in the start's location
+func (r *Rule) occurrences(start time.Time, period int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+	year, month, day := start.Date()
+
+	var times []time.Time
+	switch r.Freq {
+	case FreqDaily:
+		times = append(times, at(year, month, day+period))
+	case FreqWeekly:
+		monday := day - (int(start.Weekday())+6)%7 + period*7
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		for _, wd := range days {
+			times = append(times, at(year, month, monday+(int(wd)+6)%7))
+		}
+	case FreqMonthly:
+		first := time.Date(year, month+time.Month(period), 1, 0, 0, 0, 0, time.UTC)
+		last := daysIn(first.Year(), first.Month())
+		days := r.ByMonthDay
+		if len(days) == 0 {
+			days = []int{day}
+		}
+		for _, d := range days {
+			if d == -1 || d > last {
+				d = last
+			}
+			times = append(times, at(first.Year(), first.Month(), d))
+		}
+	case FreqYearly:
+		d := day
+		if last := daysIn(year+period, month); d > last {
+			d = last
+		}
+		times = append(times, at(year+period, month, d))
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
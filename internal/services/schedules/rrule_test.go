@@ -0,0 +1,183 @@
+package schedules
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+func eat(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, utils.LocalZone)
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		want    string // canonical form, empty when the rule is invalid
+		wantErr bool
+	}{
+		{name: "prefix and lower case", rule: "rrule:freq=weekly;byday=fr;interval=2", want: "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR"},
+		{name: "last day of the month", rule: "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12", want: "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12"},
+		{name: "bare until date is the end of the local day", rule: "FREQ=DAILY;UNTIL=20240503", want: "FREQ=DAILY;UNTIL=20240503T205959Z"},
+		{name: "until date-time", rule: "FREQ=DAILY;UNTIL=20240503T120000Z", want: "FREQ=DAILY;UNTIL=20240503T120000Z"},
+		{name: "missing freq", rule: "INTERVAL=2", wantErr: true},
+		{name: "hourly", rule: "FREQ=HOURLY", wantErr: true},
+		{name: "count and until", rule: "FREQ=DAILY;COUNT=2;UNTIL=20240101", wantErr: true},
+		{name: "byday on a monthly rule", rule: "FREQ=MONTHLY;BYDAY=MO", wantErr: true},
+		{name: "month day zero", rule: "FREQ=MONTHLY;BYMONTHDAY=0", wantErr: true},
+		{name: "key given twice", rule: "FREQ=DAILY;FREQ=WEEKLY", wantErr: true},
+		{name: "interval too large", rule: "FREQ=DAILY;INTERVAL=367", wantErr: true},
+		{name: "unsupported key", rule: "FREQ=DAILY;BYHOUR=9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Fatalf("got error %v, want ErrInvalidRule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule: %v", err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		// after is where the search begins; the start if zero
+		after time.Time
+		// want are the successive occurrences in local time
+		want []time.Time
+		// done is set when the rule has no occurrence after the last wanted
+		done bool
+	}{
+		{
+			name:  "month end clamps to short months",
+			rule:  "FREQ=MONTHLY",
+			start: eat(2024, time.January, 31, 9, 0),
+			want: []time.Time{eat(2024, time.February, 29, 9, 0), eat(2024, time.March, 31, 9, 0),
+				eat(2024, time.April, 30, 9, 0)},
+		},
+		{
+			name:  "last day of the month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: eat(2023, time.December, 31, 18, 0),
+			want:  []time.Time{eat(2024, time.January, 31, 18, 0), eat(2024, time.February, 29, 18, 0)},
+		},
+		{
+			name:  "several month days in order",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=30,15",
+			start: eat(2024, time.January, 10, 8, 0),
+			want: []time.Time{eat(2024, time.January, 15, 8, 0), eat(2024, time.January, 30, 8, 0),
+				eat(2024, time.February, 15, 8, 0), eat(2024, time.February, 29, 8, 0)},
+		},
+		{
+			name:  "monthly interval from long after the start",
+			rule:  "FREQ=MONTHLY;INTERVAL=3",
+			start: eat(2024, time.January, 15, 10, 0),
+			after: eat(2025, time.February, 20, 0, 0),
+			want:  []time.Time{eat(2025, time.April, 15, 10, 0), eat(2025, time.July, 15, 10, 0)},
+		},
+		{
+			name:  "monthly interval just after an occurrence",
+			rule:  "FREQ=MONTHLY;INTERVAL=2",
+			start: eat(2024, time.January, 1, 10, 0),
+			after: eat(2024, time.May, 1, 10, 0),
+			want:  []time.Time{eat(2024, time.July, 1, 10, 0)},
+		},
+		{
+			name:  "daily interval from long after the start",
+			rule:  "FREQ=DAILY;INTERVAL=3",
+			start: eat(2024, time.May, 1, 7, 30),
+			after: eat(2024, time.May, 20, 12, 0),
+			want:  []time.Time{eat(2024, time.May, 22, 7, 30), eat(2024, time.May, 25, 7, 30)},
+		},
+		{
+			name:  "weekly week starting before the start",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			start: eat(2024, time.May, 1, 12, 0), // a Wednesday
+			want: []time.Time{eat(2024, time.May, 3, 12, 0), eat(2024, time.May, 13, 12, 0),
+				eat(2024, time.May, 17, 12, 0)},
+		},
+		{
+			name:  "weekly on the start's weekday",
+			rule:  "FREQ=WEEKLY",
+			start: eat(2024, time.May, 5, 20, 0), // a Sunday
+			want:  []time.Time{eat(2024, time.May, 12, 20, 0), eat(2024, time.May, 19, 20, 0)},
+		},
+		{
+			name:  "early morning weekday is a local one",
+			rule:  "FREQ=WEEKLY;BYDAY=FR",
+			start: eat(2024, time.May, 3, 2, 0), // a Friday, Thursday in UTC
+			want:  []time.Time{eat(2024, time.May, 10, 2, 0), eat(2024, time.May, 17, 2, 0)},
+		},
+		{
+			name:  "early morning month day is a local one",
+			rule:  "FREQ=MONTHLY",
+			start: eat(2024, time.May, 1, 1, 0), // 30 April in UTC
+			want:  []time.Time{eat(2024, time.June, 1, 1, 0), eat(2024, time.July, 1, 1, 0)},
+		},
+		{
+			name:  "leap day in other years",
+			rule:  "FREQ=YEARLY",
+			start: eat(2024, time.February, 29, 9, 0),
+			want:  []time.Time{eat(2025, time.February, 28, 9, 0), eat(2026, time.February, 28, 9, 0)},
+		},
+		{
+			name:  "bare until date includes its whole day",
+			rule:  "FREQ=DAILY;UNTIL=20240503",
+			start: eat(2024, time.May, 1, 23, 0),
+			want:  []time.Time{eat(2024, time.May, 2, 23, 0), eat(2024, time.May, 3, 23, 0)},
+			done:  true,
+		},
+		{
+			name:  "until date-time",
+			rule:  "FREQ=WEEKLY;UNTIL=20240515T000000Z",
+			start: eat(2024, time.May, 1, 9, 0),
+			want:  []time.Time{eat(2024, time.May, 8, 9, 0)},
+			done:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRule: %v", err)
+			}
+			after := tt.after
+			if after.IsZero() {
+				after = tt.start
+			}
+			for i, want := range tt.want {
+				got, ok := rule.Next(tt.start, after)
+				if !ok {
+					t.Fatalf("occurrence %d: none, want %s", i, want)
+				}
+				if !got.Equal(want) {
+					t.Fatalf("occurrence %d: got %s, want %s", i, got.In(utils.LocalZone), want)
+				}
+				if got.Location() != time.UTC {
+					t.Errorf("occurrence %d: location %s, want UTC", i, got.Location())
+				}
+				after = got
+			}
+			if got, ok := rule.Next(tt.start, after); ok == tt.done {
+				t.Errorf("after the last wanted occurrence: got %s, %v; want done = %v", got.In(utils.LocalZone), ok, tt.done)
+			}
+		})
+	}
+}
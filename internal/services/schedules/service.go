@@ -0,0 +1,677 @@
+package schedules
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/limits"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	// referencePrefix marks the transfers a schedule runs
+	referencePrefix = "scheduled_transfer:"
+
+	// codeTTL is how long the sender has to confirm a new schedule
+	codeTTL         = 10 * time.Minute
+	maxCodeAttempts = 5
+
+	// maxLeadTime is how far ahead a schedule may start
+	maxLeadTime = 366 * 24 * time.Hour
+
+	// The sender is reminded a day before each run, unless the run is less
+	// than an hour away by the time the reminder would go
+	reminderLead    = 24 * time.Hour
+	minReminderLead = time.Hour
+
+	// A run the wallet could not cover is retried every few hours, up to
+	// maxRetries times, before the occurrence is skipped
+	retryInterval = 4 * time.Hour
+	maxRetries    = 3
+
+	workerInterval = 5 * time.Minute
+	batchSize      = 100
+)
+
+var (
+	ErrScheduleNotFound = errors.New("scheduled transfer not found")
+	ErrInvalidStart     = errors.New("start must be in the future and within a year")
+	ErrNoOccurrences    = errors.New("the recurrence rule has no occurrences after the start")
+	ErrNotAwaitingCode  = errors.New("scheduled transfer is not awaiting confirmation")
+	ErrNotActive        = errors.New("scheduled transfer is not active")
+	ErrNotPaused        = errors.New("scheduled transfer is not paused")
+	ErrFinished         = errors.New("scheduled transfer has already finished")
+)
+
+// CreateInput describes a new scheduled transfer
+type CreateInput struct {
+	RecipientPhone      string
+	Amount              float64
+	Currency            string // defaults to the sender's preferred currency
+	Description         string
+	StartAt             time.Time // the first run, whether or not the rule would produce it
+	Recurrence          string    // an RRULE; empty for a one-time transfer
+	OnInsufficientFunds string    // defaults to models.InsufficientFundsRetry
+}
+
+// Service keeps users' scheduled transfers and runs them as they fall due.
+// A schedule is authorised once, with a code sent to the sender, and each
+// run is then executed as a transfer without asking again. The service is
+// the transfers' hook that moves the schedule on to its next occurrence in
+// the transaction that pays the current one.
+type Service struct {
+	db        *gorm.DB
+	transfers *transfers.Service
+	limits    *limits.Policy
+	whatsapp  *whatsapp.WhatsAppProvider
+}
+
+func NewService(db *gorm.DB, transferService *transfers.Service, policy *limits.Policy, whatsapp *whatsapp.WhatsAppProvider) *Service {
+	return &Service{db: db, transfers: transferService, limits: policy, whatsapp: whatsapp}
+}
+
+// Create stores a schedule awaiting confirmation and sends the sender the
+// code to confirm it
+func (s *Service) Create(userID uuid.UUID, in CreateInput) (*models.ScheduledTransfer, error) {
+	amount := utils.RoundMoney(in.Amount)
+	if amount <= 0 || math.Abs(in.Amount-amount) > 1e-9 {
+		return nil, transfers.ErrInvalidAmount
+	}
+	now := time.Now()
+	start := in.StartAt.UTC().Truncate(time.Second)
+	if !start.After(now) || start.After(now.Add(maxLeadTime)) {
+		return nil, ErrInvalidStart
+	}
+	policy := in.OnInsufficientFunds
+	if policy == "" {
+		policy = models.InsufficientFundsRetry
+	}
+
+	recurrence := ""
+	if strings.TrimSpace(in.Recurrence) != "" {
+		rule, err := ParseRule(in.Recurrence)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Until != nil && rule.Until.Before(start) {
+			return nil, ErrNoOccurrences
+		}
+		recurrence = rule.String()
+	}
+
+	var sender models.User
+	if err := s.db.First(&sender, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	var recipient models.User
+	err := s.db.Scopes(models.UnsuspendedUsers(time.Now())).
+		Where("phone = ?", strings.TrimSpace(in.RecipientPhone)).First(&recipient).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, transfers.ErrRecipientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if recipient.ID == sender.ID {
+		return nil, transfers.ErrSelfTransfer
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(in.Currency))
+	if currency == "" {
+		currency = strings.ToUpper(sender.PreferredCurrency)
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return nil, err
+	}
+	expires := now.Add(codeTTL)
+	schedule := models.ScheduledTransfer{
+		UserID:              sender.ID,
+		RecipientID:         recipient.ID,
+		Amount:              amount,
+		Currency:            currency,
+		Description:         strings.TrimSpace(in.Description),
+		StartAt:             start,
+		Recurrence:          recurrence,
+		OnInsufficientFunds: policy,
+		Status:              models.ScheduledTransferPendingConfirmation,
+		NextRunAt:           &start,
+		OTPHash:             utils.HashOTP(code),
+		OTPExpiresAt:        &expires,
+	}
+	if err := s.db.Create(&schedule).Error; err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("KaafiPay: Your code to schedule %s to %s is %s. It expires in %d minutes. Never share this code.",
+		describe(&schedule), recipient.Name, code, int(codeTTL.Minutes()))
+	if err := s.whatsapp.SendMessage(sender.Phone, message); err != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to send code for schedule %s: %v", schedule.ID, err)
+		s.transition(&schedule, []string{models.ScheduledTransferPendingConfirmation}, models.ScheduledTransferCancelled, nil)
+		return &schedule, transfers.ErrCodeNotSent
+	}
+	log.Printf("[SCHEDULED-TRANSFER] Created schedule %s of %.2f %s from %s to %s (%q)",
+		schedule.ID, amount, currency, sender.ID, recipient.ID, recurrence)
+
+	schedule.Recipient = &models.User{ID: recipient.ID, Name: recipient.Name, Phone: recipient.Phone}
+	return &schedule, nil
+}
+
+// Confirm activates a new schedule with the code sent to the sender
+func (s *Service) Confirm(userID, scheduleID uuid.UUID, code string) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status != models.ScheduledTransferPendingConfirmation {
+		return schedule, ErrNotAwaitingCode
+	}
+	pending := []string{models.ScheduledTransferPendingConfirmation}
+	if schedule.OTPExpiresAt == nil || time.Now().After(*schedule.OTPExpiresAt) {
+		s.transition(schedule, pending, models.ScheduledTransferCancelled, map[string]interface{}{"otp_hash": nil})
+		return schedule, transfers.ErrCodeExpired
+	}
+	attempts, ok, err := utils.ClaimOTPAttempt(s.db, models.ScheduledTransfer{}.TableName(), schedule.ID,
+		models.ScheduledTransferPendingConfirmation, maxCodeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Out of attempts, or confirmed or cancelled by a parallel request
+		if !s.transition(schedule, pending, models.ScheduledTransferCancelled, map[string]interface{}{"otp_hash": nil}) {
+			return schedule, ErrNotAwaitingCode
+		}
+		return schedule, transfers.ErrTooManyAttempts
+	}
+	schedule.OTPAttempts = attempts
+	if !utils.CheckOTP(code, schedule.OTPHash) {
+		if attempts >= maxCodeAttempts {
+			s.transition(schedule, pending, models.ScheduledTransferCancelled, map[string]interface{}{"otp_hash": nil})
+			return schedule, transfers.ErrTooManyAttempts
+		}
+		return schedule, transfers.ErrInvalidCode
+	}
+
+	now := time.Now()
+	if !s.transition(schedule, pending, models.ScheduledTransferActive, map[string]interface{}{
+		"otp_hash":     nil,
+		"confirmed_at": now,
+	}) {
+		return schedule, ErrNotAwaitingCode
+	}
+	schedule.ConfirmedAt = &now
+	log.Printf("[SCHEDULED-TRANSFER] Schedule %s confirmed", schedule.ID)
+	return schedule, nil
+}
+
+// List returns the user's schedules, newest first, optionally filtered by
+// status
+func (s *Service) List(userID uuid.UUID, status string) ([]models.ScheduledTransfer, error) {
+	schedules := []models.ScheduledTransfer{}
+	query := s.db.Preload("Recipient", models.PublicUser).Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC").Find(&schedules).Error
+	return schedules, err
+}
+
+// Get returns one of the user's schedules
+func (s *Service) Get(userID, scheduleID uuid.UUID) (*models.ScheduledTransfer, error) {
+	var schedule models.ScheduledTransfer
+	err := s.db.Preload("Recipient", models.PublicUser).
+		Where("id = ? AND user_id = ?", scheduleID, userID).
+		First(&schedule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// Pause stops an active schedule running until it is resumed
+func (s *Service) Pause(userID, scheduleID uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.transition(schedule, []string{models.ScheduledTransferActive}, models.ScheduledTransferPaused, nil) {
+		return schedule, ErrNotActive
+	}
+	return schedule, nil
+}
+
+// Resume restarts a paused schedule. Occurrences that fell due while it was
+// paused are skipped, not made up.
+func (s *Service) Resume(userID, scheduleID uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status != models.ScheduledTransferPaused {
+		return schedule, ErrNotPaused
+	}
+
+	updates := map[string]interface{}{"retry_attempts": 0, "retry_at": nil}
+	status := models.ScheduledTransferActive
+	now := time.Now()
+	next, occurrences := schedule.NextRunAt, schedule.Occurrences
+	for next != nil && !next.After(now) {
+		occurrences++
+		next = following(schedule, *next, occurrences)
+	}
+	if next == nil {
+		status = models.ScheduledTransferCompleted
+	}
+	updates["next_run_at"] = next
+	updates["occurrences"] = occurrences
+	if !s.transition(schedule, []string{models.ScheduledTransferPaused}, status, updates) {
+		return schedule, ErrNotPaused
+	}
+	schedule.NextRunAt, schedule.Occurrences = next, occurrences
+	schedule.RetryAttempts, schedule.RetryAt = 0, nil
+	return schedule, nil
+}
+
+// Skip passes over the schedule's next occurrence. Skipping a one-time
+// transfer or a schedule's last occurrence finishes the schedule.
+func (s *Service) Skip(userID, scheduleID uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status != models.ScheduledTransferActive && schedule.Status != models.ScheduledTransferPaused {
+		return schedule, ErrNotActive
+	}
+	if !s.advance(schedule, "skipped by the sender") {
+		return schedule, ErrNotActive
+	}
+	log.Printf("[SCHEDULED-TRANSFER] Schedule %s skipped an occurrence", schedule.ID)
+	return schedule, nil
+}
+
+// Cancel stops a schedule for good
+func (s *Service) Cancel(userID, scheduleID uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.transition(schedule, []string{
+		models.ScheduledTransferPendingConfirmation,
+		models.ScheduledTransferActive,
+		models.ScheduledTransferPaused,
+	}, models.ScheduledTransferCancelled, map[string]interface{}{
+		"next_run_at": nil,
+		"retry_at":    nil,
+		"otp_hash":    nil,
+	}) {
+		return schedule, ErrFinished
+	}
+	schedule.NextRunAt, schedule.RetryAt = nil, nil
+	return schedule, nil
+}
+
+// TransferCompleting moves the schedule a transfer runs on to its next
+// occurrence. It rejects the transfer unless the schedule is still active
+// and the occurrence is still the one due, so an occurrence is only ever
+// paid once.
+func (s *Service) TransferCompleting(tx *gorm.DB, transfer *models.Transfer) error {
+	if transfer.ReferenceID == nil || !strings.HasPrefix(*transfer.ReferenceID, referencePrefix) {
+		return nil
+	}
+	scheduleID, occurrence, ok := parseReference(*transfer.ReferenceID)
+	if !ok {
+		return nil
+	}
+
+	var schedule models.ScheduledTransfer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ? AND next_run_at = ?", scheduleID, models.ScheduledTransferActive, occurrence).
+		Where("user_id = ? AND recipient_id = ? AND amount = ? AND currency = ?",
+			transfer.SenderID, transfer.ReceiverID, transfer.Amount, transfer.Currency).
+		First(&schedule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: the scheduled transfer is no longer due", transfers.ErrRejected)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	next := following(&schedule, occurrence, schedule.Occurrences+1)
+	updates := map[string]interface{}{
+		"next_run_at":         next,
+		"occurrences":         gorm.Expr("occurrences + 1"),
+		"retry_attempts":      0,
+		"retry_at":            nil,
+		"last_run_at":         now,
+		"last_transfer_id":    transfer.ID,
+		"last_failure_reason": "",
+	}
+	if next == nil {
+		updates["status"] = models.ScheduledTransferCompleted
+	}
+	if err := tx.Model(&models.ScheduledTransfer{}).Where("id = ?", schedule.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	log.Printf("[SCHEDULED-TRANSFER] Schedule %s ran as transfer %s", schedule.ID, transfer.ID)
+	return nil
+}
+
+// Start runs due schedules and sends reminders now and then every few
+// minutes
+func (s *Service) Start() {
+	go func() {
+		for {
+			s.sendReminders()
+			s.runDue()
+			time.Sleep(workerInterval)
+		}
+	}()
+}
+
+// sendReminders tells senders about runs coming up in the next day, and
+// warns them if their wallet does not yet cover the amount
+func (s *Service) sendReminders() {
+	now := time.Now()
+	var due []models.ScheduledTransfer
+	if err := s.db.Preload("Recipient", models.PublicUser).
+		Where("status = ? AND retry_at IS NULL AND next_run_at BETWEEN ? AND ?",
+			models.ScheduledTransferActive, now.Add(minReminderLead), now.Add(reminderLead)).
+		Where("reminded_for IS NULL OR reminded_for <> next_run_at").
+		Limit(batchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to load schedules due a reminder: %v", err)
+		return
+	}
+
+	for i := range due {
+		schedule := &due[i]
+		message := fmt.Sprintf("KaafiPay: Reminder: %s will be sent to %s on %s.",
+			describe(schedule), recipientName(schedule), schedule.NextRunAt.In(utils.LocalZone).Format("2 Jan 2006 at 15:04"))
+		var wallet models.Wallet
+		err := s.db.Where("user_id = ? AND currency = ?", schedule.UserID, schedule.Currency).First(&wallet).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && wallet.Balance < schedule.Amount) {
+			message += fmt.Sprintf(" Your wallet balance is %.2f %s, so please top up before then.", wallet.Balance, schedule.Currency)
+		}
+		message += " You can skip or pause it in the app."
+		s.send(schedule.UserID, message)
+
+		if err := s.db.Model(&models.ScheduledTransfer{}).Where("id = ?", schedule.ID).
+			Update("reminded_for", schedule.NextRunAt).Error; err != nil {
+			log.Printf("[SCHEDULED-TRANSFER] Failed to record reminder for schedule %s: %v", schedule.ID, err)
+		}
+	}
+}
+
+// runDue runs the schedules whose occurrence or retry has come
+func (s *Service) runDue() {
+	var due []models.ScheduledTransfer
+	if err := s.db.Preload("Recipient", models.PublicUser).
+		Where("status = ? AND COALESCE(retry_at, next_run_at) <= ?", models.ScheduledTransferActive, time.Now()).
+		Order("COALESCE(retry_at, next_run_at) ASC").
+		Limit(batchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to load due schedules: %v", err)
+		return
+	}
+	for i := range due {
+		s.run(&due[i])
+	}
+}
+
+// run pays the schedule's current occurrence. A wallet that cannot cover
+// it, a payment over the sender's limits, or a frozen wallet or suspended
+// sender gets the schedule's insufficient-funds treatment; a recipient who
+// can no longer be paid skips the occurrence. Other errors leave the
+// schedule to be tried again on the next pass.
+func (s *Service) run(schedule *models.ScheduledTransfer) {
+	occurrence := *schedule.NextRunAt
+	var transfer *models.Transfer
+	err := s.limits.Check(schedule.UserID, schedule.Amount, schedule.Currency)
+	if err == nil {
+		transfer, err = s.transfers.Execute(transfers.Request{
+			SenderID:    schedule.UserID,
+			RecipientID: schedule.RecipientID,
+			Amount:      schedule.Amount,
+			Currency:    schedule.Currency,
+			Description: schedule.Description,
+			ReferenceID: reference(schedule.ID, occurrence),
+		})
+	}
+	var limitErr *limits.LimitError
+	switch {
+	case err == nil:
+		// The transfer has told both parties it went through
+		if transfer.Status == models.TransferStatusCompleted {
+			s.notifyIfFinished(schedule)
+		}
+	case errors.Is(err, repository.ErrInsufficientFunds), errors.Is(err, repository.ErrWalletInactive),
+		errors.Is(err, transfers.ErrSenderSuspended), errors.As(err, &limitErr):
+		reason := "insufficient funds"
+		switch {
+		case errors.Is(err, repository.ErrWalletInactive):
+			reason = "your wallet is frozen or closed"
+		case errors.Is(err, transfers.ErrSenderSuspended):
+			reason = "your account is suspended"
+		case limitErr != nil:
+			reason = fmt.Sprintf("it would take you over your %s limit of %.2f %s",
+				limitErr.Period, limitErr.Limit, limitErr.Currency)
+		}
+		if schedule.OnInsufficientFunds == models.InsufficientFundsRetry && schedule.RetryAttempts < maxRetries {
+			s.retry(schedule, occurrence, reason)
+			return
+		}
+		s.skipFailed(schedule, reason)
+	case errors.Is(err, transfers.ErrRecipientNotFound), errors.Is(err, repository.ErrCurrencyMismatch):
+		s.skipFailed(schedule, "the recipient can no longer be paid")
+	case errors.Is(err, limits.ErrUnsupportedCurrency):
+		s.skipFailed(schedule, "transfers in "+schedule.Currency+" are not supported")
+	case errors.Is(err, transfers.ErrRejected):
+		// Paused, cancelled or already paid since it was loaded
+		log.Printf("[SCHEDULED-TRANSFER] Run of schedule %s rejected: %v", schedule.ID, err)
+	default:
+		log.Printf("[SCHEDULED-TRANSFER] Run of schedule %s failed: %v", schedule.ID, err)
+	}
+}
+
+// retry puts the current occurrence off for a while
+func (s *Service) retry(schedule *models.ScheduledTransfer, occurrence time.Time, reason string) {
+	retryAt := time.Now().Add(retryInterval)
+	result := s.db.Model(&models.ScheduledTransfer{}).
+		Where("id = ? AND status = ? AND next_run_at = ?", schedule.ID, models.ScheduledTransferActive, occurrence).
+		Updates(map[string]interface{}{
+			"retry_attempts":      gorm.Expr("retry_attempts + 1"),
+			"retry_at":            retryAt,
+			"last_failure_reason": reason,
+		})
+	if result.Error != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to schedule a retry of %s: %v", schedule.ID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	log.Printf("[SCHEDULED-TRANSFER] Schedule %s will retry at %s: %s", schedule.ID, retryAt.Format(time.RFC3339), reason)
+	s.send(schedule.UserID, fmt.Sprintf("KaafiPay: We couldn't send %s to %s: %s. We'll try again at %s.",
+		describe(schedule), recipientName(schedule), reason, retryAt.In(utils.LocalZone).Format("15:04 on 2 Jan")))
+}
+
+// skipFailed gives up on the current occurrence and tells the sender
+func (s *Service) skipFailed(schedule *models.ScheduledTransfer, reason string) {
+	if !s.advance(schedule, reason) {
+		return
+	}
+	log.Printf("[SCHEDULED-TRANSFER] Schedule %s skipped an occurrence: %s", schedule.ID, reason)
+	message := fmt.Sprintf("KaafiPay: We couldn't send %s to %s: %s, so this payment was skipped.",
+		describe(schedule), recipientName(schedule), reason)
+	if schedule.NextRunAt != nil {
+		message += fmt.Sprintf(" The next one is on %s.", schedule.NextRunAt.In(utils.LocalZone).Format("2 Jan 2006"))
+	}
+	s.send(schedule.UserID, message)
+}
+
+// advance moves the schedule past its current occurrence without paying it,
+// finishing the schedule if it has no more, and reports whether the
+// occurrence was still current
+func (s *Service) advance(schedule *models.ScheduledTransfer, reason string) bool {
+	if schedule.NextRunAt == nil {
+		return false
+	}
+	occurrence := *schedule.NextRunAt
+	next := following(schedule, occurrence, schedule.Occurrences+1)
+	updates := map[string]interface{}{
+		"next_run_at":         next,
+		"occurrences":         gorm.Expr("occurrences + 1"),
+		"retry_attempts":      0,
+		"retry_at":            nil,
+		"last_failure_reason": reason,
+	}
+	if next == nil {
+		updates["status"] = models.ScheduledTransferCompleted
+	}
+	result := s.db.Model(&models.ScheduledTransfer{}).
+		Where("id = ? AND status = ? AND next_run_at = ?", schedule.ID, schedule.Status, occurrence).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to advance schedule %s: %v", schedule.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	schedule.NextRunAt = next
+	schedule.Occurrences++
+	schedule.RetryAttempts, schedule.RetryAt = 0, nil
+	schedule.LastFailureReason = reason
+	if next == nil {
+		schedule.Status = models.ScheduledTransferCompleted
+	}
+	return true
+}
+
+// notifyIfFinished tells the sender when a recurring schedule has made its
+// last run
+func (s *Service) notifyIfFinished(schedule *models.ScheduledTransfer) {
+	if schedule.Recurrence == "" {
+		return
+	}
+	var current models.ScheduledTransfer
+	if err := s.db.Select("id", "status").First(&current, "id = ?", schedule.ID).Error; err != nil {
+		return
+	}
+	if current.Status == models.ScheduledTransferCompleted {
+		s.send(schedule.UserID, fmt.Sprintf("KaafiPay: That was the last scheduled payment of %s to %s.",
+			describe(schedule), recipientName(schedule)))
+	}
+}
+
+// transition moves the schedule from one of the from statuses to status and
+// reports whether it was still in one of them
+func (s *Service) transition(schedule *models.ScheduledTransfer, from []string, status string, updates map[string]interface{}) bool {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = status
+	result := s.db.Model(&models.ScheduledTransfer{}).
+		Where("id = ? AND status IN ?", schedule.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to mark schedule %s %s: %v", schedule.ID, status, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	schedule.Status = status
+	return true
+}
+
+// send messages the user on WhatsApp
+func (s *Service) send(userID uuid.UUID, message string) {
+	var user models.User
+	if err := s.db.Select("id", "phone").First(&user, "id = ?", userID).Error; err != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to load user %s: %v", userID, err)
+		return
+	}
+	if err := s.whatsapp.SendMessage(user.Phone, message); err != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Failed to message %s: %v", user.Phone, err)
+	}
+}
+
+// following returns the occurrence after the given one for a schedule that
+// has used done occurrences, or nil when the schedule has run its course
+func following(schedule *models.ScheduledTransfer, occurrence time.Time, done int) *time.Time {
+	if schedule.Recurrence == "" {
+		return nil
+	}
+	rule, err := ParseRule(schedule.Recurrence)
+	if err != nil {
+		log.Printf("[SCHEDULED-TRANSFER] Schedule %s has an invalid rule %q: %v", schedule.ID, schedule.Recurrence, err)
+		return nil
+	}
+	if rule.Count > 0 && done >= rule.Count {
+		return nil
+	}
+	next, ok := rule.Next(schedule.StartAt, occurrence)
+	if !ok {
+		return nil
+	}
+	return &next
+}
+
+// reference names the transfer that pays an occurrence
+func reference(scheduleID uuid.UUID, occurrence time.Time) string {
+	return referencePrefix + scheduleID.String() + ":" + strconv.FormatInt(occurrence.Unix(), 10)
+}
+
+func parseReference(ref string) (uuid.UUID, time.Time, bool) {
+	id, unix, ok := strings.Cut(strings.TrimPrefix(ref, referencePrefix), ":")
+	if !ok {
+		return uuid.Nil, time.Time{}, false
+	}
+	scheduleID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return uuid.Nil, time.Time{}, false
+	}
+	return scheduleID, time.Unix(seconds, 0).UTC(), true
+}
+
+// describe names the schedule's payment in messages
+func describe(schedule *models.ScheduledTransfer) string {
+	text := fmt.Sprintf("%.2f %s", schedule.Amount, schedule.Currency)
+	if schedule.Description != "" {
+		text += " for \"" + schedule.Description + "\""
+	}
+	return text
+}
+
+func recipientName(schedule *models.ScheduledTransfer) string {
+	if schedule.Recipient != nil {
+		return schedule.Recipient.Name
+	}
+	return "the recipient"
+}
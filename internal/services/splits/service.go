@@ -0,0 +1,598 @@
+package splits
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/transfers"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	// referencePrefix marks the transfers that settle a share
+	referencePrefix = "bill_split_share:"
+
+	maxParticipants = 50
+	// reminderGap stops the creator nagging more than twice a day
+	reminderGap = 12 * time.Hour
+)
+
+var (
+	ErrSplitNotFound       = errors.New("bill split not found")
+	ErrShareNotFound       = errors.New("share not found")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrAlreadySplit        = errors.New("this transaction has already been split")
+	ErrNotOpen             = errors.New("bill split is no longer open")
+	ErrNotOwed             = errors.New("share is no longer owed")
+	ErrNotYourShare        = errors.New("only the participant who owes this share can pay it")
+	ErrRemindTooSoon       = errors.New("everyone who still owes was reminded recently")
+)
+
+// CreateInput describes a bill to split. The bill is either one of the
+// creator's transactions or an amount entered by hand.
+type CreateInput struct {
+	TransactionID  *uuid.UUID
+	Amount         float64
+	Currency       string // defaults to the creator's preferred currency
+	Description    string // defaults to the transaction's merchant or description
+	Method         string
+	IncludeCreator bool // whether the creator takes a share of an equal split
+	Participants   []Participant
+}
+
+// Balance is what the user and one other person owe each other across
+// their open splits in one currency
+type Balance struct {
+	UserID    *uuid.UUID `json:"userId,omitempty"`
+	Phone     string     `json:"phone"`
+	Name      string     `json:"name,omitempty"`
+	Currency  string     `json:"currency"`
+	OwedToYou float64    `json:"owedToYou"`
+	YouOwe    float64    `json:"youOwe"`
+	// Net is positive when the other person owes the user
+	Net float64 `json:"net"`
+}
+
+// Service splits bills, settles shares and works out balances. Shares paid
+// from a wallet go through a transfer to the creator; the service is the
+// transfers' hook that marks the share paid in the same transaction.
+type Service struct {
+	db           *gorm.DB
+	transactions repository.TransactionRepository
+	transfers    *transfers.Service
+	whatsapp     *whatsapp.WhatsAppProvider
+}
+
+func NewService(db *gorm.DB, transactions repository.TransactionRepository, transferService *transfers.Service, whatsapp *whatsapp.WhatsAppProvider) *Service {
+	return &Service{db: db, transactions: transactions, transfers: transferService, whatsapp: whatsapp}
+}
+
+// Create splits a bill and tells each participant what they owe
+func (s *Service) Create(creatorID uuid.UUID, in CreateInput) (*models.BillSplit, error) {
+	if len(in.Participants) == 0 || len(in.Participants) > maxParticipants {
+		return nil, models.ValidationError{Field: "participants",
+			Message: fmt.Sprintf("Split with between 1 and %d people", maxParticipants)}
+	}
+
+	var creator models.User
+	if err := s.db.First(&creator, "id = ?", creatorID).Error; err != nil {
+		return nil, err
+	}
+
+	split := models.BillSplit{
+		CreatorID:   creatorID,
+		Description: strings.TrimSpace(in.Description),
+		Method:      in.Method,
+		Status:      models.BillSplitOpen,
+	}
+	if in.TransactionID != nil {
+		txn, err := s.transactions.Get(creatorID, *in.TransactionID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransactionNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if txn.TransactionType != models.TransactionTypeDebit {
+			return nil, models.ValidationError{Field: "transactionId", Message: "Only money you spent can be split"}
+		}
+		split.TransactionID = &txn.ID
+		split.TotalAmount = txn.Amount
+		split.Currency = strings.ToUpper(txn.Currency)
+		if split.Description == "" {
+			split.Description = txn.MerchantName
+		}
+		if split.Description == "" {
+			split.Description = txn.Description
+		}
+	} else {
+		amount := utils.RoundMoney(in.Amount)
+		if amount <= 0 || math.Abs(in.Amount-amount) > 1e-9 {
+			return nil, models.ValidationError{Field: "amount", Message: "Amount must be a positive number of whole cents"}
+		}
+		split.TotalAmount = amount
+		split.Currency = strings.ToUpper(strings.TrimSpace(in.Currency))
+		if split.Currency == "" {
+			split.Currency = strings.ToUpper(creator.PreferredCurrency)
+		}
+		if split.Currency == "" {
+			split.Currency = "USD"
+		}
+	}
+	if split.Description == "" {
+		return nil, models.ValidationError{Field: "description", Message: "Description is required"}
+	}
+	if runes := []rune(split.Description); len(runes) > 255 {
+		split.Description = string(runes[:255])
+	}
+
+	participants, users, err := s.resolve(&creator, in.Participants)
+	if err != nil {
+		return nil, err
+	}
+	creatorCents, cents, err := divide(in.Method, int64(math.Round(split.TotalAmount*100)), in.IncludeCreator, participants)
+	if err != nil {
+		return nil, err
+	}
+	split.CreatorShare = float64(creatorCents) / 100
+	for i, p := range participants {
+		share := models.BillSplitShare{
+			Phone:  p.Phone,
+			Name:   p.Name,
+			Amount: float64(cents[i]) / 100,
+			Status: models.BillShareOwed,
+		}
+		if user, ok := users[p.Phone]; ok {
+			share.UserID = &user.ID
+		}
+		if in.Method == models.SplitMethodPercentage {
+			percentage := p.Percentage
+			share.Percentage = &percentage
+		}
+		split.Shares = append(split.Shares, share)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if split.TransactionID != nil {
+			var existing int64
+			if err := tx.Model(&models.BillSplit{}).
+				Where("transaction_id = ? AND status <> ?", *split.TransactionID, models.BillSplitCancelled).
+				Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing > 0 {
+				return ErrAlreadySplit
+			}
+		}
+		return tx.Create(&split).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[BILL-SPLIT] User %s split %.2f %s with %d people (%s)",
+		creatorID, split.TotalAmount, split.Currency, len(split.Shares), split.Method)
+
+	split.Creator = &models.User{ID: creator.ID, Name: creator.Name, Phone: creator.Phone}
+	for _, share := range split.Shares {
+		message := fmt.Sprintf("KaafiPay: %s split \"%s\" (%.2f %s) with you. Your share is %.2f %s.",
+			creator.Name, split.Description, split.TotalAmount, split.Currency, share.Amount, split.Currency)
+		if share.UserID != nil {
+			message += " You can pay it from your wallet in the KaafiPay app."
+		} else {
+			message += fmt.Sprintf(" Pay %s directly, or join KaafiPay with this number to settle up in the app.", creator.Name)
+		}
+		go s.send(share.Phone, message)
+	}
+	return &split, nil
+}
+
+// resolve cleans up the participants' phone numbers and finds the ones
+// that belong to KaafiPay users, whose names fill in any left blank
+func (s *Service) resolve(creator *models.User, in []Participant) ([]Participant, map[string]models.User, error) {
+	participants := make([]Participant, len(in))
+	phones := make([]string, 0, len(in))
+	seen := make(map[string]bool, len(in))
+	for i, p := range in {
+		p.Phone = strings.TrimSpace(p.Phone)
+		p.Name = strings.TrimSpace(p.Name)
+		switch {
+		case p.Phone == "":
+			return nil, nil, models.ValidationError{Field: "participants", Message: "Every participant needs a phone number"}
+		case p.Phone == creator.Phone:
+			return nil, nil, models.ValidationError{Field: "participants", Message: "You cannot split a bill with yourself"}
+		case seen[p.Phone]:
+			return nil, nil, models.ValidationError{Field: "participants", Message: "Each participant can only be added once"}
+		}
+		seen[p.Phone] = true
+		participants[i] = p
+		phones = append(phones, p.Phone)
+	}
+
+	var found []models.User
+	if err := s.db.Select("id", "name", "phone").
+		Scopes(models.UnsuspendedUsers(time.Now())).
+		Where("phone IN ?", phones).
+		Find(&found).Error; err != nil {
+		return nil, nil, err
+	}
+	users := make(map[string]models.User, len(found))
+	for _, u := range found {
+		users[u.Phone] = u
+	}
+	for i := range participants {
+		if u, ok := users[participants[i].Phone]; ok && participants[i].Name == "" {
+			participants[i].Name = u.Name
+		}
+	}
+	return participants, users, nil
+}
+
+// List returns the splits the user created, or with owed set, the ones
+// they owe a share of, newest first
+func (s *Service) List(userID uuid.UUID, owed bool, status string) ([]models.BillSplit, error) {
+	splits := []models.BillSplit{}
+	query := s.withDetails(s.db)
+	if owed {
+		query = query.Where("id IN (?)", s.sharesOf(userID).Select("split_id"))
+	} else {
+		query = query.Where("creator_id = ?", userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC").Limit(100).Find(&splits).Error
+	return splits, err
+}
+
+// Get returns a split the user created or has a share in
+func (s *Service) Get(userID, splitID uuid.UUID) (*models.BillSplit, error) {
+	var split models.BillSplit
+	err := s.withDetails(s.db).
+		Where("id = ?", splitID).
+		Where("creator_id = ? OR id IN (?)", userID, s.sharesOf(userID).Select("split_id")).
+		First(&split).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSplitNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &split, nil
+}
+
+// Balances nets what the user is owed against what they owe, per person
+// and currency, across open splits. People who owe nothing either way are
+// left out.
+func (s *Service) Balances(userID uuid.UUID) ([]Balance, error) {
+	type row struct {
+		UserID   *uuid.UUID
+		Phone    string
+		Name     string
+		Currency string
+		Total    float64
+	}
+
+	var owedToMe []row
+	if err := s.db.Table("bill_split_shares AS sh").
+		Select("sh.user_id, sh.phone, MAX(COALESCE(u.name, sh.name)) AS name, bs.currency, SUM(sh.amount) AS total").
+		Joins("JOIN bill_splits bs ON bs.id = sh.split_id").
+		Joins("LEFT JOIN users u ON u.id = sh.user_id").
+		Where("bs.creator_id = ? AND bs.status = ? AND sh.status = ?", userID, models.BillSplitOpen, models.BillShareOwed).
+		Group("sh.user_id, sh.phone, bs.currency").
+		Scan(&owedToMe).Error; err != nil {
+		return nil, err
+	}
+
+	var iOwe []row
+	if err := s.db.Table("bill_split_shares AS sh").
+		Select("bs.creator_id AS user_id, u.phone, u.name, bs.currency, SUM(sh.amount) AS total").
+		Joins("JOIN bill_splits bs ON bs.id = sh.split_id").
+		Joins("JOIN users u ON u.id = bs.creator_id").
+		Where("sh.id IN (?)", s.sharesOf(userID).Select("id")).
+		Where("bs.status = ? AND sh.status = ?", models.BillSplitOpen, models.BillShareOwed).
+		Group("bs.creator_id, u.phone, u.name, bs.currency").
+		Scan(&iOwe).Error; err != nil {
+		return nil, err
+	}
+
+	balances := map[string]*Balance{}
+	entry := func(r row) *Balance {
+		key := "phone:" + r.Phone
+		if r.UserID != nil {
+			key = "user:" + r.UserID.String()
+		}
+		key += ":" + r.Currency
+		b, ok := balances[key]
+		if !ok {
+			b = &Balance{UserID: r.UserID, Phone: r.Phone, Name: r.Name, Currency: r.Currency}
+			balances[key] = b
+		}
+		return b
+	}
+	for _, r := range owedToMe {
+		entry(r).OwedToYou += r.Total
+	}
+	for _, r := range iOwe {
+		entry(r).YouOwe += r.Total
+	}
+
+	result := make([]Balance, 0, len(balances))
+	for _, b := range balances {
+		b.OwedToYou = utils.RoundMoney(b.OwedToYou)
+		b.YouOwe = utils.RoundMoney(b.YouOwe)
+		b.Net = utils.RoundMoney(b.OwedToYou - b.YouOwe)
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if math.Abs(result[i].Net) != math.Abs(result[j].Net) {
+			return math.Abs(result[i].Net) > math.Abs(result[j].Net)
+		}
+		return result[i].Phone < result[j].Phone
+	})
+	return result, nil
+}
+
+// Pay starts settling the user's share from their wallet. It returns the
+// pending transfer for the user to confirm with their code; the share is
+// paid when it completes.
+func (s *Service) Pay(userID, splitID, shareID uuid.UUID) (*models.BillSplitShare, *models.Transfer, error) {
+	split, share, err := s.share(userID, splitID, shareID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.owns(userID, share) {
+		return nil, nil, ErrNotYourShare
+	}
+	if split.Status != models.BillSplitOpen {
+		return nil, nil, ErrNotOpen
+	}
+	if share.Status != models.BillShareOwed {
+		return nil, nil, ErrNotOwed
+	}
+	if share.UserID == nil {
+		// Someone who joined with the share's number claims it
+		if err := s.db.Model(&models.BillSplitShare{}).Where("id = ? AND user_id IS NULL", share.ID).
+			Update("user_id", userID).Error; err != nil {
+			return nil, nil, err
+		}
+		share.UserID = &userID
+	}
+
+	transfer, err := s.transfers.Initiate(transfers.Request{
+		SenderID:    userID,
+		RecipientID: split.CreatorID,
+		Amount:      share.Amount,
+		Currency:    split.Currency,
+		Description: "Share of " + split.Description,
+		ReferenceID: referencePrefix + share.ID.String(),
+	})
+	return share, transfer, err
+}
+
+// MarkPaid records that the creator got a participant's share outside the
+// app
+func (s *Service) MarkPaid(creatorID, splitID, shareID uuid.UUID) (*models.BillSplitShare, error) {
+	split, share, err := s.share(creatorID, splitID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if split.CreatorID != creatorID {
+		return nil, ErrSplitNotFound
+	}
+	if split.Status != models.BillSplitOpen {
+		return nil, ErrNotOpen
+	}
+
+	now := time.Now()
+	via := models.SettledViaManual
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.BillSplitShare{}).
+			Where("id = ? AND status = ?", share.ID, models.BillShareOwed).
+			Updates(map[string]interface{}{
+				"status":      models.BillSharePaid,
+				"settled_via": via,
+				"paid_at":     now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotOwed
+		}
+		return settleIfDone(tx, split.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	share.Status = models.BillSharePaid
+	share.SettledVia = &via
+	share.PaidAt = &now
+
+	go s.send(share.Phone, fmt.Sprintf("KaafiPay: %s marked your share of \"%s\" (%.2f %s) as paid. Thank you!",
+		split.Creator.Name, split.Description, share.Amount, split.Currency))
+	return share, nil
+}
+
+// Cancel withdraws one of the creator's open splits. Shares already paid
+// stay paid.
+func (s *Service) Cancel(creatorID, splitID uuid.UUID) (*models.BillSplit, error) {
+	split, err := s.Get(creatorID, splitID)
+	if err != nil {
+		return nil, err
+	}
+	if split.CreatorID != creatorID {
+		return nil, ErrSplitNotFound
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.BillSplit{}).
+			Where("id = ? AND status = ?", split.ID, models.BillSplitOpen).
+			Update("status", models.BillSplitCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotOpen
+		}
+		return tx.Model(&models.BillSplitShare{}).
+			Where("split_id = ? AND status = ?", split.ID, models.BillShareOwed).
+			Update("status", models.BillShareCancelled).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	split.Status = models.BillSplitCancelled
+
+	for i := range split.Shares {
+		share := &split.Shares[i]
+		if share.Status != models.BillShareOwed {
+			continue
+		}
+		share.Status = models.BillShareCancelled
+		go s.send(share.Phone, fmt.Sprintf("KaafiPay: %s cancelled the split of \"%s\". You no longer owe your share of %.2f %s.",
+			split.Creator.Name, split.Description, share.Amount, split.Currency))
+	}
+	log.Printf("[BILL-SPLIT] Split %s cancelled", split.ID)
+	return split, nil
+}
+
+// Remind nudges everyone who still owes a share and was not reminded in
+// the last few hours
+func (s *Service) Remind(creatorID, splitID uuid.UUID) (*models.BillSplit, error) {
+	split, err := s.Get(creatorID, splitID)
+	if err != nil {
+		return nil, err
+	}
+	if split.CreatorID != creatorID {
+		return nil, ErrSplitNotFound
+	}
+	if split.Status != models.BillSplitOpen {
+		return nil, ErrNotOpen
+	}
+
+	now := time.Now()
+	var reminded []uuid.UUID
+	for i := range split.Shares {
+		share := &split.Shares[i]
+		if share.Status != models.BillShareOwed ||
+			(share.LastRemindedAt != nil && now.Sub(*share.LastRemindedAt) < reminderGap) {
+			continue
+		}
+		go s.send(share.Phone, fmt.Sprintf("KaafiPay: Reminder: you owe %s %.2f %s for \"%s\".",
+			split.Creator.Name, share.Amount, split.Currency, split.Description))
+		share.LastRemindedAt = &now
+		reminded = append(reminded, share.ID)
+	}
+	if len(reminded) == 0 {
+		return nil, ErrRemindTooSoon
+	}
+	if err := s.db.Model(&models.BillSplitShare{}).Where("id IN ?", reminded).
+		Update("last_reminded_at", now).Error; err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// TransferCompleting marks the share a transfer settles as paid, and the
+// split settled if it was the last one owed. It rejects the transfer if
+// the share was paid or the split cancelled since the transfer started.
+func (s *Service) TransferCompleting(tx *gorm.DB, transfer *models.Transfer) error {
+	if transfer.ReferenceID == nil || !strings.HasPrefix(*transfer.ReferenceID, referencePrefix) {
+		return nil
+	}
+	shareID, err := uuid.Parse(strings.TrimPrefix(*transfer.ReferenceID, referencePrefix))
+	if err != nil {
+		return nil
+	}
+
+	var share models.BillSplitShare
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ? AND user_id = ? AND amount = ?", shareID, models.BillShareOwed, transfer.SenderID, transfer.Amount).
+		Where("split_id IN (?)", tx.Model(&models.BillSplit{}).Select("id").
+			Where("creator_id = ? AND currency = ? AND status = ?", transfer.ReceiverID, transfer.Currency, models.BillSplitOpen)).
+		First(&share).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: the share is no longer owed", transfers.ErrRejected)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.BillSplitShare{}).Where("id = ?", share.ID).
+		Updates(map[string]interface{}{
+			"status":      models.BillSharePaid,
+			"settled_via": models.SettledViaTransfer,
+			"transfer_id": transfer.ID,
+			"paid_at":     time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+	log.Printf("[BILL-SPLIT] Share %s paid by transfer %s", share.ID, transfer.ID)
+	return settleIfDone(tx, share.SplitID)
+}
+
+// settleIfDone marks an open split settled once no share is owed
+func settleIfDone(tx *gorm.DB, splitID uuid.UUID) error {
+	return tx.Model(&models.BillSplit{}).
+		Where("id = ? AND status = ?", splitID, models.BillSplitOpen).
+		Where("NOT EXISTS (SELECT 1 FROM bill_split_shares WHERE split_id = ? AND status = ?)", splitID, models.BillShareOwed).
+		Updates(map[string]interface{}{"status": models.BillSplitSettled, "settled_at": time.Now()}).Error
+}
+
+// share loads a share of a split the user can see
+func (s *Service) share(userID, splitID, shareID uuid.UUID) (*models.BillSplit, *models.BillSplitShare, error) {
+	split, err := s.Get(userID, splitID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range split.Shares {
+		if split.Shares[i].ID == shareID {
+			return split, &split.Shares[i], nil
+		}
+	}
+	return nil, nil, ErrShareNotFound
+}
+
+// owns reports whether the share is the user's, by account or by the
+// phone number they signed up with
+func (s *Service) owns(userID uuid.UUID, share *models.BillSplitShare) bool {
+	if share.UserID != nil {
+		return *share.UserID == userID
+	}
+	var user models.User
+	if err := s.db.Select("id", "phone").First(&user, "id = ?", userID).Error; err != nil {
+		return false
+	}
+	return user.Phone == share.Phone
+}
+
+// sharesOf selects the shares held by the user, including those addressed
+// to their phone number before they joined
+func (s *Service) sharesOf(userID uuid.UUID) *gorm.DB {
+	return s.db.Model(&models.BillSplitShare{}).
+		Where("user_id = ? OR (user_id IS NULL AND phone = (?))", userID,
+			s.db.Model(&models.User{}).Select("phone").Where("id = ?", userID))
+}
+
+func (s *Service) withDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Creator", models.PublicUser).
+		Preload("Shares", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC, phone ASC") })
+}
+
+func (s *Service) send(phone, message string) {
+	if err := s.whatsapp.SendMessage(phone, message); err != nil {
+		log.Printf("[BILL-SPLIT] Failed to message %s: %v", phone, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Package splits divides bills among the people who shared them and
+// tracks who still owes whom.
+package splits
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+// Participant is someone a bill is split with
+type Participant struct {
+	Phone      string
+	Name       string
+	Percentage float64 // for percentage splits
+	Amount     float64 // for exact splits
+}
+
+// divide works out each participant's share of total, in cents, and what
+// is left for the creator. Equal splits give the odd cents to the creator
+// when they take part, otherwise to the first participants. Percentage
+// splits leave the creator whatever percentage the participants don't
+// cover; exact splits leave the creator the rest of the total.
+func divide(method string, total int64, includeCreator bool, participants []Participant) (int64, []int64, error) {
+	shares := make([]int64, len(participants))
+	var creator int64
+
+	switch method {
+	case models.SplitMethodEqual:
+		count := int64(len(participants))
+		if includeCreator {
+			count++
+		}
+		base, rest := total/count, total%count
+		if base == 0 {
+			return 0, nil, models.ValidationError{Field: "amount", Message: "Amount is too small to split this many ways"}
+		}
+		for i := range shares {
+			shares[i] = base
+		}
+		if includeCreator {
+			creator = base + rest
+		} else {
+			for i := int64(0); i < rest; i++ {
+				shares[i]++
+			}
+		}
+
+	case models.SplitMethodPercentage:
+		var percent float64
+		for i, p := range participants {
+			if p.Percentage <= 0 || p.Percentage > 100 {
+				return 0, nil, models.ValidationError{Field: "participants", Message: "Each percentage must be above 0 and at most 100"}
+			}
+			percent += p.Percentage
+			shares[i] = int64(math.Round(float64(total) * p.Percentage / 100))
+		}
+		if percent > 100+1e-9 {
+			return 0, nil, models.ValidationError{Field: "participants", Message: "Percentages add up to more than 100"}
+		}
+		creator = total - sum(shares)
+		if math.Abs(percent-100) < 1e-9 && creator != 0 {
+			// Rounding left a cent or two over; the last participant takes it
+			shares[len(shares)-1] += creator
+			creator = 0
+		}
+
+	case models.SplitMethodExact:
+		for i, p := range participants {
+			cents := math.Round(p.Amount * 100)
+			if cents <= 0 || math.Abs(p.Amount*100-cents) > 1e-6 {
+				return 0, nil, models.ValidationError{Field: "participants", Message: "Each amount must be a positive number of whole cents"}
+			}
+			shares[i] = int64(cents)
+		}
+		creator = total - sum(shares)
+		if creator < 0 {
+			return 0, nil, models.ValidationError{Field: "participants",
+				Message: fmt.Sprintf("Amounts add up to more than the total of %.2f", float64(total)/100)}
+		}
+
+	default:
+		return 0, nil, models.ValidationError{Field: "method", Message: "Method must be equal, percentage or exact"}
+	}
+
+	for _, share := range shares {
+		if share <= 0 {
+			return 0, nil, models.ValidationError{Field: "participants", Message: "Every participant's share must be at least 0.01"}
+		}
+	}
+	if creator < 0 {
+		return 0, nil, models.ValidationError{Field: "participants", Message: "Shares add up to more than the total"}
+	}
+	return creator, shares, nil
+}
+
+func sum(values []int64) int64 {
+	var total int64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -0,0 +1,160 @@
+package splits
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+func TestDivide(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		total          int64
+		includeCreator bool
+		participants   []Participant
+		wantCreator    int64
+		wantShares     []int64
+		wantErr        string // field of the expected validation error
+	}{
+		// Equal
+		{
+			name:         "equal odd cents go to the first participants",
+			method:       models.SplitMethodEqual,
+			total:        1000,
+			participants: make([]Participant, 3),
+			wantShares:   []int64{334, 333, 333},
+		},
+		{
+			name:         "equal two odd cents",
+			method:       models.SplitMethodEqual,
+			total:        1001,
+			participants: make([]Participant, 3),
+			wantShares:   []int64{334, 334, 333},
+		},
+		{
+			name:           "equal odd cents go to the creator",
+			method:         models.SplitMethodEqual,
+			total:          1000,
+			includeCreator: true,
+			participants:   make([]Participant, 2),
+			wantCreator:    334,
+			wantShares:     []int64{333, 333},
+		},
+		{
+			name:         "equal too small to split",
+			method:       models.SplitMethodEqual,
+			total:        2,
+			participants: make([]Participant, 3),
+			wantErr:      "amount",
+		},
+
+		// Percentage
+		{
+			name:         "percentage rounding moved onto the last share",
+			method:       models.SplitMethodPercentage,
+			total:        1001,
+			participants: []Participant{{Percentage: 33.33}, {Percentage: 33.33}, {Percentage: 33.34}},
+			wantShares:   []int64{334, 334, 333},
+		},
+		{
+			name:         "percentage short cent moved onto the last share",
+			method:       models.SplitMethodPercentage,
+			total:        100,
+			participants: []Participant{{Percentage: 50.5}, {Percentage: 49.5}},
+			wantShares:   []int64{51, 49},
+		},
+		{
+			name:         "percentage under 100 leaves the rest to the creator",
+			method:       models.SplitMethodPercentage,
+			total:        1000,
+			participants: []Participant{{Percentage: 25}, {Percentage: 33.5}},
+			wantCreator:  415,
+			wantShares:   []int64{250, 335},
+		},
+		{
+			name:         "percentage over 100",
+			method:       models.SplitMethodPercentage,
+			total:        1000,
+			participants: []Participant{{Percentage: 60}, {Percentage: 41}},
+			wantErr:      "participants",
+		},
+		{
+			name:         "percentage of zero",
+			method:       models.SplitMethodPercentage,
+			total:        1000,
+			participants: []Participant{{Percentage: 0}},
+			wantErr:      "participants",
+		},
+		{
+			name:         "percentage share rounding to nothing",
+			method:       models.SplitMethodPercentage,
+			total:        10,
+			participants: []Participant{{Percentage: 1}},
+			wantErr:      "participants",
+		},
+
+		// Exact
+		{
+			name:         "exact leaves the rest to the creator",
+			method:       models.SplitMethodExact,
+			total:        2500,
+			participants: []Participant{{Amount: 12.5}, {Amount: 7.5}},
+			wantCreator:  500,
+			wantShares:   []int64{1250, 750},
+		},
+		{
+			name:         "exact covering the whole total",
+			method:       models.SplitMethodExact,
+			total:        2000,
+			participants: []Participant{{Amount: 12.5}, {Amount: 7.5}},
+			wantShares:   []int64{1250, 750},
+		},
+		{
+			name:         "exact over the total",
+			method:       models.SplitMethodExact,
+			total:        2000,
+			participants: []Participant{{Amount: 12.5}, {Amount: 7.51}},
+			wantErr:      "participants",
+		},
+		{
+			name:         "exact fraction of a cent",
+			method:       models.SplitMethodExact,
+			total:        2000,
+			participants: []Participant{{Amount: 1.005}},
+			wantErr:      "participants",
+		},
+
+		{
+			name:         "unknown method",
+			method:       "shares",
+			total:        1000,
+			participants: make([]Participant, 2),
+			wantErr:      "method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator, shares, err := divide(tt.method, tt.total, tt.includeCreator, tt.participants)
+			if tt.wantErr != "" {
+				var validationErr models.ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Field != tt.wantErr {
+					t.Fatalf("got error %v, want a validation error on %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("divide: %v", err)
+			}
+			if creator != tt.wantCreator || !reflect.DeepEqual(shares, tt.wantShares) {
+				t.Errorf("got creator %d, shares %v; want %d, %v", creator, shares, tt.wantCreator, tt.wantShares)
+			}
+			if creator+sum(shares) != tt.total {
+				t.Errorf("shares add up to %d, want %d", creator+sum(shares), tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package statements
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+// CSVMapping tells the importer which columns hold which fields. Columns are
+// given by header name (case-insensitive) or by zero-based index ("0", "3").
+// Either Amount (signed) or Debit and/or Credit must be set.
+type CSVMapping struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	Debit       string `json:"debit"`
+	Credit      string `json:"credit"`
+	Balance     string `json:"balance"`
+	Reference   string `json:"reference"`
+	Payee       string `json:"payee"`
+	Currency    string `json:"currency"`
+	// Delimiter defaults to a comma
+	Delimiter string `json:"delimiter"`
+	// NoHeader is set when the first line is already data
+	NoHeader bool `json:"noHeader"`
+}
+
+var csvDateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"02/01/2006",
+	"02/01/2006 15:04",
+	"02/01/2006 15:04:05",
+	"02-01-2006",
+	"02 Jan 2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+}
+
+// MappingError reports a CSV mapping that does not fit the file
+type MappingError struct {
+	Message string
+}
+
+func (e MappingError) Error() string {
+	return e.Message
+}
+
+// Validate checks that the mapping names the columns the importer needs
+func (m CSVMapping) Validate() error {
+	if m.Date == "" {
+		return MappingError{"mapping.date is required"}
+	}
+	if m.Amount == "" && m.Debit == "" && m.Credit == "" {
+		return MappingError{"mapping.amount or mapping.debit/mapping.credit is required"}
+	}
+	if m.Amount != "" && (m.Debit != "" || m.Credit != "") {
+		return MappingError{"mapping.amount cannot be combined with mapping.debit/mapping.credit"}
+	}
+	if len([]rune(m.Delimiter)) > 1 {
+		return MappingError{"mapping.delimiter must be a single character"}
+	}
+	return nil
+}
+
+func parseCSV(data []byte, opts Options) ([]Row, error) {
+	mapping := opts.Mapping
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		reader.Comma = []rune(mapping.Delimiter)[0]
+	}
+
+	var header []string
+	if !mapping.NoHeader {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, ErrEmptyStatement
+		}
+		if err != nil {
+			return nil, ParseError{Line: 1, Message: err.Error()}
+		}
+		header = record
+	}
+
+	columns := make(map[string]int)
+	for field, name := range map[string]string{
+		"date":        mapping.Date,
+		"description": mapping.Description,
+		"amount":      mapping.Amount,
+		"debit":       mapping.Debit,
+		"credit":      mapping.Credit,
+		"balance":     mapping.Balance,
+		"reference":   mapping.Reference,
+		"payee":       mapping.Payee,
+		"currency":    mapping.Currency,
+	} {
+		if name == "" {
+			continue
+		}
+		idx, err := columnIndex(header, name)
+		if err != nil {
+			return nil, MappingError{fmt.Sprintf("mapping.%s: %v", field, err)}
+		}
+		columns[field] = idx
+	}
+
+	get := func(record []string, field string) string {
+		idx, ok := columns[field]
+		if !ok || idx >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[idx])
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return nil, ParseError{Line: perr.Line, Message: perr.Err.Error()}
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if isBlank(record) {
+			continue
+		}
+
+		date, err := parseDate(get(record, "date"), opts.DateFormat, csvDateLayouts)
+		if err != nil {
+			return nil, ParseError{Line: line, Message: err.Error()}
+		}
+
+		var amount float64
+		if _, ok := columns["amount"]; ok {
+			amount, err = parseAmount(get(record, "amount"))
+			if err != nil {
+				return nil, ParseError{Line: line, Message: err.Error()}
+			}
+		} else {
+			// Banks often fill the unused column with 0.00, so a row is
+			// its credit less its debit rather than whichever is present
+			debit, credit := get(record, "debit"), get(record, "credit")
+			if debit == "" && credit == "" {
+				return nil, ParseError{Line: line, Message: "row has neither a debit nor a credit amount"}
+			}
+			for _, cell := range []struct {
+				value string
+				sign  float64
+			}{{credit, 1}, {debit, -1}} {
+				if cell.value == "" {
+					continue
+				}
+				v, err := parseAmount(cell.value)
+				if err != nil {
+					return nil, ParseError{Line: line, Message: err.Error()}
+				}
+				amount += cell.sign * math.Abs(v)
+			}
+			amount = utils.RoundMoney(amount)
+		}
+		if amount == 0 {
+			continue
+		}
+
+		row := Row{
+			Date:        date,
+			Amount:      amount,
+			Currency:    strings.ToUpper(get(record, "currency")),
+			Description: get(record, "description"),
+			Payee:       get(record, "payee"),
+			Reference:   get(record, "reference"),
+		}
+		if row.Currency == "" {
+			row.Currency = opts.Currency
+		}
+		if v := get(record, "balance"); v != "" {
+			balance, err := parseAmount(v)
+			if err != nil {
+				return nil, ParseError{Line: line, Message: err.Error()}
+			}
+			row.Balance = &balance
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// columnIndex resolves a mapping entry to a column position
+func columnIndex(header []string, name string) (int, error) {
+	if idx, err := strconv.Atoi(name); err == nil {
+		if idx < 0 {
+			return 0, fmt.Errorf("column index %d is negative", idx)
+		}
+		return idx, nil
+	}
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+			return i, nil
+		}
+	}
+	if header == nil {
+		return 0, fmt.Errorf("column %q must be an index when the file has no header", name)
+	}
+	return 0, fmt.Errorf("column %q not found in header", name)
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package statements
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseCSVAmounts(t *testing.T) {
+	debitCredit := CSVMapping{Date: "Date", Description: "Details", Debit: "Debit", Credit: "Credit"}
+	tests := []struct {
+		name    string
+		mapping CSVMapping
+		data    string
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name:    "zero in the unused column",
+			mapping: debitCredit,
+			data: "Date,Details,Debit,Credit\n" +
+				"2024-05-01,Salary,0.00,1500.00\n" +
+				"2024-05-02,Rent,400.00,0.00\n",
+			want: []float64{1500, -400},
+		},
+		{
+			name:    "empty unused column",
+			mapping: debitCredit,
+			data: "Date,Details,Debit,Credit\n" +
+				"2024-05-01,Salary,,1500.00\n" +
+				"2024-05-02,Rent,400.00,\n",
+			want: []float64{1500, -400},
+		},
+		{
+			name:    "signed debits",
+			mapping: debitCredit,
+			data: "Date,Details,Debit,Credit\n" +
+				"2024-05-02,Rent,-400.00,\n",
+			want: []float64{-400},
+		},
+		{
+			name:    "both columns filled nets out",
+			mapping: debitCredit,
+			data: "Date,Details,Debit,Credit\n" +
+				"2024-05-03,Refund less fee,2.50,10.00\n",
+			want: []float64{7.5},
+		},
+		{
+			name:    "row of zeros is skipped",
+			mapping: debitCredit,
+			data: "Date,Details,Debit,Credit\n" +
+				"2024-05-01,Salary,0.00,1500.00\n" +
+				"2024-05-04,Balance brought forward,0.00,0.00\n",
+			want: []float64{1500},
+		},
+		{
+			name:    "credit column only",
+			mapping: CSVMapping{Date: "Date", Credit: "Credit"},
+			data: "Date,Credit\n" +
+				"2024-05-01,25.00\n",
+			want: []float64{25},
+		},
+		{
+			name:    "signed amount column",
+			mapping: CSVMapping{Date: "Date", Amount: "Amount"},
+			data: "Date,Amount\n" +
+				"2024-05-01,-12.40\n" +
+				"2024-05-02,30\n",
+			want: []float64{-12.4, 30},
+		},
+		{
+			name:    "neither debit nor credit",
+			mapping: debitCredit,
+			data: "Date,Details,Debit,Credit\n" +
+				"2024-05-01,Nothing,,\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseCSV([]byte(tt.data), Options{Currency: "USD", Mapping: tt.mapping})
+			if tt.wantErr {
+				var perr ParseError
+				if !errors.As(err, &perr) {
+					t.Fatalf("got error %v, want a ParseError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCSV: %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, row := range rows {
+				if math.Abs(row.Amount-tt.want[i]) > 1e-9 {
+					t.Errorf("row %d: amount = %v, want %v", i, row.Amount, tt.want[i])
+				}
+			}
+		})
+	}
+}
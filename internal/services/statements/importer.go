@@ -0,0 +1,367 @@
+package statements
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/transactions"
+)
+
+var (
+	ErrImportNotFound      = errors.New("import not found")
+	ErrImportNotPending    = errors.New("import has already been committed or discarded")
+	ErrImportNotUndoable   = errors.New("import cannot be undone in its current state")
+	ErrCurrencyUnsupported = errors.New("currency must be a three letter code")
+)
+
+// Importer runs the preview, commit and undo steps of a statement import
+type Importer struct {
+	db       *gorm.DB
+	ingestor *transactions.Ingestor
+}
+
+func NewImporter(db *gorm.DB, ingestor *transactions.Ingestor) *Importer {
+	return &Importer{db: db, ingestor: ingestor}
+}
+
+// Preview parses the file, flags rows that already exist on the account and
+// stores the result so it can be committed later
+func (im *Importer) Preview(account *models.LinkedAccount, format Format, fileName string, data []byte, opts Options) (*models.StatementImport, error) {
+	if opts.Currency == "" {
+		opts.Currency = strings.ToUpper(account.CurrencyCode)
+	}
+
+	rows, err := Parse(format, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	importRows := make([]models.StatementImportRow, 0, len(rows))
+	occurrences := make(map[string]int)
+	for i, row := range rows {
+		if len(row.Currency) != 3 {
+			return nil, ErrCurrencyUnsupported
+		}
+		txnType := models.TransactionTypeCredit
+		if row.Amount < 0 {
+			txnType = models.TransactionTypeDebit
+		}
+		description := row.Description
+		if description == "" {
+			description = row.Payee
+		}
+
+		id := rowKey(row)
+		occurrences[id]++
+		// Two identical rows on the same day are two real transactions
+		if n := occurrences[id]; n > 1 {
+			id = fmt.Sprintf("%s#%d", id, n)
+		}
+
+		importRows = append(importRows, models.StatementImportRow{
+			Index:                 i,
+			ProviderTransactionID: id,
+			Date:                  row.Date,
+			Type:                  txnType,
+			Amount:                math.Abs(row.Amount),
+			Currency:              row.Currency,
+			Description:           description,
+			Payee:                 row.Payee,
+			Reference:             row.Reference,
+			BalanceAfter:          row.Balance,
+		})
+	}
+
+	if err := im.markDuplicates(account, importRows); err != nil {
+		return nil, err
+	}
+
+	stmtImport := &models.StatementImport{
+		UserID:          account.UserID,
+		LinkedAccountID: account.ID,
+		Format:          string(format),
+		FileName:        fileName,
+		Status:          models.ImportStatusPreview,
+		Rows:            importRows,
+		RowCount:        len(importRows),
+		DuplicateCount:  countDuplicates(importRows),
+	}
+	if err := im.db.Create(stmtImport).Error; err != nil {
+		return nil, err
+	}
+	return stmtImport, nil
+}
+
+// Commit ingests the non-duplicate rows of a previewed import. Duplicates are
+// detected again because the account may have synced since the preview.
+func (im *Importer) Commit(account *models.LinkedAccount, importID uuid.UUID) (*models.StatementImport, *transactions.Result, error) {
+	stmtImport, err := im.find(account, importID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stmtImport.Status != models.ImportStatusPreview {
+		return nil, nil, ErrImportNotPending
+	}
+
+	if err := im.markDuplicates(account, stmtImport.Rows); err != nil {
+		return nil, nil, err
+	}
+
+	txns := make([]models.ProviderTransaction, 0, len(stmtImport.Rows))
+	for _, row := range stmtImport.Rows {
+		if row.Duplicate {
+			continue
+		}
+		txns = append(txns, rowToTransaction(stmtImport, row))
+	}
+
+	// Claim the preview before ingesting it, so a second commit or a
+	// discard racing this one finds it already taken
+	if err := im.transition(stmtImport.ID, models.ImportStatusPreview, models.ImportStatusCommitted); err != nil {
+		if errors.Is(err, errStatusChanged) {
+			return nil, nil, ErrImportNotPending
+		}
+		return nil, nil, err
+	}
+
+	// The sync is recorded on the import in the ingestion's transaction, so
+	// a committed import always has the sync that Undo reverts
+	duplicates := countDuplicates(stmtImport.Rows)
+	rowsJSON, err := json.Marshal(stmtImport.Rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := im.ingestor.IngestWith(account, models.SyncSourceImport, txns, func(tx *gorm.DB, result *transactions.Result) error {
+		updated := tx.Model(&models.StatementImport{}).
+			Where("id = ? AND status = ? AND sync_id IS NULL", stmtImport.ID, models.ImportStatusCommitted).
+			Updates(map[string]interface{}{
+				"rows":            string(rowsJSON),
+				"sync_id":         result.SyncID,
+				"duplicate_count": duplicates + result.Duplicates,
+			})
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return errStatusChanged
+		}
+		return nil
+	})
+	if errors.Is(err, errStatusChanged) {
+		// Undone while it was being ingested
+		return nil, nil, ErrImportNotPending
+	}
+	if err != nil {
+		// Hand the preview back so the commit can be retried
+		if rerr := im.transition(stmtImport.ID, models.ImportStatusCommitted, models.ImportStatusPreview); rerr != nil {
+			log.Printf("[IMPORT] Failed to return import %s to preview: %v", stmtImport.ID, rerr)
+		}
+		return nil, nil, err
+	}
+
+	stmtImport.Status = models.ImportStatusCommitted
+	stmtImport.SyncID = &result.SyncID
+	stmtImport.DuplicateCount = duplicates + result.Duplicates
+	return stmtImport, result, nil
+}
+
+// Undo discards a preview, or deletes the transactions a committed import
+// created
+func (im *Importer) Undo(account *models.LinkedAccount, importID uuid.UUID) (*models.StatementImport, int64, error) {
+	stmtImport, err := im.find(account, importID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var removed int64
+	switch {
+	case stmtImport.Status == models.ImportStatusPreview:
+		err = im.transition(stmtImport.ID, models.ImportStatusPreview, models.ImportStatusDiscarded)
+		stmtImport.Status = models.ImportStatusDiscarded
+	case stmtImport.Status == models.ImportStatusCommitted && stmtImport.SyncID != nil:
+		removed, err = im.ingestor.Revert(account, *stmtImport.SyncID)
+		if err != nil {
+			return nil, 0, err
+		}
+		err = im.transition(stmtImport.ID, models.ImportStatusCommitted, models.ImportStatusReverted)
+		stmtImport.Status = models.ImportStatusReverted
+	case stmtImport.Status == models.ImportStatusCommitted:
+		// Claimed by a commit whose ingestion has not recorded its sync,
+		// so nothing was imported; a commit still running is rolled back
+		// when it finds the import reverted
+		updated := im.db.Model(&models.StatementImport{}).
+			Where("id = ? AND status = ? AND sync_id IS NULL", stmtImport.ID, models.ImportStatusCommitted).
+			Update("status", models.ImportStatusReverted)
+		err = updated.Error
+		if err == nil && updated.RowsAffected == 0 {
+			err = errStatusChanged
+		}
+		stmtImport.Status = models.ImportStatusReverted
+	default:
+		return nil, 0, ErrImportNotUndoable
+	}
+	if errors.Is(err, errStatusChanged) {
+		return nil, 0, ErrImportNotUndoable
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return stmtImport, removed, nil
+}
+
+var errStatusChanged = errors.New("import status changed")
+
+// transition moves the import from one status to another, failing with
+// errStatusChanged if it is no longer in from
+func (im *Importer) transition(importID uuid.UUID, from, to string) error {
+	result := im.db.Model(&models.StatementImport{}).
+		Where("id = ? AND status = ?", importID, from).
+		Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errStatusChanged
+	}
+	return nil
+}
+
+func (im *Importer) find(account *models.LinkedAccount, importID uuid.UUID) (*models.StatementImport, error) {
+	var stmtImport models.StatementImport
+	err := im.db.Where("id = ? AND linked_account_id = ?", importID, account.ID).First(&stmtImport).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmtImport, nil
+}
+
+// markDuplicates flags rows whose id already exists on the account, or that
+// match an existing transaction on the same day with the same direction and
+// amount. Each existing transaction absorbs at most one row.
+func (im *Importer) markDuplicates(account *models.LinkedAccount, rows []models.StatementImportRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(rows))
+	from, to := rows[0].Date, rows[0].Date
+	for i, row := range rows {
+		rows[i].Duplicate = false
+		rows[i].DuplicateOf = nil
+		ids[i] = row.ProviderTransactionID
+		if row.Date.Before(from) {
+			from = row.Date
+		}
+		if row.Date.After(to) {
+			to = row.Date
+		}
+	}
+
+	existingIDs, err := repository.NewTransactionRepository(im.db).ExistingProviderIDs(account.ID, ids)
+	if err != nil {
+		return err
+	}
+
+	// Statement dates are calendar days, so allow a day either side for
+	// provider timestamps in a different zone
+	var existing []models.ProviderTransaction
+	if err := im.db.Where("linked_account_id = ? AND transaction_date >= ? AND transaction_date < ?",
+		account.ID, from.AddDate(0, 0, -1), to.AddDate(0, 0, 2)).
+		Order("transaction_date, id").
+		Find(&existing).Error; err != nil {
+		return err
+	}
+
+	claimed := make(map[uuid.UUID]bool)
+	for i := range rows {
+		row := &rows[i]
+		if existingIDs[row.ProviderTransactionID] {
+			row.Duplicate = true
+			continue
+		}
+		for j := range existing {
+			candidate := &existing[j]
+			if claimed[candidate.ID] || candidate.TransactionType != row.Type {
+				continue
+			}
+			if math.Abs(candidate.Amount-row.Amount) >= 0.005 {
+				continue
+			}
+			if !sameDay(candidate.TransactionDate.In(row.Date.Location()), row.Date) {
+				continue
+			}
+			claimed[candidate.ID] = true
+			row.Duplicate = true
+			row.DuplicateOf = &candidate.ID
+			break
+		}
+	}
+	return nil
+}
+
+// rowKey derives the dedup id of a statement row. The bank's own reference
+// (FITID, cheque number) wins; otherwise date, amount and text are hashed.
+func rowKey(row Row) string {
+	if ref := strings.TrimSpace(row.Reference); ref != "" {
+		return "stmt:" + ref
+	}
+	raw := fmt.Sprintf("%s|%.2f|%s|%s", row.Date.Format("2006-01-02"), row.Amount,
+		strings.ToLower(strings.Join(strings.Fields(row.Description), " ")),
+		strings.ToLower(strings.Join(strings.Fields(row.Payee), " ")))
+	sum := sha256.Sum256([]byte(raw))
+	return "stmt:sha-" + hex.EncodeToString(sum[:16])
+}
+
+func rowToTransaction(stmtImport *models.StatementImport, row models.StatementImportRow) models.ProviderTransaction {
+	txn := models.ProviderTransaction{
+		ProviderTransactionID: row.ProviderTransactionID,
+		TransactionType:       row.Type,
+		Amount:                row.Amount,
+		Currency:              row.Currency,
+		Description:           row.Description,
+		MerchantName:          row.Payee,
+		TransactionDate:       row.Date,
+		BalanceAfter:          row.BalanceAfter,
+	}
+	metadata, err := json.Marshal(map[string]string{
+		"source":    "statement_import",
+		"importId":  stmtImport.ID.String(),
+		"format":    stmtImport.Format,
+		"reference": row.Reference,
+	})
+	if err == nil {
+		txn.ProviderMetadata = models.JSON(metadata)
+	}
+	return txn
+}
+
+func countDuplicates(rows []models.StatementImportRow) int {
+	n := 0
+	for _, row := range rows {
+		if row.Duplicate {
+			n++
+		}
+	}
+	return n
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,115 @@
+package statements
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ofxTransactionStart = regexp.MustCompile(`(?i)<STMTTRN>`)
+	ofxTransactionEnd   = regexp.MustCompile(`(?i)</STMTTRN>|</BANKTRANLIST>`)
+	ofxCurrency         = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Z]{3})`)
+	ofxFields           = make(map[string]*regexp.Regexp)
+)
+
+func init() {
+	for _, tag := range []string{"DTPOSTED", "DTUSER", "TRNAMT", "NAME", "MEMO", "FITID", "CURRENCY"} {
+		ofxFields[tag] = regexp.MustCompile(`(?i)<` + tag + `>([^<\r\n]*)`)
+	}
+}
+
+// OFX dates look like 20240512, 20240512101530 or 20240512101530.000[-5:EST]
+var ofxDateLayouts = []string{
+	"20060102150405",
+	"200601021504",
+	"20060102",
+}
+
+// parseOFX reads STMTTRN blocks from both SGML (OFX 1.x, unclosed tags) and
+// XML (OFX 2.x) documents
+func parseOFX(data []byte, opts Options) ([]Row, error) {
+	doc := string(data)
+
+	currency := opts.Currency
+	if m := ofxCurrency.FindStringSubmatch(doc); m != nil {
+		currency = strings.ToUpper(m[1])
+	}
+
+	// SGML documents may omit </STMTTRN>, so each block runs to the next
+	// <STMTTRN> or to an explicit closing tag, whichever comes first.
+	starts := ofxTransactionStart.FindAllStringIndex(doc, -1)
+	rows := make([]Row, 0, len(starts))
+	for i, start := range starts {
+		end := len(doc)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		block := doc[start[1]:end]
+		if loc := ofxTransactionEnd.FindStringIndex(block); loc != nil {
+			block = block[:loc[0]]
+		}
+		line := strings.Count(doc[:start[0]], "\n") + 1
+
+		rawDate := ofxField(block, "DTPOSTED")
+		if rawDate == "" {
+			rawDate = ofxField(block, "DTUSER")
+		}
+		date, err := parseOFXDate(rawDate, opts.DateFormat)
+		if err != nil {
+			return nil, ParseError{Line: line, Message: err.Error()}
+		}
+
+		amount, err := parseAmount(ofxField(block, "TRNAMT"))
+		if err != nil {
+			return nil, ParseError{Line: line, Message: err.Error()}
+		}
+		if amount == 0 {
+			continue
+		}
+
+		row := Row{
+			Date:        date,
+			Amount:      amount,
+			Currency:    currency,
+			Payee:       ofxField(block, "NAME"),
+			Description: ofxField(block, "MEMO"),
+			Reference:   ofxField(block, "FITID"),
+		}
+		if row.Description == "" {
+			row.Description = row.Payee
+		}
+		if c := ofxField(block, "CURRENCY"); len(c) == 3 {
+			row.Currency = strings.ToUpper(c)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// ofxField returns the value of a tag inside a block. SGML values run to the
+// next tag or end of line; XML values run to the closing tag.
+func ofxField(block, tag string) string {
+	m := ofxFields[tag].FindStringSubmatch(block)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(m[1]))
+}
+
+func parseOFXDate(value, pattern string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("transaction has no date")
+	}
+	if pattern != "" {
+		return parseDate(value, pattern, nil)
+	}
+	// Drop fractional seconds and the [offset:TZ] suffix
+	if i := strings.IndexAny(value, ".["); i >= 0 {
+		value = value[:i]
+	}
+	return parseDate(value, "", ofxDateLayouts)
+}
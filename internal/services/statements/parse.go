@@ -0,0 +1,149 @@
+// Package statements parses bank and wallet statement exports (CSV, OFX and
+// QIF) into rows that can be imported as provider transactions.
+package statements
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is a supported statement file format
+type Format string
+
+const (
+	FormatCSV Format = "csv"
+	FormatOFX Format = "ofx"
+	FormatQIF Format = "qif"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported statement format")
+	ErrEmptyStatement    = errors.New("statement contains no transactions")
+	ErrTooManyRows       = errors.New("statement has too many rows")
+)
+
+// MaxRows caps the number of rows accepted from a single file
+const MaxRows = 5000
+
+// Row is one transaction read from a statement. Amount is signed: negative
+// for money leaving the account.
+type Row struct {
+	Date        time.Time
+	Amount      float64
+	Currency    string
+	Description string
+	Payee       string
+	Reference   string
+	Balance     *float64
+}
+
+// ParseError reports the statement line that could not be read
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Options carries the per-file settings supplied with an upload
+type Options struct {
+	// DateFormat overrides the date layout, e.g. "DD/MM/YYYY"
+	DateFormat string
+	// Currency is used when the file does not state one
+	Currency string
+	// Mapping describes CSV columns; ignored for OFX and QIF
+	Mapping CSVMapping
+}
+
+// Parse reads a statement in the given format
+func Parse(format Format, data []byte, opts Options) ([]Row, error) {
+	var (
+		rows []Row
+		err  error
+	)
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(data, opts)
+	case FormatOFX:
+		rows, err = parseOFX(data, opts)
+	case FormatQIF:
+		rows, err = parseQIF(data, opts)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrEmptyStatement
+	}
+	if len(rows) > MaxRows {
+		return nil, fmt.Errorf("%w: %d rows, maximum is %d", ErrTooManyRows, len(rows), MaxRows)
+	}
+	return rows, nil
+}
+
+// layoutFromPattern turns a human date pattern such as "DD/MM/YYYY HH:mm"
+// into a Go time layout. Go layouts contain none of the tokens and pass
+// through unchanged.
+func layoutFromPattern(pattern string) string {
+	return strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MM", "01",
+		"DD", "02",
+		"HH", "15",
+		"mm", "04",
+		"ss", "05",
+	).Replace(pattern)
+}
+
+// parseDate tries the configured layout first and then the given fallbacks
+func parseDate(value, pattern string, fallbacks []string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	layouts := fallbacks
+	if pattern != "" {
+		layouts = []string{layoutFromPattern(pattern)}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+// parseAmount accepts "1,234.50", "-20", "(20.00)", "20.00 CR" and "$20"
+func parseAmount(value string) (float64, error) {
+	v := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(v, "(") && strings.HasSuffix(v, ")") {
+		negative = true
+		v = strings.Trim(v, "()")
+	}
+	upper := strings.ToUpper(v)
+	switch {
+	case strings.HasSuffix(upper, "DR"):
+		negative = true
+		v = strings.TrimSpace(v[:len(v)-2])
+	case strings.HasSuffix(upper, "CR"):
+		v = strings.TrimSpace(v[:len(v)-2])
+	}
+	v = strings.NewReplacer(",", "", "$", "", " ", "").Replace(v)
+	if v == "" {
+		return 0, errors.New("empty amount")
+	}
+	amount, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
@@ -0,0 +1,112 @@
+package statements
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// QIF dates come in many shapes: 12/31/2024, 12/31'24, 31/12/2024, 2024-12-31
+var qifDateLayouts = []string{
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/06",
+	"1/2/06",
+	"01/02'06",
+	"1/2'06",
+	"01-02-2006",
+	"2006-01-02",
+}
+
+// parseQIF reads a QIF bank or cash register. Each record is a run of
+// single-letter prefixed lines terminated by "^".
+func parseQIF(data []byte, opts Options) ([]Row, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	var (
+		rows      []Row
+		current   Row
+		hasAmount bool
+		hasDate   bool
+		startLine int
+		memo      string
+		line      int
+	)
+
+	flush := func() error {
+		defer func() {
+			current, hasAmount, hasDate, memo, startLine = Row{}, false, false, "", 0
+		}()
+		if !hasAmount && !hasDate {
+			return nil
+		}
+		if !hasDate {
+			return ParseError{Line: startLine, Message: "transaction has no date"}
+		}
+		if !hasAmount {
+			return ParseError{Line: startLine, Message: "transaction has no amount"}
+		}
+		if current.Amount == 0 {
+			return nil
+		}
+		current.Description = memo
+		if current.Description == "" {
+			current.Description = current.Payee
+		}
+		current.Currency = opts.Currency
+		rows = append(rows, current)
+		return nil
+	}
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		if startLine == 0 {
+			startLine = line
+		}
+
+		code, value := text[0], strings.TrimSpace(text[1:])
+		switch code {
+		case '!':
+			// Header such as !Type:Bank; nothing to record
+			startLine = 0
+		case '^':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case 'D':
+			// Quicken pads single digit days with a space: " 1/ 5'24"
+			date, err := parseDate(strings.ReplaceAll(value, " ", "0"), opts.DateFormat, qifDateLayouts)
+			if err != nil {
+				return nil, ParseError{Line: line, Message: err.Error()}
+			}
+			current.Date = date
+			hasDate = true
+		case 'T', 'U':
+			amount, err := parseAmount(value)
+			if err != nil {
+				return nil, ParseError{Line: line, Message: err.Error()}
+			}
+			current.Amount = amount
+			hasAmount = true
+		case 'P':
+			current.Payee = value
+		case 'M':
+			memo = value
+		case 'N':
+			current.Reference = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// Some exporters omit the final "^"
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
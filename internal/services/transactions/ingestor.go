@@ -0,0 +1,201 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/rules"
+)
+
+var ErrAlreadyReverted = errors.New("sync has already been reverted")
+
+// Ingestor stores transactions fetched or parsed for a linked account and
+// records the run in the account's sync history. Ingesting the same provider
+// transaction twice is safe: the second copy updates the first.
+type Ingestor struct {
+	db        *gorm.DB
+	listeners []Listener
+}
+
+// Listener is told about the transactions an ingestion run created, after
+// they are committed. Listeners run synchronously on the ingesting request,
+// so slow work belongs on a goroutine.
+type Listener interface {
+	TransactionsIngested(account *models.LinkedAccount, created []models.ProviderTransaction)
+}
+
+// Result summarises a single ingestion run
+type Result struct {
+	SyncID     uuid.UUID
+	Created    []models.ProviderTransaction
+	Duplicates int
+}
+
+func NewIngestor(db *gorm.DB) *Ingestor {
+	return &Ingestor{db: db}
+}
+
+// AddListener registers l to be told about newly ingested transactions
+func (i *Ingestor) AddListener(l Listener) {
+	i.listeners = append(i.listeners, l)
+}
+
+// Ingest upserts txns for the account inside one database transaction and
+// records the run as a sync entry with the given source. New transactions are
+// assigned to the user's budget categories by their rules. Every transaction
+// must carry a ProviderTransactionID, which is the dedup key.
+func (i *Ingestor) Ingest(account *models.LinkedAccount, source string, txns []models.ProviderTransaction) (*Result, error) {
+	return i.IngestWith(account, source, txns, nil)
+}
+
+// IngestWith is Ingest that also calls record, if set, inside the
+// ingestion's database transaction, so the caller can store the result
+// with it. An error from record rolls the ingestion back.
+func (i *Ingestor) IngestWith(account *models.LinkedAccount, source string, txns []models.ProviderTransaction,
+	record func(tx *gorm.DB, result *Result) error) (*Result, error) {
+	result := &Result{}
+
+	ids := make([]string, 0, len(txns))
+	seen := make(map[string]bool, len(txns))
+	batch := make([]models.ProviderTransaction, 0, len(txns))
+	for _, txn := range txns {
+		if txn.ProviderTransactionID == "" {
+			return nil, fmt.Errorf("transaction without provider transaction id")
+		}
+		// Collapse repeats inside the batch; Postgres rejects an upsert that
+		// touches the same row twice.
+		if seen[txn.ProviderTransactionID] {
+			result.Duplicates++
+			continue
+		}
+		seen[txn.ProviderTransactionID] = true
+
+		txn.LinkedAccountID = account.ID
+		if txn.SyncStatus == "" {
+			txn.SyncStatus = models.TransactionSyncSynced
+		}
+		ids = append(ids, txn.ProviderTransactionID)
+		batch = append(batch, txn)
+	}
+
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		repo := repository.NewTransactionRepository(tx)
+
+		existing, err := repo.ExistingProviderIDs(account.ID, ids)
+		if err != nil {
+			return err
+		}
+
+		sync := models.AccountSync{
+			LinkedAccountID:  account.ID,
+			SyncStatus:       models.AccountSyncSuccess,
+			Source:           source,
+			TransactionCount: len(batch) - len(existing),
+		}
+		if err := tx.Create(&sync).Error; err != nil {
+			return err
+		}
+		result.SyncID = sync.ID
+
+		// Only new rows are categorized; rows that already exist keep their
+		// category, like they keep the sync that created them
+		evaluator, err := rules.Load(tx, account.UserID)
+		if err != nil {
+			return err
+		}
+		for idx := range batch {
+			batch[idx].SyncID = &sync.ID
+			evaluator.Apply(&batch[idx])
+		}
+		if err := repo.Upsert(batch); err != nil {
+			return err
+		}
+
+		for _, txn := range batch {
+			if existing[txn.ProviderTransactionID] {
+				result.Duplicates++
+				continue
+			}
+			result.Created = append(result.Created, txn)
+		}
+
+		now := time.Now()
+		if err := tx.Model(account).UpdateColumn("last_sync_at", now).Error; err != nil {
+			return err
+		}
+		account.LastSyncAt = &now
+		if record != nil {
+			return record(tx, result)
+		}
+		return nil
+	})
+	if err != nil {
+		i.recordFailure(account, source, err)
+		return nil, err
+	}
+
+	log.Printf("[INGEST] Account %s (%s): %d created, %d duplicates", account.ID, source, len(result.Created), result.Duplicates)
+	if len(result.Created) > 0 {
+		for _, l := range i.listeners {
+			l.TransactionsIngested(account, result.Created)
+		}
+	}
+	return result, nil
+}
+
+// Revert deletes the transactions created by a sync run and marks the run as
+// reverted. Transactions the run only updated are left alone.
+func (i *Ingestor) Revert(account *models.LinkedAccount, syncID uuid.UUID) (int64, error) {
+	var removed int64
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		var sync models.AccountSync
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND linked_account_id = ?", syncID, account.ID).
+			First(&sync).Error; err != nil {
+			return err
+		}
+		if sync.RevertedAt != nil {
+			return ErrAlreadyReverted
+		}
+
+		result := tx.Where("sync_id = ? AND linked_account_id = ?", syncID, account.ID).
+			Delete(&models.ProviderTransaction{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+
+		now := time.Now()
+		return tx.Model(&sync).Updates(map[string]interface{}{
+			"sync_status": models.AccountSyncReverted,
+			"reverted_at": now,
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("[INGEST] Reverted sync %s on account %s: %d transactions removed", syncID, account.ID, removed)
+	return removed, nil
+}
+
+// recordFailure stores a failed sync entry outside the rolled back transaction
+func (i *Ingestor) recordFailure(account *models.LinkedAccount, source string, cause error) {
+	sync := models.AccountSync{
+		LinkedAccountID: account.ID,
+		SyncStatus:      models.AccountSyncFailed,
+		Source:          source,
+		ErrorMessage:    cause.Error(),
+	}
+	if err := i.db.Create(&sync).Error; err != nil {
+		log.Printf("[INGEST] Failed to record failed sync for account %s: %v", account.ID, err)
+	}
+}
@@ -0,0 +1,446 @@
+package transfers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+	"github.com/moha/kaafipay-backend/internal/services/whatsapp"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	// codeTTL is how long the sender has to confirm a transfer
+	codeTTL = 5 * time.Minute
+	// maxCodeAttempts incorrect codes fail the transfer
+	maxCodeAttempts = 5
+)
+
+var (
+	ErrRecipientNotFound = errors.New("no active KaafiPay user has this phone number")
+	ErrSelfTransfer      = errors.New("cannot send money to yourself")
+	ErrInvalidAmount     = errors.New("amount must be a positive number of whole cents")
+	ErrTransferNotFound  = errors.New("transfer not found")
+	ErrNotPending        = errors.New("transfer is no longer pending")
+	ErrCodeExpired       = errors.New("confirmation code has expired")
+	ErrInvalidCode       = errors.New("invalid confirmation code")
+	ErrTooManyAttempts   = errors.New("too many incorrect codes")
+	ErrCodeNotSent       = errors.New("failed to send the confirmation code")
+	ErrRejected          = errors.New("transfer rejected")
+	ErrSenderSuspended   = errors.New("sender's account is suspended")
+)
+
+// Hook is told about a transfer inside the transaction that completes it,
+// so whatever the transfer pays for is settled atomically with the money
+// moving. Returning an error wrapping ErrRejected fails the transfer; any
+// other error rolls back the confirmation so it can be retried.
+type Hook interface {
+	TransferCompleting(tx *gorm.DB, transfer *models.Transfer) error
+}
+
+// Request is a transfer the sender wants to make
+type Request struct {
+	SenderID       uuid.UUID
+	RecipientPhone string
+	RecipientID    uuid.UUID // used instead of RecipientPhone when set
+	Amount         float64
+	Currency       string // defaults to the sender's preferred currency
+	Description    string
+	ReferenceID    string // what the transfer pays for, e.g. "payment_request:<id>"
+}
+
+// Service moves money between users' wallets. A transfer is created
+// pending and a code is sent to the sender's phone; confirming it with that
+// code posts a single journal entry from the sender's wallet to the
+// receiver's. Both parties are told over WhatsApp once it completes.
+type Service struct {
+	db       *gorm.DB
+	ledger   repository.LedgerRepository
+	whatsapp *whatsapp.WhatsAppProvider
+	hooks    []Hook
+}
+
+func NewService(db *gorm.DB, ledger repository.LedgerRepository, whatsapp *whatsapp.WhatsAppProvider) *Service {
+	return &Service{db: db, ledger: ledger, whatsapp: whatsapp}
+}
+
+// AddHook registers a hook to run as transfers complete
+func (s *Service) AddHook(h Hook) {
+	s.hooks = append(s.hooks, h)
+}
+
+// Initiate creates a pending transfer and sends the sender its
+// confirmation code
+func (s *Service) Initiate(req Request) (*models.Transfer, error) {
+	transfer, sender, receiver, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(codeTTL)
+	transfer.OTPHash = utils.HashOTP(code)
+	transfer.ExpiresAt = &expires
+	if err := s.db.Create(transfer).Error; err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("KaafiPay: Your code to send %.2f %s to %s is %s. It expires in %d minutes. Never share this code.",
+		transfer.Amount, transfer.Currency, receiver.Name, code, int(codeTTL.Minutes()))
+	if err := s.whatsapp.SendMessage(sender.Phone, message); err != nil {
+		log.Printf("[TRANSFER] Failed to send code for transfer %s: %v", transfer.ID, err)
+		s.finish(transfer, models.TransferStatusFailed, "confirmation code could not be sent")
+		return transfer, ErrCodeNotSent
+	}
+	log.Printf("[TRANSFER] Created transfer %s of %.2f %s from %s to %s",
+		transfer.ID, transfer.Amount, transfer.Currency, sender.ID, receiver.ID)
+
+	transfer.Receiver = &models.User{ID: receiver.ID, Name: receiver.Name, Phone: receiver.Phone}
+	return transfer, nil
+}
+
+// Execute creates a transfer and completes it straight away, without a
+// confirmation code. It is only for transfers the sender has already
+// authorised some other way, such as a confirmed schedule. Errors are
+// those of Confirm; a transfer that fails the pre-checks is not created.
+func (s *Service) Execute(req Request) (*models.Transfer, error) {
+	transfer, _, receiver, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(transfer).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[TRANSFER] Executing transfer %s of %.2f %s from %s to %s",
+		transfer.ID, transfer.Amount, transfer.Currency, transfer.SenderID, receiver.ID)
+
+	transfer.Receiver = &models.User{ID: receiver.ID, Name: receiver.Name, Phone: receiver.Phone}
+	return s.complete(transfer)
+}
+
+// prepare validates a request and builds its pending transfer, checking
+// the sender can currently afford it
+func (s *Service) prepare(req Request) (*models.Transfer, *models.User, *models.User, error) {
+	amount := utils.RoundMoney(req.Amount)
+	if amount <= 0 || math.Abs(req.Amount-amount) > 1e-9 {
+		return nil, nil, nil, ErrInvalidAmount
+	}
+
+	var sender models.User
+	if err := s.db.First(&sender, "id = ?", req.SenderID).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	if sender.Suspended(time.Now()) {
+		return nil, nil, nil, ErrSenderSuspended
+	}
+	var receiver models.User
+	query := s.db.Scopes(models.UnsuspendedUsers(time.Now()))
+	if req.RecipientID != uuid.Nil {
+		query = query.Where("id = ?", req.RecipientID)
+	} else {
+		query = query.Where("phone = ?", strings.TrimSpace(req.RecipientPhone))
+	}
+	err := query.First(&receiver).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil, ErrRecipientNotFound
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if receiver.ID == sender.ID {
+		return nil, nil, nil, ErrSelfTransfer
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = strings.ToUpper(sender.PreferredCurrency)
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	// Checked again when the transfer is posted; failing early saves the
+	// sender a code for a transfer that cannot go through
+	var wallet models.Wallet
+	err = s.db.Where("user_id = ? AND currency = ?", sender.ID, currency).First(&wallet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && wallet.Balance < amount) {
+		return nil, nil, nil, repository.ErrInsufficientFunds
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if wallet.Status != models.WalletStatusActive {
+		return nil, nil, nil, repository.ErrWalletInactive
+	}
+
+	transfer := &models.Transfer{
+		SenderID:    sender.ID,
+		ReceiverID:  receiver.ID,
+		Amount:      amount,
+		Currency:    currency,
+		Status:      models.TransferStatusPending,
+		Type:        models.TransferTypeTransfer,
+		Description: strings.TrimSpace(req.Description),
+	}
+	if req.ReferenceID != "" {
+		transfer.ReferenceID = &req.ReferenceID
+	}
+	return transfer, &sender, &receiver, nil
+}
+
+// Confirm checks the sender's code and completes the transfer. A transfer
+// that cannot be posted, e.g. because the balance has since dropped, is
+// marked failed and returned with the error.
+func (s *Service) Confirm(senderID, transferID uuid.UUID, code string) (*models.Transfer, error) {
+	transfer, err := s.Get(senderID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.SenderID != senderID {
+		return nil, ErrTransferNotFound
+	}
+	if transfer.Status != models.TransferStatusPending {
+		return transfer, ErrNotPending
+	}
+	if transfer.ExpiresAt != nil && time.Now().After(*transfer.ExpiresAt) {
+		s.finish(transfer, models.TransferStatusCancelled, "confirmation code expired")
+		return transfer, ErrCodeExpired
+	}
+	attempts, ok, err := utils.ClaimOTPAttempt(s.db, models.Transfer{}.TableName(), transfer.ID,
+		models.TransferStatusPending, maxCodeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Out of attempts, or confirmed or cancelled by a parallel request
+		if !s.finish(transfer, models.TransferStatusFailed, "too many incorrect codes") {
+			return transfer, ErrNotPending
+		}
+		return transfer, ErrTooManyAttempts
+	}
+	transfer.OTPAttempts = attempts
+	if !utils.CheckOTP(code, transfer.OTPHash) {
+		if attempts >= maxCodeAttempts {
+			s.finish(transfer, models.TransferStatusFailed, "too many incorrect codes")
+			return transfer, ErrTooManyAttempts
+		}
+		return transfer, ErrInvalidCode
+	}
+
+	return s.complete(transfer)
+}
+
+// complete posts a pending transfer's journal entry and runs the hooks in
+// the same transaction
+func (s *Service) complete(transfer *models.Transfer) (*models.Transfer, error) {
+	receiverWallet, err := s.ledger.GetOrCreateWallet(transfer.ReceiverID, transfer.Currency)
+	if err != nil {
+		return nil, err
+	}
+	var senderWallet models.Wallet
+	err = s.db.Where("user_id = ? AND currency = ?", transfer.SenderID, transfer.Currency).First(&senderWallet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.finish(transfer, models.TransferStatusFailed, repository.ErrInsufficientFunds.Error())
+		return transfer, repository.ErrInsufficientFunds
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reference := "transfer:" + transfer.ID.String()
+	entry := &models.JournalEntry{
+		Kind:        models.JournalKindTransfer,
+		Reference:   &reference,
+		Description: transfer.Description,
+		Currency:    transfer.Currency,
+	}
+	now := time.Now()
+	err = s.ledger.Transact(func(tx *gorm.DB) error {
+		// Claiming the transfer first means a concurrent confirmation either
+		// waits for this one or finds it no longer pending
+		result := tx.Model(&models.Transfer{}).
+			Where("id = ? AND status = ?", transfer.ID, models.TransferStatusPending).
+			Updates(map[string]interface{}{"status": models.TransferStatusCompleted, "completed_at": now, "otp_hash": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotPending
+		}
+
+		entry.ID = uuid.Nil
+		entry.Lines = []models.LedgerEntry{
+			models.WalletLine(senderWallet.ID, -transfer.Amount),
+			models.WalletLine(receiverWallet.ID, transfer.Amount),
+		}
+		if err := s.ledger.PostTx(tx, entry); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Transfer{}).Where("id = ?", transfer.ID).
+			Update("journal_entry_id", entry.ID).Error; err != nil {
+			return err
+		}
+		for _, hook := range s.hooks {
+			if err := hook.TransferCompleting(tx, transfer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotPending):
+		return transfer, err
+	case errors.Is(err, repository.ErrInsufficientFunds),
+		errors.Is(err, repository.ErrWalletInactive),
+		errors.Is(err, repository.ErrCurrencyMismatch):
+		s.finish(transfer, models.TransferStatusFailed, rootCause(err))
+		return transfer, err
+	case errors.Is(err, ErrRejected):
+		s.finish(transfer, models.TransferStatusFailed, err.Error())
+		return transfer, err
+	default:
+		return nil, err
+	}
+
+	transfer.Status = models.TransferStatusCompleted
+	transfer.CompletedAt = &now
+	transfer.JournalEntryID = &entry.ID
+	log.Printf("[TRANSFER] Completed transfer %s", transfer.ID)
+
+	go s.notify(transfer, entry)
+	return transfer, nil
+}
+
+// Cancel withdraws a pending transfer
+func (s *Service) Cancel(senderID, transferID uuid.UUID) (*models.Transfer, error) {
+	transfer, err := s.Get(senderID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.SenderID != senderID {
+		return nil, ErrTransferNotFound
+	}
+	if !s.finish(transfer, models.TransferStatusCancelled, "") {
+		return transfer, ErrNotPending
+	}
+	return transfer, nil
+}
+
+// Get returns a transfer the user sent or received. Pending transfers only
+// show to their sender.
+func (s *Service) Get(userID, transferID uuid.UUID) (*models.Transfer, error) {
+	var transfer models.Transfer
+	err := s.withParties(s.db).
+		Where("id = ? AND type = ?", transferID, models.TransferTypeTransfer).
+		Where("sender_id = ? OR (receiver_id = ? AND status <> ?)", userID, userID, models.TransferStatusPending).
+		First(&transfer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// List returns the user's transfers, sent and received, newest first.
+// Pending transfers only show to their sender.
+func (s *Service) List(userID uuid.UUID, limit int) ([]models.Transfer, error) {
+	transfers := []models.Transfer{}
+	err := s.withParties(s.db).
+		Where("type = ?", models.TransferTypeTransfer).
+		Where("sender_id = ? OR (receiver_id = ? AND status <> ?)", userID, userID, models.TransferStatusPending).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&transfers).Error
+	return transfers, err
+}
+
+func (s *Service) withParties(db *gorm.DB) *gorm.DB {
+	party := func(db *gorm.DB) *gorm.DB { return db.Select("id", "name", "phone") }
+	return db.Preload("Sender", party).Preload("Receiver", party)
+}
+
+// finish moves a pending transfer to status and reports whether it was
+// still pending
+func (s *Service) finish(transfer *models.Transfer, status, reason string) bool {
+	updates := map[string]interface{}{"status": status, "otp_hash": nil}
+	if reason != "" {
+		updates["failure_reason"] = reason
+	}
+	result := s.db.Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.TransferStatusPending).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[TRANSFER] Failed to mark transfer %s %s: %v", transfer.ID, status, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	transfer.Status = status
+	transfer.FailureReason = reason
+	log.Printf("[TRANSFER] Transfer %s %s: %s", transfer.ID, status, reason)
+	return true
+}
+
+// notify tells both parties about a completed transfer and their new
+// balances
+func (s *Service) notify(transfer *models.Transfer, entry *models.JournalEntry) {
+	var sender, receiver models.User
+	if err := s.db.Select("id", "name", "phone").First(&sender, "id = ?", transfer.SenderID).Error; err != nil {
+		log.Printf("[TRANSFER] Failed to load sender of %s: %v", transfer.ID, err)
+		return
+	}
+	if err := s.db.Select("id", "name", "phone").First(&receiver, "id = ?", transfer.ReceiverID).Error; err != nil {
+		log.Printf("[TRANSFER] Failed to load receiver of %s: %v", transfer.ID, err)
+		return
+	}
+
+	var senderBalance, receiverBalance float64
+	for _, line := range entry.Lines {
+		if line.BalanceAfter == nil {
+			continue
+		}
+		if line.Amount < 0 {
+			senderBalance = *line.BalanceAfter
+		} else {
+			receiverBalance = *line.BalanceAfter
+		}
+	}
+
+	messages := map[string]string{
+		sender.Phone: fmt.Sprintf("KaafiPay: You sent %.2f %s to %s (%s). Your balance is %.2f %s.",
+			transfer.Amount, transfer.Currency, receiver.Name, receiver.Phone, senderBalance, transfer.Currency),
+		receiver.Phone: fmt.Sprintf("KaafiPay: You received %.2f %s from %s (%s). Your balance is %.2f %s.",
+			transfer.Amount, transfer.Currency, sender.Name, sender.Phone, receiverBalance, transfer.Currency),
+	}
+	for phone, message := range messages {
+		if err := s.whatsapp.SendMessage(phone, message); err != nil {
+			log.Printf("[TRANSFER] Failed to notify %s of transfer %s: %v", phone, transfer.ID, err)
+		}
+	}
+}
+
+// rootCause returns the message of the sentinel error behind err, leaving
+// out wallet IDs
+func rootCause(err error) string {
+	for _, sentinel := range []error{repository.ErrInsufficientFunds, repository.ErrWalletInactive, repository.ErrCurrencyMismatch} {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return err.Error()
+}
@@ -0,0 +1,226 @@
+package ussd
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/utils"
+)
+
+const (
+	// intentTTL is how long a payment has to show up on the account
+	intentTTL = 24 * time.Hour
+	// clockSkew allows for receipt times that lag the intent's creation
+	clockSkew = 10 * time.Minute
+
+	expireInterval = time.Hour
+)
+
+var (
+	ErrIntentNotFound = errors.New("payment intent not found")
+	ErrNotPending     = errors.New("payment intent is no longer pending")
+)
+
+// IntentInput describes a payment to start from a linked account
+type IntentInput struct {
+	RecipientNumber string
+	Amount          float64
+	Note            string
+}
+
+// Intents creates payment intents and completes them when the debit they
+// produced is ingested, whether from an SMS receipt or a provider sync
+type Intents struct {
+	db *gorm.DB
+}
+
+func NewIntents(db *gorm.DB) *Intents {
+	return &Intents{db: db}
+}
+
+// Create builds the dial string for a payment from the account and tracks
+// it until the payment arrives
+func (i *Intents) Create(account *models.LinkedAccount, in IntentInput) (*models.PaymentIntent, error) {
+	dial, err := Build(account.Provider, in.RecipientNumber, in.Amount, account.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	if dial.Number == NormalizeNumber(account.AccountNumber) {
+		return nil, ErrInvalidNumber
+	}
+
+	intent := models.PaymentIntent{
+		UserID:          account.UserID,
+		LinkedAccountID: account.ID,
+		Provider:        account.Provider,
+		RecipientNumber: dial.Number,
+		Amount:          utils.RoundMoney(in.Amount),
+		Currency:        strings.ToUpper(account.CurrencyCode),
+		Note:            strings.TrimSpace(in.Note),
+		DialString:      dial.String,
+		Status:          models.PaymentIntentPending,
+		ExpiresAt:       time.Now().Add(intentTTL),
+	}
+	if err := i.db.Create(&intent).Error; err != nil {
+		return nil, err
+	}
+	intent.TelURI = dial.URI
+	log.Printf("[PAYMENT-INTENT] Created intent %s on account %s for %.2f %s to %s",
+		intent.ID, account.ID, intent.Amount, intent.Currency, intent.RecipientNumber)
+	return &intent, nil
+}
+
+// List returns the account's intents, newest first
+func (i *Intents) List(accountID uuid.UUID, status string) ([]models.PaymentIntent, error) {
+	intents := []models.PaymentIntent{}
+	query := i.db.Where("linked_account_id = ?", accountID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at DESC").Limit(100).Find(&intents).Error; err != nil {
+		return nil, err
+	}
+	for j := range intents {
+		decorate(&intents[j])
+	}
+	return intents, nil
+}
+
+// Get returns one of the account's intents
+func (i *Intents) Get(accountID, intentID uuid.UUID) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := i.db.Where("id = ? AND linked_account_id = ?", intentID, accountID).First(&intent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIntentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	decorate(&intent)
+	return &intent, nil
+}
+
+// Cancel stops tracking a pending intent, e.g. when the user backed out of
+// the dial
+func (i *Intents) Cancel(accountID, intentID uuid.UUID) (*models.PaymentIntent, error) {
+	intent, err := i.Get(accountID, intentID)
+	if err != nil {
+		return nil, err
+	}
+	result := i.db.Model(&models.PaymentIntent{}).
+		Where("id = ? AND status = ?", intent.ID, models.PaymentIntentPending).
+		Update("status", models.PaymentIntentCancelled)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotPending
+	}
+	intent.Status = models.PaymentIntentCancelled
+	return intent, nil
+}
+
+// TransactionsIngested matches the account's new debits to its pending
+// intents in the background
+func (i *Intents) TransactionsIngested(account *models.LinkedAccount, created []models.ProviderTransaction) {
+	var debits []models.ProviderTransaction
+	for _, txn := range created {
+		if txn.TransactionType == models.TransactionTypeDebit && !txn.IsManual() {
+			debits = append(debits, txn)
+		}
+	}
+	if len(debits) == 0 {
+		return
+	}
+	go i.match(account.ID, debits)
+}
+
+// match pairs each debit with the oldest pending intent for the same amount
+// and currency made shortly before it. A debit that names its recipient
+// must name the intent's; one that doesn't only matches when a single
+// intent could explain it.
+func (i *Intents) match(accountID uuid.UUID, debits []models.ProviderTransaction) {
+	var intents []models.PaymentIntent
+	if err := i.db.Where("linked_account_id = ? AND status = ? AND expires_at > ?",
+		accountID, models.PaymentIntentPending, time.Now()).
+		Order("created_at ASC").
+		Find(&intents).Error; err != nil {
+		log.Printf("[PAYMENT-INTENT] Failed to load intents for account %s: %v", accountID, err)
+		return
+	}
+	if len(intents) == 0 {
+		return
+	}
+
+	sort.Slice(debits, func(a, b int) bool { return debits[a].TransactionDate.Before(debits[b].TransactionDate) })
+	used := make(map[uuid.UUID]bool, len(intents))
+	for _, txn := range debits {
+		recipient := NormalizeNumber(txn.CounterpartyPhone)
+		var candidates []*models.PaymentIntent
+		for j := range intents {
+			intent := &intents[j]
+			if used[intent.ID] ||
+				math.Round(intent.Amount*100) != math.Round(txn.Amount*100) ||
+				!strings.EqualFold(intent.Currency, txn.Currency) ||
+				txn.TransactionDate.Before(intent.CreatedAt.Add(-clockSkew)) ||
+				txn.TransactionDate.After(intent.ExpiresAt) {
+				continue
+			}
+			if recipient != "" && recipient != intent.RecipientNumber {
+				continue
+			}
+			candidates = append(candidates, intent)
+		}
+		if len(candidates) == 0 || (recipient == "" && len(candidates) > 1) {
+			continue
+		}
+
+		intent := candidates[0]
+		now := time.Now()
+		result := i.db.Model(&models.PaymentIntent{}).
+			Where("id = ? AND status = ?", intent.ID, models.PaymentIntentPending).
+			Updates(map[string]interface{}{
+				"status":                  models.PaymentIntentCompleted,
+				"provider_transaction_id": txn.ID,
+				"completed_at":            now,
+			})
+		if result.Error != nil {
+			log.Printf("[PAYMENT-INTENT] Failed to complete intent %s with transaction %s: %v", intent.ID, txn.ID, result.Error)
+			continue
+		}
+		used[intent.ID] = true
+		if result.RowsAffected == 1 {
+			log.Printf("[PAYMENT-INTENT] Intent %s completed by transaction %s", intent.ID, txn.ID)
+		}
+	}
+}
+
+// Start expires intents nobody paid now and then every hour
+func (i *Intents) Start() {
+	go func() {
+		for {
+			result := i.db.Model(&models.PaymentIntent{}).
+				Where("status = ? AND expires_at <= ?", models.PaymentIntentPending, time.Now()).
+				Update("status", models.PaymentIntentExpired)
+			if result.Error != nil {
+				log.Printf("[PAYMENT-INTENT] Failed to expire intents: %v", result.Error)
+			} else if result.RowsAffected > 0 {
+				log.Printf("[PAYMENT-INTENT] Expired %d intents", result.RowsAffected)
+			}
+			time.Sleep(expireInterval)
+		}
+	}()
+}
+
+// decorate fills in the intent's dialler URI
+func decorate(intent *models.PaymentIntent) {
+	intent.TelURI = "tel:" + strings.ReplaceAll(intent.DialString, "#", "%23")
+}
@@ -0,0 +1,120 @@
+// Package ussd builds the USSD dial strings that start mobile-money payments
+// and matches the payments the user then makes to the transactions they
+// produce.
+package ussd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+)
+
+var (
+	ErrUnsupportedProvider = errors.New("USSD payments are not supported for this provider")
+	ErrInvalidNumber       = errors.New("recipient number is not valid for this provider")
+	ErrInvalidAmount       = errors.New("amount is not valid for this provider")
+)
+
+// Template is a provider's send-money USSD code. Pattern holds {number} and
+// {amount} placeholders.
+type Template struct {
+	Provider models.Provider
+	Pattern  string
+	// Number is the local subscriber number format the code accepts
+	Number *regexp.Regexp
+}
+
+// Somali mobile numbers are dialled as nine local digits
+var localNumber = regexp.MustCompile(`^[1-9]\d{8}$`)
+
+var templates = map[models.Provider]*Template{
+	models.ProviderEvcplus: {
+		Provider: models.ProviderEvcplus,
+		Pattern:  "*712*{number}*{amount}#",
+		Number:   localNumber,
+	},
+	models.ProviderZaad: {
+		Provider: models.ProviderZaad,
+		Pattern:  "*220*{number}*{amount}#",
+		Number:   localNumber,
+	},
+}
+
+// TemplateFor returns the provider's template, if it has one
+func TemplateFor(provider models.Provider) (*Template, bool) {
+	t, ok := templates[provider]
+	return t, ok
+}
+
+// Supports reports whether dial strings can be built for the provider
+func Supports(provider models.Provider) bool {
+	_, ok := templates[provider]
+	return ok
+}
+
+// Dial is a ready-to-dial payment
+type Dial struct {
+	// String is what the user dials, e.g. "*712*615123456*10#"
+	String string `json:"dialString"`
+	// URI opens the phone's dialler with the string filled in
+	URI string `json:"telUri"`
+	// Number is the recipient as dialled
+	Number string `json:"recipientNumber"`
+}
+
+// Build returns the dial string paying amount in currency to number with the
+// template. Shilling amounts must be whole; dollars may have cents.
+func (t *Template) Build(number string, amount float64, currency string) (*Dial, error) {
+	local := NormalizeNumber(number)
+	if !t.Number.MatchString(local) {
+		return nil, ErrInvalidNumber
+	}
+
+	decimals := 2
+	if strings.EqualFold(currency, "SLS") || strings.EqualFold(currency, "SOS") {
+		decimals = 0
+	}
+	scale := math.Pow10(decimals)
+	if amount <= 0 || math.Abs(amount*scale-math.Round(amount*scale)) > 1e-6 {
+		return nil, ErrInvalidAmount
+	}
+	formatted := strconv.FormatFloat(math.Round(amount*scale)/scale, 'f', -1, 64)
+
+	dial := strings.NewReplacer("{number}", local, "{amount}", formatted).Replace(t.Pattern)
+	return &Dial{
+		String: dial,
+		URI:    "tel:" + strings.ReplaceAll(dial, "#", "%23"),
+		Number: local,
+	}, nil
+}
+
+// NormalizeNumber reduces a phone number to its local digits, dropping
+// punctuation, the 252 country code and a trunk 0
+func NormalizeNumber(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if len(digits) > 9 {
+		digits = strings.TrimPrefix(digits, "252")
+	}
+	return strings.TrimPrefix(digits, "0")
+}
+
+// Build returns the dial string for paying amount in currency to number from
+// an account with the provider
+func Build(provider models.Provider, number string, amount float64, currency string) (*Dial, error) {
+	t, ok := TemplateFor(provider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, provider)
+	}
+	return t.Build(number, amount, currency)
+}
@@ -0,0 +1,60 @@
+package wallets
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/moha/kaafipay-backend/internal/models"
+	"github.com/moha/kaafipay-backend/internal/repository"
+)
+
+const reconcileInterval = time.Hour
+
+// Reconciler checks that every wallet's stored balance still equals the sum
+// of its ledger lines. Postings keep the two in step, so a mismatch means
+// the balance was changed outside the ledger and needs investigating.
+type Reconciler struct {
+	db     *gorm.DB
+	ledger repository.LedgerRepository
+}
+
+func NewReconciler(db *gorm.DB, ledger repository.LedgerRepository) *Reconciler {
+	return &Reconciler{db: db, ledger: ledger}
+}
+
+// Start runs the reconciler now and then every hour
+func (r *Reconciler) Start() {
+	go func() {
+		for {
+			if _, err := r.ReconcileAll(); err != nil {
+				log.Printf("[LEDGER-RECONCILE] %v", err)
+			}
+			time.Sleep(reconcileInterval)
+		}
+	}()
+}
+
+// ReconcileAll checks every wallet and returns those whose balance does not
+// match their ledger
+func (r *Reconciler) ReconcileAll() ([]repository.Reconciliation, error) {
+	var mismatched []repository.Reconciliation
+	var wallets []models.Wallet
+	err := r.db.Select("id").Order("id").FindInBatches(&wallets, 100, func(tx *gorm.DB, batch int) error {
+		for _, wallet := range wallets {
+			result, err := r.ledger.Reconcile(wallet.ID)
+			if err != nil {
+				log.Printf("[LEDGER-RECONCILE] Wallet %s: %v", wallet.ID, err)
+				continue
+			}
+			if !result.Matches() {
+				log.Printf("[LEDGER-RECONCILE] Wallet %s balance %.2f does not match ledger %.2f",
+					wallet.ID, result.Balance, result.LedgerBalance)
+				mismatched = append(mismatched, *result)
+			}
+		}
+		return nil
+	}).Error
+	return mismatched, err
+}
@@ -179,20 +179,27 @@ func (w *WhatsAppProvider) GenerateCode(phone string) (string, error) {
 }
 
 func (w *WhatsAppProvider) SendCode(code, phone string) error {
+	return w.SendMessage(phone, fmt.Sprintf("Your KaafiPay verification code is: %s", code))
+}
+
+// SendMessage sends a text message to a local phone number
+func (w *WhatsAppProvider) SendMessage(phone, text string) error {
 	jid := fmt.Sprintf("252%s@s.whatsapp.net", phone)
-	message := fmt.Sprintf("Your KaafiPay verification code is: %s", code)
 
 	body := map[string]interface{}{
 		"jid": jid,
 		"message": map[string]string{
-			"text": message,
+			"text": text,
 		},
 	}
 
-	_, _, err := w.makeRequest("/"+w.sessionID+"/messages/send", http.MethodPost, body)
+	_, status, err := w.makeRequest("/"+w.sessionID+"/messages/send", http.MethodPost, body)
 	if err != nil {
 		return fmt.Errorf("failed to send WhatsApp message: %v", err)
 	}
+	if status >= http.StatusBadRequest {
+		return fmt.Errorf("failed to send WhatsApp message: status %d", status)
+	}
 
 	return nil
 }
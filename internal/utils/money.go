@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// LocalZone is East Africa Time, the calendar used for days, months and
+// reset times shown to users
+var LocalZone = time.FixedZone("EAT", 3*60*60)
+
+// RoundMoney rounds an amount to whole cents
+func RoundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GenerateOTP returns a random 6-digit one-time code
+func GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HashOTP returns the hash a one-time code is stored under
+func HashOTP(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckOTP compares a code against its stored hash in constant time
+func CheckOTP(code, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashOTP(code)), []byte(hash)) == 1
+}
+
+// ClaimOTPAttempt uses up one of the attempts at the code of a row in table
+// that is still in status, before the code is checked, so parallel guesses
+// cannot get more than maxAttempts tries between them. It returns how many
+// attempts the row has had, and false if it is no longer in status or has
+// none left.
+func ClaimOTPAttempt(db *gorm.DB, table string, id uuid.UUID, status string, maxAttempts int) (int, bool, error) {
+	var rows []struct {
+		OTPAttempts int `gorm:"column:otp_attempts"`
+	}
+	err := db.Raw(`UPDATE `+table+` SET otp_attempts = otp_attempts + 1
+		WHERE id = ? AND status = ? AND otp_attempts < ?
+		RETURNING otp_attempts`, id, status, maxAttempts).
+		Scan(&rows).Error
+	if err != nil {
+		return 0, false, err
+	}
+	if len(rows) == 0 {
+		return 0, false, nil
+	}
+	return rows[0].OTPAttempts, true, nil
+}